@@ -9,9 +9,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/admin"
+	"github.com/Rorical/IPFSniffer/internal/codec"
 	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/health"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
 	"github.com/Rorical/IPFSniffer/internal/logging"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
 	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+	"github.com/Rorical/IPFSniffer/internal/redis"
 	"github.com/Rorical/IPFSniffer/internal/search"
 	"github.com/Rorical/IPFSniffer/internal/server"
 )
@@ -26,6 +34,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// "config print" shows the effective configuration and exits.
+	if len(os.Args) == 3 && os.Args[1] == "config" && os.Args[2] == "print" {
+		if err := cfg.Print(os.Stdout); err != nil {
+			slog.Error("print config", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+	codec.SetCompressThreshold(cfg.Codec.CompressThreshold)
+
 	logger := logging.New(logging.Config{Level: slog.LevelInfo})
 	slog.SetDefault(logger)
 	ctx = logging.WithLogger(ctx, logger)
@@ -37,18 +55,56 @@ func main() {
 	}
 	defer func() { _ = shutdownOTel(context.Background()) }()
 
-	osc, err := opensearch.New(opensearch.Config{URL: cfg.OpenSearch.URL, Insecure: true})
+	osc, err := opensearch.New(cfg.OpenSearch.Config)
 	if err != nil {
 		slog.Error("opensearch client", "err", err)
 		os.Exit(1)
 	}
 
-	searchClient := &search.Client{OS: osc, Index: "ipfsniffer-docs"}
+	alias := cfg.OpenSearch.Alias
+	searchClient := &search.Client{OS: osc, Index: alias}
+
+	ready := &health.Checker{Timeout: cfg.Health.CheckTimeout}
+	ready.Add(health.OpenSearch(osc), health.OpenSearchAlias(osc, alias))
+
+	api := &server.API{Search: searchClient, Ready: ready}
+	if cfg.Peers.Enabled {
+		api.Peers = &peers.Store{OS: osc, Index: cfg.Peers.Index, CIDsIndex: cfg.Peers.CIDsIndex}
+	}
+	if cfg.IPNS.Enabled {
+		rdb, err := redis.Connect(ctx, cfg.Redis)
+		if err != nil {
+			slog.Error("redis connect", "err", err)
+			os.Exit(1)
+		}
+		defer rdb.Close()
+
+		ready.Add(health.Redis(rdb))
+		api.Names = &ipnsreg.Registry{Redis: rdb, Config: cfg.IPNS}
+	}
+
+	if cfg.Admin.Token != "" {
+		nc, js, err := internalnats.Connect(ctx, cfg.NATS)
+		if err != nil {
+			slog.Error("nats connect", "err", err)
+			os.Exit(1)
+		}
+		defer nc.Close()
+
+		ready.Add(health.NATSStream(js, internalnats.StreamName))
+		kv, err := policy.Ensure(js, cfg.Policy)
+		if err != nil {
+			slog.Error("ensure policy bucket", "err", err)
+			os.Exit(1)
+		}
+		api.Admin = &admin.Service{NATS: js, OS: osc, Index: alias, Policy: kv}
+		api.AdminToken = cfg.Admin.Token
+		slog.Info("admin api enabled")
+	}
 
-	api := &server.API{Search: searchClient}
 	mux := api.Handler()
 
-	addr := getenv("IPFSNIFFER_HTTP_ADDR", "127.0.0.1:8080")
+	addr := cfg.HTTP.Addr
 	srv := &http.Server{
 		Addr:              addr,
 		Handler:           mux,
@@ -70,14 +126,3 @@ func main() {
 	_ = srv.Shutdown(shutdownCtx)
 	slog.Info("server shutdown")
 }
-
-func getenv(key, def string) string {
-	v, ok := os.LookupEnv(key)
-	if !ok {
-		return def
-	}
-	if v == "" {
-		return def
-	}
-	return v
-}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/health"
+	"github.com/Rorical/IPFSniffer/internal/redis"
+)
+
+// pebbleSweepInterval is how often expired keys are dropped from the Pebble
+// dedupe store.
+const pebbleSweepInterval = time.Hour
+
+// openDedupers connects the backends cfg.Dedupe selects and returns the
+// registry every role in the process shares. release closes them.
+func openDedupers(ctx context.Context, cfg config.Config, ready *health.Checker) (reg *dedupe.Registry, release func(), err error) {
+	reg = &dedupe.Registry{Config: cfg.Dedupe}
+	var closers []func()
+	release = func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	if cfg.Dedupe.Uses(dedupe.BackendRedis) {
+		reg.Redis, err = redis.Connect(ctx, cfg.Redis)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redis connect: %w", err)
+		}
+		closers = append(closers, func() { _ = reg.Redis.Close() })
+		ready.Add(health.Redis(reg.Redis))
+	}
+	if cfg.Dedupe.Uses(dedupe.BackendPebble) {
+		reg.Pebble, err = dedupe.OpenPebble(cfg.Dedupe.Path)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		closers = append(closers, func() { _ = reg.Pebble.Close() })
+		go reg.Pebble.Sweep(ctx, pebbleSweepInterval)
+	}
+	go reg.LogStats(ctx, cfg.Dedupe.StatsInterval)
+	return reg, release, nil
+}
@@ -5,28 +5,64 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/codec"
 	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/decode"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
 	"github.com/Rorical/IPFSniffer/internal/discovery"
 	"github.com/Rorical/IPFSniffer/internal/discoverydht"
 	"github.com/Rorical/IPFSniffer/internal/discoveryipnsdht"
 	"github.com/Rorical/IPFSniffer/internal/discoveryipnspubsub"
+	"github.com/Rorical/IPFSniffer/internal/dlq"
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
 	"github.com/Rorical/IPFSniffer/internal/enqueue"
 	"github.com/Rorical/IPFSniffer/internal/extractor"
 	"github.com/Rorical/IPFSniffer/internal/fetcher"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
+	"github.com/Rorical/IPFSniffer/internal/health"
 	"github.com/Rorical/IPFSniffer/internal/indexer"
 	"github.com/Rorical/IPFSniffer/internal/indexprep"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
 	"github.com/Rorical/IPFSniffer/internal/kubo"
 	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
 	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	"github.com/Rorical/IPFSniffer/internal/redis"
 	"github.com/Rorical/IPFSniffer/internal/resolver"
 	"github.com/Rorical/IPFSniffer/internal/tika"
+
+	nats "github.com/nats-io/nats.go"
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+	goredis "github.com/redis/go-redis/v9"
 )
 
+// shared holds the connections and the Kubo node every role in the process
+// uses. Fields a plan does not need stay nil.
+type shared struct {
+	cfg      config.Config
+	nc       *nats.Conn
+	js       nats.JetStreamContext
+	claims   *internalnats.ClaimStore
+	policy   nats.KeyValue
+	ipfs     *kubo.Node
+	dedupers *dedupe.Registry
+	// popularity is nil when popularity tracking is disabled.
+	popularity *popularity.Tracker
+	// geoip is nil when no GeoIP database is configured.
+	geoip *geoip.DB
+	redis *goredis.Client
+	osc   *osclient.Client
+	tika  *tika.Client
+}
+
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
@@ -37,10 +73,26 @@ func main() {
 		os.Exit(1)
 	}
 
+	// "config print" shows the effective configuration and exits.
+	if len(os.Args) == 3 && os.Args[1] == "config" && os.Args[2] == "print" {
+		if err := cfg.Print(os.Stdout); err != nil {
+			slog.Error("print config", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+	codec.SetCompressThreshold(cfg.Codec.CompressThreshold)
+
 	logger := logging.New(logging.Config{Level: slog.LevelInfo})
 	slog.SetDefault(logger)
 	ctx = logging.WithLogger(ctx, logger)
 
+	plan, err := planRoles(cfg.Worker.Roles)
+	if err != nil {
+		slog.Error("worker roles", "roles", cfg.Worker.Roles, "err", err)
+		os.Exit(2)
+	}
+
 	shutdownOTel, err := logging.InitOTel(ctx, logging.OTelConfig{Insecure: true, ServiceName: "ipfsniffer-worker"})
 	if err != nil {
 		slog.Error("otel init", "err", err)
@@ -50,251 +102,422 @@ func main() {
 		_ = shutdownOTel(context.Background())
 	}()
 
-	nc, js, err := internalnats.Connect(ctx, cfg.NATS)
+	// Readiness: checks are added for each shared resource the roles use.
+	ready := &health.Checker{Timeout: cfg.Health.CheckTimeout}
+	// Not ready until every shared resource's check has been added.
+	started := ready.Starting()
+	if cfg.Health.Addr != "" {
+		go func() {
+			slog.Info("health listening", "addr", cfg.Health.Addr)
+			if err := health.Serve(ctx, cfg.Health.Addr, ready); err != nil {
+				slog.Error("health listen", "err", err)
+			}
+		}()
+	}
+
+	if plan.roles[0] == "standalone" {
+		// The whole pipeline in this process over an in-memory bus; no NATS.
+		slog.Info("worker started", "env", cfg.Service.Env, "roles", plan.roles)
+		if err := runStandalone(ctx, cfg, ready, started); err != nil && ctx.Err() == nil {
+			slog.Error("standalone run", "err", err)
+			os.Exit(1)
+		}
+		slog.Info("worker shutting down")
+		return
+	}
+
+	sh := &shared{cfg: cfg}
+
+	sh.nc, sh.js, err = internalnats.Connect(ctx, cfg.NATS)
 	if err != nil {
 		slog.Error("nats connect", "err", err)
 		os.Exit(1)
 	}
-	defer nc.Drain()
+	defer sh.nc.Drain()
 
-	if err := internalnats.EnsureStream(ctx, js); err != nil {
+	if err := internalnats.EnsureStream(ctx, sh.js, cfg.Streams); err != nil {
 		slog.Error("ensure stream", "err", err)
 		os.Exit(1)
 	}
-
-	role := os.Getenv("IPFSNIFFER_WORKER_ROLE")
-	if role == "" {
-		role = "discovery-pubsub"
+	sh.claims, err = internalnats.EnsureClaimStore(ctx, sh.js, cfg.Claims)
+	if err != nil {
+		slog.Error("ensure claim store", "err", err)
+		os.Exit(1)
 	}
+	sh.policy, err = policy.Ensure(sh.js, cfg.Policy)
+	if err != nil {
+		slog.Error("ensure policy bucket", "err", err)
+		os.Exit(1)
+	}
+	// Every NATS-backed role depends on the streams.
+	ready.Add(health.NATSStream(sh.js, internalnats.StreamName), health.NATSStream(sh.js, internalnats.ChunkStreamName))
 
-	slog.Info("worker started", "env", cfg.Service.Env, "role", role)
-
-	switch role {
-	case "discovery-dht":
-		// DHT provider-record capture (server mode).
-		// Note: this can increase resource usage and may see limited traffic when not publicly reachable.
-		rdb, err := redis.Connect(ctx, redis.Config{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+	if opts := plan.needs.kubo; opts != nil {
+		// Only discovery-pubsub enables plain pubsub.
+		opts.TrackPubSubTopics = opts.EnablePubSub && cfg.Discovery.PubSubDiscover
+		sh.ipfs, err = kubo.OpenOrInitWithOptions(ctx, cfg.Kubo.RepoPath, *opts)
 		if err != nil {
-			slog.Error("redis connect", "err", err)
+			slog.Error("kubo open", "err", err)
 			os.Exit(1)
 		}
-		defer rdb.Close()
-
-		w := &discoverydht.Worker{
-			RepoPath: cfg.Kubo.RepoPath,
-			NATS:     js,
-			Redis:    rdb,
-			Dedupe:   redis.Dedupe{Prefix: "ipfsniffer:seen:cid", TTL: cfg.Discovery.DedupeTTL},
-		}
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("discovery-dht run", "err", err)
+		defer sh.ipfs.Close()
+		ready.Add(health.MinPeers("kubo_peers", sh.ipfs.PeerCount, cfg.Health.MinPeers))
+		if opts.EnableIPNSPubSub && (sh.ipfs.Raw == nil || sh.ipfs.Raw.PSRouter == nil) {
+			slog.Error("ipns pubsub disabled in node")
 			os.Exit(1)
 		}
-	case "discovery-pubsub":
-		ipfsNode, err := kubo.OpenOrInitPubSub(ctx, cfg.Kubo.RepoPath)
+	}
+	if plan.needs.dedupe {
+		var release func()
+		sh.dedupers, release, err = openDedupers(ctx, cfg, ready)
 		if err != nil {
-			slog.Error("kubo open", "err", err)
+			slog.Error("dedupe", "err", err)
 			os.Exit(1)
 		}
-		defer ipfsNode.Close()
-
-		rdb, err := redis.Connect(ctx, redis.Config{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+		defer release()
+	}
+	if plan.needs.redis {
+		if sh.dedupers != nil {
+			sh.redis = sh.dedupers.Redis
+		}
+		if sh.redis == nil {
+			sh.redis, err = redis.Connect(ctx, cfg.Redis)
+			if err != nil {
+				slog.Error("redis connect", "err", err)
+				os.Exit(1)
+			}
+			defer sh.redis.Close()
+			ready.Add(health.Redis(sh.redis))
+		}
+	}
+	if slices.Contains(plan.roles, "popularity-index") && !cfg.Popularity.Enabled {
+		slog.Error("popularity-index requires popularity.enabled")
+		os.Exit(2)
+	}
+	if plan.needs.popularity && cfg.Popularity.Enabled {
+		var rdb *goredis.Client
+		if sh.dedupers != nil {
+			rdb = sh.dedupers.Redis
+		}
+		var release func()
+		sh.popularity, release, err = openPopularity(ctx, cfg, rdb, ready)
 		if err != nil {
-			slog.Error("redis connect", "err", err)
+			slog.Error("popularity", "err", err)
 			os.Exit(1)
 		}
-		defer rdb.Close()
-
-		w := &discovery.PubSubWorker{
-			IPFS:   ipfsNode,
-			NATS:   js,
-			Redis:  rdb,
-			Topics: cfg.Discovery.PubSubTopics,
-			Dedupe: redis.Dedupe{Prefix: "ipfsniffer:seen:cid", TTL: cfg.Discovery.DedupeTTL},
-		}
-
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("worker run", "err", err)
+		// Deferred after the dedupe release, so it runs first and flushes
+		// while a shared Redis client is still open.
+		defer release()
+	}
+	if plan.needs.geoip && cfg.GeoIP.Enabled() {
+		sh.geoip, err = geoip.Open(cfg.GeoIP)
+		if err != nil {
+			slog.Error("geoip", "err", err)
 			os.Exit(1)
 		}
-	case "resolver-ipns":
-		ipfsNode, err := kubo.OpenOrInit(ctx, cfg.Kubo.RepoPath)
+		defer sh.geoip.Close()
+	}
+	if plan.needs.opensearch {
+		sh.osc, err = opensearch.New(cfg.OpenSearch.Config)
 		if err != nil {
-			slog.Error("kubo open", "err", err)
+			slog.Error("opensearch client", "err", err)
 			os.Exit(1)
 		}
-		defer ipfsNode.Close()
+		_ = indexer.EnsureDefaultIndex(ctx, sh.osc, cfg.OpenSearch.Index, cfg.OpenSearch.Alias)
+		ready.Add(health.OpenSearch(sh.osc), health.OpenSearchAlias(sh.osc, cfg.OpenSearch.Alias))
+	}
+	if plan.needs.tika {
+		sh.tika = &tika.Client{BaseURL: cfg.Tika.URL}
+		ready.Add(health.Tika(sh.tika))
+	}
 
-		w := &resolver.IPNSResolverWorker{
-			IPFS:       ipfsNode,
-			NATS:       js,
-			Durable:    "resolver-ipns",
-			MaxDeliver: internalnats.DefaultMaxDeliver,
-		}
+	started()
+	slog.Info("worker started", "env", cfg.Service.Env, "roles", plan.roles)
 
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("resolver run", "err", err)
-			os.Exit(1)
+	var wg sync.WaitGroup
+	for _, role := range plan.roles {
+		s := &supervisor{
+			Role: role,
+			Run:  sh.runner(role),
+			Base: cfg.Worker.RestartBase,
+			Max:  cfg.Worker.RestartMax,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.supervise(ctx)
+		}()
+	}
+
+	<-ctx.Done()
+	slog.Info("worker shutting down")
+
+	// Shared connections close only after every role has stopped.
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(cfg.Worker.ShutdownTimeout):
+		slog.Error("roles did not stop in time", "timeout", cfg.Worker.ShutdownTimeout)
+	}
+}
+
+// runner returns the run function for role, building a fresh worker on each
+// call so a restart starts from clean state.
+func (sh *shared) runner(role string) func(context.Context) error {
+	cfg := sh.cfg
+	switch role {
+	case "discovery-dht":
+		// DHT provider-record capture (server mode).
+		// Note: this can increase resource usage and may see limited traffic when not publicly reachable.
+		return func(ctx context.Context) error {
+			w := &discoverydht.Worker{
+				RepoPath:   cfg.Kubo.RepoPath,
+				NATS:       sh.js,
+				Dedupers:   sh.dedupers,
+				Dedupe:     redis.Dedupe{Prefix: "ipfsniffer:seen:cid", TTL: cfg.Discovery.DedupeTTL},
+				Popularity: sh.popularity,
+				PeerDedupe: peerDedupe(cfg),
+				GeoIP:      sh.geoip,
+			}
+			return w.Run(ctx)
 		}
-	case "discovery-ipns-dht":
-		// DHT validator wrapper to sniff IPNS records.
-		rdb, err := redis.Connect(ctx, redis.Config{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
-		if err != nil {
-			slog.Error("redis connect", "err", err)
-			os.Exit(1)
+	case "discovery-pubsub":
+		return func(ctx context.Context) error {
+			decoders, err := decode.ParseRules(cfg.Discovery.PubSubDecoders)
+			if err != nil {
+				return err
+			}
+			w := &discovery.PubSubWorker{
+				IPFS:       sh.ipfs,
+				NATS:       sh.js,
+				Dedupers:   sh.dedupers,
+				Topics:     cfg.Discovery.PubSubTopics,
+				Dedupe:     redis.Dedupe{Prefix: "ipfsniffer:seen:cid", TTL: cfg.Discovery.DedupeTTL},
+				Policies:   sh.policy,
+				Popularity: sh.popularity,
+				PeerDedupe: peerDedupe(cfg),
+				GeoIP:      sh.geoip,
+				Discover:   topicDiscovery(cfg),
+				Decoders:   decoders,
+			}
+			return w.Run(ctx)
 		}
-		defer rdb.Close()
-
-		w := &discoveryipnsdht.Worker{
-			RepoPath: cfg.Kubo.RepoPath,
-			NATS:     js,
-			Redis:    rdb,
-			Dedupe:   redis.Dedupe{Prefix: "ipfsniffer:seen:ipns:dht", TTL: cfg.Discovery.DedupeTTL},
+	case "resolver-ipns":
+		return func(ctx context.Context) error {
+			w := &resolver.IPNSResolverWorker{
+				IPFS:        sh.ipfs,
+				NATS:        sh.js,
+				Conn:        sh.nc,
+				Durable:     "resolver-ipns",
+				MaxDeliver:  cfg.Consumer.MaxDeliverFor(role),
+				AckWait:     cfg.Consumer.AckWaitFor(role),
+				Concurrency: cfg.Consumer.ConcurrencyFor(role),
+				Batch:       cfg.Consumer.BatchFor(role),
+			}
+			if cfg.DNSLink.Enabled {
+				w.DNSLink = dnslink.NewResolver(cfg.DNSLink.Server)
+				w.Watchlist = &dnslink.Watchlist{Redis: sh.redis, Config: cfg.DNSLink}
+				w.HostDedupe = redis.Dedupe{Prefix: "ipfsniffer:seen:dnslink", TTL: cfg.DNSLink.HostDedupeTTL}
+				w.Redis = sh.redis
+				w.Dedupers = sh.dedupers
+			}
+			w.Names = ipnsNames(cfg, sh.redis)
+			return w.Run(ctx)
 		}
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("discovery-ipns-dht run", "err", err)
-			os.Exit(1)
+	case "discovery-ipns-dht":
+		// DHT validator wrapper to sniff IPNS records.
+		return func(ctx context.Context) error {
+			w := &discoveryipnsdht.Worker{
+				RepoPath:   cfg.Kubo.RepoPath,
+				NATS:       sh.js,
+				Dedupers:   sh.dedupers,
+				Dedupe:     redis.Dedupe{Prefix: "ipfsniffer:seen:ipns:dht", TTL: cfg.Discovery.DedupeTTL},
+				Popularity: sh.popularity,
+				Names:      ipnsNames(cfg, sh.redis),
+			}
+			return w.Run(ctx)
 		}
 	case "discovery-ipns-pubsub":
 		// Seed per-name IPNS pubsub subscriptions and harvest updates.
-		ipfsNode, err := kubo.OpenOrInitIPNSPubSub(ctx, cfg.Kubo.RepoPath)
-		if err != nil {
-			slog.Error("kubo open", "err", err)
-			os.Exit(1)
-		}
-		defer ipfsNode.Close()
-		if ipfsNode.Raw == nil || ipfsNode.Raw.PSRouter == nil {
-			slog.Error("ipns pubsub disabled in node")
-			os.Exit(1)
-		}
-
-		rdb, err := redis.Connect(ctx, redis.Config{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
-		if err != nil {
-			slog.Error("redis connect", "err", err)
-			os.Exit(1)
-		}
-		defer rdb.Close()
+		return func(ctx context.Context) error {
+			w := &discoveryipnspubsub.Worker{
+				PSRouter:   sh.ipfs.Raw.PSRouter,
+				NATS:       sh.js,
+				Dedupers:   sh.dedupers,
+				Dedupe:     redis.Dedupe{Prefix: "ipfsniffer:seen:ipns:pubsub", TTL: cfg.Discovery.DedupeTTL},
+				Names:      cfg.Discovery.IPNSPubSubNames,
+				Poll:       cfg.Discovery.IPNSPubSubPoll,
+				Policies:   sh.policy,
+				Popularity: sh.popularity,
 
-		w := &discoveryipnspubsub.Worker{
-			PSRouter: ipfsNode.Raw.PSRouter,
-			NATS:     js,
-			Redis:    rdb,
-			Dedupe:   redis.Dedupe{Prefix: "ipfsniffer:seen:ipns:pubsub", TTL: cfg.Discovery.DedupeTTL},
-			Names:    cfg.Discovery.IPNSPubSubNames,
-			Poll:     cfg.Discovery.IPNSPubSubPoll,
-		}
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("discovery-ipns-pubsub run", "err", err)
-			os.Exit(1)
+				Registry:         ipnsNames(cfg, sh.redis),
+				MaxSubscriptions: cfg.Discovery.IPNSPubSubMaxSubscriptions,
+				StaleAfter:       cfg.Discovery.IPNSPubSubStaleAfter,
+			}
+			return w.Run(ctx)
 		}
 	case "enqueue-fetch":
-		rdb, err := redis.Connect(ctx, redis.Config{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
-		if err != nil {
-			slog.Error("redis connect", "err", err)
-			os.Exit(1)
-		}
-		defer rdb.Close()
-
-		w := &enqueue.FetchEnqueuer{
-			NATS:       js,
-			Redis:      rdb,
-			Dedupe:     redis.Dedupe{Prefix: "ipfsniffer:seen:fetch", TTL: 24 * time.Hour},
-			MaxDeliver: internalnats.DefaultMaxDeliver,
-			Limits: enqueue.FetchDefaults{
-				MaxTotalBytes: cfg.Fetch.MaxTotalBytes,
-				MaxFileBytes:  cfg.Fetch.MaxFileBytes,
-				MaxDAGNodes:   cfg.Fetch.MaxDAGNodes,
-				MaxDepth:      cfg.Fetch.MaxDepth,
-				Timeout:       cfg.Fetch.Timeout,
-			},
-			Inline: enqueue.InlineDefaults{InlineMaxBytes: cfg.Fetch.InlineMaxBytes},
-			Policy: enqueue.FetchPolicyDefaults{SkipExt: cfg.Fetch.SkipExt, SkipMimePrefix: cfg.Fetch.SkipMimePrefix},
-		}
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("enqueue-fetch run", "err", err)
-			os.Exit(1)
+		return func(ctx context.Context) error {
+			w := &enqueue.FetchEnqueuer{
+				NATS:        sh.js,
+				Conn:        sh.nc,
+				Dedupers:    sh.dedupers,
+				Dedupe:      redis.Dedupe{Prefix: "ipfsniffer:seen:fetch", TTL: cfg.Fetch.DedupeTTL},
+				MaxDeliver:  cfg.Consumer.MaxDeliverFor(role),
+				AckWait:     cfg.Consumer.AckWaitFor(role),
+				Concurrency: cfg.Consumer.ConcurrencyFor(role),
+				Batch:       cfg.Consumer.BatchFor(role),
+				Limits: enqueue.FetchDefaults{
+					MaxTotalBytes: cfg.Fetch.MaxTotalBytes,
+					MaxFileBytes:  cfg.Fetch.MaxFileBytes,
+					MaxDAGNodes:   cfg.Fetch.MaxDAGNodes,
+					MaxDepth:      cfg.Fetch.MaxDepth,
+					Timeout:       cfg.Fetch.Timeout,
+				},
+				Inline:   enqueue.InlineDefaults{InlineMaxBytes: cfg.Fetch.InlineMaxBytes},
+				Policy:   enqueue.FetchPolicyDefaults{SkipExt: cfg.Fetch.SkipExt, SkipMimePrefix: cfg.Fetch.SkipMimePrefix},
+				Policies: sh.policy,
+			}
+			return w.Run(ctx)
 		}
 	case "fetcher":
-		ipfsNode, err := kubo.OpenOrInit(ctx, cfg.Kubo.RepoPath)
-		if err != nil {
-			slog.Error("kubo open", "err", err)
-			os.Exit(1)
-		}
-		defer ipfsNode.Close()
-
-		w := &fetcher.Worker{
-			IPFS:       ipfsNode,
-			NATS:       js,
-			Durable:    "fetcher",
-			MaxDeliver: internalnats.DefaultMaxDeliver,
-		}
-
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("fetcher run", "err", err)
-			os.Exit(1)
+		return func(ctx context.Context) error {
+			w := &fetcher.Worker{
+				IPFS:        sh.ipfs,
+				NATS:        sh.js,
+				Conn:        sh.nc,
+				Durable:     "fetcher",
+				MaxDeliver:  cfg.Consumer.MaxDeliverFor(role),
+				AckWait:     cfg.Consumer.AckWaitFor(role),
+				Concurrency: cfg.Consumer.ConcurrencyFor(role),
+				Batch:       cfg.Consumer.BatchFor(role),
+				Claims:      sh.claims,
+			}
+			return w.Run(ctx)
 		}
 	case "stream-server":
-		ipfsNode, err := kubo.OpenOrInit(ctx, cfg.Kubo.RepoPath)
-		if err != nil {
-			slog.Error("kubo open", "err", err)
-			os.Exit(1)
-		}
-		defer ipfsNode.Close()
-
-		srv := &fetcher.StreamServer{IPFS: ipfsNode, NATS: js}
-		if err := srv.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("stream server run", "err", err)
-			os.Exit(1)
+		return func(ctx context.Context) error {
+			srv := &fetcher.StreamServer{IPFS: sh.ipfs, NATS: sh.js}
+			return srv.Run(ctx)
 		}
 	case "extractor":
-		tc := &tika.Client{BaseURL: cfg.Tika.URL}
-		w := &extractor.Worker{
-			NATS:         js,
-			Tika:         tc,
-			Durable:      "extractor",
-			MaxDeliver:   internalnats.DefaultMaxDeliver,
-			TikaTimeout:  cfg.Tika.Timeout,
-			MaxTextBytes: cfg.Tika.MaxTextBytes,
-		}
-
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("extractor run", "err", err)
-			os.Exit(1)
+		return func(ctx context.Context) error {
+			w := &extractor.Worker{
+				NATS:         sh.js,
+				Conn:         sh.nc,
+				Tika:         sh.tika,
+				Durable:      "extractor",
+				MaxDeliver:   cfg.Consumer.MaxDeliverFor(role),
+				AckWait:      cfg.Consumer.AckWaitFor(role),
+				Concurrency:  cfg.Consumer.ConcurrencyFor(role),
+				Batch:        cfg.Consumer.BatchFor(role),
+				TikaTimeout:  cfg.Tika.Timeout,
+				MaxTextBytes: cfg.Tika.MaxTextBytes,
+				Claims:       sh.claims,
+				Hostnames:    cfg.DNSLink.Enabled && cfg.DNSLink.DiscoverHosts,
+			}
+			return w.Run(ctx)
 		}
 	case "index-prep":
-		w := &indexprep.Worker{
-			NATS:       js,
-			Durable:    "index-prep",
-			MaxDeliver: internalnats.DefaultMaxDeliver,
-			IndexName:  cfg.OpenSearch.Index,
-		}
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("index-prep run", "err", err)
-			os.Exit(1)
+		return func(ctx context.Context) error {
+			w := &indexprep.Worker{
+				NATS:        sh.js,
+				Conn:        sh.nc,
+				Durable:     "index-prep",
+				MaxDeliver:  cfg.Consumer.MaxDeliverFor(role),
+				AckWait:     cfg.Consumer.AckWaitFor(role),
+				Concurrency: cfg.Consumer.ConcurrencyFor(role),
+				Batch:       cfg.Consumer.BatchFor(role),
+				IndexName:   cfg.OpenSearch.Index,
+				Claims:      sh.claims,
+			}
+			return w.Run(ctx)
 		}
 	case "indexer":
-		osc, err := opensearch.New(opensearch.Config{URL: cfg.OpenSearch.URL, Insecure: true})
-		if err != nil {
-			slog.Error("opensearch client", "err", err)
-			os.Exit(1)
+		return func(ctx context.Context) error {
+			w := &indexer.Worker{
+				NATS:       sh.js,
+				OS:         sh.osc,
+				Durable:    "indexer",
+				MaxDeliver: cfg.Consumer.MaxDeliverFor(role),
+				BulkMax:    cfg.OpenSearch.BulkMax,
+				Claims:     sh.claims,
+			}
+			return w.Run(ctx)
+		}
+	case "popularity-index":
+		return func(ctx context.Context) error {
+			x := &popularity.Indexer{
+				Redis:     sh.popularity.Redis,
+				OS:        sh.osc,
+				IndexName: cfg.OpenSearch.Index,
+				Config:    cfg.Popularity,
+			}
+			return x.Run(ctx)
+		}
+	case "peer-indexer":
+		return func(ctx context.Context) error {
+			w := &peers.Worker{
+				NATS:        sh.js,
+				Conn:        sh.nc,
+				OS:          sh.osc,
+				Index:       cfg.Peers.Index,
+				CIDsIndex:   cfg.Peers.CIDsIndex,
+				Durable:     "peer-indexer",
+				MaxDeliver:  cfg.Consumer.MaxDeliverFor(role),
+				AckWait:     cfg.Consumer.AckWaitFor(role),
+				Concurrency: cfg.Consumer.ConcurrencyFor(role),
+				Batch:       cfg.Consumer.BatchFor(role),
+			}
+			return w.Run(ctx)
+		}
+	case "dlq-replayer":
+		return func(ctx context.Context) error {
+			w := &dlq.Replayer{
+				NATS:          sh.js,
+				Interval:      cfg.DLQ.ReplayInterval,
+				MinAge:        cfg.DLQ.ReplayMinAge,
+				MaxReplays:    cfg.DLQ.MaxReplays,
+				MaxPerSubject: cfg.DLQ.ReplayMaxPerSubject,
+				Caps:          cfg.DLQ.ReplayCaps,
+			}
+			return w.Run(ctx)
 		}
-		_ = indexer.EnsureDefaultIndex(ctx, osc, cfg.OpenSearch.Index)
+	}
+	// planRoles rejects unknown roles before we get here.
+	panic("unknown role " + role)
+}
 
-		w := &indexer.Worker{
-			NATS:       js,
-			OS:         osc,
-			Durable:    "indexer",
-			MaxDeliver: internalnats.DefaultMaxDeliver,
-			BulkMax:    100,
-		}
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("indexer run", "err", err)
-			os.Exit(1)
-		}
-	default:
-		slog.Error("unknown role", "role", role)
-		os.Exit(2)
+// ipnsNames returns the IPNS name registry, or nil when it is disabled.
+func ipnsNames(cfg config.Config, rdb *goredis.Client) *ipnsreg.Registry {
+	if !cfg.IPNS.Enabled {
+		return nil
 	}
+	return &ipnsreg.Registry{Redis: rdb, Config: cfg.IPNS}
+}
 
-	slog.Info("worker shutting down")
+// peerDedupe is the discovery workers' peer.observed dedupe; its empty
+// Prefix disables publishing when the peer index is off.
+func peerDedupe(cfg config.Config) redis.Dedupe {
+	if !cfg.Peers.Enabled {
+		return redis.Dedupe{}
+	}
+	return redis.Dedupe{Prefix: peers.DedupePrefix, TTL: cfg.Peers.DedupeTTL}
+}
+
+// topicDiscovery is the discovery-pubsub topic discovery settings.
+func topicDiscovery(cfg config.Config) discovery.TopicDiscovery {
+	return discovery.TopicDiscovery{
+		Enabled:    cfg.Discovery.PubSubDiscover,
+		Interval:   cfg.Discovery.PubSubDiscoverInterval,
+		MaxTopics:  cfg.Discovery.PubSubMaxTopics,
+		MinPeers:   cfg.Discovery.PubSubMinPeers,
+		QuietAfter: cfg.Discovery.PubSubQuietAfter,
+		Include:    cfg.Discovery.PubSubInclude,
+		Exclude:    cfg.Discovery.PubSubExclude,
+	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/health"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
+	"github.com/Rorical/IPFSniffer/internal/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// openPopularity starts the tracker every discovery role in the process
+// reports to. It reuses rdb when the dedupe registry already connected Redis.
+// release flushes pending observations and closes what it opened.
+func openPopularity(ctx context.Context, cfg config.Config, rdb *goredis.Client, ready *health.Checker) (t *popularity.Tracker, release func(), err error) {
+	owned := rdb == nil
+	if owned {
+		rdb, err = redis.Connect(ctx, cfg.Redis)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redis connect: %w", err)
+		}
+		ready.Add(health.Redis(rdb))
+	}
+	t = &popularity.Tracker{Redis: rdb, Config: cfg.Popularity}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = t.Run(runCtx)
+	}()
+	release = func() {
+		cancel()
+		<-done
+		if owned {
+			_ = rdb.Close()
+		}
+	}
+	return t, release, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Rorical/IPFSniffer/internal/kubo"
+)
+
+// roleNeeds lists the shared resources a role uses.
+type roleNeeds struct {
+	// kubo is the shared node's feature set; nil means the role does not use
+	// the shared node.
+	kubo *kubo.Options
+	// dedupe is the dedupe registry (Redis and/or Pebble).
+	dedupe bool
+	// popularity is the observation tracker; it uses Redis.
+	popularity bool
+	// geoip is the GeoIP databases, opened when configured.
+	geoip bool
+	// redis is a Redis client for state beyond dedupe, shared with the
+	// dedupe registry when that uses Redis.
+	redis      bool
+	opensearch bool
+	tika       bool
+	// ownsRepo marks roles that build their own Kubo node (custom DHT
+	// routing) on the repo, so they cannot share the process with any other
+	// Kubo user.
+	ownsRepo bool
+}
+
+var roleTable = map[string]roleNeeds{
+	"discovery-dht":         {dedupe: true, popularity: true, geoip: true, ownsRepo: true},
+	"discovery-ipns-dht":    {dedupe: true, redis: true, popularity: true, ownsRepo: true},
+	"discovery-pubsub":      {kubo: &kubo.Options{EnablePubSub: true}, dedupe: true, popularity: true, geoip: true},
+	"discovery-ipns-pubsub": {kubo: &kubo.Options{EnableIPNSPubSub: true}, dedupe: true, redis: true, popularity: true},
+	"resolver-ipns":         {kubo: &kubo.Options{}, dedupe: true, redis: true},
+	"enqueue-fetch":         {dedupe: true},
+	"fetcher":               {kubo: &kubo.Options{}},
+	"stream-server":         {kubo: &kubo.Options{}},
+	"extractor":             {tika: true},
+	"index-prep":            {},
+	"indexer":               {opensearch: true},
+	"popularity-index":      {popularity: true, opensearch: true},
+	"peer-indexer":          {opensearch: true},
+	"dlq-replayer":          {},
+	"standalone":            {},
+}
+
+// rolePlan is the validated role list of a process and the union of what the
+// roles need.
+type rolePlan struct {
+	roles []string
+	needs roleNeeds
+}
+
+func planRoles(names []string) (rolePlan, error) {
+	var p rolePlan
+	if len(names) == 0 {
+		return p, fmt.Errorf("no roles")
+	}
+	owners := 0
+	for _, name := range names {
+		n, ok := roleTable[name]
+		if !ok {
+			return p, fmt.Errorf("unknown role %q", name)
+		}
+		if slices.Contains(p.roles, name) {
+			return p, fmt.Errorf("role %q listed twice", name)
+		}
+		p.roles = append(p.roles, name)
+
+		if n.kubo != nil {
+			if p.needs.kubo == nil {
+				p.needs.kubo = &kubo.Options{}
+			}
+			p.needs.kubo.EnablePubSub = p.needs.kubo.EnablePubSub || n.kubo.EnablePubSub
+			p.needs.kubo.EnableIPNSPubSub = p.needs.kubo.EnableIPNSPubSub || n.kubo.EnableIPNSPubSub
+		}
+		p.needs.dedupe = p.needs.dedupe || n.dedupe
+		p.needs.popularity = p.needs.popularity || n.popularity
+		p.needs.geoip = p.needs.geoip || n.geoip
+		p.needs.redis = p.needs.redis || n.redis
+		p.needs.opensearch = p.needs.opensearch || n.opensearch
+		p.needs.tika = p.needs.tika || n.tika
+		if n.ownsRepo {
+			owners++
+		}
+	}
+
+	if slices.Contains(p.roles, "standalone") && len(p.roles) > 1 {
+		return p, fmt.Errorf("standalone runs the whole pipeline and cannot be combined with other roles")
+	}
+	if owners > 1 || (owners == 1 && p.needs.kubo != nil) {
+		return p, fmt.Errorf("discovery-dht and discovery-ipns-dht open their own Kubo node and must run without other Kubo roles")
+	}
+	return p, nil
+}
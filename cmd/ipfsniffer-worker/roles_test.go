@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlanRoles(t *testing.T) {
+	p, err := planRoles([]string{"discovery-pubsub", "fetcher", "stream-server", "discovery-ipns-pubsub", "indexer"})
+	if err != nil {
+		t.Fatalf("planRoles: %v", err)
+	}
+	if p.needs.kubo == nil || !p.needs.kubo.EnablePubSub || !p.needs.kubo.EnableIPNSPubSub {
+		t.Fatalf("kubo options: %+v", p.needs.kubo)
+	}
+	if !p.needs.dedupe || !p.needs.popularity || !p.needs.opensearch || p.needs.tika {
+		t.Fatalf("needs: %+v", p.needs)
+	}
+
+	p, err = planRoles([]string{"index-prep", "extractor"})
+	if err != nil {
+		t.Fatalf("planRoles: %v", err)
+	}
+	if p.needs.kubo != nil || !p.needs.tika {
+		t.Fatalf("needs: %+v", p.needs)
+	}
+
+	p, err = planRoles([]string{"popularity-index"})
+	if err != nil {
+		t.Fatalf("planRoles: %v", err)
+	}
+	if p.needs.dedupe || !p.needs.popularity || !p.needs.opensearch {
+		t.Fatalf("needs: %+v", p.needs)
+	}
+
+	for _, bad := range [][]string{
+		nil,
+		{"nope"},
+		{"fetcher", "fetcher"},
+		{"standalone", "fetcher"},
+		{"discovery-dht", "fetcher"},
+		{"discovery-dht", "discovery-ipns-dht"},
+	} {
+		if _, err := planRoles(bad); err == nil {
+			t.Fatalf("planRoles(%v): expected error", bad)
+		}
+	}
+	if _, err := planRoles([]string{"discovery-dht", "enqueue-fetch"}); err != nil {
+		t.Fatalf("dht role without shared node: %v", err)
+	}
+}
+
+func TestSupervisorRestartsUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs atomic.Int32
+	s := &supervisor{
+		Role: "test",
+		Base: time.Millisecond,
+		Max:  10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			switch runs.Add(1) {
+			case 1:
+				return errors.New("boom")
+			case 2:
+				panic("bad")
+			case 3:
+				return nil
+			}
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.supervise(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("supervisor did not stop")
+	}
+	if n := runs.Load(); n != 4 {
+		t.Fatalf("runs = %d, want 4", n)
+	}
+}
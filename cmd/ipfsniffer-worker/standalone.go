@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/decode"
+	"github.com/Rorical/IPFSniffer/internal/discovery"
+	"github.com/Rorical/IPFSniffer/internal/enqueue"
+	"github.com/Rorical/IPFSniffer/internal/extractor"
+	"github.com/Rorical/IPFSniffer/internal/fetcher"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
+	"github.com/Rorical/IPFSniffer/internal/health"
+	"github.com/Rorical/IPFSniffer/internal/indexer"
+	"github.com/Rorical/IPFSniffer/internal/indexprep"
+	"github.com/Rorical/IPFSniffer/internal/kubo"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
+	"github.com/Rorical/IPFSniffer/internal/redis"
+	"github.com/Rorical/IPFSniffer/internal/tika"
+)
+
+// runStandalone runs discovery-pubsub, enqueue-fetch, fetcher, stream-server,
+// extractor, index-prep, indexer and, when enabled, peer-indexer and
+// popularity-index in one process. They share one Kubo node and talk over an in-memory bus, so
+// in-flight work is lost on restart. The first role to fail stops the others.
+func runStandalone(ctx context.Context, cfg config.Config, ready *health.Checker, started func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bus := internalnats.NewMemoryBus()
+
+	ipfsNode, err := kubo.OpenOrInitWithOptions(ctx, cfg.Kubo.RepoPath,
+		kubo.Options{EnablePubSub: true, TrackPubSubTopics: cfg.Discovery.PubSubDiscover})
+	if err != nil {
+		return fmt.Errorf("kubo open: %w", err)
+	}
+	defer ipfsNode.Close()
+	ready.Add(health.MinPeers("kubo_peers", ipfsNode.PeerCount, cfg.Health.MinPeers))
+
+	dedupers, release, err := openDedupers(ctx, cfg, ready)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var tracker *popularity.Tracker
+	if cfg.Popularity.Enabled {
+		var stop func()
+		tracker, stop, err = openPopularity(ctx, cfg, dedupers.Redis, ready)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	var geo *geoip.DB
+	if cfg.GeoIP.Enabled() {
+		geo, err = geoip.Open(cfg.GeoIP)
+		if err != nil {
+			return err
+		}
+		defer geo.Close()
+	}
+
+	decoders, err := decode.ParseRules(cfg.Discovery.PubSubDecoders)
+	if err != nil {
+		return err
+	}
+
+	tc := &tika.Client{BaseURL: cfg.Tika.URL}
+	ready.Add(health.Tika(tc))
+
+	osc, err := opensearch.New(cfg.OpenSearch.Config)
+	if err != nil {
+		return fmt.Errorf("opensearch client: %w", err)
+	}
+	_ = indexer.EnsureDefaultIndex(ctx, osc, cfg.OpenSearch.Index, cfg.OpenSearch.Alias)
+	ready.Add(health.OpenSearch(osc), health.OpenSearchAlias(osc, cfg.OpenSearch.Alias))
+	started()
+
+	type role struct {
+		name string
+		run  func(context.Context) error
+	}
+	roles := []role{
+		{"discovery-pubsub", (&discovery.PubSubWorker{
+			IPFS:       ipfsNode,
+			Bus:        bus,
+			Dedupers:   dedupers,
+			Topics:     cfg.Discovery.PubSubTopics,
+			Dedupe:     redis.Dedupe{Prefix: "ipfsniffer:seen:cid", TTL: cfg.Discovery.DedupeTTL},
+			Popularity: tracker,
+			PeerDedupe: peerDedupe(cfg),
+			GeoIP:      geo,
+			Discover:   topicDiscovery(cfg),
+			Decoders:   decoders,
+		}).Run},
+		{"enqueue-fetch", (&enqueue.FetchEnqueuer{
+			Bus:         bus,
+			Dedupers:    dedupers,
+			Dedupe:      redis.Dedupe{Prefix: "ipfsniffer:seen:fetch", TTL: cfg.Fetch.DedupeTTL},
+			MaxDeliver:  cfg.Consumer.MaxDeliverFor("enqueue-fetch"),
+			AckWait:     cfg.Consumer.AckWaitFor("enqueue-fetch"),
+			Concurrency: cfg.Consumer.ConcurrencyFor("enqueue-fetch"),
+			Batch:       cfg.Consumer.BatchFor("enqueue-fetch"),
+			Limits: enqueue.FetchDefaults{
+				MaxTotalBytes: cfg.Fetch.MaxTotalBytes,
+				MaxFileBytes:  cfg.Fetch.MaxFileBytes,
+				MaxDAGNodes:   cfg.Fetch.MaxDAGNodes,
+				MaxDepth:      cfg.Fetch.MaxDepth,
+				Timeout:       cfg.Fetch.Timeout,
+			},
+			Inline: enqueue.InlineDefaults{InlineMaxBytes: cfg.Fetch.InlineMaxBytes},
+			Policy: enqueue.FetchPolicyDefaults{SkipExt: cfg.Fetch.SkipExt, SkipMimePrefix: cfg.Fetch.SkipMimePrefix},
+		}).Run},
+		{"fetcher", (&fetcher.Worker{
+			IPFS:        ipfsNode,
+			Bus:         bus,
+			Durable:     "fetcher",
+			MaxDeliver:  cfg.Consumer.MaxDeliverFor("fetcher"),
+			AckWait:     cfg.Consumer.AckWaitFor("fetcher"),
+			Concurrency: cfg.Consumer.ConcurrencyFor("fetcher"),
+			Batch:       cfg.Consumer.BatchFor("fetcher"),
+		}).Run},
+		{"stream-server", (&fetcher.StreamServer{IPFS: ipfsNode, Bus: bus}).Run},
+		{"extractor", (&extractor.Worker{
+			Bus:          bus,
+			Tika:         tc,
+			Durable:      "extractor",
+			MaxDeliver:   cfg.Consumer.MaxDeliverFor("extractor"),
+			AckWait:      cfg.Consumer.AckWaitFor("extractor"),
+			Concurrency:  cfg.Consumer.ConcurrencyFor("extractor"),
+			Batch:        cfg.Consumer.BatchFor("extractor"),
+			TikaTimeout:  cfg.Tika.Timeout,
+			MaxTextBytes: cfg.Tika.MaxTextBytes,
+		}).Run},
+		{"index-prep", (&indexprep.Worker{
+			Bus:         bus,
+			Durable:     "index-prep",
+			MaxDeliver:  cfg.Consumer.MaxDeliverFor("index-prep"),
+			AckWait:     cfg.Consumer.AckWaitFor("index-prep"),
+			Concurrency: cfg.Consumer.ConcurrencyFor("index-prep"),
+			Batch:       cfg.Consumer.BatchFor("index-prep"),
+			IndexName:   cfg.OpenSearch.Index,
+		}).Run},
+		{"indexer", (&indexer.Worker{
+			Bus:        bus,
+			OS:         osc,
+			Durable:    "indexer",
+			MaxDeliver: cfg.Consumer.MaxDeliverFor("indexer"),
+			BulkMax:    cfg.OpenSearch.BulkMax,
+		}).Run},
+	}
+	if cfg.Peers.Enabled {
+		roles = append(roles, role{"peer-indexer", (&peers.Worker{
+			Bus:         bus,
+			OS:          osc,
+			Index:       cfg.Peers.Index,
+			CIDsIndex:   cfg.Peers.CIDsIndex,
+			Durable:     "peer-indexer",
+			MaxDeliver:  cfg.Consumer.MaxDeliverFor("peer-indexer"),
+			AckWait:     cfg.Consumer.AckWaitFor("peer-indexer"),
+			Concurrency: cfg.Consumer.ConcurrencyFor("peer-indexer"),
+			Batch:       cfg.Consumer.BatchFor("peer-indexer"),
+		}).Run})
+	}
+	if tracker != nil {
+		roles = append(roles, role{"popularity-index", (&popularity.Indexer{
+			Redis:     tracker.Redis,
+			OS:        osc,
+			IndexName: cfg.OpenSearch.Index,
+			Config:    cfg.Popularity,
+		}).Run})
+	}
+
+	errc := make(chan error, len(roles))
+	var wg sync.WaitGroup
+	for _, r := range roles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			if err := r.run(ctx); err != nil && ctx.Err() == nil {
+				errc <- fmt.Errorf("%s: %w", r.name, err)
+			}
+			slog.Info("standalone role stopped", "role", r.name)
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	return <-errc
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+)
+
+// supervisor restarts a role until ctx is cancelled. A role that returns
+// while ctx is live, with or without an error, has failed.
+type supervisor struct {
+	Role string
+	Run  func(ctx context.Context) error
+
+	// Base and Max bound the restart backoff. A run that lasted longer than
+	// Max resets it.
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (s *supervisor) supervise(ctx context.Context) {
+	logger := slog.Default().With("role", s.Role)
+	failures := 0
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			logger.Info("role stopped")
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("returned unexpectedly")
+		}
+		if time.Since(started) > s.Max {
+			failures = 0
+		}
+		failures++
+		delay := internalnats.Backoff(failures, s.Base, s.Max)
+		logger.Error("role failed, restarting", "err", err, "failures", failures, "delay", delay)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			logger.Info("role stopped")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// runOnce runs the role, turning a panic into an error so one role cannot
+// take the process down.
+func (s *supervisor) runOnce(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.Run(ctx)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Rorical/IPFSniffer/internal/config"
+)
+
+func runConfig(_ context.Context, cfg config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: config print")
+	}
+	return cfg.Print(os.Stdout)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/admin"
+	"github.com/Rorical/IPFSniffer/internal/config"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func runDLQ(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required: ls, show, replay or purge")
+	}
+	sub, args := args[0], args[1:]
+
+	fs := newFlagSet("dlq " + sub)
+	limit := fs.Int("limit", 100, "maximum messages to show or replay")
+	_ = fs.Parse(args)
+
+	subject := ""
+	switch sub {
+	case "ls":
+		if fs.NArg() != 0 {
+			return fmt.Errorf("dlq ls takes no arguments")
+		}
+	case "show", "replay", "purge":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("dlq %s requires a subject", sub)
+		}
+		subject = fs.Arg(0)
+	default:
+		return fmt.Errorf("unknown dlq subcommand %q", sub)
+	}
+
+	nc, js, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	svc := &admin.Service{NATS: js}
+
+	switch sub {
+	case "ls":
+		dlqs, err := svc.DLQs(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(dlqs)
+	case "show":
+		msgs, err := svc.DLQMessages(ctx, subject, *limit)
+		if err != nil {
+			return err
+		}
+		claims := openClaims(js, cfg)
+		out := make([]dlqLine, 0, len(msgs))
+		for _, m := range msgs {
+			l := dlqLine{Seq: m.Seq, Subject: m.Subject, Time: m.Time, Header: m.Header}
+			l.Msg, l.Error = decodeMsg(ctx, claims, &nats.Msg{Subject: m.Subject, Header: m.Header, Data: m.Data})
+			out = append(out, l)
+		}
+		return printJSON(out)
+	case "replay":
+		n, err := svc.ReplayDLQ(ctx, subject, *limit)
+		if err != nil {
+			return fmt.Errorf("replayed %d before error: %w", n, err)
+		}
+		return printJSON(map[string]any{"subject": subject, "replayed": n})
+	default:
+		if err := svc.PurgeDLQ(ctx, subject); err != nil {
+			return err
+		}
+		return printJSON(map[string]any{"subject": subject, "purged": true})
+	}
+}
+
+type dlqLine struct {
+	Seq     uint64          `json:"seq"`
+	Subject string          `json:"subject"`
+	Time    time.Time       `json:"time"`
+	Header  nats.Header     `json:"header,omitempty"`
+	Msg     json.RawMessage `json:"msg,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
@@ -0,0 +1,112 @@
+// Command ipfsniffer is an operator tool for inspecting and driving the
+// pipeline. It reads the same IPFSNIFFER_* environment as the server and
+// workers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/config"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+
+	nats "github.com/nats-io/nats.go"
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+)
+
+const usage = `usage: ipfsniffer <command> [flags] [args]
+
+commands:
+  submit [-force] [-max-depth N ...] <cid|path>...   publish cid.discovered
+  search [-size N ...] [query]                       query the document index
+  doc <doc_id>                                       fetch one document
+  dlq ls                                             list DLQ streams
+  dlq show [-limit N] <subject>                      print DLQ messages
+  dlq replay [-limit N] <subject>                    republish DLQ messages
+  dlq purge <subject>                                drop DLQ messages
+  tail [-all] [-n N] <subject>                       decode messages as JSON
+  stats                                              stream and consumer info
+  config print                                       effective config, secrets redacted
+  policy get                                         current pipeline policy
+  policy history <key>                               kept versions of a policy key
+  policy set <key> <json>                            set a policy key; workers apply it live
+  policy rm <key>                                    revert a policy key to worker defaults
+
+Flags must precede positional arguments.
+`
+
+type command func(ctx context.Context, cfg config.Config, args []string) error
+
+var commands = map[string]command{
+	"submit": runSubmit,
+	"search": runSearch,
+	"doc":    runDoc,
+	"dlq":    runDLQ,
+	"tail":   runTail,
+	"stats":  runStats,
+	"config": runConfig,
+	"policy": runPolicy,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load config:", err)
+		os.Exit(1)
+	}
+	codec.SetCompressThreshold(cfg.Codec.CompressThreshold)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := cmd(ctx, cfg, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage of %s:\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func connectNATS(ctx context.Context, cfg config.Config) (*nats.Conn, nats.JetStreamContext, error) {
+	cfg.NATS.Name = "ipfsniffer-cli"
+	return internalnats.Connect(ctx, cfg.NATS)
+}
+
+func connectOpenSearch(cfg config.Config) (*osclient.Client, error) {
+	return opensearch.New(cfg.OpenSearch.Config)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
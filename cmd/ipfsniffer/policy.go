@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rorical/IPFSniffer/internal/admin"
+	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+)
+
+func runPolicy(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required: get, history, set or rm")
+	}
+	sub, args := args[0], args[1:]
+
+	want := map[string]int{"get": 0, "history": 1, "set": 2, "rm": 1}
+	n, ok := want[sub]
+	if !ok {
+		return fmt.Errorf("unknown policy subcommand %q", sub)
+	}
+	if len(args) != n {
+		return fmt.Errorf("policy %s takes %d argument(s)", sub, n)
+	}
+
+	nc, js, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	kv, err := policy.Ensure(js, cfg.Policy)
+	if err != nil {
+		return err
+	}
+	svc := &admin.Service{NATS: js, Policy: kv}
+
+	switch sub {
+	case "get":
+		entries, err := svc.Policies(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(entries)
+	case "history":
+		hist, err := svc.PolicyHistory(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return printJSON(hist)
+	case "set":
+		rev, err := svc.SetPolicy(ctx, args[0], []byte(args[1]))
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]any{"key": args[0], "revision": rev})
+	default:
+		if err := svc.DeletePolicy(ctx, args[0]); err != nil {
+			return err
+		}
+		return printJSON(map[string]any{"key": args[0], "deleted": true})
+	}
+}
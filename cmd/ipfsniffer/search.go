@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Rorical/IPFSniffer/internal/config"
+	"github.com/Rorical/IPFSniffer/internal/search"
+)
+
+func runSearch(ctx context.Context, cfg config.Config, args []string) error {
+	fs := newFlagSet("search")
+	var p search.SearchParams
+	fs.IntVar(&p.From, "from", 0, "result offset")
+	fs.IntVar(&p.Size, "size", 20, "result count (max 100)")
+	fs.StringVar(&p.RootCID, "root-cid", "", "filter by root CID")
+	fs.StringVar(&p.Path, "path", "", "filter by path")
+	fs.StringVar(&p.Mime, "mime", "", "filter by MIME type")
+	fs.StringVar(&p.Ext, "ext", "", "filter by extension")
+	fs.StringVar(&p.Source, "source", "", "filter by discovery source")
+	fs.StringVar(&p.IPNSName, "ipns-name", "", "filter by IPNS name or DNSLink domain")
+	fs.Int64Var(&p.MinCount, "min-count", 0, "filter by minimum observation count")
+	fs.StringVar(&p.SeenSince, "seen-since", "", "filter by last observation, e.g. now-1d")
+	fs.StringVar(&p.Country, "country", "", "filter by observing peer country (ISO code)")
+	asn := fs.Uint("asn", 0, "filter by observing peer ASN")
+	fs.BoolVar(&p.Facets, "facets", false, "include country and ASN facets")
+	fs.StringVar(&p.Sort, "sort", "", "sort as field:dir")
+	_ = fs.Parse(args)
+	p.ASN = uint32(*asn)
+
+	p.Q = strings.Join(fs.Args(), " ")
+	p.Normalize()
+
+	c, err := searchClient(cfg)
+	if err != nil {
+		return err
+	}
+	res, err := c.Search(ctx, p)
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+func runDoc(ctx context.Context, cfg config.Config, args []string) error {
+	fs := newFlagSet("doc")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("exactly one doc id required")
+	}
+
+	c, err := searchClient(cfg)
+	if err != nil {
+		return err
+	}
+	doc, found, err := c.GetDoc(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("doc %s not found", fs.Arg(0))
+	}
+	return printJSON(map[string]any{"id": fs.Arg(0), "doc": doc})
+}
+
+func searchClient(cfg config.Config) (*search.Client, error) {
+	osc, err := connectOpenSearch(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &search.Client{OS: osc, Index: cfg.OpenSearch.Alias}, nil
+}
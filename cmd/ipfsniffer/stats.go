@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rorical/IPFSniffer/internal/config"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func runStats(ctx context.Context, cfg config.Config, args []string) error {
+	fs := newFlagSet("stats")
+	_ = fs.Parse(args)
+
+	nc, js, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	streams := make([]map[string]any, 0, 2)
+	for _, name := range []string{internalnats.StreamName, internalnats.ChunkStreamName} {
+		si, err := js.StreamInfo(name, nats.Context(ctx))
+		if err != nil {
+			return fmt.Errorf("stream %s: %w", name, err)
+		}
+		streams = append(streams, map[string]any{
+			"name":      si.Config.Name,
+			"subjects":  si.Config.Subjects,
+			"retention": si.Config.Retention.String(),
+			"storage":   si.Config.Storage.String(),
+			"max_age":   si.Config.MaxAge.String(),
+			"max_bytes": si.Config.MaxBytes,
+			"replicas":  si.Config.Replicas,
+			"messages":  si.State.Msgs,
+			"bytes":     si.State.Bytes,
+			"first_seq": si.State.FirstSeq,
+			"last_seq":  si.State.LastSeq,
+			"consumers": si.State.Consumers,
+		})
+	}
+	consumers, err := internalnats.ListConsumers(ctx, js, "")
+	if err != nil {
+		return err
+	}
+	dlqs, err := internalnats.ListDLQ(ctx, js)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(map[string]any{
+		"streams":   streams,
+		"consumers": consumers,
+		"dlq":       dlqs,
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rorical/IPFSniffer/internal/admin"
+	"github.com/Rorical/IPFSniffer/internal/config"
+)
+
+func runSubmit(ctx context.Context, cfg config.Config, args []string) error {
+	fs := newFlagSet("submit")
+	force := fs.Bool("force", false, "bypass fetch dedupe")
+	var l admin.Limits
+	fs.Int64Var(&l.MaxTotalBytes, "max-total-bytes", 0, "override fetch max total bytes")
+	fs.Int64Var(&l.MaxFileBytes, "max-file-bytes", 0, "override fetch max file bytes")
+	fs.Int64Var(&l.MaxDAGNodes, "max-dag-nodes", 0, "override fetch max DAG nodes")
+	fs.Int64Var(&l.MaxDepth, "max-depth", 0, "override fetch max depth")
+	timeout := fs.Duration("timeout", 0, "override fetch timeout")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("at least one cid or path required")
+	}
+	l.TimeoutMs = timeout.Milliseconds()
+
+	nc, js, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	req := admin.SubmitRequest{Targets: fs.Args(), Force: *force}
+	if l != (admin.Limits{}) {
+		req.Limits = &l
+	}
+
+	svc := &admin.Service{NATS: js}
+	res, err := svc.Submit(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := printJSON(res); err != nil {
+		return err
+	}
+	if len(res.Rejected) > 0 {
+		return fmt.Errorf("%d target(s) rejected", len(res.Rejected))
+	}
+	return nil
+}
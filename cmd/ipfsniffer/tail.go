@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/config"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	nats "github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func runTail(ctx context.Context, cfg config.Config, args []string) error {
+	fs := newFlagSet("tail")
+	all := fs.Bool("all", false, "replay retained messages before following")
+	n := fs.Int("n", 0, "exit after N messages (0 = follow until interrupted)")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("exactly one subject required")
+	}
+	subject := fs.Arg(0)
+
+	nc, js, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	claims := openClaims(js, cfg)
+
+	deliver := nats.DeliverNew()
+	if *all {
+		deliver = nats.DeliverAll()
+	}
+
+	// An ordered consumer is ephemeral and never acks, so tailing does not
+	// interfere with the durable pipeline consumers.
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := js.ChanSubscribe(subject, msgs, nats.OrderedConsumer(), deliver)
+	if err != nil {
+		return fmt.Errorf("subscribe %s: %w", subject, err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	enc := json.NewEncoder(os.Stdout)
+	for seen := 0; *n == 0 || seen < *n; seen++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m := <-msgs:
+			line := tailLine{Subject: m.Subject}
+			if md, err := m.Metadata(); err == nil {
+				line.Seq = md.Sequence.Stream
+				line.Time = md.Timestamp
+			}
+			line.Msg, line.Error = decodeMsg(ctx, claims, m)
+			if err := enc.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type tailLine struct {
+	Subject string          `json:"subject"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Time    time.Time       `json:"time,omitzero"`
+	Msg     json.RawMessage `json:"msg,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// messageFor returns an empty envelope of the type published on subject.
+// DLQ subjects carry the same type as the subject they shadow.
+func messageFor(subject string) proto.Message {
+	subject = strings.TrimSuffix(subject, ".dlq")
+	switch {
+	case subject == internalnats.SubjectCidDiscovered:
+		return &ipfsnifferv1.CidDiscovered{}
+	case subject == internalnats.SubjectFetchRequest:
+		return &ipfsnifferv1.FetchRequest{}
+	case subject == internalnats.SubjectFetchResult:
+		return &ipfsnifferv1.FetchResult{}
+	case subject == internalnats.SubjectDocReady:
+		return &ipfsnifferv1.DocReady{}
+	case subject == internalnats.SubjectIndexRequest:
+		return &ipfsnifferv1.IndexRequest{}
+	case subject == internalnats.SubjectPeerObserved:
+		return &ipfsnifferv1.PeerObserved{}
+	case subject == internalnats.SubjectStreamGet:
+		return &ipfsnifferv1.StreamGet{}
+	case strings.HasPrefix(subject, internalnats.SubjectStreamChunkPrefix):
+		return &ipfsnifferv1.StreamChunk{}
+	}
+	return nil
+}
+
+// openClaims opens the claim store, so that claim-checked messages are shown
+// with their stored payload. It returns nil when there is none.
+func openClaims(js nats.JetStreamContext, cfg config.Config) *internalnats.ClaimStore {
+	store, err := js.ObjectStore(cfg.Claims.Bucket)
+	if err != nil {
+		return nil
+	}
+	return &internalnats.ClaimStore{Store: store}
+}
+
+// decodeMsg is decodeJSON for the payload of m, loaded from claims when m
+// carries a claim. A claim that cannot be loaded is reported by name.
+func decodeMsg(ctx context.Context, claims *internalnats.ClaimStore, m *nats.Msg) (json.RawMessage, string) {
+	data, err := claims.Resolve(ctx, m)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return decodeJSON(m.Subject, data)
+}
+
+// decodeJSON renders a pipeline payload as protojson. On failure it returns
+// the reason instead, so one bad message does not stop a tail.
+func decodeJSON(subject string, data []byte) (json.RawMessage, string) {
+	m := messageFor(subject)
+	if m == nil {
+		return nil, fmt.Sprintf("no message type for subject %s (%d bytes)", subject, len(data))
+	}
+	if err := codec.Unmarshal(data, m); err != nil {
+		return nil, err.Error()
+	}
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return b, ""
+}
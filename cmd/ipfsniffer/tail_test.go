@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestDecodeJSON_PipelineAndDLQSubjects(t *testing.T) {
+	b, err := codec.Marshal(&ipfsnifferv1.FetchRequest{V: 1, Id: "x", Data: &ipfsnifferv1.FetchRequestData{RootCid: "bafy1"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, subject := range []string{"fetch.request", "fetch.request.dlq"} {
+		out, errMsg := decodeJSON(subject, b)
+		if errMsg != "" {
+			t.Fatalf("%s: %s", subject, errMsg)
+		}
+		if !strings.Contains(string(out), "bafy1") {
+			t.Fatalf("%s: %s", subject, out)
+		}
+	}
+}
+
+func TestDecodeJSON_PeerObserved(t *testing.T) {
+	b, err := codec.Marshal(&ipfsnifferv1.PeerObserved{V: 1, Id: "peer-msg-1"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	out, errMsg := decodeJSON("peer.observed", b)
+	if errMsg != "" || !strings.Contains(string(out), "peer-msg-1") {
+		t.Fatalf("peer.observed: %s %s", out, errMsg)
+	}
+}
+
+func TestDecodeJSON_UnknownSubject(t *testing.T) {
+	if _, errMsg := decodeJSON("nope", []byte{1}); errMsg == "" {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestDecodeMsg_NamesUnresolvedClaim(t *testing.T) {
+	h := nats.Header{}
+	h.Set(internalnats.HeaderClaim, "abc123")
+	m := &nats.Msg{Subject: "fetch.result.dlq", Header: h, Data: []byte("abc123")}
+	out, errMsg := decodeMsg(context.Background(), nil, m)
+	if out != nil || !strings.Contains(errMsg, "claim abc123") {
+		t.Fatalf("claimed message without a store: %s %q", out, errMsg)
+	}
+}
@@ -0,0 +1,264 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	cid "github.com/ipfs/go-cid"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	nats "github.com/nats-io/nats.go"
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+)
+
+var ErrBadRequest = errors.New("bad request")
+
+func IsBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+// Service implements the operator actions behind the /admin API.
+//
+// Submissions enter the pipeline as cid.discovered with source "admin", so
+// they take the same resolver/enqueuer path as sniffed CIDs.
+type Service struct {
+	NATS nats.JetStreamContext
+	OS   *osclient.Client
+
+	// Index is the index or alias documents are deleted from.
+	Index string
+
+	// Policy is the pipeline policy bucket. Optional.
+	Policy nats.KeyValue
+}
+
+type Limits struct {
+	MaxTotalBytes int64 `json:"max_total_bytes,omitempty"`
+	MaxFileBytes  int64 `json:"max_file_bytes,omitempty"`
+	MaxDAGNodes   int64 `json:"max_dag_nodes,omitempty"`
+	MaxDepth      int64 `json:"max_depth,omitempty"`
+	TimeoutMs     int64 `json:"timeout_ms,omitempty"`
+}
+
+type SubmitRequest struct {
+	// Targets are bare CIDs, /ipfs/<cid>[/path] or /ipns/<name>.
+	Targets []string `json:"targets"`
+	Limits  *Limits  `json:"limits,omitempty"`
+	// Force bypasses fetch dedupe.
+	Force bool `json:"force,omitempty"`
+}
+
+type Submitted struct {
+	Target string `json:"target"`
+	Path   string `json:"path"`
+	ID     string `json:"id"`
+}
+
+type Rejected struct {
+	Target string `json:"target"`
+	Error  string `json:"error"`
+}
+
+type SubmitResult struct {
+	Submitted []Submitted `json:"submitted"`
+	Rejected  []Rejected  `json:"rejected,omitempty"`
+}
+
+func (s *Service) Submit(ctx context.Context, req SubmitRequest) (SubmitResult, error) {
+	if s.NATS == nil {
+		return SubmitResult{}, fmt.Errorf("nats jetstream required")
+	}
+	if len(req.Targets) == 0 {
+		return SubmitResult{}, fmt.Errorf("%w: targets required", ErrBadRequest)
+	}
+
+	var limits *ipfsnifferv1.FetchLimits
+	if l := req.Limits; l != nil {
+		limits = &ipfsnifferv1.FetchLimits{
+			MaxTotalBytes: l.MaxTotalBytes,
+			MaxFileBytes:  l.MaxFileBytes,
+			MaxDagNodes:   l.MaxDAGNodes,
+			MaxDepth:      l.MaxDepth,
+			TimeoutMs:     l.TimeoutMs,
+		}
+	}
+
+	out := SubmitResult{Submitted: make([]Submitted, 0, len(req.Targets))}
+	for _, t := range req.Targets {
+		p, err := NormalizeTarget(t)
+		if err != nil {
+			out.Rejected = append(out.Rejected, Rejected{Target: t, Error: err.Error()})
+			continue
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		env := &ipfsnifferv1.CidDiscovered{
+			V:  1,
+			Id: uuid.NewString(),
+			Ts: now,
+			Data: &ipfsnifferv1.CidDiscoveredData{
+				Cid:          p,
+				Source:       "admin",
+				SourceDetail: "submit",
+				ObservedAt:   now,
+				Limits:       limits,
+				Force:        req.Force,
+			},
+		}
+		b, err := codec.Marshal(env)
+		if err != nil {
+			return out, err
+		}
+		// Every submission is deliberate, so it gets a unique ID.
+		if _, err := internalnats.Publish(ctx, s.NATS, internalnats.SubjectCidDiscovered, b, nats.MsgId(env.Id)); err != nil {
+			return out, err
+		}
+		out.Submitted = append(out.Submitted, Submitted{Target: t, Path: p, ID: env.Id})
+	}
+	return out, nil
+}
+
+func (s *Service) Consumers(ctx context.Context) ([]internalnats.ConsumerStats, error) {
+	if s.NATS == nil {
+		return nil, fmt.Errorf("nats jetstream required")
+	}
+	return internalnats.ListConsumers(ctx, s.NATS, "")
+}
+
+func (s *Service) DLQs(ctx context.Context) ([]internalnats.DLQInfo, error) {
+	if s.NATS == nil {
+		return nil, fmt.Errorf("nats jetstream required")
+	}
+	return internalnats.ListDLQ(ctx, s.NATS)
+}
+
+func (s *Service) DLQMessages(ctx context.Context, subject string, limit int) ([]internalnats.DLQMessage, error) {
+	if err := s.checkSubject(subject); err != nil {
+		return nil, err
+	}
+	return internalnats.ReadDLQ(ctx, s.NATS, subject, limit)
+}
+
+func (s *Service) ReplayDLQ(ctx context.Context, subject string, limit int) (int, error) {
+	if err := s.checkSubject(subject); err != nil {
+		return 0, err
+	}
+	return internalnats.ReplayDLQ(ctx, s.NATS, subject, limit)
+}
+
+func (s *Service) PurgeDLQ(ctx context.Context, subject string) error {
+	if err := s.checkSubject(subject); err != nil {
+		return err
+	}
+	return internalnats.PurgeDLQ(ctx, s.NATS, subject)
+}
+
+func (s *Service) DeleteDoc(ctx context.Context, docID string) (bool, error) {
+	if s.OS == nil || s.Index == "" {
+		return false, fmt.Errorf("opensearch client and index required")
+	}
+	return opensearch.DeleteDocument(ctx, s.OS, s.Index, docID)
+}
+
+func (s *Service) DeleteByRootCID(ctx context.Context, rootCID string) (int, error) {
+	if s.OS == nil || s.Index == "" {
+		return 0, fmt.Errorf("opensearch client and index required")
+	}
+	if _, err := cid.Decode(rootCID); err != nil {
+		return 0, fmt.Errorf("%w: invalid root cid: %v", ErrBadRequest, err)
+	}
+	return opensearch.DeleteByRootCID(ctx, s.OS, s.Index, rootCID)
+}
+
+func (s *Service) Policies(ctx context.Context) ([]policy.Entry, error) {
+	if s.Policy == nil {
+		return nil, fmt.Errorf("policy bucket required")
+	}
+	return policy.Current(s.Policy)
+}
+
+func (s *Service) PolicyHistory(ctx context.Context, key string) ([]policy.Entry, error) {
+	if s.Policy == nil {
+		return nil, fmt.Errorf("policy bucket required")
+	}
+	return badPolicy(policy.History(s.Policy, key))
+}
+
+// SetPolicy stores value as the new version of key and returns its revision.
+// Workers watching the key apply it without a restart.
+func (s *Service) SetPolicy(ctx context.Context, key string, value json.RawMessage) (uint64, error) {
+	if s.Policy == nil {
+		return 0, fmt.Errorf("policy bucket required")
+	}
+	return badPolicy(policy.Set(ctx, s.Policy, key, value))
+}
+
+// DeletePolicy reverts key to the workers' configured defaults.
+func (s *Service) DeletePolicy(ctx context.Context, key string) error {
+	if s.Policy == nil {
+		return fmt.Errorf("policy bucket required")
+	}
+	_, err := badPolicy(struct{}{}, policy.Delete(ctx, s.Policy, key))
+	return err
+}
+
+// badPolicy marks invalid policy keys and values as bad requests.
+func badPolicy[T any](v T, err error) (T, error) {
+	if errors.Is(err, policy.ErrInvalid) {
+		return v, fmt.Errorf("%w: %w", ErrBadRequest, err)
+	}
+	return v, err
+}
+
+func (s *Service) checkSubject(subject string) error {
+	if s.NATS == nil {
+		return fmt.Errorf("nats jetstream required")
+	}
+	if !slices.Contains(internalnats.PipelineSubjects, subject) {
+		return fmt.Errorf("%w: unknown subject %q", ErrBadRequest, subject)
+	}
+	return nil
+}
+
+// NormalizeTarget turns a submitted CID or path into the /ipfs/... or
+// /ipns/... form carried in cid.discovered.
+func NormalizeTarget(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return "", fmt.Errorf("empty target")
+	case strings.HasPrefix(s, "/ipfs/"):
+		root, _, _ := strings.Cut(strings.TrimPrefix(s, "/ipfs/"), "/")
+		if _, err := cid.Decode(root); err != nil {
+			return "", fmt.Errorf("invalid cid %q: %w", root, err)
+		}
+		return s, nil
+	case strings.HasPrefix(s, "/ipns/"):
+		name, rest, _ := strings.Cut(strings.TrimPrefix(s, "/ipns/"), "/")
+		if name == "" {
+			return "", fmt.Errorf("missing ipns name")
+		}
+		// The resolver only resolves bare names.
+		if rest != "" {
+			return "", fmt.Errorf("ipns sub-paths are not supported")
+		}
+		return s, nil
+	default:
+		c, err := cid.Decode(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid cid %q: %w", s, err)
+		}
+		return "/ipfs/" + c.String(), nil
+	}
+}
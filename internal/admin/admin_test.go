@@ -0,0 +1,37 @@
+package admin
+
+import "testing"
+
+func TestNormalizeTarget(t *testing.T) {
+	const c = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+
+	ok := map[string]string{
+		c:                     "/ipfs/" + c,
+		"  " + c + " ":        "/ipfs/" + c,
+		"/ipfs/" + c:          "/ipfs/" + c,
+		"/ipfs/" + c + "/a/b": "/ipfs/" + c + "/a/b",
+		"/ipns/example.com":   "/ipns/example.com",
+	}
+	for in, want := range ok {
+		got, err := NormalizeTarget(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %q want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "nope", "/ipfs/nope", "/ipns/", "/ipns/example.com/x"} {
+		if _, err := NormalizeTarget(in); err == nil {
+			t.Fatalf("%q: expected error", in)
+		}
+	}
+}
+
+func TestSubmit_RequiresTargets(t *testing.T) {
+	s := &Service{}
+	if _, err := s.Submit(nil, SubmitRequest{}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
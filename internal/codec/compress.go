@@ -0,0 +1,66 @@
+package codec
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressed payloads are framed as [frameMarker, algorithm, data...]. A
+// protobuf message never starts with 0x00 (field number 0 is invalid), so
+// unframed payloads already in the streams still decode as plain protobuf.
+const (
+	frameMarker = 0x00
+	algoZstd    = 0x01
+)
+
+// MaxDecompressedBytes bounds a single decompressed payload.
+const MaxDecompressedBytes = 64 << 20
+
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	decoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedBytes))
+
+	compressThreshold atomic.Int64
+)
+
+// SetCompressThreshold makes Marshal zstd-compress payloads larger than n
+// bytes. n <= 0 disables compression. Unmarshal accepts both forms
+// regardless, so consumers must be upgraded before publishers enable it.
+func SetCompressThreshold(n int) {
+	compressThreshold.Store(int64(n))
+}
+
+func compress(b []byte) []byte {
+	n := compressThreshold.Load()
+	if n <= 0 || int64(len(b)) <= n {
+		return b
+	}
+	out := make([]byte, 2, 2+len(b)/2)
+	out[0], out[1] = frameMarker, algoZstd
+	out = encoder.EncodeAll(b, out)
+	if len(out) >= len(b) {
+		return b
+	}
+	return out
+}
+
+func decompress(b []byte) ([]byte, error) {
+	if len(b) == 0 || b[0] != frameMarker {
+		return b, nil
+	}
+	if len(b) < 2 {
+		return nil, fmt.Errorf("truncated frame")
+	}
+	switch b[1] {
+	case algoZstd:
+		out, err := decoder.DecodeAll(b[2:], nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown compression 0x%02x", b[1])
+	}
+}
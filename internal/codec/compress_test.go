@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"strings"
+	"testing"
+
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMarshal_Compressed(t *testing.T) {
+	SetCompressThreshold(64)
+	defer SetCompressThreshold(0)
+
+	in := &ipfsnifferv1.DocReady{V: 1, Id: "id", Data: &ipfsnifferv1.DocReadyData{Text: strings.Repeat("compressible text ", 200)}}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if b[0] != frameMarker || b[1] != algoZstd {
+		t.Fatalf("expected zstd frame, got % x", b[:2])
+	}
+	plain, _ := proto.Marshal(in)
+	if len(b) >= len(plain) {
+		t.Fatalf("compressed %d >= plain %d", len(b), len(plain))
+	}
+
+	var out ipfsnifferv1.DocReady
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out.GetData().GetText() != in.GetData().GetText() {
+		t.Fatalf("roundtrip mismatch")
+	}
+
+	// Small messages and messages written before compression stay plain.
+	small := &ipfsnifferv1.CidDiscovered{V: 1, Id: "id"}
+	sb, _ := Marshal(small)
+	if sb[0] == frameMarker {
+		t.Fatalf("small message should not be framed")
+	}
+	if err := Unmarshal(plain, &out); err != nil {
+		t.Fatalf("plain payload: %v", err)
+	}
+}
+
+func TestUnmarshal_BadFrame(t *testing.T) {
+	var m ipfsnifferv1.CidDiscovered
+	for _, b := range [][]byte{{frameMarker}, {frameMarker, 0x7f, 1}, {frameMarker, algoZstd, 1, 2, 3}} {
+		if err := Unmarshal(b, &m); err == nil {
+			t.Fatalf("expected error for % x", b)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// Marshal encodes m as protobuf, compressed when it exceeds the threshold set
+// with SetCompressThreshold.
 func Marshal(m proto.Message) ([]byte, error) {
 	if m == nil {
 		return nil, fmt.Errorf("nil message")
@@ -14,9 +16,10 @@ func Marshal(m proto.Message) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("proto marshal: %w", err)
 	}
-	return b, nil
+	return compress(b), nil
 }
 
+// Unmarshal decodes plain or compressed payloads produced by Marshal.
 func Unmarshal(b []byte, m proto.Message) error {
 	if m == nil {
 		return fmt.Errorf("nil message")
@@ -24,6 +27,10 @@ func Unmarshal(b []byte, m proto.Message) error {
 	if len(b) == 0 {
 		return fmt.Errorf("empty payload")
 	}
+	b, err := decompress(b)
+	if err != nil {
+		return fmt.Errorf("decompress: %w", err)
+	}
 	if err := proto.Unmarshal(b, m); err != nil {
 		return fmt.Errorf("proto unmarshal: %w", err)
 	}
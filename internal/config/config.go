@@ -7,13 +7,41 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
+	"github.com/Rorical/IPFSniffer/internal/redis"
+	"github.com/Rorical/IPFSniffer/internal/tlsconfig"
 )
 
 type Config struct {
-	NATS internalnats.ConnConfig
-
-	Redis RedisConfig
+	NATS    internalnats.ConnConfig
+	Streams internalnats.StreamsConfig
+	Claims  internalnats.ClaimConfig
+	// Policy is the KV bucket holding the live-tunable pipeline policy.
+	Policy policy.Config
+
+	Consumer ConsumerConfig
+
+	Redis redis.Config
+	// Dedupe selects the dedupe backend for each key prefix.
+	Dedupe dedupe.Config
+	// Popularity counts observations per CID.
+	Popularity popularity.Config
+	// Peers records which peers provide which CIDs.
+	Peers peers.Config
+	// GeoIP locates peer addresses with local databases.
+	GeoIP geoip.Config
+	// DNSLink resolves and watches DNSLink domains.
+	DNSLink dnslink.Config
+	// IPNS registers observed IPNS names and re-resolves them.
+	IPNS ipnsreg.Config
 
 	Discovery DiscoveryConfig
 	Fetch     FetchConfig
@@ -23,17 +51,96 @@ type Config struct {
 
 	Kubo KuboConfig
 
+	Health HealthConfig
+
+	Admin AdminConfig
+
+	Codec CodecConfig
+
+	DLQ DLQConfig
+
+	Worker WorkerConfig
+
+	HTTP HTTPConfig
+
 	Service ServiceConfig
+
+	// effective is the resolved configuration, for Print.
+	effective map[string]any
 }
 
-type ServiceConfig struct {
-	Env string
+type HTTPConfig struct {
+	// Addr is the server's listen address.
+	Addr string
+}
+
+// WorkerConfig controls which roles a worker process runs and how they are
+// supervised.
+type WorkerConfig struct {
+	// Roles run side by side in one process and share its Kubo node, Redis
+	// client and NATS connection.
+	Roles []string
+	// RestartBase and RestartMax bound the backoff before a failed role is
+	// restarted.
+	RestartBase time.Duration
+	RestartMax  time.Duration
+	// ShutdownTimeout is how long roles get to stop after a signal.
+	ShutdownTimeout time.Duration
+}
+
+// ConsumerConfig applies to every JetStream pull consumer the workers run.
+type ConsumerConfig struct {
+	MaxDeliver int
+	AckWait    time.Duration
+
+	// Concurrency and Batch are keyed by worker role, e.g. fetcher=32.
+	Concurrency map[string]int
+	Batch       map[string]int
+
+	// Roles overrides MaxDeliver and AckWait per worker role.
+	Roles map[string]RoleConsumerConfig
+}
+
+type RoleConsumerConfig struct {
+	MaxDeliver int
+	AckWait    time.Duration
+}
+
+// MaxDeliverFor returns the delivery limit for role's consumer.
+func (c ConsumerConfig) MaxDeliverFor(role string) int {
+	if n := c.Roles[role].MaxDeliver; n > 0 {
+		return n
+	}
+	return c.MaxDeliver
+}
+
+// AckWaitFor returns the ack wait for role's consumer.
+func (c ConsumerConfig) AckWaitFor(role string) time.Duration {
+	if d := c.Roles[role].AckWait; d > 0 {
+		return d
+	}
+	return c.AckWait
 }
 
-type RedisConfig struct {
-	Addr     string
-	DB       int
-	Password string
+// ConcurrencyFor returns the number of messages role handles in parallel.
+func (c ConsumerConfig) ConcurrencyFor(role string) int {
+	if n := c.Concurrency[role]; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// BatchFor returns the pull batch size for role; it defaults to the role's
+// concurrency.
+func (c ConsumerConfig) BatchFor(role string) int {
+	if n := c.Batch[role]; n > 0 {
+		return n
+	}
+	return c.ConcurrencyFor(role)
+}
+
+type ServiceConfig struct {
+	Env string
 }
 
 type DiscoveryConfig struct {
@@ -44,6 +151,27 @@ type DiscoveryConfig struct {
 	// There is no global IPNS pubsub feed; we must subscribe per-name.
 	IPNSPubSubNames []string
 	IPNSPubSubPoll  time.Duration
+	// IPNSPubSubMaxSubscriptions caps the names followed over pubsub on top
+	// of IPNSPubSubNames, picked from the IPNS registry by activity. Names
+	// that drop out of the ranking are unsubscribed once they have gone
+	// IPNSPubSubStaleAfter without an update.
+	IPNSPubSubMaxSubscriptions int
+	IPNSPubSubStaleAfter       time.Duration
+
+	// PubSubDiscover also subscribes to the topics connected peers are
+	// subscribed to, within PubSubMaxTopics. Topics quiet for
+	// PubSubQuietAfter make room for new ones.
+	PubSubDiscover         bool
+	PubSubDiscoverInterval time.Duration
+	PubSubMaxTopics        int
+	PubSubMinPeers         int
+	PubSubQuietAfter       time.Duration
+	// PubSubInclude and PubSubExclude filter discovered topics by glob.
+	PubSubInclude []string
+	PubSubExclude []string
+	// PubSubDecoders maps topic globs to payload decoders, as
+	// pattern=json|cbor|dag-cbor|protobuf:<descriptor set>#<message>.
+	PubSubDecoders []string
 }
 
 type FetchConfig struct {
@@ -53,14 +181,22 @@ type FetchConfig struct {
 	MaxDepth       int64
 	Timeout        time.Duration
 	InlineMaxBytes int64
+	// DedupeTTL is how long a root CID is remembered as already enqueued.
+	DedupeTTL time.Duration
 
 	SkipExt        []string
 	SkipMimePrefix []string
 }
 
 type OpenSearchConfig struct {
-	URL   string
+	// Config holds the connection settings: URL, credentials and TLS.
+	opensearch.Config
+
 	Index string
+	// Alias is the read alias the server queries and the indexer maintains.
+	Alias string
+	// BulkMax is the indexer's bulk request size in documents.
+	BulkMax int
 }
 
 type TikaConfig struct {
@@ -73,102 +209,388 @@ type KuboConfig struct {
 	RepoPath string
 }
 
-func LoadFromEnv() (Config, error) {
-	cfg := Config{}
+type HealthConfig struct {
+	// Addr is the worker health listener (/healthz, /readyz). Empty disables it.
+	Addr         string
+	CheckTimeout time.Duration
+	// MinPeers is the swarm peer count below which Kubo-backed roles report not ready.
+	MinPeers int
+}
 
-	cfg.Service.Env = getenv("IPFSNIFFER_ENV", "dev")
+type CodecConfig struct {
+	// CompressThreshold is the encoded size above which messages are
+	// zstd-compressed. 0, the default, disables compression. Consumers
+	// read both forms once upgraded, so upgrade every consumer before
+	// setting it on any publisher; older consumers cannot read compressed
+	// messages.
+	CompressThreshold int
+}
 
-	cfg.NATS = internalnats.DefaultConnConfig()
-	cfg.NATS.URL = getenv("IPFSNIFFER_NATS_URL", cfg.NATS.URL)
-	cfg.NATS.Name = getenv("IPFSNIFFER_NATS_NAME", cfg.NATS.Name)
-	if d := getenv("IPFSNIFFER_NATS_TIMEOUT", ""); d != "" {
-		dur, err := time.ParseDuration(d)
-		if err != nil {
-			return Config{}, fmt.Errorf("IPFSNIFFER_NATS_TIMEOUT: %w", err)
-		}
-		cfg.NATS.Timeout = dur
-	}
+type AdminConfig struct {
+	// Token is the bearer token for the server's /admin API. Empty disables it.
+	Token string
+}
 
-	cfg.Redis.Addr = getenv("IPFSNIFFER_REDIS_ADDR", "127.0.0.1:6379")
-	cfg.Redis.Password = getenv("IPFSNIFFER_REDIS_PASSWORD", "")
-	cfg.Redis.DB = getenvInt("IPFSNIFFER_REDIS_DB", 0)
+type DLQConfig struct {
+	ReplayInterval time.Duration
+	// ReplayMinAge leaves fresh entries alone so transient failures can clear.
+	ReplayMinAge time.Duration
+	// MaxReplays is how often an entry may be replayed before it is quarantined.
+	MaxReplays int
 
-	cfg.Discovery.PubSubTopics = splitCSV(getenv("IPFSNIFFER_DISCOVERY_PUBSUB_TOPICS", ""))
-	if len(cfg.Discovery.PubSubTopics) == 0 {
-		cfg.Discovery.PubSubTopics = []string{"ipfs.pubsub.chat", "fil"}
-	}
-	cfg.Discovery.DedupeTTL = getenvDuration("IPFSNIFFER_DISCOVERY_DEDUPE_TTL", 24*time.Hour)
+	ReplayMaxPerSubject int
+	// ReplayCaps overrides ReplayMaxPerSubject per subject ("subject=N,...").
+	ReplayCaps map[string]int
+}
 
-	cfg.Discovery.IPNSPubSubNames = splitCSV(getenv("IPFSNIFFER_DISCOVERY_IPNS_PUBSUB_NAMES", ""))
-	cfg.Discovery.IPNSPubSubPoll = getenvDuration("IPFSNIFFER_DISCOVERY_IPNS_PUBSUB_POLL", 10*time.Minute)
+// LoadFromEnv loads the configuration from the environment, layered over the
+// YAML file named by IPFSNIFFER_CONFIG if set. Malformed values, unknown file
+// keys and out-of-range settings are all reported together.
+func LoadFromEnv() (Config, error) {
+	l := newLoader()
+	if name := strings.TrimSpace(os.Getenv("IPFSNIFFER_CONFIG")); name != "" {
+		if err := l.readFile(name); err != nil {
+			return Config{}, err
+		}
+	}
 
-	cfg.Fetch.MaxTotalBytes = getenvInt64("IPFSNIFFER_FETCH_MAX_TOTAL_BYTES", 100*1024*1024)
-	cfg.Fetch.MaxFileBytes = getenvInt64("IPFSNIFFER_FETCH_MAX_FILE_BYTES", 10*1024*1024)
-	cfg.Fetch.MaxDAGNodes = getenvInt64("IPFSNIFFER_FETCH_MAX_DAG_NODES", 200000)
-	cfg.Fetch.MaxDepth = getenvInt64("IPFSNIFFER_FETCH_MAX_DEPTH", 64)
-	cfg.Fetch.Timeout = getenvDuration("IPFSNIFFER_FETCH_TIMEOUT", 10*time.Minute)
-	cfg.Fetch.InlineMaxBytes = getenvInt64("IPFSNIFFER_FETCH_INLINE_MAX_BYTES", 256*1024)
-	cfg.Fetch.SkipExt = splitCSV(getenv("IPFSNIFFER_FETCH_SKIP_EXT", ".zip,.tar,.gz,.tgz,.mp4,.mp3,.png,.jpg,.jpeg,.gif,.webp"))
-	cfg.Fetch.SkipMimePrefix = splitCSV(getenv("IPFSNIFFER_FETCH_SKIP_MIME_PREFIX", "video/,audio/,image/"))
+	cfg := Config{}
 
-	cfg.OpenSearch.URL = getenv("IPFSNIFFER_OPENSEARCH_URL", "http://127.0.0.1:9200")
-	cfg.OpenSearch.Index = getenv("IPFSNIFFER_OPENSEARCH_INDEX", "ipfsniffer-docs-v1")
+	cfg.Service.Env = "dev"
+	l.str("env", &cfg.Service.Env)
 
-	cfg.Tika.URL = getenv("IPFSNIFFER_TIKA_URL", "http://127.0.0.1:9998")
-	cfg.Tika.Timeout = getenvDuration("IPFSNIFFER_TIKA_TIMEOUT", 60*time.Second)
-	cfg.Tika.MaxTextBytes = getenvInt64("IPFSNIFFER_TIKA_MAX_TEXT_BYTES", 2_000_000)
+	cfg.NATS = internalnats.DefaultConnConfig()
+	l.str("nats.url", &cfg.NATS.URL)
+	l.str("nats.name", &cfg.NATS.Name)
+	l.duration("nats.timeout", &cfg.NATS.Timeout)
+	l.str("nats.creds_file", &cfg.NATS.CredsFile)
+	l.str("nats.nkey_file", &cfg.NATS.NKeyFile)
+	l.secret("nats.token", &cfg.NATS.Token)
+	l.tls("nats.tls", &cfg.NATS.TLS)
+	if err := cfg.NATS.ValidateAuth(); err != nil {
+		l.fail(envName("nats")+"_*", err)
+	}
 
-	cfg.Kubo.RepoPath = getenv("IPFSNIFFER_KUBO_REPO", defaultKuboRepo())
+	cfg.Streams = internalnats.DefaultStreamsConfig()
+	for _, sc := range []struct {
+		prefix string
+		s      *internalnats.StreamSettings
+		shared bool
+	}{
+		{"stream", &cfg.Streams.Pipeline, true},
+		{"chunk_stream", &cfg.Streams.Chunks, false},
+		{"dlq_stream", &cfg.Streams.DLQ, false},
+	} {
+		l.streamSettings(sc.prefix, sc.s, sc.shared)
+	}
 
+	cfg.Claims = internalnats.DefaultClaimConfig()
+	l.str("claim.bucket", &cfg.Claims.Bucket)
+	l.int("claim.threshold", &cfg.Claims.Threshold)
+	l.duration("claim.ttl", &cfg.Claims.TTL)
+	l.int("claim.replicas", &cfg.Claims.Replicas)
+	l.check(cfg.Claims.Threshold >= 0, "claim.threshold", "must not be negative")
+
+	cfg.Policy = policy.DefaultConfig()
+	l.str("policy.bucket", &cfg.Policy.Bucket)
+	l.int("policy.history", &cfg.Policy.History)
+	l.int("policy.replicas", &cfg.Policy.Replicas)
+	l.check(cfg.Policy.History >= 1 && cfg.Policy.History <= 64, "policy.history", "must be between 1 and 64")
+
+	cfg.Consumer.MaxDeliver = internalnats.DefaultMaxDeliver
+	cfg.Consumer.AckWait = internalnats.DefaultAckWait
+	l.int("consumer.max_deliver", &cfg.Consumer.MaxDeliver)
+	l.duration("consumer.ack_wait", &cfg.Consumer.AckWait)
+	l.check(cfg.Consumer.MaxDeliver >= 1, "consumer.max_deliver", "must be at least 1")
+	l.check(cfg.Consumer.AckWait > 0, "consumer.ack_wait", "must be positive")
+	l.roles(&cfg.Consumer)
+
+	cfg.Redis.Addr = "127.0.0.1:6379"
+	l.str("redis.addr", &cfg.Redis.Addr)
+	l.str("redis.username", &cfg.Redis.Username)
+	l.secret("redis.password", &cfg.Redis.Password)
+	l.int("redis.db", &cfg.Redis.DB)
+	l.tls("redis.tls", &cfg.Redis.TLS)
+
+	cfg.Dedupe = dedupe.DefaultConfig()
+	l.str("dedupe.backend", &cfg.Dedupe.Backend)
+	l.kvStr("dedupe.prefixes", &cfg.Dedupe.Prefixes)
+	l.str("dedupe.path", &cfg.Dedupe.Path)
+	l.int("dedupe.filter_capacity", &cfg.Dedupe.FilterCapacity)
+	l.float("dedupe.filter_fp_rate", &cfg.Dedupe.FilterFPRate)
+	l.duration("dedupe.stats_interval", &cfg.Dedupe.StatsInterval)
+	if err := cfg.Dedupe.Validate(); err != nil {
+		l.fail(envName("dedupe")+"_*", err)
+	}
+	l.check(cfg.Dedupe.Path != "" || !cfg.Dedupe.Uses(dedupe.BackendPebble), "dedupe.path", "must be set when a pebble backend is selected")
+
+	cfg.Popularity = popularity.DefaultConfig()
+	l.bool("popularity.enabled", &cfg.Popularity.Enabled)
+	l.str("popularity.prefix", &cfg.Popularity.Prefix)
+	l.duration("popularity.flush_interval", &cfg.Popularity.FlushInterval)
+	l.int("popularity.flush_batch", &cfg.Popularity.FlushBatch)
+	l.int("popularity.max_pending", &cfg.Popularity.MaxPending)
+	l.duration("popularity.index_interval", &cfg.Popularity.IndexInterval)
+	l.int("popularity.index_batch", &cfg.Popularity.IndexBatch)
+	l.duration("popularity.retain", &cfg.Popularity.Retain)
+	l.duration("popularity.ttl", &cfg.Popularity.TTL)
+	l.check(cfg.Popularity.FlushInterval > 0, "popularity.flush_interval", "must be positive")
+	l.check(cfg.Popularity.FlushBatch > 0, "popularity.flush_batch", "must be positive")
+	l.check(cfg.Popularity.MaxPending >= 0, "popularity.max_pending", "must not be negative")
+	l.check(cfg.Popularity.IndexInterval > 0, "popularity.index_interval", "must be positive")
+	l.check(cfg.Popularity.IndexBatch > 0, "popularity.index_batch", "must be positive")
+
+	cfg.Peers = peers.DefaultConfig()
+	l.bool("peers.enabled", &cfg.Peers.Enabled)
+	l.str("peers.index", &cfg.Peers.Index)
+	l.str("peers.cids_index", &cfg.Peers.CIDsIndex)
+	l.duration("peers.dedupe_ttl", &cfg.Peers.DedupeTTL)
+	l.check(cfg.Peers.Index != "" && cfg.Peers.CIDsIndex != "", "peers.index", "peers.index and peers.cids_index must be set")
+	l.check(cfg.Peers.DedupeTTL > 0, "peers.dedupe_ttl", "must be positive")
+
+	l.str("geoip.country_db", &cfg.GeoIP.CountryDB)
+	l.str("geoip.asn_db", &cfg.GeoIP.ASNDB)
+
+	cfg.DNSLink = dnslink.DefaultConfig()
+	l.bool("dnslink.enabled", &cfg.DNSLink.Enabled)
+	l.str("dnslink.server", &cfg.DNSLink.Server)
+	l.str("dnslink.prefix", &cfg.DNSLink.Prefix)
+	l.duration("dnslink.interval", &cfg.DNSLink.Interval)
+	l.int("dnslink.max_domains", &cfg.DNSLink.MaxDomains)
+	l.duration("dnslink.host_dedupe_ttl", &cfg.DNSLink.HostDedupeTTL)
+	l.bool("dnslink.discover_hosts", &cfg.DNSLink.DiscoverHosts)
+	l.check(cfg.DNSLink.Interval > 0, "dnslink.interval", "must be positive")
+	l.check(cfg.DNSLink.MaxDomains >= 0, "dnslink.max_domains", "must not be negative")
+	l.check(cfg.DNSLink.HostDedupeTTL > 0, "dnslink.host_dedupe_ttl", "must be positive")
+
+	cfg.IPNS = ipnsreg.DefaultConfig()
+	l.bool("ipns.enabled", &cfg.IPNS.Enabled)
+	l.str("ipns.prefix", &cfg.IPNS.Prefix)
+	l.duration("ipns.min_interval", &cfg.IPNS.MinInterval)
+	l.duration("ipns.max_interval", &cfg.IPNS.MaxInterval)
+	l.int("ipns.max_names", &cfg.IPNS.MaxNames)
+	l.int("ipns.history_max", &cfg.IPNS.HistoryMax)
+	l.duration("ipns.activity_half_life", &cfg.IPNS.ActivityHalfLife)
+	l.int("ipns.max_failures", &cfg.IPNS.MaxFailures)
+	l.duration("ipns.stats_interval", &cfg.IPNS.StatsInterval)
+	l.check(cfg.IPNS.MinInterval > 0, "ipns.min_interval", "must be positive")
+	l.check(cfg.IPNS.MaxInterval >= cfg.IPNS.MinInterval, "ipns.max_interval", "must not be below ipns.min_interval")
+	l.check(cfg.IPNS.MaxNames >= 0, "ipns.max_names", "must not be negative")
+	l.check(cfg.IPNS.HistoryMax >= 0, "ipns.history_max", "must not be negative")
+	l.check(cfg.IPNS.ActivityHalfLife > 0, "ipns.activity_half_life", "must be positive")
+	l.check(cfg.IPNS.MaxFailures >= 0, "ipns.max_failures", "must not be negative")
+	l.check(cfg.IPNS.StatsInterval >= 0, "ipns.stats_interval", "must not be negative")
+
+	cfg.Discovery.PubSubTopics = []string{"ipfs.pubsub.chat", "fil"}
+	l.list("discovery.pubsub_topics", &cfg.Discovery.PubSubTopics)
+	cfg.Discovery.DedupeTTL = 24 * time.Hour
+	l.duration("discovery.dedupe_ttl", &cfg.Discovery.DedupeTTL)
+	l.list("discovery.ipns_pubsub_names", &cfg.Discovery.IPNSPubSubNames)
+	cfg.Discovery.IPNSPubSubPoll = 10 * time.Minute
+	l.duration("discovery.ipns_pubsub_poll", &cfg.Discovery.IPNSPubSubPoll)
+	cfg.Discovery.IPNSPubSubMaxSubscriptions = 200
+	cfg.Discovery.IPNSPubSubStaleAfter = time.Hour
+	l.int("discovery.ipns_pubsub_max_subscriptions", &cfg.Discovery.IPNSPubSubMaxSubscriptions)
+	l.duration("discovery.ipns_pubsub_stale_after", &cfg.Discovery.IPNSPubSubStaleAfter)
+	l.check(cfg.Discovery.IPNSPubSubMaxSubscriptions >= 0, "discovery.ipns_pubsub_max_subscriptions", "must not be negative")
+	l.check(cfg.Discovery.IPNSPubSubStaleAfter > 0, "discovery.ipns_pubsub_stale_after", "must be positive")
+	cfg.Discovery.PubSubDiscoverInterval = time.Minute
+	cfg.Discovery.PubSubMaxTopics = 50
+	cfg.Discovery.PubSubMinPeers = 1
+	cfg.Discovery.PubSubQuietAfter = 10 * time.Minute
+	l.bool("discovery.pubsub_discover", &cfg.Discovery.PubSubDiscover)
+	l.duration("discovery.pubsub_discover_interval", &cfg.Discovery.PubSubDiscoverInterval)
+	l.int("discovery.pubsub_max_topics", &cfg.Discovery.PubSubMaxTopics)
+	l.int("discovery.pubsub_min_peers", &cfg.Discovery.PubSubMinPeers)
+	l.duration("discovery.pubsub_quiet_after", &cfg.Discovery.PubSubQuietAfter)
+	l.list("discovery.pubsub_include", &cfg.Discovery.PubSubInclude)
+	l.list("discovery.pubsub_exclude", &cfg.Discovery.PubSubExclude)
+	l.list("discovery.pubsub_decoders", &cfg.Discovery.PubSubDecoders)
+	l.check(cfg.Discovery.PubSubDiscoverInterval > 0, "discovery.pubsub_discover_interval", "must be positive")
+	l.check(cfg.Discovery.PubSubMaxTopics > 0, "discovery.pubsub_max_topics", "must be positive")
+
+	cfg.Fetch = FetchConfig{
+		MaxTotalBytes:  100 * 1024 * 1024,
+		MaxFileBytes:   10 * 1024 * 1024,
+		MaxDAGNodes:    200000,
+		MaxDepth:       64,
+		Timeout:        10 * time.Minute,
+		InlineMaxBytes: 256 * 1024,
+		DedupeTTL:      24 * time.Hour,
+		SkipExt:        []string{".zip", ".tar", ".gz", ".tgz", ".mp4", ".mp3", ".png", ".jpg", ".jpeg", ".gif", ".webp"},
+		SkipMimePrefix: []string{"video/", "audio/", "image/"},
+	}
+	l.int64("fetch.max_total_bytes", &cfg.Fetch.MaxTotalBytes)
+	l.int64("fetch.max_file_bytes", &cfg.Fetch.MaxFileBytes)
+	l.int64("fetch.max_dag_nodes", &cfg.Fetch.MaxDAGNodes)
+	l.int64("fetch.max_depth", &cfg.Fetch.MaxDepth)
+	l.duration("fetch.timeout", &cfg.Fetch.Timeout)
+	l.int64("fetch.inline_max_bytes", &cfg.Fetch.InlineMaxBytes)
+	l.duration("fetch.dedupe_ttl", &cfg.Fetch.DedupeTTL)
+	l.list("fetch.skip_ext", &cfg.Fetch.SkipExt)
+	l.list("fetch.skip_mime_prefix", &cfg.Fetch.SkipMimePrefix)
+	l.check(cfg.Fetch.Timeout > 0, "fetch.timeout", "must be positive")
+	l.check(cfg.Fetch.DedupeTTL > 0, "fetch.dedupe_ttl", "must be positive")
+
+	cfg.OpenSearch = OpenSearchConfig{
+		Config:  opensearch.Config{URL: "http://127.0.0.1:9200"},
+		Index:   "ipfsniffer-docs-v1",
+		Alias:   "ipfsniffer-docs",
+		BulkMax: 100,
+	}
+	l.str("opensearch.url", &cfg.OpenSearch.URL)
+	l.str("opensearch.index", &cfg.OpenSearch.Index)
+	l.str("opensearch.alias", &cfg.OpenSearch.Alias)
+	l.str("opensearch.username", &cfg.OpenSearch.Username)
+	l.secret("opensearch.password", &cfg.OpenSearch.Password)
+	l.tls("opensearch.tls", &cfg.OpenSearch.TLS)
+	// Without a CA file, https certificates are verified against the system
+	// roots; only opensearch.insecure skips verification.
+	l.bool("opensearch.insecure", &cfg.OpenSearch.Insecure)
+	l.int("opensearch.bulk_max", &cfg.OpenSearch.BulkMax)
+	l.check(cfg.OpenSearch.Alias != "" && cfg.OpenSearch.Alias != cfg.OpenSearch.Index, "opensearch.alias", "must be set and differ from the index")
+	l.check(cfg.OpenSearch.BulkMax >= 1, "opensearch.bulk_max", "must be at least 1")
+
+	cfg.Tika.URL = "http://127.0.0.1:9998"
+	cfg.Tika.Timeout = 60 * time.Second
+	cfg.Tika.MaxTextBytes = 2_000_000
+	l.str("tika.url", &cfg.Tika.URL)
+	l.duration("tika.timeout", &cfg.Tika.Timeout)
+	l.int64("tika.max_text_bytes", &cfg.Tika.MaxTextBytes)
+
+	cfg.Kubo.RepoPath = defaultKuboRepo()
+	l.str("kubo.repo", &cfg.Kubo.RepoPath)
+
+	cfg.Health.CheckTimeout = 2 * time.Second
+	cfg.Health.MinPeers = 1
+	l.str("health.addr", &cfg.Health.Addr)
+	l.duration("health.check_timeout", &cfg.Health.CheckTimeout)
+	l.int("health.min_peers", &cfg.Health.MinPeers)
+
+	l.secret("admin.token", &cfg.Admin.Token)
+
+	l.int("codec.compress_threshold", &cfg.Codec.CompressThreshold)
+	l.check(cfg.Codec.CompressThreshold >= 0, "codec.compress_threshold", "must not be negative")
+
+	cfg.DLQ.ReplayInterval = time.Minute
+	cfg.DLQ.ReplayMinAge = 5 * time.Minute
+	cfg.DLQ.MaxReplays = 3
+	cfg.DLQ.ReplayMaxPerSubject = 100
+	l.duration("dlq.replay_interval", &cfg.DLQ.ReplayInterval)
+	l.duration("dlq.replay_min_age", &cfg.DLQ.ReplayMinAge)
+	l.int("dlq.max_replays", &cfg.DLQ.MaxReplays)
+	l.int("dlq.replay_max_per_subject", &cfg.DLQ.ReplayMaxPerSubject)
+	l.kvInt("dlq.replay_caps", &cfg.DLQ.ReplayCaps)
+
+	cfg.Worker.Roles = []string{"discovery-pubsub"}
+	cfg.Worker.RestartBase = time.Second
+	cfg.Worker.RestartMax = time.Minute
+	cfg.Worker.ShutdownTimeout = 30 * time.Second
+	l.list("worker.role", &cfg.Worker.Roles)
+	l.duration("worker.restart_base", &cfg.Worker.RestartBase)
+	l.duration("worker.restart_max", &cfg.Worker.RestartMax)
+	l.duration("worker.shutdown_timeout", &cfg.Worker.ShutdownTimeout)
+	l.check(len(cfg.Worker.Roles) > 0, "worker.role", "must not be empty")
+	l.check(cfg.Worker.RestartBase > 0 && cfg.Worker.RestartMax >= cfg.Worker.RestartBase, "worker.restart_max", "must be at least worker.restart_base, which must be positive")
+
+	cfg.HTTP.Addr = "127.0.0.1:8080"
+	l.str("http.addr", &cfg.HTTP.Addr)
+
+	l.unknownKeys()
+	if err := l.err(); err != nil {
+		return Config{}, err
+	}
+	cfg.effective = l.effective
 	return cfg, nil
 }
 
-func getenv(key, def string) string {
-	v, ok := os.LookupEnv(key)
-	if !ok {
-		return def
+// streamSettings overrides s from <prefix>.retention, storage, max_age,
+// max_bytes, max_msgs, replicas and duplicates. A shared stream has several
+// consumers per subject.
+func (l *loader) streamSettings(prefix string, s *internalnats.StreamSettings, shared bool) {
+	l.str(prefix+".retention", &s.Retention)
+	l.str(prefix+".storage", &s.Storage)
+	l.duration(prefix+".max_age", &s.MaxAge)
+	l.int64(prefix+".max_bytes", &s.MaxBytes)
+	l.int64(prefix+".max_msgs", &s.MaxMsgs)
+	l.int(prefix+".replicas", &s.Replicas)
+	l.duration(prefix+".duplicates", &s.Duplicates)
+	validate := s.Validate
+	if shared {
+		validate = s.ValidateShared
 	}
-	v = strings.TrimSpace(v)
-	if v == "" {
-		return def
+	if err := validate(); err != nil {
+		l.fail(envName(prefix)+"_*", err)
 	}
-	return v
 }
 
-func getenvInt(key string, def int) int {
-	v := getenv(key, "")
-	if v == "" {
-		return def
-	}
-	i, err := strconv.Atoi(v)
-	if err != nil {
-		return def
+// tls reads <prefix>.enabled, ca_file, cert_file, key_file and server_name.
+func (l *loader) tls(prefix string, t *tlsconfig.Config) {
+	l.bool(prefix+".enabled", &t.Enabled)
+	l.str(prefix+".ca_file", &t.CAFile)
+	l.str(prefix+".cert_file", &t.CertFile)
+	l.str(prefix+".key_file", &t.KeyFile)
+	l.str(prefix+".server_name", &t.ServerName)
+	if err := t.Validate(); err != nil {
+		l.fail(envName(prefix)+"_*", err)
 	}
-	return i
 }
 
-func getenvInt64(key string, def int64) int64 {
-	v := getenv(key, "")
-	if v == "" {
-		return def
-	}
-	i, err := strconv.ParseInt(v, 10, 64)
-	if err != nil {
-		return def
+// roles reads the consumer settings keyed by worker role: consumer.concurrency
+// and consumer.batch ("role=N,..."), and the per-role sections of the config
+// file:
+//
+//	roles:
+//	  fetcher:
+//	    concurrency: 32
+//	    ack_wait: 2m
+//
+// consumer.concurrency and consumer.batch win over the sections.
+func (l *loader) roles(c *ConsumerConfig) {
+	concurrency, batch := map[string]int{}, map[string]int{}
+	roles := map[string]RoleConsumerConfig{}
+	for key, v := range l.fileChildren("roles") {
+		role, field, ok := strings.Cut(key, ".")
+		if !ok {
+			continue
+		}
+		path := "roles." + key
+		src := l.fileName + ": " + path
+		l.used[path] = true
+		rc := roles[role]
+		var err error
+		switch field {
+		case "concurrency":
+			concurrency[role], err = strconv.Atoi(v)
+		case "batch":
+			batch[role], err = strconv.Atoi(v)
+		case "max_deliver":
+			rc.MaxDeliver, err = strconv.Atoi(v)
+		case "ack_wait":
+			rc.AckWait, err = time.ParseDuration(v)
+		default:
+			l.used[path] = false
+			continue
+		}
+		if err != nil {
+			l.fail(src, fmt.Errorf("invalid value %q", v))
+			continue
+		}
+		roles[role] = rc
+		l.record(path, v)
 	}
-	return i
-}
 
-func getenvDuration(key string, def time.Duration) time.Duration {
-	v := getenv(key, "")
-	if v == "" {
-		return def
+	var kv map[string]int
+	l.kvInt("consumer.concurrency", &kv)
+	for k, n := range kv {
+		concurrency[k] = n
 	}
-	d, err := time.ParseDuration(v)
-	if err != nil {
-		return def
+	kv = nil
+	l.kvInt("consumer.batch", &kv)
+	for k, n := range kv {
+		batch[k] = n
 	}
-	return d
+	c.Concurrency, c.Batch, c.Roles = concurrency, batch, roles
 }
 
 func splitCSV(s string) []string {
@@ -188,6 +610,28 @@ func splitCSV(s string) []string {
 	return out
 }
 
+// splitKV parses "key=v,key2=w" into a map.
+func splitKV[T any](s string, parse func(string) (T, error)) (map[string]T, error) {
+	parts := splitCSV(s)
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]T, len(parts))
+	for _, p := range parts {
+		k, v, ok := strings.Cut(p, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", p)
+		}
+		n, err := parse(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		out[k] = n
+	}
+	return out, nil
+}
+
 func defaultKuboRepo() string {
 
 	home, err := os.UserHomeDir()
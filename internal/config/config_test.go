@@ -49,6 +49,9 @@ func TestLoadFromEnv_Defaults(t *testing.T) {
 	if cfg.OpenSearch.Index == "" {
 		t.Fatalf("expected opensearch index")
 	}
+	if cfg.OpenSearch.Insecure {
+		t.Fatalf("opensearch certificates must be verified by default")
+	}
 	if cfg.Tika.URL == "" {
 		t.Fatalf("expected tika url")
 	}
@@ -131,3 +134,130 @@ func TestLoadFromEnv_BadTimeout(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestLoadFromEnv_IPNSMaxFailures(t *testing.T) {
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if cfg.IPNS.MaxFailures <= 0 {
+		t.Fatalf("failing names must be dropped by default")
+	}
+
+	_ = os.Setenv("IPFSNIFFER_IPNS_MAX_FAILURES", "-1")
+	defer os.Unsetenv("IPFSNIFFER_IPNS_MAX_FAILURES")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestLoadFromEnv_DLQReplayCaps(t *testing.T) {
+	_ = os.Setenv("IPFSNIFFER_DLQ_REPLAY_CAPS", "fetch.request=10, index.request=0")
+	defer os.Unsetenv("IPFSNIFFER_DLQ_REPLAY_CAPS")
+
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if got := cfg.DLQ.ReplayCaps; len(got) != 2 || got["fetch.request"] != 10 || got["index.request"] != 0 {
+		t.Fatalf("caps: %+v", got)
+	}
+
+	_ = os.Setenv("IPFSNIFFER_DLQ_REPLAY_CAPS", "fetch.request")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestLoadFromEnv_ConsumerConcurrency(t *testing.T) {
+	_ = os.Setenv("IPFSNIFFER_CONSUMER_CONCURRENCY", "fetcher=32,extractor=4")
+	_ = os.Setenv("IPFSNIFFER_CONSUMER_BATCH", "fetcher=8")
+	defer os.Unsetenv("IPFSNIFFER_CONSUMER_CONCURRENCY")
+	defer os.Unsetenv("IPFSNIFFER_CONSUMER_BATCH")
+
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	c := cfg.Consumer
+	if c.ConcurrencyFor("fetcher") != 32 || c.BatchFor("fetcher") != 8 {
+		t.Fatalf("fetcher: %d/%d", c.ConcurrencyFor("fetcher"), c.BatchFor("fetcher"))
+	}
+	if c.ConcurrencyFor("extractor") != 4 || c.BatchFor("extractor") != 4 {
+		t.Fatalf("extractor: %d/%d", c.ConcurrencyFor("extractor"), c.BatchFor("extractor"))
+	}
+	if c.ConcurrencyFor("index-prep") != 1 || c.BatchFor("index-prep") != 1 {
+		t.Fatalf("index-prep: %d/%d", c.ConcurrencyFor("index-prep"), c.BatchFor("index-prep"))
+	}
+
+	_ = os.Setenv("IPFSNIFFER_CONSUMER_CONCURRENCY", "fetcher")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestLoadFromEnv_Streams(t *testing.T) {
+	_ = os.Setenv("IPFSNIFFER_STREAM_MAX_AGE", "168h")
+	_ = os.Setenv("IPFSNIFFER_CHUNK_STREAM_MAX_BYTES", "1048576")
+	_ = os.Setenv("IPFSNIFFER_DLQ_STREAM_REPLICAS", "3")
+	_ = os.Setenv("IPFSNIFFER_STREAM_DUPLICATES", "30m")
+	defer os.Unsetenv("IPFSNIFFER_STREAM_DUPLICATES")
+	defer os.Unsetenv("IPFSNIFFER_STREAM_MAX_AGE")
+	defer os.Unsetenv("IPFSNIFFER_CHUNK_STREAM_MAX_BYTES")
+	defer os.Unsetenv("IPFSNIFFER_DLQ_STREAM_REPLICAS")
+
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if cfg.Streams.Pipeline.MaxAge != 168*time.Hour {
+		t.Fatalf("pipeline max age: %v", cfg.Streams.Pipeline.MaxAge)
+	}
+	if cfg.Streams.Pipeline.Duplicates != 30*time.Minute {
+		t.Fatalf("pipeline duplicates: %v", cfg.Streams.Pipeline.Duplicates)
+	}
+	if cfg.Streams.Chunks.MaxBytes != 1048576 || cfg.Streams.Chunks.Storage != "memory" {
+		t.Fatalf("chunks: %+v", cfg.Streams.Chunks)
+	}
+	if cfg.Streams.DLQ.Replicas != 3 {
+		t.Fatalf("dlq replicas: %d", cfg.Streams.DLQ.Replicas)
+	}
+
+	_ = os.Setenv("IPFSNIFFER_STREAM_RETENTION", "workqueue")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Fatalf("expected workqueue pipeline stream to be rejected")
+	}
+	_ = os.Unsetenv("IPFSNIFFER_STREAM_RETENTION")
+
+	_ = os.Setenv("IPFSNIFFER_CHUNK_STREAM_RETENTION", "forever")
+	defer os.Unsetenv("IPFSNIFFER_CHUNK_STREAM_RETENTION")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestLoadFromEnv_WorkerRoles(t *testing.T) {
+	_ = os.Unsetenv("IPFSNIFFER_WORKER_ROLE")
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if len(cfg.Worker.Roles) != 1 || cfg.Worker.Roles[0] != "discovery-pubsub" {
+		t.Fatalf("default roles: %v", cfg.Worker.Roles)
+	}
+
+	_ = os.Setenv("IPFSNIFFER_WORKER_ROLE", "fetcher, stream-server,resolver-ipns")
+	_ = os.Setenv("IPFSNIFFER_WORKER_RESTART_MAX", "5m")
+	defer os.Unsetenv("IPFSNIFFER_WORKER_ROLE")
+	defer os.Unsetenv("IPFSNIFFER_WORKER_RESTART_MAX")
+	cfg, err = LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if len(cfg.Worker.Roles) != 3 || cfg.Worker.Roles[1] != "stream-server" {
+		t.Fatalf("roles: %v", cfg.Worker.Roles)
+	}
+	if cfg.Worker.RestartMax != 5*time.Minute || cfg.Worker.RestartBase != time.Second {
+		t.Fatalf("restart: %v/%v", cfg.Worker.RestartBase, cfg.Worker.RestartMax)
+	}
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Every setting has a dotted path in the config file, e.g. fetch.timeout, and
+// an environment variable derived from it, IPFSNIFFER_FETCH_TIMEOUT. The
+// environment wins over the file.
+
+const redacted = "REDACTED"
+
+// loader reads settings and collects every bad key and value instead of
+// stopping at the first.
+type loader struct {
+	fileName string
+	// file holds the file's leaves by dotted path; lists are joined with ','.
+	file map[string]string
+	used map[string]bool
+	errs []error
+	// effective is the resolved config as a nested tree, for Print.
+	effective map[string]any
+}
+
+func newLoader() *loader {
+	return &loader{file: map[string]string{}, used: map[string]bool{}, effective: map[string]any{}}
+}
+
+func envName(path string) string {
+	return "IPFSNIFFER_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// readFile loads a YAML config file.
+func (l *loader) readFile(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return fmt.Errorf("config file %s: %w", name, err)
+	}
+	l.fileName = name
+	if len(root.Content) == 0 {
+		return nil
+	}
+	l.flatten("", root.Content[0])
+	return nil
+}
+
+func (l *loader) flatten(path string, n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Kind != yaml.ScalarNode || k.Value == "" {
+				l.errs = append(l.errs, fmt.Errorf("%s: line %d: bad key", l.fileName, k.Line))
+				continue
+			}
+			p := k.Value
+			if path != "" {
+				p = path + "." + k.Value
+			}
+			l.flatten(p, v)
+		}
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(n.Content))
+		for _, it := range n.Content {
+			if it.Kind != yaml.ScalarNode {
+				l.errs = append(l.errs, fmt.Errorf("%s: %s: line %d: list items must be scalars", l.fileName, path, it.Line))
+				return
+			}
+			items = append(items, it.Value)
+		}
+		l.file[path] = strings.Join(items, ",")
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return
+		}
+		l.file[path] = n.Value
+	case yaml.AliasNode:
+		l.flatten(path, n.Alias)
+	default:
+		l.errs = append(l.errs, fmt.Errorf("%s: %s: line %d: unsupported value", l.fileName, path, n.Line))
+	}
+}
+
+// lookup returns the raw value for path and where it came from.
+func (l *loader) lookup(path string) (value, source string, ok bool) {
+	fv, inFile := l.file[path]
+	if inFile {
+		l.used[path] = true
+	}
+	name := envName(path)
+	if v, ok := os.LookupEnv(name); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v), name, true
+	}
+	if inFile {
+		return strings.TrimSpace(fv), l.fileName + ": " + path, true
+	}
+	return "", "", false
+}
+
+// fileChildren returns the file entries below prefix, keyed by the rest of
+// their path. Callers mark the ones they consume as used.
+func (l *loader) fileChildren(prefix string) map[string]string {
+	out := map[string]string{}
+	for k, v := range l.file {
+		if rest, ok := strings.CutPrefix(k, prefix+"."); ok {
+			out[rest] = v
+		}
+	}
+	return out
+}
+
+func (l *loader) fail(source string, err error) {
+	l.errs = append(l.errs, fmt.Errorf("%s: %w", source, err))
+}
+
+// check records a validation error for path unless ok.
+func (l *loader) check(ok bool, path, format string, args ...any) {
+	if !ok {
+		l.errs = append(l.errs, fmt.Errorf("%s (%s): %s", path, envName(path), fmt.Sprintf(format, args...)))
+	}
+}
+
+func (l *loader) record(path string, v any) {
+	m := l.effective
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+func (l *loader) str(path string, dst *string) {
+	if v, _, ok := l.lookup(path); ok {
+		*dst = v
+	}
+	l.record(path, *dst)
+}
+
+// secret is str for values Print must not show.
+func (l *loader) secret(path string, dst *string) {
+	if v, _, ok := l.lookup(path); ok {
+		*dst = v
+	}
+	if *dst != "" {
+		l.record(path, redacted)
+	} else {
+		l.record(path, "")
+	}
+}
+
+func (l *loader) int(path string, dst *int) {
+	if v, src, ok := l.lookup(path); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			l.fail(src, fmt.Errorf("invalid integer %q", v))
+		} else {
+			*dst = n
+		}
+	}
+	l.record(path, *dst)
+}
+
+func (l *loader) int64(path string, dst *int64) {
+	if v, src, ok := l.lookup(path); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			l.fail(src, fmt.Errorf("invalid integer %q", v))
+		} else {
+			*dst = n
+		}
+	}
+	l.record(path, *dst)
+}
+
+func (l *loader) bool(path string, dst *bool) {
+	if v, src, ok := l.lookup(path); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			l.fail(src, fmt.Errorf("invalid boolean %q", v))
+		} else {
+			*dst = b
+		}
+	}
+	l.record(path, *dst)
+}
+
+func (l *loader) duration(path string, dst *time.Duration) {
+	if v, src, ok := l.lookup(path); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			l.fail(src, fmt.Errorf("invalid duration %q", v))
+		} else {
+			*dst = d
+		}
+	}
+	l.record(path, dst.String())
+}
+
+func (l *loader) list(path string, dst *[]string) {
+	if v, _, ok := l.lookup(path); ok {
+		*dst = splitCSV(v)
+	}
+	l.record(path, slices.Clone(*dst))
+}
+
+func (l *loader) float(path string, dst *float64) {
+	if v, src, ok := l.lookup(path); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			l.fail(src, fmt.Errorf("invalid number %q", v))
+		} else {
+			*dst = f
+		}
+	}
+	l.record(path, *dst)
+}
+
+// kvInt reads "key=N,..." from the environment, or a mapping from the file.
+func (l *loader) kvInt(path string, dst *map[string]int) {
+	kvMap(l, path, dst, "integer", strconv.Atoi)
+}
+
+// kvStr reads "key=value,..." from the environment, or a mapping from the
+// file.
+func (l *loader) kvStr(path string, dst *map[string]string) {
+	kvMap(l, path, dst, "value", func(s string) (string, error) { return s, nil })
+}
+
+func kvMap[T any](l *loader, path string, dst *map[string]T, what string, parse func(string) (T, error)) {
+	kids := l.fileChildren(path)
+	for k := range kids {
+		l.used[path+"."+k] = true
+	}
+	name := envName(path)
+	if v, ok := os.LookupEnv(name); ok && strings.TrimSpace(v) != "" {
+		m, err := splitKV(v, parse)
+		if err != nil {
+			l.fail(name, err)
+		} else {
+			*dst = m
+		}
+	} else if len(kids) > 0 {
+		m := make(map[string]T, len(kids))
+		for k, v := range kids {
+			n, err := parse(strings.TrimSpace(v))
+			if err != nil {
+				l.fail(l.fileName+": "+path+"."+k, fmt.Errorf("invalid %s %q", what, v))
+				continue
+			}
+			m[k] = n
+		}
+		*dst = m
+	} else if v, src, ok := l.lookup(path); ok {
+		// A "key=value,..." string in the file.
+		m, err := splitKV(v, parse)
+		if err != nil {
+			l.fail(src, err)
+		} else {
+			*dst = m
+		}
+	}
+	if len(*dst) > 0 {
+		l.record(path, *dst)
+	}
+}
+
+// unknownKeys reports file keys no setting consumed.
+func (l *loader) unknownKeys() {
+	var unknown []string
+	for k := range l.file {
+		if !l.used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	slices.Sort(unknown)
+	for _, k := range unknown {
+		l.errs = append(l.errs, fmt.Errorf("%s: %s: unknown key", l.fileName, k))
+	}
+}
+
+func (l *loader) err() error {
+	return errors.Join(l.errs...)
+}
+
+// Print writes the effective configuration as a config file, with secrets
+// redacted.
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.effective); err != nil {
+		return err
+	}
+	return enc.Close()
+}
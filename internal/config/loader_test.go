@@ -0,0 +1,214 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, body string) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "ipfsniffer.yaml")
+	if err := os.WriteFile(name, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IPFSNIFFER_CONFIG", name)
+}
+
+func TestLoadFromEnv_File(t *testing.T) {
+	writeConfig(t, `
+env: staging
+redis:
+  addr: redis:6379
+  password: hunter2
+fetch:
+  dedupe_ttl: 48h
+  skip_ext: [.iso, .bin]
+opensearch:
+  alias: docs
+  insecure: false
+  bulk_max: 500
+dlq:
+  replay_caps:
+    fetch.request: 10
+roles:
+  fetcher:
+    concurrency: 32
+    max_deliver: 10
+    ack_wait: 2m
+  extractor:
+    batch: 2
+`)
+	t.Setenv("IPFSNIFFER_ENV", "prod")
+
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if cfg.Service.Env != "prod" {
+		t.Fatalf("env should override file, got %q", cfg.Service.Env)
+	}
+	if cfg.Redis.Addr != "redis:6379" || cfg.Redis.Password != "hunter2" {
+		t.Fatalf("redis: %+v", cfg.Redis)
+	}
+	if cfg.Fetch.DedupeTTL != 48*time.Hour || len(cfg.Fetch.SkipExt) != 2 || cfg.Fetch.SkipExt[1] != ".bin" {
+		t.Fatalf("fetch: %+v", cfg.Fetch)
+	}
+	if cfg.OpenSearch.Alias != "docs" || cfg.OpenSearch.Insecure || cfg.OpenSearch.BulkMax != 500 {
+		t.Fatalf("opensearch: %+v", cfg.OpenSearch)
+	}
+	if cfg.DLQ.ReplayCaps["fetch.request"] != 10 {
+		t.Fatalf("caps: %+v", cfg.DLQ.ReplayCaps)
+	}
+	c := cfg.Consumer
+	if c.ConcurrencyFor("fetcher") != 32 || c.MaxDeliverFor("fetcher") != 10 || c.AckWaitFor("fetcher") != 2*time.Minute {
+		t.Fatalf("fetcher: %d %d %v", c.ConcurrencyFor("fetcher"), c.MaxDeliverFor("fetcher"), c.AckWaitFor("fetcher"))
+	}
+	if c.BatchFor("extractor") != 2 || c.MaxDeliverFor("extractor") != c.MaxDeliver {
+		t.Fatalf("extractor: %d %d", c.BatchFor("extractor"), c.MaxDeliverFor("extractor"))
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "hunter2") || !strings.Contains(printed, "password: "+redacted) {
+		t.Fatalf("secret not redacted:\n%s", printed)
+	}
+	if !strings.Contains(printed, "env: prod") || !strings.Contains(printed, "bulk_max: 500") {
+		t.Fatalf("unexpected print:\n%s", printed)
+	}
+}
+
+func TestLoadFromEnv_ReportsEveryError(t *testing.T) {
+	writeConfig(t, `
+fetch:
+  timeout: soon
+  max_depht: 3
+opensearch:
+  bulk_max: 0
+roles:
+  fetcher:
+    concurency: 4
+`)
+	t.Setenv("IPFSNIFFER_REDIS_DB", "two")
+
+	_, err := LoadFromEnv()
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	for _, want := range []string{
+		"fetch.timeout: invalid duration",
+		"fetch.max_depht: unknown key",
+		"roles.fetcher.concurency: unknown key",
+		"IPFSNIFFER_REDIS_DB: invalid integer",
+		"opensearch.bulk_max",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error should mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadFromEnv_MissingFile(t *testing.T) {
+	t.Setenv("IPFSNIFFER_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := LoadFromEnv(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestLoadFromEnv_SecureConnections(t *testing.T) {
+	writeConfig(t, `
+nats:
+  creds_file: /etc/nats/user.creds
+  tls:
+    ca_file: /etc/nats/ca.pem
+redis:
+  username: sniffer
+  tls:
+    enabled: true
+opensearch:
+  username: admin
+  password: s3cret
+  tls:
+    ca_file: /etc/os/ca.pem
+`)
+
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	if cfg.NATS.CredsFile != "/etc/nats/user.creds" || !cfg.NATS.TLS.On() {
+		t.Fatalf("nats: %+v", cfg.NATS)
+	}
+	if cfg.Redis.Username != "sniffer" || !cfg.Redis.TLS.On() {
+		t.Fatalf("redis: %+v", cfg.Redis)
+	}
+	if cfg.OpenSearch.Username != "admin" || cfg.OpenSearch.Password != "s3cret" || cfg.OpenSearch.Insecure {
+		t.Fatalf("opensearch: %+v", cfg.OpenSearch.Config)
+	}
+}
+
+func TestLoadFromEnv_ConflictingAuth(t *testing.T) {
+	t.Setenv("IPFSNIFFER_NATS_TOKEN", "t")
+	t.Setenv("IPFSNIFFER_NATS_NKEY_FILE", "/seed")
+	t.Setenv("IPFSNIFFER_REDIS_TLS_CERT_FILE", "/client.pem")
+
+	_, err := LoadFromEnv()
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	for _, want := range []string{"only one of creds_file, nkey_file and token", "IPFSNIFFER_REDIS_TLS_*"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error should mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadFromEnv_TLSErrorReportedOnce(t *testing.T) {
+	t.Setenv("IPFSNIFFER_NATS_TLS_CERT_FILE", "/client.pem")
+
+	_, err := LoadFromEnv()
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if n := strings.Count(err.Error(), "key_file"); n != 1 || !strings.Contains(err.Error(), "IPFSNIFFER_NATS_TLS_*") {
+		t.Fatalf("want one IPFSNIFFER_NATS_TLS_* error, got:\n%v", err)
+	}
+}
+
+func TestLoadFromEnv_DedupeBackends(t *testing.T) {
+	writeConfig(t, `
+dedupe:
+  backend: redis+filter
+  path: /var/lib/ipfsniffer/dedupe
+  filter_fp_rate: 0.01
+  prefixes:
+    ipfsniffer:seen:cid:dhtds: pebble+filter
+`)
+	cfg, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	d := cfg.Dedupe
+	if d.Backend != "redis+filter" || d.FilterFPRate != 0.01 || d.Prefixes["ipfsniffer:seen:cid:dhtds"] != "pebble+filter" {
+		t.Fatalf("dedupe: %+v", d)
+	}
+
+	t.Setenv("IPFSNIFFER_DEDUPE_PREFIXES", "ipfsniffer:seen:fetch=memcached")
+	t.Setenv("IPFSNIFFER_DEDUPE_PATH", "")
+	writeConfig(t, "dedupe:\n  backend: pebble\n")
+	_, err = LoadFromEnv()
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	for _, want := range []string{`unknown dedupe backend "memcached"`, "dedupe.path"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error should mention %q:\n%v", want, err)
+		}
+	}
+}
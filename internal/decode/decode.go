@@ -0,0 +1,110 @@
+// Package decode finds CIDs in structured pubsub payloads.
+//
+// A Registry maps topic patterns to Decoders for JSON, CBOR, DAG-CBOR and
+// protobuf (given a descriptor set). Each decoder walks the decoded value
+// for CIDs held as strings, as binary CIDs in byte fields, or as DAG-CBOR
+// links, and reports the path of the value each one was found at, e.g.
+// $.Message.To or $.heads[0].
+package decode
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Rorical/IPFSniffer/internal/glob"
+)
+
+// Found is one CID found in a payload.
+type Found struct {
+	CID string
+	// Path locates the value that held the CID, rooted at $.
+	Path string
+}
+
+type Decoder interface {
+	Decode(payload []byte) ([]Found, error)
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	decoder Decoder
+}
+
+// Registry picks the decoder of the first rule whose topic pattern matches.
+// A nil *Registry has no rules.
+type Registry struct {
+	rules []rule
+}
+
+// Add appends a rule decoding the topics matching the glob pattern with d.
+func (r *Registry) Add(pattern string, d Decoder) error {
+	re, err := glob.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	if re == nil {
+		return fmt.Errorf("empty topic pattern")
+	}
+	r.rules = append(r.rules, rule{pattern: re, decoder: d})
+	return nil
+}
+
+// For returns the decoder for topic, or nil when no rule matches.
+func (r *Registry) For(topic string) Decoder {
+	if r == nil {
+		return nil
+	}
+	for _, rl := range r.rules {
+		if rl.pattern.MatchString(topic) {
+			return rl.decoder
+		}
+	}
+	return nil
+}
+
+// ParseRules builds a Registry from specs of the form pattern=kind, where
+// kind is json, cbor, dag-cbor or protobuf:<descriptor set file>#<message
+// full name>. Patterns are globs over topic names.
+func ParseRules(specs []string) (*Registry, error) {
+	r := &Registry{}
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("decoder rule %q: want pattern=kind", spec)
+		}
+		pattern, kind := spec[:i], spec[i+1:]
+		d, err := New(kind)
+		if err != nil {
+			return nil, fmt.Errorf("decoder rule %q: %w", spec, err)
+		}
+		if err := r.Add(pattern, d); err != nil {
+			return nil, fmt.Errorf("decoder rule %q: %w", spec, err)
+		}
+	}
+	return r, nil
+}
+
+// New returns the decoder kind names, as accepted by ParseRules.
+func New(kind string) (Decoder, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(kind), ":")
+	switch name {
+	case "json":
+		return JSON{}, nil
+	case "cbor":
+		return CBOR{}, nil
+	case "dag-cbor":
+		return DagCBOR{}, nil
+	case "protobuf":
+		file, msg, ok := strings.Cut(arg, "#")
+		if !ok || file == "" || msg == "" {
+			return nil, fmt.Errorf("protobuf decoder wants protobuf:<descriptor set file>#<message>")
+		}
+		return LoadProtobuf(file, msg)
+	}
+	return nil, fmt.Errorf("unknown decoder %q", kind)
+}
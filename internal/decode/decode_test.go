@@ -0,0 +1,161 @@
+package decode
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	cidA = "bafkreibm6jg3ux5qumhcn2b3flc3tyu6dmlb4xa7u5bf44yegnrjhc4yeq"
+	cidB = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+)
+
+func mustCID(t *testing.T, s string) cid.Cid {
+	t.Helper()
+	c, err := cid.Decode(s)
+	if err != nil {
+		t.Fatalf("cid %s: %v", s, err)
+	}
+	return c
+}
+
+func checkFound(t *testing.T, got []Found, want ...Found) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("found %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("found %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	payload := `{"heads":[{"/":"` + cidB + `"}],"entry":{"payload":"see /ipfs/` + cidA + `/x"},"n":1,"odd key":"` + cidA + `"}`
+	got, err := JSON{}.Decode([]byte(payload))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	checkFound(t, got,
+		Found{CID: cidA, Path: "$.entry.payload"},
+		Found{CID: cidB, Path: `$.heads[0]["/"]`},
+	)
+
+	if _, err := (JSON{}).Decode([]byte("not json")); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestDagCBOR(t *testing.T) {
+	a, b := mustCID(t, cidA), mustCID(t, cidB)
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Parents", qp.List(-1, func(la datamodel.ListAssembler) {
+			qp.ListEntry(la, qp.Link(cidlink.Link{Cid: a}))
+		}))
+		qp.MapEntry(ma, "Raw", qp.Bytes(b.Bytes()))
+		qp.MapEntry(ma, "Note", qp.String("hello"))
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := dagcbor.Encode(n, &buf); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	for _, d := range []Decoder{DagCBOR{}, CBOR{}} {
+		got, err := d.Decode(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%T decode: %v", d, err)
+		}
+		// DAG-CBOR orders map keys shortest first.
+		checkFound(t, got,
+			Found{CID: cidB, Path: "$.Raw"},
+			Found{CID: cidA, Path: "$.Parents[0]"},
+		)
+	}
+
+	// Lenient CBOR ignores what follows the first item; DAG-CBOR does not.
+	trailing := append(buf.Bytes(), 0x01)
+	if _, err := (CBOR{}).Decode(trailing); err != nil {
+		t.Fatalf("cbor with trailing data: %v", err)
+	}
+	if _, err := (DagCBOR{}).Decode(trailing); err == nil {
+		t.Fatalf("dag-cbor should reject trailing data")
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Block"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("parents"), Number: proto.Int32(1), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum(), JsonName: proto.String("parents")},
+					{Name: proto.String("head"), Number: proto.Int32(2), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), JsonName: proto.String("head")},
+				},
+			},
+		},
+	}
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatalf("marshal set: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "set.pb")
+	if err := os.WriteFile(path, set, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	reg, err := ParseRules([]string{"/blocks/*=protobuf:" + path + "#test.Block", "*=json"})
+	if err != nil {
+		t.Fatalf("rules: %v", err)
+	}
+	d := reg.For("/blocks/main")
+	if _, ok := d.(Protobuf); !ok {
+		t.Fatalf("decoder for /blocks/main = %T", d)
+	}
+	if _, ok := reg.For("chat").(JSON); !ok {
+		t.Fatalf("decoder for chat = %T", reg.For("chat"))
+	}
+
+	// Field 1 (bytes): the binary CID; field 2 (string): a CID string.
+	raw := mustCID(t, cidB).Bytes()
+	payload := append([]byte{0x0a, byte(len(raw))}, raw...)
+	payload = append(payload, 0x12, byte(len(cidA)))
+	payload = append(payload, cidA...)
+	got, err := d.Decode(payload)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	checkFound(t, got,
+		Found{CID: cidB, Path: "$.parents[0]"},
+		Found{CID: cidA, Path: "$.head"},
+	)
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	for _, spec := range []string{"noequals", "=json", "t=yaml", "t=protobuf:missing"} {
+		if _, err := ParseRules([]string{spec}); err == nil {
+			t.Fatalf("ParseRules(%q) should fail", spec)
+		}
+	}
+	var nilReg *Registry
+	if nilReg.For("t") != nil {
+		t.Fatalf("nil registry should have no decoders")
+	}
+}
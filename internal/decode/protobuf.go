@@ -0,0 +1,107 @@
+package decode
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Protobuf decodes payloads of one message type described at runtime.
+type Protobuf struct {
+	Message protoreflect.MessageDescriptor
+}
+
+// LoadProtobuf reads a binary FileDescriptorSet (protoc
+// --descriptor_set_out --include_imports) and returns a decoder for the
+// message with the given full name.
+func LoadProtobuf(path, message string) (Protobuf, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Protobuf{}, fmt.Errorf("read descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return Protobuf{}, fmt.Errorf("parse descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return Protobuf{}, fmt.Errorf("descriptor set %s: %w", path, err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return Protobuf{}, fmt.Errorf("descriptor set %s: %w", path, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return Protobuf{}, fmt.Errorf("descriptor set %s: %s is not a message", path, message)
+	}
+	return Protobuf{Message: md}, nil
+}
+
+func (p Protobuf) Decode(payload []byte) ([]Found, error) {
+	m := dynamicpb.NewMessage(p.Message)
+	if err := proto.Unmarshal(payload, m); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", p.Message.FullName(), err)
+	}
+	var c collector
+	walkMessage(&c, m, "$")
+	return c.out, nil
+}
+
+// walkMessage walks the set fields of m in field-number order, and map
+// entries in key order, so the CIDs come out in a stable order.
+func walkMessage(c *collector, m protoreflect.Message, path string) {
+	fields := m.Descriptor().Fields()
+	fds := make([]protoreflect.FieldDescriptor, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); m.Has(fd) {
+			fds = append(fds, fd)
+		}
+	}
+	slices.SortFunc(fds, func(a, b protoreflect.FieldDescriptor) int { return cmp.Compare(a.Number(), b.Number()) })
+
+	for _, fd := range fds {
+		v := m.Get(fd)
+		p := field(path, string(fd.Name()))
+		switch {
+		case fd.IsList():
+			l := v.List()
+			for i := 0; i < l.Len(); i++ {
+				walkValue(c, fd, l.Get(i), index(p, i))
+			}
+		case fd.IsMap():
+			mv := v.Map()
+			keys := make([]protoreflect.MapKey, 0, mv.Len())
+			mv.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+				keys = append(keys, k)
+				return true
+			})
+			slices.SortFunc(keys, func(a, b protoreflect.MapKey) int { return strings.Compare(a.String(), b.String()) })
+			for _, k := range keys {
+				walkValue(c, fd.MapValue(), mv.Get(k), p+"["+strconv.Quote(k.String())+"]")
+			}
+		default:
+			walkValue(c, fd, v, p)
+		}
+	}
+}
+
+func walkValue(c *collector, fd protoreflect.FieldDescriptor, v protoreflect.Value, path string) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		c.str(v.String(), path)
+	case protoreflect.BytesKind:
+		c.bytes(v.Bytes(), path)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		walkMessage(c, v.Message(), path)
+	}
+}
@@ -0,0 +1,172 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/Rorical/IPFSniffer/internal/cidutil"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// maxFound bounds the CIDs taken from one payload.
+const maxFound = 256
+
+// collector gathers CIDs in walk order, keeping the first path of each.
+type collector struct {
+	out  []Found
+	seen map[string]bool
+}
+
+func (c *collector) add(s, path string) {
+	if c.seen == nil {
+		c.seen = map[string]bool{}
+	}
+	if c.seen[s] || len(c.out) >= maxFound {
+		return
+	}
+	c.seen[s] = true
+	c.out = append(c.out, Found{CID: s, Path: path})
+}
+
+// str takes a string that is a CID, or else the CIDs embedded in it (e.g.
+// /ipfs/ paths).
+func (c *collector) str(s, path string) {
+	if parsed, err := cid.Decode(s); err == nil {
+		c.add(parsed.String(), path)
+		return
+	}
+	for _, found := range cidutil.ExtractCIDStrings(s) {
+		c.add(found, path)
+	}
+}
+
+// bytes takes a binary CID, with or without the 0x00 multibase prefix
+// DAG-CBOR puts in front of links.
+func (c *collector) bytes(b []byte, path string) {
+	if len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	if parsed, err := cid.Cast(b); err == nil {
+		c.add(parsed.String(), path)
+	}
+}
+
+func (c *collector) link(l datamodel.Link, path string) {
+	if cl, ok := l.(cidlink.Link); ok {
+		c.add(cl.Cid.String(), path)
+	}
+}
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// field extends path with a map key or field name.
+func field(path, key string) string {
+	if identRe.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+func index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// JSON decodes JSON payloads, including DAG-JSON, whose {"/": "<cid>"}
+// links are found as strings.
+type JSON struct{}
+
+func (JSON) Decode(payload []byte) ([]Found, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	var c collector
+	walkJSON(&c, v, "$")
+	return c.out, nil
+}
+
+func walkJSON(c *collector, v any, path string) {
+	switch v := v.(type) {
+	case string:
+		c.str(v, path)
+	case []any:
+		for i, e := range v {
+			walkJSON(c, e, index(path, i))
+		}
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			walkJSON(c, v[k], field(path, k))
+		}
+	}
+}
+
+// CBOR decodes CBOR payloads leniently: trailing data is ignored and
+// tag 42 is read as a CID link.
+type CBOR struct{}
+
+func (CBOR) Decode(payload []byte) ([]Found, error) {
+	return decodeCBOR(payload, dagcbor.DecodeOptions{AllowLinks: true, DontParseBeyondEnd: true})
+}
+
+// DagCBOR decodes DAG-CBOR blocks, e.g. Filecoin blocks and messages.
+type DagCBOR struct{}
+
+func (DagCBOR) Decode(payload []byte) ([]Found, error) {
+	return decodeCBOR(payload, dagcbor.DecodeOptions{AllowLinks: true})
+}
+
+func decodeCBOR(payload []byte, opts dagcbor.DecodeOptions) ([]Found, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := opts.Decode(nb, bytes.NewReader(payload)); err != nil {
+		return nil, fmt.Errorf("decode cbor: %w", err)
+	}
+	var c collector
+	walkNode(&c, nb.Build(), "$")
+	return c.out, nil
+}
+
+func walkNode(c *collector, n datamodel.Node, path string) {
+	switch n.Kind() {
+	case datamodel.Kind_String:
+		if s, err := n.AsString(); err == nil {
+			c.str(s, path)
+		}
+	case datamodel.Kind_Bytes:
+		if b, err := n.AsBytes(); err == nil {
+			c.bytes(b, path)
+		}
+	case datamodel.Kind_Link:
+		if l, err := n.AsLink(); err == nil {
+			c.link(l, path)
+		}
+	case datamodel.Kind_List:
+		for it := n.ListIterator(); !it.Done(); {
+			i, v, err := it.Next()
+			if err != nil {
+				return
+			}
+			walkNode(c, v, index(path, int(i)))
+		}
+	case datamodel.Kind_Map:
+		for it := n.MapIterator(); !it.Done(); {
+			k, v, err := it.Next()
+			if err != nil {
+				return
+			}
+			key, _ := k.AsString()
+			walkNode(c, v, field(path, key))
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package dedupe decides whether a discovered key was already handled
+// recently. Backends are Redis (shared across processes), Pebble (on disk,
+// single node) and an in-memory filter that can sit in front of either.
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Deduper remembers keys for a while.
+type Deduper interface {
+	// Seen reports whether key was already marked, marking it if not.
+	Seen(ctx context.Context, key string) (bool, error)
+	// Has reports whether key is marked, without marking it. With Mark it
+	// lets a caller mark a key only once the work behind it succeeded.
+	Has(ctx context.Context, key string) (bool, error)
+	// Mark marks key.
+	Mark(ctx context.Context, key string) error
+	Stats() Stats
+}
+
+type Stats struct {
+	// Hits counts keys already seen; Misses counts keys marked for the
+	// first time.
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+	// Filtered counts the hits the in-memory filter answered alone.
+	Filtered uint64 `json:"filtered,omitempty"`
+}
+
+type counter struct {
+	hits, misses, errors, filtered atomic.Uint64
+}
+
+func (c *counter) record(seen bool, err error) (bool, error) {
+	switch {
+	case err != nil:
+		c.errors.Add(1)
+	case seen:
+		c.hits.Add(1)
+	default:
+		c.misses.Add(1)
+	}
+	return seen, err
+}
+
+func (c *counter) recordErr(err error) error {
+	if err != nil {
+		c.errors.Add(1)
+	}
+	return err
+}
+
+func (c *counter) Stats() Stats {
+	return Stats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Errors:   c.errors.Load(),
+		Filtered: c.filtered.Load(),
+	}
+}
+
+// Backend names accepted in a spec.
+const (
+	BackendRedis  = "redis"
+	BackendPebble = "pebble"
+)
+
+// Spec is a backend name, optionally followed by "+filter" to put the
+// in-memory filter in front, e.g. "pebble+filter".
+type Spec struct {
+	Backend string
+	Filter  bool
+}
+
+func ParseSpec(s string) (Spec, error) {
+	backend, opt, hasOpt := strings.Cut(strings.TrimSpace(s), "+")
+	spec := Spec{Backend: backend, Filter: hasOpt}
+	if hasOpt && opt != "filter" {
+		return Spec{}, fmt.Errorf("unknown dedupe option %q", opt)
+	}
+	switch backend {
+	case BackendRedis, BackendPebble:
+		return spec, nil
+	default:
+		return Spec{}, fmt.Errorf("unknown dedupe backend %q (want redis or pebble)", backend)
+	}
+}
+
+type Config struct {
+	// Backend is the spec used for prefixes not in Prefixes.
+	Backend string
+	// Prefixes overrides Backend per dedupe prefix.
+	Prefixes map[string]string
+	// Path is the Pebble directory. Only one process may open it.
+	Path string
+	// FilterCapacity is the number of keys each filter generation holds
+	// at FilterFPRate false positives. A false positive drops a new key.
+	FilterCapacity int
+	FilterFPRate   float64
+	// StatsInterval is how often hit/miss counts are logged. 0 disables it.
+	StatsInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend:        BackendRedis,
+		FilterCapacity: 1_000_000,
+		FilterFPRate:   0.001,
+		StatsInterval:  5 * time.Minute,
+	}
+}
+
+// Validate checks every spec.
+func (c Config) Validate() error {
+	if _, err := ParseSpec(c.Backend); err != nil {
+		return err
+	}
+	for prefix, s := range c.Prefixes {
+		if _, err := ParseSpec(s); err != nil {
+			return fmt.Errorf("%s: %w", prefix, err)
+		}
+	}
+	if c.FilterCapacity < 1 {
+		return fmt.Errorf("filter capacity must be at least 1")
+	}
+	if c.FilterFPRate <= 0 || c.FilterFPRate >= 1 {
+		return fmt.Errorf("filter false positive rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// Uses reports whether any spec selects backend.
+func (c Config) Uses(backend string) bool {
+	specs := []string{c.Backend}
+	for _, s := range c.Prefixes {
+		specs = append(specs, s)
+	}
+	for _, s := range specs {
+		if spec, err := ParseSpec(s); err == nil && spec.Backend == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry hands out one Deduper per prefix, built from the prefix's spec,
+// so every role in a process shares its filters and counters.
+type Registry struct {
+	Config Config
+	Redis  *goredis.Client
+	Pebble *Pebble
+
+	mu       sync.Mutex
+	dedupers map[string]Deduper
+}
+
+// Default returns r, or a Redis-only registry over rdb when r is nil.
+func Default(r *Registry, rdb *goredis.Client) *Registry {
+	if r != nil {
+		return r
+	}
+	return &Registry{Config: DefaultConfig(), Redis: rdb}
+}
+
+// For returns the Deduper for prefix. ttl applies when the prefix is first
+// requested.
+func (r *Registry) For(prefix string, ttl time.Duration) (Deduper, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d, ok := r.dedupers[prefix]; ok {
+		return d, nil
+	}
+
+	s, ok := r.Config.Prefixes[prefix]
+	if !ok {
+		s = r.Config.Backend
+	}
+	spec, err := ParseSpec(s)
+	if err != nil {
+		return nil, fmt.Errorf("dedupe %s: %w", prefix, err)
+	}
+
+	var d Deduper
+	switch spec.Backend {
+	case BackendRedis:
+		if r.Redis == nil {
+			return nil, fmt.Errorf("dedupe %s: redis required", prefix)
+		}
+		d = NewRedis(r.Redis, prefix, ttl)
+	case BackendPebble:
+		if r.Pebble == nil {
+			return nil, fmt.Errorf("dedupe %s: pebble store required", prefix)
+		}
+		d = r.Pebble.Deduper(prefix, ttl)
+	}
+	if spec.Filter {
+		d = NewFilter(d, ttl, r.Config.FilterCapacity, r.Config.FilterFPRate)
+	}
+
+	if r.dedupers == nil {
+		r.dedupers = map[string]Deduper{}
+	}
+	r.dedupers[prefix] = d
+	return d, nil
+}
+
+// Stats returns the counters of every Deduper handed out, by prefix.
+func (r *Registry) Stats() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]Stats, len(r.dedupers))
+	for prefix, d := range r.dedupers {
+		out[prefix] = d.Stats()
+	}
+	return out
+}
+
+// LogStats logs Stats every interval until ctx is done.
+func (r *Registry) LogStats(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		stats := r.Stats()
+		prefixes := make([]string, 0, len(stats))
+		for p := range stats {
+			prefixes = append(prefixes, p)
+		}
+		sort.Strings(prefixes)
+		for _, p := range prefixes {
+			s := stats[p]
+			logger.Info("dedupe stats", "prefix", p, "hits", s.Hits, "misses", s.Misses, "errors", s.Errors, "filtered", s.Filtered)
+		}
+	}
+}
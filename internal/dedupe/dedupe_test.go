@@ -0,0 +1,235 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// mapDeduper is an exact in-memory backend.
+type mapDeduper struct {
+	keys  map[string]bool
+	calls int
+	counter
+}
+
+func (d *mapDeduper) Seen(_ context.Context, key string) (bool, error) {
+	d.calls++
+	seen := d.keys[key]
+	d.keys[key] = true
+	return d.record(seen, nil)
+}
+
+func (d *mapDeduper) Has(_ context.Context, key string) (bool, error) {
+	d.calls++
+	return d.record(d.keys[key], nil)
+}
+
+func (d *mapDeduper) Mark(_ context.Context, key string) error {
+	d.calls++
+	d.keys[key] = true
+	return nil
+}
+
+func TestFilter_AnswersRepeatsFromMemory(t *testing.T) {
+	ctx := context.Background()
+	next := &mapDeduper{keys: map[string]bool{"old": true}}
+	f := NewFilter(next, time.Hour, 1000, 0.001)
+
+	for _, tc := range []struct {
+		key  string
+		seen bool
+	}{{"a", false}, {"a", true}, {"old", true}, {"old", true}, {"b", false}} {
+		seen, err := f.Seen(ctx, tc.key)
+		if err != nil || seen != tc.seen {
+			t.Fatalf("Seen(%q) = %v, %v; want %v", tc.key, seen, err, tc.seen)
+		}
+	}
+	// "old" was marked before the filter saw it, so it stays with the
+	// backend, which knows when it expires.
+	if next.calls != 4 {
+		t.Fatalf("backend calls = %d, want 4", next.calls)
+	}
+	if s := f.Stats(); s.Hits != 3 || s.Misses != 2 || s.Filtered != 1 {
+		t.Fatalf("stats: %+v", s)
+	}
+}
+
+func TestFilter_HasDoesNotMark(t *testing.T) {
+	ctx := context.Background()
+	next := &mapDeduper{keys: map[string]bool{}}
+	f := NewFilter(next, time.Hour, 1000, 0.001)
+
+	for range 2 {
+		if seen, err := f.Has(ctx, "a"); err != nil || seen {
+			t.Fatalf("Has before Mark = %v, %v", seen, err)
+		}
+	}
+	if err := f.Mark(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if !next.keys["a"] {
+		t.Fatalf("Mark did not reach the backend")
+	}
+	calls := next.calls
+	if seen, err := f.Has(ctx, "a"); err != nil || !seen {
+		t.Fatalf("Has after Mark = %v, %v", seen, err)
+	}
+	if next.calls != calls {
+		t.Fatalf("marked key should be answered from memory")
+	}
+}
+
+func TestFilter_ForgetsAfterTwoWindows(t *testing.T) {
+	f := NewFilter(&mapDeduper{keys: map[string]bool{}}, time.Hour, 1000, 0.001)
+	h := uint64(42)
+	f.cur.add(h)
+
+	f.rotate(f.rotated.Add(31 * time.Minute))
+	if !f.prev.has(h) || f.cur.has(h) {
+		t.Fatalf("key should move to the previous generation")
+	}
+	f.rotate(f.rotated.Add(31 * time.Minute))
+	if f.prev.has(h) || f.cur.has(h) {
+		t.Fatalf("key should be forgotten")
+	}
+}
+
+func TestFilter_RotatesAtCapacity(t *testing.T) {
+	ctx := context.Background()
+	f := NewFilter(&mapDeduper{keys: map[string]bool{}}, time.Hour, 100, 0.01)
+	for i := range 10000 {
+		if _, err := f.Seen(ctx, fmt.Sprint("in", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.cur.n >= 100 || f.prev.n > 100 {
+		t.Fatalf("generations hold %d and %d keys", f.cur.n, f.prev.n)
+	}
+	seen := 0
+	for i := range 1000 {
+		s, err := f.Seen(ctx, fmt.Sprint("fresh", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s {
+			seen++
+		}
+	}
+	if seen > 50 {
+		t.Fatalf("fresh keys reported seen = %d of 1000", seen)
+	}
+}
+
+func TestBloom_FalsePositiveRate(t *testing.T) {
+	b := newBloom(10000, 0.01)
+	for i := range 10000 {
+		b.add(hashOf(fmt.Sprint("in", i)))
+	}
+	fp := 0
+	for i := range 10000 {
+		if b.has(hashOf(fmt.Sprint("out", i))) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("false positives = %d of 10000", fp)
+	}
+}
+
+func hashOf(s string) uint64 {
+	return NewFilter(nil, time.Hour, 1, 0.5).hash(s)
+}
+
+func TestPebble(t *testing.T) {
+	p, err := OpenPebble(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	now := time.Now()
+	for _, tc := range []struct {
+		key  string
+		at   time.Time
+		seen bool
+	}{
+		{"p:a", now, false},
+		{"p:a", now.Add(time.Minute), true},
+		{"q:a", now, false},
+		{"p:a", now.Add(2 * time.Hour), false},
+	} {
+		seen, err := p.seen([]byte(tc.key), time.Hour, tc.at)
+		if err != nil || seen != tc.seen {
+			t.Fatalf("seen(%q) at %v = %v, %v; want %v", tc.key, tc.at.Sub(now), seen, err, tc.seen)
+		}
+	}
+
+	n, err := p.sweep(now.Add(90*time.Minute), sweepBatch)
+	if err != nil || n != 1 {
+		t.Fatalf("sweep = %d, %v; want 1", n, err)
+	}
+
+	// Deletes are committed in batches as the sweep goes.
+	for i := range 5 {
+		if _, err := p.seen(fmt.Appendf(nil, "r:%d", i), time.Hour, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err = p.sweep(now.Add(3*time.Hour), 2)
+	if err != nil || n != 6 {
+		t.Fatalf("batched sweep = %d, %v; want 6", n, err)
+	}
+	if live, err := p.has([]byte("r:4"), now); err != nil || live {
+		t.Fatalf("swept key still live: %v, %v", live, err)
+	}
+}
+
+func TestRegistry_PerPrefixSpec(t *testing.T) {
+	p, err := OpenPebble(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	cfg := DefaultConfig()
+	cfg.Prefixes = map[string]string{"dht": "pebble+filter", "cid": "pebble"}
+	r := &Registry{Config: cfg, Pebble: p}
+
+	d, err := r.For("dht", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*Filter); !ok {
+		t.Fatalf("dht: got %T, want *Filter", d)
+	}
+	if again, _ := r.For("dht", time.Hour); again != d {
+		t.Fatalf("For should return the same deduper")
+	}
+	if d, _ := r.For("cid", time.Hour); d == nil {
+		t.Fatalf("cid: nil deduper")
+	}
+	// The default backend is Redis, which this registry lacks.
+	if _, err := r.For("fetch", time.Hour); err == nil {
+		t.Fatalf("expected error without redis")
+	}
+
+	if _, err := d.Seen(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+	if s := r.Stats()["dht"]; s.Misses != 1 {
+		t.Fatalf("stats: %+v", r.Stats())
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	if s, err := ParseSpec("redis+filter"); err != nil || s.Backend != BackendRedis || !s.Filter {
+		t.Fatalf("got %+v, %v", s, err)
+	}
+	for _, bad := range []string{"", "memcached", "redis+cache"} {
+		if _, err := ParseSpec(bad); err == nil {
+			t.Fatalf("ParseSpec(%q) should fail", bad)
+		}
+	}
+}
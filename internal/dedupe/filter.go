@@ -0,0 +1,153 @@
+package dedupe
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+)
+
+// Filter answers repeated keys from memory and only asks Next about keys
+// it has not seen, taking hot keys off the backend. It remembers only the
+// keys it saw marked, when Next reported them new or on Mark; a key Next
+// already held was marked at an unknown time and is left to Next. It keeps
+// two Bloom filter generations and drops the older one every ttl/2, or
+// sooner once the current one holds capacity keys, so a key is remembered
+// for at most ttl after it was marked; it never outlives the backend's TTL. A false positive reports a new
+// key as seen; capping each generation keeps that rate near fpRate however
+// busy the window.
+type Filter struct {
+	Next Deduper
+
+	capacity int
+	fpRate   float64
+	window   time.Duration
+	seed     maphash.Seed
+
+	mu        sync.Mutex
+	cur, prev *bloom
+	rotated   time.Time
+
+	counter
+}
+
+func NewFilter(next Deduper, ttl time.Duration, capacity int, fpRate float64) *Filter {
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	f := &Filter{
+		Next:     next,
+		capacity: capacity,
+		fpRate:   fpRate,
+		window:   ttl / 2,
+		seed:     maphash.MakeSeed(),
+		rotated:  time.Now(),
+	}
+	f.cur, f.prev = newBloom(capacity, fpRate), newBloom(capacity, fpRate)
+	return f
+}
+
+func (f *Filter) Seen(ctx context.Context, key string) (bool, error) {
+	h := f.hash(key)
+	if f.hit(h) {
+		f.filtered.Add(1)
+		return f.record(true, nil)
+	}
+
+	seen, err := f.Next.Seen(ctx, key)
+	if err == nil && !seen {
+		f.add(h)
+	}
+	return f.record(seen, err)
+}
+
+func (f *Filter) Has(ctx context.Context, key string) (bool, error) {
+	if f.hit(f.hash(key)) {
+		f.filtered.Add(1)
+		return f.record(true, nil)
+	}
+
+	return f.record(f.Next.Has(ctx, key))
+}
+
+func (f *Filter) Mark(ctx context.Context, key string) error {
+	if err := f.Next.Mark(ctx, key); err != nil {
+		return f.recordErr(err)
+	}
+	f.add(f.hash(key))
+	return nil
+}
+
+// hit reports whether either generation holds h.
+func (f *Filter) hit(h uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rotate(time.Now())
+	return f.cur.has(h) || f.prev.has(h)
+}
+
+// add puts h in the current generation, rotating once it holds capacity
+// keys.
+func (f *Filter) add(h uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cur.add(h)
+	if f.cur.n >= f.capacity {
+		f.cur, f.prev = newBloom(f.capacity, f.fpRate), f.cur
+		f.rotated = time.Now()
+	}
+}
+
+func (f *Filter) hash(key string) uint64 {
+	return maphash.String(f.seed, key)
+}
+
+func (f *Filter) rotate(now time.Time) {
+	switch elapsed := now.Sub(f.rotated); {
+	case elapsed >= 2*f.window:
+		f.cur, f.prev = newBloom(f.capacity, f.fpRate), newBloom(f.capacity, f.fpRate)
+	case elapsed >= f.window:
+		f.cur, f.prev = newBloom(f.capacity, f.fpRate), f.cur
+	default:
+		return
+	}
+	f.rotated = now
+}
+
+type bloom struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+	// n counts the keys added.
+	n int
+}
+
+// newBloom sizes a filter for n keys at false positive rate p.
+func newBloom(n int, p float64) *bloom {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloom{bits: make([]uint64, (m+63)/64), m: m, k: max(k, 1)}
+}
+
+// Positions come from double hashing the two halves of h.
+func (b *bloom) add(h uint64) {
+	b.n++
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloom) has(h uint64) bool {
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
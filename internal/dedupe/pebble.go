@@ -0,0 +1,178 @@
+package dedupe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+
+	"github.com/cockroachdb/pebble/v2"
+)
+
+// Pebble keeps dedupe keys on local disk for single-node setups, without a
+// network round-trip. One store serves every prefix; each key holds its
+// expiry time.
+type Pebble struct {
+	db *pebble.DB
+	// mu makes the check-and-mark in seen atomic.
+	mu sync.Mutex
+}
+
+func OpenPebble(dir string) (*Pebble, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("pebble dir required")
+	}
+	db, err := pebble.Open(dir, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("open pebble %s: %w", dir, err)
+	}
+	return &Pebble{db: db}, nil
+}
+
+func (p *Pebble) Close() error {
+	return p.db.Close()
+}
+
+// Deduper returns a Deduper storing keys as "<prefix>:<key>".
+func (p *Pebble) Deduper(prefix string, ttl time.Duration) Deduper {
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	return &pebbleDeduper{store: p, prefix: prefix + ":", ttl: ttl}
+}
+
+func (p *Pebble) seen(key []byte, ttl time.Duration, now time.Time) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	live, err := p.has(key, now)
+	if err != nil || live {
+		return live, err
+	}
+	return false, p.mark(key, ttl, now)
+}
+
+// has reports whether key holds an unexpired mark.
+func (p *Pebble) has(key []byte, now time.Time) (bool, error) {
+	v, closer, err := p.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("pebble get: %w", err)
+	}
+	live := len(v) == 8 && now.UnixNano() < int64(binary.BigEndian.Uint64(v))
+	_ = closer.Close()
+	return live, nil
+}
+
+func (p *Pebble) mark(key []byte, ttl time.Duration, now time.Time) error {
+	exp := binary.BigEndian.AppendUint64(nil, uint64(now.Add(ttl).UnixNano()))
+	if err := p.db.Set(key, exp, pebble.NoSync); err != nil {
+		return fmt.Errorf("pebble set: %w", err)
+	}
+	return nil
+}
+
+// Sweep deletes expired keys every interval until ctx is done.
+func (p *Pebble) Sweep(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		n, err := p.sweep(time.Now(), sweepBatch)
+		if err != nil {
+			logging.FromContext(ctx).Error("dedupe sweep", "err", err)
+			continue
+		}
+		logging.FromContext(ctx).Debug("dedupe sweep", "deleted", n)
+	}
+}
+
+// sweepBatch caps the deletes a sweep holds in memory before committing
+// them.
+const sweepBatch = 10000
+
+// sweep deletes the keys expired at now, committing every batch deletes.
+func (p *Pebble) sweep(now time.Time, batch int) (int, error) {
+	it, err := p.db.NewIter(nil)
+	if err != nil {
+		return 0, fmt.Errorf("pebble iter: %w", err)
+	}
+	defer it.Close()
+	b := p.db.NewBatch()
+	defer func() { _ = b.Close() }()
+	// A key re-marked since it was read is deleted too; it is only seen
+	// again sooner than its TTL.
+	commit := func() error {
+		if b.Empty() {
+			return nil
+		}
+		if err := b.Commit(pebble.NoSync); err != nil {
+			return fmt.Errorf("pebble commit: %w", err)
+		}
+		_ = b.Close()
+		b = p.db.NewBatch()
+		return nil
+	}
+	n := 0
+	for it.First(); it.Valid(); it.Next() {
+		v := it.Value()
+		if len(v) == 8 && now.UnixNano() < int64(binary.BigEndian.Uint64(v)) {
+			continue
+		}
+		if err := b.Delete(it.Key(), nil); err != nil {
+			return n, err
+		}
+		n++
+		if int(b.Count()) >= batch {
+			if err := commit(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return n, err
+	}
+	if err := commit(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+type pebbleDeduper struct {
+	store  *Pebble
+	prefix string
+	ttl    time.Duration
+
+	counter
+}
+
+func (d *pebbleDeduper) Seen(_ context.Context, key string) (bool, error) {
+	if key == "" {
+		return false, fmt.Errorf("key required")
+	}
+	return d.record(d.store.seen([]byte(d.prefix+key), d.ttl, time.Now()))
+}
+
+func (d *pebbleDeduper) Has(_ context.Context, key string) (bool, error) {
+	if key == "" {
+		return false, fmt.Errorf("key required")
+	}
+	return d.record(d.store.has([]byte(d.prefix+key), time.Now()))
+}
+
+func (d *pebbleDeduper) Mark(_ context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key required")
+	}
+	return d.recordErr(d.store.mark([]byte(d.prefix+key), d.ttl, time.Now()))
+}
@@ -0,0 +1,35 @@
+package dedupe
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Redis marks keys with SETNX, so every process sharing the Redis instance
+// sees the same keys.
+type Redis struct {
+	Client *goredis.Client
+	Dedupe redis.Dedupe
+
+	counter
+}
+
+func NewRedis(rdb *goredis.Client, prefix string, ttl time.Duration) *Redis {
+	return &Redis{Client: rdb, Dedupe: redis.Dedupe{Prefix: prefix, TTL: ttl}}
+}
+
+func (d *Redis) Seen(ctx context.Context, key string) (bool, error) {
+	return d.record(d.Dedupe.Seen(ctx, d.Client, key))
+}
+
+func (d *Redis) Has(ctx context.Context, key string) (bool, error) {
+	return d.record(d.Dedupe.Has(ctx, d.Client, key))
+}
+
+func (d *Redis) Mark(ctx context.Context, key string) error {
+	return d.recordErr(d.Dedupe.Mark(ctx, d.Client, key))
+}
@@ -76,6 +76,7 @@ func (s *PublishingDatastore) sniffKey(ctx context.Context, op string, key datas
 			if namePath, ok := ipnssniff.IPNSRoutingKeyBytesToNamePath(byts); ok {
 				logger.Info("dhtsniff: publishing IPNS name", "name", namePath)
 				_ = s.Sniff.PublishCID(ctx, namePath, "ipns-dht", "datastore_"+op+":routing_key", "")
+				s.Sniff.ObserveName(namePath, value)
 			}
 			if len(value) > 0 {
 				logger.Debug("dhtsniff: checking IPNS record value", "bytes_len", len(value))
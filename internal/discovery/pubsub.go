@@ -2,92 +2,267 @@ package discovery
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/cidutil"
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/decode"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
 	ipfs "github.com/Rorical/IPFSniffer/internal/kubo"
 	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	"github.com/Rorical/IPFSniffer/internal/redis"
 	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
 
 	nats "github.com/nats-io/nats.go"
 	goredis "github.com/redis/go-redis/v9"
-	"google.golang.org/protobuf/proto"
 )
 
 type PubSubWorker struct {
-	IPFS  *ipfs.Node
-	NATS  nats.JetStreamContext
+	IPFS *ipfs.Node
+	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus   internalnats.Bus
 	Redis *goredis.Client
 
 	Topics []string
 	Dedupe redis.Dedupe
+	// Dedupers picks the dedupe backend per prefix; nil uses Redis. Optional.
+	Dedupers *dedupe.Registry
+	// Popularity counts every observation, duplicates included. Optional.
+	Popularity *popularity.Tracker
+	// PeerDedupe, when its Prefix is set, publishes peer.observed once per
+	// new peer/CID pair. Optional.
+	PeerDedupe redis.Dedupe
+	// GeoIP tags records with the location of the sender's known
+	// addresses. Optional.
+	GeoIP *geoip.DB
+
+	// Policies, when set, replaces Topics live from the
+	// policy.KeyPubSubTopics key. Optional.
+	Policies nats.KeyValue
+
+	// Decoders picks a structured decoder per topic; topics without one
+	// are scanned as text. Optional.
+	Decoders *decode.Registry
+
+	// Discover adds the topics connected peers subscribe to. It needs a
+	// node opened with TrackPubSubTopics. Optional.
+	Discover TopicDiscovery
+	// StatsInterval is how often each topic's message and CID counts are
+	// logged; 0 uses 5 minutes.
+	StatsInterval time.Duration
+
+	mu sync.Mutex
+	// subs holds every subscription; static the configured topics.
+	subs   map[string]*subscription
+	static map[string]bool
+	seen   dedupe.Deduper
+	peers  *peers.Observer
+}
+
+type subscription struct {
+	cancel     context.CancelFunc
+	stats      *topicStats
+	discovered bool
 }
 
 func (w *PubSubWorker) Run(ctx context.Context) error {
 	if w.IPFS == nil || w.IPFS.API == nil {
 		return fmt.Errorf("ipfs node required")
 	}
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
-	if w.Redis == nil {
-		return fmt.Errorf("redis client required")
+	if w.Dedupe.Prefix == "" {
+		w.Dedupe.Prefix = "ipfsniffer:seen:cid"
+	}
+	if w.Dedupe.TTL == 0 {
+		w.Dedupe.TTL = 24 * time.Hour
+	}
+	seen, err := dedupe.Default(w.Dedupers, w.Redis).For(w.Dedupe.Prefix, w.Dedupe.TTL)
+	if err != nil {
+		return err
+	}
+	w.seen = seen
+	if w.PeerDedupe.Prefix != "" {
+		d, err := dedupe.Default(w.Dedupers, w.Redis).For(w.PeerDedupe.Prefix, w.PeerDedupe.TTL)
+		if err != nil {
+			return err
+		}
+		w.peers = &peers.Observer{Bus: w.Bus, Deduper: d, GeoIP: w.GeoIP}
+		if w.IPFS.Raw != nil {
+			w.peers.Host = w.IPFS.Raw.PeerHost
+		}
+		go w.peers.Run(ctx)
 	}
 
 	logger := logging.FromContext(ctx)
 
-	if len(w.Topics) == 0 {
-		return fmt.Errorf("no pubsub topics configured")
+	w.subs = map[string]*subscription{}
+	w.static = map[string]bool{}
+
+	var filter topicFilter
+	if w.Discover.Enabled {
+		if w.IPFS.PubSubTopics == nil || w.IPFS.Raw == nil || w.IPFS.Raw.PubSub == nil {
+			return fmt.Errorf("topic discovery requires a node tracking pubsub topics")
+		}
+		def := DefaultTopicDiscovery()
+		if w.Discover.Interval <= 0 {
+			w.Discover.Interval = def.Interval
+		}
+		if w.Discover.MaxTopics <= 0 {
+			w.Discover.MaxTopics = def.MaxTopics
+		}
+		if filter, err = newTopicFilter(w.Discover); err != nil {
+			return err
+		}
 	}
 
-	// Subscribe per-topic.
-	for _, topic := range w.Topics {
-		topic := topic
-		sub, err := w.IPFS.API.PubSub().Subscribe(ctx, topic)
+	if w.Policies == nil {
+		if len(w.Topics) == 0 && !w.Discover.Enabled {
+			return fmt.Errorf("no pubsub topics configured")
+		}
+		if err := w.setTopics(ctx, w.Topics); err != nil {
+			return err
+		}
+	} else {
+		err := policy.Watch(ctx, w.Policies, policy.KeyPubSubTopics, func(topics *[]string, _ uint64) {
+			want := w.Topics
+			if topics != nil {
+				want = *topics
+			}
+			if err := w.setTopics(ctx, want); err != nil {
+				logger.Error("pubsub topics", "err", err)
+			}
+		})
 		if err != nil {
-			return fmt.Errorf("pubsub subscribe %s: %w", topic, err)
-		}
-
-		go func() {
-			defer sub.Close()
-			logger.Info("pubsub subscribed", "topic", topic)
-
-			for {
-				msg, err := sub.Next(ctx)
-				if err != nil {
-					if ctx.Err() != nil {
-						return
-					}
-					logger.Error("pubsub next", "topic", topic, "err", err)
-					time.Sleep(1 * time.Second)
-					continue
-				}
+			return err
+		}
+	}
 
-				w.handleMessage(ctx, topic, msg.Data(), msg.From().String())
-			}
-		}()
+	// Discovery starts after the configured topics are subscribed, so it
+	// never spends its budget on one of them.
+	if w.Discover.Enabled {
+		go w.discoverTopics(ctx, filter)
+	}
+	if w.StatsInterval <= 0 {
+		w.StatsInterval = 5 * time.Minute
 	}
+	go w.logTopicStats(ctx)
 
 	<-ctx.Done()
 	return ctx.Err()
 }
 
-func (w *PubSubWorker) handleMessage(ctx context.Context, topic string, payload []byte, peerID string) {
+// setTopics subscribes to the configured topics not yet subscribed and
+// cancels the configured subscriptions no longer wanted. A discovered topic
+// that becomes configured is kept and no longer counts as discovered. A
+// message already being handled on a dropped topic is still published.
+func (w *PubSubWorker) setTopics(ctx context.Context, topics []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	logger := logging.FromContext(ctx)
+	want := map[string]bool{}
+	for _, t := range topics {
+		if t = strings.TrimSpace(t); t != "" {
+			want[t] = true
+		}
+	}
+	for topic := range w.static {
+		if !want[topic] {
+			w.subs[topic].cancel()
+			delete(w.subs, topic)
+			logger.Info("pubsub unsubscribed", "topic", topic)
+		}
+	}
+
+	var errs []error
+	for topic := range want {
+		if s, ok := w.subs[topic]; ok {
+			s.discovered = false
+			continue
+		}
+		s, err := w.subscribe(ctx, topic)
+		if err != nil {
+			errs = append(errs, err)
+			delete(want, topic)
+			continue
+		}
+		w.subs[topic] = s
+	}
+	w.static = want
+	return errors.Join(errs...)
+}
+
+func (w *PubSubWorker) subscribe(ctx context.Context, topic string) (*subscription, error) {
 	logger := logging.FromContext(ctx)
 
-	cids := cidutil.ExtractCIDStrings(string(payload))
-	if len(cids) == 0 {
+	subCtx, cancel := context.WithCancel(ctx)
+	sub, err := w.IPFS.API.PubSub().Subscribe(subCtx, topic)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("pubsub subscribe %s: %w", topic, err)
+	}
+
+	stats := &topicStats{since: time.Now().UTC()}
+	go func() {
+		defer sub.Close()
+		logger.Info("pubsub subscribed", "topic", topic)
+
+		for {
+			msg, err := sub.Next(subCtx)
+			if err != nil {
+				if subCtx.Err() != nil {
+					return
+				}
+				logger.Error("pubsub next", "topic", topic, "err", err)
+				time.Sleep(1 * time.Second)
+				continue
+			}
+
+			w.handleMessage(ctx, topic, stats, msg.Data(), msg.From().String())
+		}
+	}()
+	return &subscription{cancel: cancel, stats: stats}, nil
+}
+
+func (w *PubSubWorker) handleMessage(ctx context.Context, topic string, stats *topicStats, payload []byte, peerID string) {
+	logger := logging.FromContext(ctx)
+
+	stats.messages.Add(1)
+	stats.last.Store(time.Now().UnixNano())
+	found := w.extract(ctx, topic, payload)
+	if len(found) == 0 {
 		return
 	}
+	stats.cids.Add(int64(len(found)))
+
+	var addrs []string
+	var geo geoip.Info
+	if w.GeoIP != nil && w.IPFS.Raw != nil {
+		addrs = peers.Addrs(w.IPFS.Raw.PeerHost, peerID)
+		geo = w.GeoIP.Lookup(addrs)
+	}
 
-	for _, c := range cids {
-		seen, err := w.Dedupe.Seen(ctx, w.Redis, c)
+	for _, f := range found {
+		c := f.CID
+		w.Popularity.ObserveGeo(c, "pubsub", topic, peerID, geo)
+		w.peers.Observe(peerID, nil, c, "pubsub", topic)
+		seen, err := w.seen.Seen(ctx, c)
 		if err != nil {
 			logger.Error("dedupe", "cid", c, "err", err)
 			continue
@@ -103,29 +278,61 @@ func (w *PubSubWorker) handleMessage(ctx context.Context, topic string, payload
 			Data: &ipfsnifferv1.CidDiscoveredData{
 				Cid:          c,
 				Source:       "pubsub",
-				SourceDetail: topic,
+				SourceDetail: sourceDetail(topic, f.Path),
 				PeerId:       peerID,
+				RemoteAddrs:  addrs,
 				ObservedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+				Country:      geo.Country,
+				Asn:          geo.ASN,
+				AsOrg:        geo.Org,
 			},
 		}
 
-		b, err := proto.Marshal(env)
+		b, err := codec.Marshal(env)
 		if err != nil {
 			logger.Error("marshal", "cid", c, "err", err)
 			continue
 		}
 
-		if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectCidDiscovered, b); err != nil {
+		id := internalnats.MsgID("", internalnats.SubjectCidDiscovered, "pubsub", c)
+		if _, err := internalnats.Publish(ctx, w.Bus, internalnats.SubjectCidDiscovered, b, nats.MsgId(id)); err != nil {
 			logger.Error("publish", "subject", internalnats.SubjectCidDiscovered, "cid", c, "err", err)
 			// best-effort DLQ for publish failures
-			_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectCidDiscovered, b)
+			_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectCidDiscovered, id, b, err)
 			continue
 		}
+		stats.newCIDs.Add(1)
 
 		logger.Debug("cid discovered", slog.String("cid", c), slog.String("topic", topic))
 	}
 }
 
+// extract finds the CIDs in payload with the topic's decoder, falling back
+// to scanning it as text when there is none or it fails.
+func (w *PubSubWorker) extract(ctx context.Context, topic string, payload []byte) []decode.Found {
+	if d := w.Decoders.For(topic); d != nil {
+		found, err := d.Decode(payload)
+		if err == nil {
+			return found
+		}
+		logging.FromContext(ctx).Debug("pubsub decode", "topic", topic, "err", err)
+	}
+	var found []decode.Found
+	for _, c := range cidutil.ExtractCIDStrings(string(payload)) {
+		found = append(found, decode.Found{CID: c})
+	}
+	return found
+}
+
+// sourceDetail is the topic, followed by the path a decoder found the CID
+// at, e.g. /fil/msgs/mainnet#$.Message.To.
+func sourceDetail(topic, path string) string {
+	if path == "" {
+		return topic
+	}
+	return topic + "#" + path
+}
+
 func newID() string {
 	return uuid.NewString()
 }
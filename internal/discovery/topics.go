@@ -0,0 +1,253 @@
+package discovery
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/glob"
+	"github.com/Rorical/IPFSniffer/internal/logging"
+)
+
+// TopicDiscovery subscribes the PubSubWorker to the topics connected peers
+// are subscribed to, on top of its configured Topics.
+type TopicDiscovery struct {
+	Enabled bool
+	// Interval is how often the announced topics are scanned.
+	Interval time.Duration
+	// MaxTopics caps the discovered topics subscribed at once; configured
+	// topics do not count against it.
+	MaxTopics int
+	// MinPeers is how many connected peers must be subscribed to a topic
+	// before it is joined.
+	MinPeers int
+	// QuietAfter is how long a discovered topic must go without messages
+	// before it can be evicted for a new one.
+	QuietAfter time.Duration
+	// Include and Exclude filter topic names by glob, where * matches any
+	// run of characters and ? one. An empty Include admits every topic.
+	Include []string
+	Exclude []string
+}
+
+func DefaultTopicDiscovery() TopicDiscovery {
+	return TopicDiscovery{
+		Interval:   time.Minute,
+		MaxTopics:  50,
+		MinPeers:   1,
+		QuietAfter: 10 * time.Minute,
+	}
+}
+
+// TopicStats is what one subscribed topic has yielded since it was joined.
+type TopicStats struct {
+	Topic      string    `json:"topic"`
+	Discovered bool      `json:"discovered"`
+	Since      time.Time `json:"since"`
+	Messages   int64     `json:"messages"`
+	// CIDs counts the CIDs found in messages; NewCIDs those that passed
+	// dedupe and were published.
+	CIDs        int64     `json:"cids"`
+	NewCIDs     int64     `json:"new_cids"`
+	LastMessage time.Time `json:"last_message,omitzero"`
+}
+
+type topicStats struct {
+	since                   time.Time
+	messages, cids, newCIDs atomic.Int64
+	// last is the Unix nanoseconds of the latest message; 0 when none.
+	last atomic.Int64
+}
+
+// active is the last time the topic saw traffic, counting the join.
+func (s *topicStats) active() time.Time {
+	if n := s.last.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return s.since
+}
+
+func (s *topicStats) snapshot(topic string, discovered bool) TopicStats {
+	out := TopicStats{
+		Topic:      topic,
+		Discovered: discovered,
+		Since:      s.since,
+		Messages:   s.messages.Load(),
+		CIDs:       s.cids.Load(),
+		NewCIDs:    s.newCIDs.Load(),
+	}
+	if n := s.last.Load(); n != 0 {
+		out.LastMessage = time.Unix(0, n).UTC()
+	}
+	return out
+}
+
+// topicFilter admits the topics Include matches and Exclude does not.
+type topicFilter struct {
+	include, exclude *regexp.Regexp
+}
+
+func newTopicFilter(d TopicDiscovery) (topicFilter, error) {
+	var f topicFilter
+	var err error
+	if f.include, err = glob.Compile(d.Include...); err != nil {
+		return f, err
+	}
+	if f.exclude, err = glob.Compile(d.Exclude...); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func (f topicFilter) allows(topic string) bool {
+	if topic == "" {
+		return false
+	}
+	if f.include != nil && !f.include.MatchString(topic) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(topic)
+}
+
+// topicCandidate is an announced topic not yet subscribed.
+type topicCandidate struct {
+	topic string
+	peers int
+}
+
+// joined is a discovered topic currently subscribed.
+type joined struct {
+	topic  string
+	active time.Time
+}
+
+// planTopics picks the candidates to join, busiest first, and the
+// discovered topics to evict for them. Once the budget is used, each join
+// evicts the least recently active discovered topic that has been quiet for
+// QuietAfter; when none has, the remaining candidates wait.
+func (d TopicDiscovery) planTopics(cands []topicCandidate, current []joined, now time.Time) (join, evict []string) {
+	cands = slices.Clone(cands)
+	slices.SortStableFunc(cands, func(a, b topicCandidate) int {
+		if a.peers != b.peers {
+			return b.peers - a.peers
+		}
+		return strings.Compare(a.topic, b.topic)
+	})
+	current = slices.Clone(current)
+	slices.SortFunc(current, func(a, b joined) int { return a.active.Compare(b.active) })
+
+	free := d.MaxTopics - len(current)
+	for _, c := range cands {
+		if c.peers < d.MinPeers {
+			continue
+		}
+		if free > 0 {
+			free--
+			join = append(join, c.topic)
+			continue
+		}
+		if len(current) == 0 || now.Sub(current[0].active) < d.QuietAfter {
+			break
+		}
+		evict = append(evict, current[0].topic)
+		current = current[1:]
+		join = append(join, c.topic)
+	}
+	return join, evict
+}
+
+// discoverTopics rescans the announced topics every Interval until ctx is
+// done.
+func (w *PubSubWorker) discoverTopics(ctx context.Context, filter topicFilter) {
+	t := time.NewTicker(w.Discover.Interval)
+	defer t.Stop()
+	for {
+		w.discoverOnce(ctx, filter)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (w *PubSubWorker) discoverOnce(ctx context.Context, filter topicFilter) {
+	logger := logging.FromContext(ctx)
+	ps := w.IPFS.Raw.PubSub
+	tracker := w.IPFS.PubSubTopics
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var cands []topicCandidate
+	for _, topic := range tracker.Topics() {
+		n := len(ps.ListPeers(topic))
+		if n == 0 {
+			// Every peer left; forget it until it is announced again.
+			tracker.Forget(topic)
+			continue
+		}
+		if _, ok := w.subs[topic]; ok || !filter.allows(topic) {
+			continue
+		}
+		cands = append(cands, topicCandidate{topic: topic, peers: n})
+	}
+	var current []joined
+	for topic, s := range w.subs {
+		if s.discovered {
+			current = append(current, joined{topic: topic, active: s.stats.active()})
+		}
+	}
+
+	join, evict := w.Discover.planTopics(cands, current, time.Now())
+	for _, topic := range evict {
+		s := w.subs[topic]
+		s.cancel()
+		delete(w.subs, topic)
+		logger.Info("pubsub topic evicted", "topic", topic, "messages", s.stats.messages.Load(), "new_cids", s.stats.newCIDs.Load())
+	}
+	for _, topic := range join {
+		s, err := w.subscribe(ctx, topic)
+		if err != nil {
+			logger.Error("pubsub discovered topic", "topic", topic, "err", err)
+			continue
+		}
+		s.discovered = true
+		w.subs[topic] = s
+		logger.Info("pubsub topic discovered", "topic", topic)
+	}
+	logger.Debug("pubsub topic scan", "candidates", len(cands), "joined", len(join), "evicted", len(evict), "subscribed", len(w.subs))
+}
+
+// TopicStats returns the stats of every subscribed topic, sorted by topic.
+func (w *PubSubWorker) TopicStats() []TopicStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]TopicStats, 0, len(w.subs))
+	for topic, s := range w.subs {
+		out = append(out, s.stats.snapshot(topic, s.discovered))
+	}
+	slices.SortFunc(out, func(a, b TopicStats) int { return strings.Compare(a.Topic, b.Topic) })
+	return out
+}
+
+// logTopicStats logs TopicStats every StatsInterval until ctx is done.
+func (w *PubSubWorker) logTopicStats(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	t := time.NewTicker(w.StatsInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for _, s := range w.TopicStats() {
+			logger.Info("pubsub topic stats", "topic", s.Topic, "discovered", s.Discovered,
+				"messages", s.Messages, "cids", s.CIDs, "new_cids", s.NewCIDs, "last_message", s.LastMessage)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTopicFilter(t *testing.T) {
+	f, err := newTopicFilter(TopicDiscovery{
+		Include: []string{"/fil/*", "ipfs.pubsub.*", "chat-??"},
+		Exclude: []string{"/fil/blocks/*"},
+	})
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	for topic, want := range map[string]bool{
+		"/fil/msgs/mainnet":         true,
+		"/fil/blocks/mainnet":       false,
+		"ipfs.pubsub.chat":          true,
+		"chat-en":                   true,
+		"chat-eng":                  false,
+		"other":                     false,
+		"":                          false,
+		"ipfs.pubsub.chat/../other": true,
+	} {
+		if got := f.allows(topic); got != want {
+			t.Fatalf("allows(%q) = %v, want %v", topic, got, want)
+		}
+	}
+
+	all, err := newTopicFilter(TopicDiscovery{Exclude: []string{"*test*"}})
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	if !all.allows("anything") || all.allows("testnet") {
+		t.Fatalf("empty include should admit everything not excluded")
+	}
+}
+
+func TestPlanTopics_Budget(t *testing.T) {
+	d := TopicDiscovery{MaxTopics: 3, MinPeers: 2, QuietAfter: 10 * time.Minute}
+	now := time.Now()
+	join, evict := d.planTopics(
+		[]topicCandidate{{"a", 2}, {"b", 9}, {"c", 1}, {"d", 5}},
+		[]joined{{"x", now}},
+		now)
+	if !slices.Equal(join, []string{"b", "d"}) || len(evict) != 0 {
+		t.Fatalf("join = %v, evict = %v", join, evict)
+	}
+}
+
+func TestPlanTopics_EvictsQuietest(t *testing.T) {
+	d := TopicDiscovery{MaxTopics: 3, MinPeers: 1, QuietAfter: 10 * time.Minute}
+	now := time.Now()
+	current := []joined{
+		{"busy", now.Add(-time.Minute)},
+		{"stale", now.Add(-time.Hour)},
+		{"quiet", now.Add(-20 * time.Minute)},
+	}
+	join, evict := d.planTopics([]topicCandidate{{"n1", 4}, {"n2", 3}, {"n3", 2}}, current, now)
+	if !slices.Equal(join, []string{"n1", "n2"}) || !slices.Equal(evict, []string{"stale", "quiet"}) {
+		t.Fatalf("join = %v, evict = %v", join, evict)
+	}
+}
+
+func TestTopicStats_Snapshot(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	s := &topicStats{since: since}
+	if !s.active().Equal(since) {
+		t.Fatalf("active should fall back to the join time")
+	}
+	s.messages.Add(3)
+	s.cids.Add(5)
+	s.newCIDs.Add(2)
+	s.last.Store(since.Add(time.Minute).UnixNano())
+	got := s.snapshot("t", true)
+	if got.Messages != 3 || got.CIDs != 5 || got.NewCIDs != 2 || !got.Discovered || !got.LastMessage.Equal(since.Add(time.Minute)) {
+		t.Fatalf("snapshot: %+v", got)
+	}
+}
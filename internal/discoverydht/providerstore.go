@@ -8,12 +8,14 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
-	"github.com/Rorical/IPFSniffer/internal/redis"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
 
 	nats "github.com/nats-io/nats.go"
-	goredis "github.com/redis/go-redis/v9"
 
 	records "github.com/libp2p/go-libp2p-kad-dht/records"
 	peer "github.com/libp2p/go-libp2p/core/peer"
@@ -22,9 +24,14 @@ import (
 type PublishingProviderStore struct {
 	Inner records.ProviderStore
 
-	NATS   nats.JetStreamContext
-	Redis  *goredis.Client
-	Dedupe redis.Dedupe
+	NATS    nats.JetStreamContext
+	Deduper dedupe.Deduper
+	// Popularity counts every observation, duplicates included. Optional.
+	Popularity *popularity.Tracker
+	// Peers publishes the providing peer. Optional.
+	Peers *peers.Observer
+	// GeoIP tags records with the provider's location. Optional.
+	GeoIP *geoip.DB
 }
 
 func (s *PublishingProviderStore) AddProvider(ctx context.Context, key []byte, prov peer.AddrInfo) error {
@@ -34,13 +41,17 @@ func (s *PublishingProviderStore) AddProvider(ctx context.Context, key []byte, p
 	if s.NATS == nil {
 		return fmt.Errorf("nats required")
 	}
-	if s.Redis == nil {
-		return fmt.Errorf("redis required")
+	if s.Deduper == nil {
+		return fmt.Errorf("deduper required")
 	}
 
 	cidStr := mhToCIDString(key)
 	if cidStr != "" {
-		seen, err := s.Dedupe.Seen(ctx, s.Redis, cidStr)
+		addrs := peerAddrsToStrings(prov.Addrs)
+		geo := s.GeoIP.Lookup(addrs)
+		s.Popularity.ObserveGeo(cidStr, "dht", "provider_add", prov.ID.String(), geo)
+		s.Peers.Observe(prov.ID.String(), addrs, cidStr, "dht", "provider_add")
+		seen, err := s.Deduper.Seen(ctx, cidStr)
 		if err == nil && !seen {
 			env := &ipfsnifferv1.CidDiscovered{
 				V:  1,
@@ -51,13 +62,17 @@ func (s *PublishingProviderStore) AddProvider(ctx context.Context, key []byte, p
 					Source:       "dht",
 					SourceDetail: "provider_add",
 					PeerId:       prov.ID.String(),
-					RemoteAddrs:  peerAddrsToStrings(prov.Addrs),
+					RemoteAddrs:  addrs,
 					ObservedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+					Country:      geo.Country,
+					Asn:          geo.ASN,
+					AsOrg:        geo.Org,
 				},
 			}
 			b, merr := codec.Marshal(env)
 			if merr == nil {
-				_, _ = internalnats.Publish(ctx, s.NATS, internalnats.SubjectCidDiscovered, b)
+				_, _ = internalnats.Publish(ctx, s.NATS, internalnats.SubjectCidDiscovered, b,
+					nats.MsgId(internalnats.MsgID("", internalnats.SubjectCidDiscovered, "dht", cidStr)))
 			}
 		}
 	}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
 	"github.com/Rorical/IPFSniffer/internal/dhtsniff"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
 	"github.com/Rorical/IPFSniffer/internal/ipnssniff"
 	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/peers"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	"github.com/Rorical/IPFSniffer/internal/redis"
 
 	ipfs "github.com/Rorical/IPFSniffer/internal/kubo"
@@ -29,15 +33,23 @@ type Worker struct {
 	NATS   nats.JetStreamContext
 	Redis  *goredis.Client
 	Dedupe redis.Dedupe
+	// Dedupers picks the dedupe backend per prefix; nil uses Redis. Optional.
+	Dedupers *dedupe.Registry
+	// Popularity counts provider records, duplicates included. Datastore
+	// writes are not counted, as every provider record is also one. Optional.
+	Popularity *popularity.Tracker
+	// PeerDedupe, when its Prefix is set, publishes peer.observed once per
+	// new peer/CID pair. Optional.
+	PeerDedupe redis.Dedupe
+	// GeoIP tags provider and peer records with the provider's location.
+	// Optional.
+	GeoIP *geoip.DB
 }
 
 func (w *Worker) Run(ctx context.Context) error {
 	if w.NATS == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
-	if w.Redis == nil {
-		return fmt.Errorf("redis required")
-	}
 	if w.RepoPath == "" {
 		return fmt.Errorf("repoPath required")
 	}
@@ -48,6 +60,27 @@ func (w *Worker) Run(ctx context.Context) error {
 	if w.Dedupe.TTL == 0 {
 		w.Dedupe.TTL = 24 * time.Hour
 	}
+	dedupers := dedupe.Default(w.Dedupers, w.Redis)
+	providerSeen, err := dedupers.For(w.Dedupe.Prefix, w.Dedupe.TTL)
+	if err != nil {
+		return err
+	}
+	// Datastore writes run inside DHT operations, which makes this prefix
+	// the one most worth putting behind a filter or on local disk.
+	datastoreSeen, err := dedupers.For(w.Dedupe.Prefix+":dhtds", w.Dedupe.TTL)
+	if err != nil {
+		return err
+	}
+
+	var peerObserver *peers.Observer
+	if w.PeerDedupe.Prefix != "" {
+		d, err := dedupers.For(w.PeerDedupe.Prefix, w.PeerDedupe.TTL)
+		if err != nil {
+			return err
+		}
+		peerObserver = &peers.Observer{Bus: w.NATS, Deduper: d, GeoIP: w.GeoIP}
+		go peerObserver.Run(ctx)
+	}
 
 	logger := logging.FromContext(ctx)
 	logger.Info("discovery-dht starting")
@@ -55,7 +88,7 @@ func (w *Worker) Run(ctx context.Context) error {
 	routingOpt := func(args libp2p.RoutingOptionArgs) (routing.Routing, error) {
 		ds := &dhtsniff.PublishingDatastore{
 			Inner: args.Datastore,
-			Sniff: &ipnssniff.Sniffer{NATS: w.NATS, Redis: w.Redis, Dedupe: redis.Dedupe{Prefix: w.Dedupe.Prefix + ":dhtds", TTL: w.Dedupe.TTL}},
+			Sniff: &ipnssniff.Sniffer{NATS: w.NATS, Deduper: datastoreSeen},
 		}
 
 		pm, err := records.NewProviderManager(args.Ctx, args.Host.ID(), args.Host.Peerstore(), ds)
@@ -63,11 +96,17 @@ func (w *Worker) Run(ctx context.Context) error {
 			return nil, fmt.Errorf("provider manager: %w", err)
 		}
 
+		if peerObserver != nil {
+			peerObserver.Host = args.Host
+		}
+
 		wrapped := &PublishingProviderStore{
-			Inner:  pm,
-			NATS:   w.NATS,
-			Redis:  w.Redis,
-			Dedupe: w.Dedupe,
+			Inner:      pm,
+			NATS:       w.NATS,
+			Deduper:    providerSeen,
+			Popularity: w.Popularity,
+			Peers:      peerObserver,
+			GeoIP:      w.GeoIP,
 		}
 
 		dhtOpts := []dht.Option{
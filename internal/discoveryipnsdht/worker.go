@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
 	"github.com/Rorical/IPFSniffer/internal/dhtsniff"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
 	"github.com/Rorical/IPFSniffer/internal/ipnssniff"
 	ipfs "github.com/Rorical/IPFSniffer/internal/kubo"
 	"github.com/Rorical/IPFSniffer/internal/logging"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	"github.com/Rorical/IPFSniffer/internal/redis"
 
 	"github.com/ipfs/kubo/core/node/libp2p"
@@ -37,15 +40,18 @@ type Worker struct {
 	NATS   nats.JetStreamContext
 	Redis  *goredis.Client
 	Dedupe redis.Dedupe
+	// Dedupers picks the dedupe backend per prefix; nil uses Redis. Optional.
+	Dedupers *dedupe.Registry
+	// Popularity counts every observation, duplicates included. Optional.
+	Popularity *popularity.Tracker
+	// Names registers the IPNS names and records sniffed. Optional.
+	Names *ipnsreg.Registry
 }
 
 func (w *Worker) Run(ctx context.Context) error {
 	if w.NATS == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
-	if w.Redis == nil {
-		return fmt.Errorf("redis required")
-	}
 	if w.RepoPath == "" {
 		return fmt.Errorf("repoPath required")
 	}
@@ -55,10 +61,17 @@ func (w *Worker) Run(ctx context.Context) error {
 	if w.Dedupe.TTL == 0 {
 		w.Dedupe.TTL = 24 * time.Hour
 	}
+	datastoreSeen, err := dedupe.Default(w.Dedupers, w.Redis).For(w.Dedupe.Prefix+":ipnsdhtds", w.Dedupe.TTL)
+	if err != nil {
+		return err
+	}
 
 	logger := logging.FromContext(ctx)
 	logger.Info("discovery-ipns-dht starting")
 
+	sniff := &ipnssniff.Sniffer{NATS: w.NATS, Deduper: datastoreSeen, Popularity: w.Popularity, Names: w.Names}
+	go sniff.Run(ctx)
+
 	routingOpt := func(args libp2p.RoutingOptionArgs) (routing.Routing, error) {
 		// We cannot wrap the ipns validator: go-libp2p-kad-dht requires the
 		// /ipns validator to be of type ipns.Validator when using the /ipfs DHT.
@@ -66,7 +79,7 @@ func (w *Worker) Run(ctx context.Context) error {
 
 		ds := &dhtsniff.PublishingDatastore{
 			Inner: args.Datastore,
-			Sniff: &ipnssniff.Sniffer{NATS: w.NATS, Redis: w.Redis, Dedupe: redis.Dedupe{Prefix: w.Dedupe.Prefix + ":ipnsdhtds", TTL: w.Dedupe.TTL}},
+			Sniff: sniff,
 		}
 
 		dhtOpts := []dht.Option{
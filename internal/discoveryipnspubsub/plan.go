@@ -0,0 +1,40 @@
+package discoveryipnspubsub
+
+import (
+	"slices"
+	"time"
+)
+
+// followed is a name followed from the Registry ranking.
+type followed struct {
+	name   string
+	active time.Time
+}
+
+// planNames picks the ranked names to follow, most active first, and the
+// followed names to drop: those no longer ranked that have gone StaleAfter
+// without an update. Followed names still ranked, or updated recently,
+// keep their place, so at most MaxSubscriptions are followed once the
+// dropped ones are gone.
+func (w *Worker) planNames(ranked []string, current []followed, now time.Time) (follow, drop []string) {
+	kept := map[string]bool{}
+	for _, c := range current {
+		if !slices.Contains(ranked, c.name) && now.Sub(c.active) >= w.StaleAfter {
+			drop = append(drop, c.name)
+			continue
+		}
+		kept[c.name] = true
+	}
+	n := len(kept)
+	for _, name := range ranked {
+		if n >= w.MaxSubscriptions {
+			break
+		}
+		if kept[name] {
+			continue
+		}
+		follow = append(follow, name)
+		n++
+	}
+	return follow, drop
+}
@@ -0,0 +1,31 @@
+package discoveryipnspubsub
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlanNames_Budget(t *testing.T) {
+	w := &Worker{MaxSubscriptions: 3, StaleAfter: time.Hour}
+	now := time.Now()
+	follow, drop := w.planNames([]string{"a", "x", "b", "c"}, []followed{{"x", now}}, now)
+	if !slices.Equal(follow, []string{"a", "b"}) || len(drop) != 0 {
+		t.Fatalf("follow = %v, drop = %v", follow, drop)
+	}
+}
+
+func TestPlanNames_DropsStale(t *testing.T) {
+	w := &Worker{MaxSubscriptions: 3, StaleAfter: time.Hour}
+	now := time.Now()
+	current := []followed{
+		{"ranked", now.Add(-2 * time.Hour)},
+		{"recent", now.Add(-time.Minute)},
+		{"stale", now.Add(-2 * time.Hour)},
+	}
+	follow, drop := w.planNames([]string{"n1", "ranked", "n2"}, current, now)
+	// "recent" holds its place although it is no longer ranked.
+	if !slices.Equal(follow, []string{"n1"}) || !slices.Equal(drop, []string{"stale"}) {
+		t.Fatalf("follow = %v, drop = %v", follow, drop)
+	}
+}
@@ -1,34 +1,45 @@
 package discoveryipnspubsub
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
 	"github.com/Rorical/IPFSniffer/internal/ipnssniff"
 	"github.com/Rorical/IPFSniffer/internal/logging"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	"github.com/Rorical/IPFSniffer/internal/redis"
 
+	boxoipns "github.com/ipfs/boxo/ipns"
 	psrouter "github.com/libp2p/go-libp2p-pubsub-router"
 
 	nats "github.com/nats-io/nats.go"
 	goredis "github.com/redis/go-redis/v9"
 )
 
-// Worker subscribes to IPNS pubsub record topics by actively querying the IPNS DHT namespace.
+// checkEvery is how often the PSRouter is asked for the latest record of
+// each followed name.
+const checkEvery = 15 * time.Second
+
+// Worker follows IPNS names over pubsub and publishes the /ipfs values of
+// the records it receives as cid.discovered.
 //
 // IMPORTANT: IPNS pubsub is per-name. There is no global IPNS pubsub feed.
 // The only way to get IPNS pubsub messages is to subscribe to specific name topics.
-// In Kubo, subscriptions are created on first IPNS resolution.
-//
-// This worker implements a pragmatic strategy:
-//   - periodically performs random /ipns lookups (configurable list) via the routing system
-//     to force subscriptions in the PSRouter
-//   - listens for updates via SearchValue and publishes /ipfs values as cid.discovered
 //
-// This is still limited, but can provide a steadier stream than arbitrary app pubsub topics
-// if you seed it with known-active IPNS names.
+// The worker follows the seed Names and, when Registry is set, the names
+// the DHT sniffers observe, most active first, up to MaxSubscriptions. A
+// followed name keeps its topic subscribed in the PSRouter for as long as
+// it is followed: SearchValue waits for its first record, and the later
+// ones, which the PSRouter stores as they arrive, are read back every
+// checkEvery. Every Poll the ranking is read again.
 type Worker struct {
 	PSRouter *psrouter.PubsubValueStore
 
@@ -36,12 +47,56 @@ type Worker struct {
 	Redis *goredis.Client
 
 	Dedupe redis.Dedupe
+	// Dedupers picks the dedupe backend per prefix; nil uses Redis. Optional.
+	Dedupers *dedupe.Registry
+	// Popularity counts every observation, duplicates included. Optional.
+	Popularity *popularity.Tracker
 
+	// Names are always followed.
 	Names []string
-	Poll  time.Duration
+	// Poll is how often the followed names are planned.
+	Poll time.Duration
+
+	// Policies, when set, replaces Names live from the
+	// policy.KeyIPNSPubSubNames key. Optional.
+	Policies nats.KeyValue
+
+	// Registry ranks the observed names and records the records received.
+	// Optional.
+	Registry *ipnsreg.Registry
+	// MaxSubscriptions caps the names followed from Registry; Names do not
+	// count against it.
+	MaxSubscriptions int
+	// StaleAfter is how long a name that dropped out of the ranking is
+	// still followed without an update.
+	StaleAfter time.Duration
 
 	Durable    string
 	MaxDeliver int
+
+	names atomic.Pointer[[]string]
+	sn    *ipnssniff.Sniffer
+
+	mu   sync.Mutex
+	subs map[string]*subscription
+}
+
+// subscription is one followed name.
+type subscription struct {
+	name   boxoipns.Name
+	since  time.Time
+	cancel context.CancelFunc
+	done   chan struct{}
+	// last is the Unix nanoseconds of the latest update; 0 when none.
+	last atomic.Int64
+}
+
+// active is the last time the name was updated, counting the subscription.
+func (s *subscription) active() time.Time {
+	if n := s.last.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return s.since
 }
 
 func (w *Worker) Run(ctx context.Context) error {
@@ -51,9 +106,6 @@ func (w *Worker) Run(ctx context.Context) error {
 	if w.NATS == nil {
 		return fmt.Errorf("nats required")
 	}
-	if w.Redis == nil {
-		return fmt.Errorf("redis required")
-	}
 	if w.Dedupe.Prefix == "" {
 		w.Dedupe.Prefix = "ipfsniffer:seen:ipns:pubsub"
 	}
@@ -63,53 +115,193 @@ func (w *Worker) Run(ctx context.Context) error {
 	if w.Poll == 0 {
 		w.Poll = 10 * time.Minute
 	}
+	if w.StaleAfter == 0 {
+		w.StaleAfter = time.Hour
+	}
+	seen, err := dedupe.Default(w.Dedupers, w.Redis).For(w.Dedupe.Prefix, w.Dedupe.TTL)
+	if err != nil {
+		return err
+	}
 
 	logger := logging.FromContext(ctx)
-	logger.Info("discovery-ipns-pubsub started", "names", len(w.Names), "poll", w.Poll)
+	logger.Info("discovery-ipns-pubsub started", "names", len(w.Names), "poll", w.Poll,
+		"auto", w.Registry != nil, "max_subscriptions", w.MaxSubscriptions)
 
-	sn := &ipnssniff.Sniffer{NATS: w.NATS, Redis: w.Redis, Dedupe: w.Dedupe}
+	w.sn = &ipnssniff.Sniffer{NATS: w.NATS, Deduper: seen, Popularity: w.Popularity, Names: w.Registry}
+	go w.sn.Run(ctx)
+	w.subs = map[string]*subscription{}
+	defer w.unfollowAll()
 
-	runOne := func(ctx context.Context, name string) {
-		name = strings.TrimSpace(name)
-		name = strings.TrimPrefix(name, "/ipns/")
-		if name == "" {
-			return
+	// A policy change triggers an immediate plan with the new names.
+	w.names.Store(&w.Names)
+	changed := make(chan struct{}, 1)
+	if w.Policies != nil {
+		err := policy.Watch(ctx, w.Policies, policy.KeyIPNSPubSubNames, func(names *[]string, _ uint64) {
+			if names == nil {
+				names = &w.Names
+			}
+			w.names.Store(names)
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			return err
 		}
+		// The startup plan below covers the current value.
+		select {
+		case <-changed:
+		default:
+		}
+	}
 
-		key := "/ipns/" + name
-		cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
+	t := time.NewTicker(w.Poll)
+	defer t.Stop()
+	for {
+		w.plan(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-t.C:
+		}
+	}
+}
 
-		ch, err := w.PSRouter.SearchValue(cctx, key)
+// plan follows the seed names and the top of the ranking, and drops the
+// followed names that went stale.
+func (w *Worker) plan(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+
+	seeds := map[string]boxoipns.Name{}
+	for _, s := range *w.names.Load() {
+		name, err := boxoipns.NameFromString(strings.TrimPrefix(strings.TrimSpace(s), "/ipns/"))
 		if err != nil {
-			return
+			logger.Debug("discovery-ipns-pubsub: skipping seed", "name", s, "err", err)
+			continue
 		}
-		select {
-		case val := <-ch:
-			if ipfsPath, ok := ipnssniff.ExtractIPFSPathFromIPNSRecord(val); ok {
-				_ = sn.PublishCID(ctx, ipfsPath, "ipns-pubsub", "search_value", "")
-			}
-		case <-cctx.Done():
+		seeds[name.String()] = name
+	}
+	var ranked []string
+	if w.Registry != nil && w.MaxSubscriptions > 0 {
+		var err error
+		if ranked, err = w.Registry.Active(ctx, w.MaxSubscriptions); err != nil {
+			logger.Warn("discovery-ipns-pubsub: rank names", "err", err)
 			return
 		}
 	}
 
-	// Kick once on startup.
-	for _, name := range w.Names {
-		runOne(ctx, name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key, name := range seeds {
+		if _, ok := w.subs[key]; !ok {
+			w.follow(ctx, key, name)
+		}
+	}
+	var current []followed
+	for key, s := range w.subs {
+		if _, ok := seeds[key]; ok {
+			continue
+		}
+		// Seeds removed from the list are ranked like any other name.
+		current = append(current, followed{name: key, active: s.active()})
 	}
 
-	// Poll to keep some subscriptions alive and harvest latest values.
-	t := time.NewTicker(w.Poll)
+	follow, drop := w.planNames(ranked, current, time.Now())
+	for _, key := range drop {
+		w.unfollow(ctx, key)
+	}
+	for _, key := range follow {
+		name, err := boxoipns.NameFromString(key)
+		if err != nil {
+			continue
+		}
+		w.follow(ctx, key, name)
+	}
+	if len(follow) > 0 || len(drop) > 0 {
+		logger.Info("discovery-ipns-pubsub: names planned", "followed", len(w.subs), "new", len(follow), "dropped", len(drop))
+	}
+}
+
+// follow subscribes to name. It must be called with mu held.
+func (w *Worker) follow(ctx context.Context, key string, name boxoipns.Name) {
+	sctx, cancel := context.WithCancel(ctx)
+	s := &subscription{name: name, since: time.Now(), cancel: cancel, done: make(chan struct{})}
+	w.subs[key] = s
+	go func() {
+		defer close(s.done)
+		w.harvest(sctx, s)
+	}()
+}
+
+// unfollow cancels the subscription to key and leaves its topic. It must be
+// called with mu held.
+func (w *Worker) unfollow(ctx context.Context, key string) {
+	s, ok := w.subs[key]
+	if !ok {
+		return
+	}
+	s.cancel()
+	<-s.done
+	delete(w.subs, key)
+	if _, err := w.PSRouter.Cancel(string(s.name.RoutingKey())); err != nil {
+		logging.FromContext(ctx).Debug("discovery-ipns-pubsub: leave topic", "name", key, "err", err)
+	}
+}
+
+func (w *Worker) unfollowAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key := range w.subs {
+		w.unfollow(context.Background(), key)
+	}
+}
+
+// harvest handles every record of s's name until ctx is done.
+func (w *Worker) harvest(ctx context.Context, s *subscription) {
+	logger := logging.FromContext(ctx).With("name", s.name.String())
+	key := string(s.name.RoutingKey())
+
+	ch, err := w.PSRouter.SearchValue(ctx, key)
+	if err != nil {
+		logger.Warn("discovery-ipns-pubsub: subscribe", "err", err)
+		return
+	}
+	// The channel yields at most one record and closes; draining it also
+	// waits out the PSRouter's cleanup when ctx is done first.
+	var last []byte
+	for val := range ch {
+		last = val
+	}
+	if last != nil {
+		w.handle(ctx, s, last)
+	}
+
+	t := time.NewTicker(checkEvery)
 	defer t.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return
 		case <-t.C:
-			for _, name := range w.Names {
-				runOne(ctx, name)
-			}
 		}
+		val, err := w.PSRouter.GetValue(ctx, key)
+		if err != nil || bytes.Equal(val, last) {
+			continue
+		}
+		last = val
+		w.handle(ctx, s, val)
+	}
+}
+
+// handle registers a record of s's name and publishes its /ipfs value.
+func (w *Worker) handle(ctx context.Context, s *subscription, val []byte) {
+	s.last.Store(time.Now().UnixNano())
+	namePath := "/ipns/" + s.name.String()
+	w.sn.ObserveName(namePath, val)
+	if ipfsPath, ok := ipnssniff.ExtractIPFSPathFromIPNSRecord(val); ok {
+		_ = w.sn.PublishCID(ctx, ipfsPath, "ipns-pubsub", "search_value", "")
 	}
 }
@@ -0,0 +1,151 @@
+package dlq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Replayer periodically re-publishes DLQ entries to their original subject.
+//
+// Entries younger than MinAge are left alone so a failing dependency has time
+// to recover. Entries that have already been replayed MaxReplays times are
+// moved to the quarantine stream instead.
+type Replayer struct {
+	NATS nats.JetStreamContext
+
+	Interval   time.Duration
+	MinAge     time.Duration
+	MaxReplays int
+
+	// MaxPerSubject caps how many entries are handled per subject per pass.
+	MaxPerSubject int
+	// Caps overrides MaxPerSubject for individual subjects; a cap of 0
+	// disables replay for that subject.
+	Caps map[string]int
+}
+
+type action int
+
+const (
+	actionWait action = iota
+	actionReplay
+	actionQuarantine
+)
+
+func (r *Replayer) Run(ctx context.Context) error {
+	if r.NATS == nil {
+		return fmt.Errorf("nats jetstream required")
+	}
+	if r.Interval <= 0 {
+		r.Interval = time.Minute
+	}
+	if r.MinAge < 0 {
+		r.MinAge = 0
+	}
+	if r.MaxReplays <= 0 {
+		r.MaxReplays = 3
+	}
+	if r.MaxPerSubject <= 0 {
+		r.MaxPerSubject = 100
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("dlq replayer started", "interval", r.Interval, "min_age", r.MinAge, "max_replays", r.MaxReplays, "max_per_subject", r.MaxPerSubject)
+
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+
+	for {
+		r.pass(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Replayer) pass(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	for _, subject := range r.subjects() {
+		limit := r.capFor(subject)
+		if limit <= 0 {
+			continue
+		}
+		replayed, quarantined, err := r.replaySubject(ctx, subject, limit)
+		if err != nil {
+			logger.Error("dlq replay", "subject", subject, "err", err)
+		}
+		if replayed > 0 || quarantined > 0 {
+			logger.Info("dlq replay", "subject", subject, "replayed", replayed, "quarantined", quarantined)
+		}
+	}
+}
+
+func (r *Replayer) replaySubject(ctx context.Context, subject string, limit int) (replayed, quarantined int, err error) {
+	stream, err := internalnats.DLQStreamName(subject)
+	if err != nil {
+		return 0, 0, err
+	}
+	msgs, err := internalnats.ReadDLQ(ctx, r.NATS, subject, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	now := time.Now()
+	for _, m := range msgs {
+		switch r.decide(m, now) {
+		case actionWait:
+			// DLQ streams are append-only, so everything after this is newer.
+			return replayed, quarantined, nil
+		case actionQuarantine:
+			if err := internalnats.QuarantineDLQMsg(ctx, r.NATS, stream, m); err != nil {
+				return replayed, quarantined, err
+			}
+			quarantined++
+		case actionReplay:
+			if err := internalnats.ReplayDLQMsg(ctx, r.NATS, stream, m); err != nil {
+				return replayed, quarantined, err
+			}
+			replayed++
+		}
+	}
+	return replayed, quarantined, nil
+}
+
+func (r *Replayer) decide(m internalnats.DLQMessage, now time.Time) action {
+	if now.Sub(m.Time) < r.MinAge {
+		return actionWait
+	}
+	if internalnats.Replays(m.Header) >= r.MaxReplays {
+		return actionQuarantine
+	}
+	return actionReplay
+}
+
+// subjects are the DLQs the replayer watches. Streaming subjects are
+// request/response traffic whose requester has long since given up.
+func (r *Replayer) subjects() []string {
+	out := make([]string, 0, len(internalnats.PipelineSubjects))
+	for _, s := range internalnats.PipelineSubjects {
+		if s == internalnats.SubjectStreamGet || s == internalnats.SubjectStreamChunkPrefix+"*" {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (r *Replayer) capFor(subject string) int {
+	if n, ok := r.Caps[subject]; ok {
+		return n
+	}
+	return r.MaxPerSubject
+}
@@ -0,0 +1,45 @@
+package dlq
+
+import (
+	"testing"
+	"time"
+
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestDecide(t *testing.T) {
+	r := &Replayer{MinAge: time.Minute, MaxReplays: 2}
+	now := time.Now()
+
+	fresh := internalnats.DLQMessage{Time: now.Add(-10 * time.Second)}
+	if got := r.decide(fresh, now); got != actionWait {
+		t.Fatalf("fresh: %v", got)
+	}
+
+	old := internalnats.DLQMessage{Time: now.Add(-time.Hour)}
+	if got := r.decide(old, now); got != actionReplay {
+		t.Fatalf("old: %v", got)
+	}
+
+	poison := internalnats.DLQMessage{Time: now.Add(-time.Hour), Header: nats.Header{internalnats.HeaderReplays: []string{"2"}}}
+	if got := r.decide(poison, now); got != actionQuarantine {
+		t.Fatalf("poison: %v", got)
+	}
+}
+
+func TestCapsAndSubjects(t *testing.T) {
+	r := &Replayer{MaxPerSubject: 50, Caps: map[string]int{internalnats.SubjectFetchRequest: 0}}
+	if r.capFor(internalnats.SubjectFetchRequest) != 0 {
+		t.Fatalf("override ignored")
+	}
+	if r.capFor(internalnats.SubjectDocReady) != 50 {
+		t.Fatalf("default cap")
+	}
+	for _, s := range r.subjects() {
+		if s == internalnats.SubjectStreamGet {
+			t.Fatalf("streaming subjects should not be replayed")
+		}
+	}
+}
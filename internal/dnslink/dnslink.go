@@ -0,0 +1,167 @@
+// Package dnslink resolves DNSLink domains and keeps the watchlist of
+// domains that are re-resolved on a schedule.
+//
+// A DNSLink domain publishes its content path in a TXT record on
+// _dnslink.<domain> (or, for older setups, on the domain itself) of the form
+// dnslink=/ipfs/<cid> or dnslink=/ipns/<name>. Candidate domains come from
+// the records themselves, when one points at another domain, and from the
+// hostnames found in fetched text and HTML.
+package dnslink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Source is the cid.discovered source of candidate domains found in
+// content.
+const Source = "dnslink"
+
+// ErrNoRecord reports a domain without a DNSLink record.
+var ErrNoRecord = errors.New("no dnslink record")
+
+type Config struct {
+	Enabled bool
+	// Server is the DNS server (host:port) TXT records are looked up on;
+	// empty uses the system resolver.
+	Server string
+	// Prefix namespaces the Redis keys.
+	Prefix string
+	// Interval is how often each watched domain is re-resolved.
+	Interval time.Duration
+	// MaxDomains caps the watchlist.
+	MaxDomains int
+	// HostDedupeTTL is how long a hostname found in content is not looked
+	// up again.
+	HostDedupeTTL time.Duration
+	// DiscoverHosts has the extractor publish the hostnames it finds as
+	// candidates.
+	DiscoverHosts bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:       true,
+		Prefix:        "ipfsniffer:dnslink",
+		Interval:      time.Hour,
+		MaxDomains:    10000,
+		HostDedupeTTL: 7 * 24 * time.Hour,
+		DiscoverHosts: true,
+	}
+}
+
+// Resolver looks up DNSLink records.
+type Resolver struct {
+	DNS *net.Resolver
+}
+
+// NewResolver returns a Resolver querying server (host:port), or the system
+// resolver when server is empty.
+func NewResolver(server string) *Resolver {
+	if server == "" {
+		return &Resolver{DNS: net.DefaultResolver}
+	}
+	return &Resolver{DNS: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}}
+}
+
+// Lookup returns the DNSLink path of domain: /ipfs/... or /ipns/...,
+// possibly with a subpath.
+func (r *Resolver) Lookup(ctx context.Context, domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	var lastErr error
+	for _, name := range []string{"_dnslink." + domain, domain} {
+		txts, err := r.DNS.LookupTXT(ctx, name)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				continue
+			}
+			lastErr = err
+			continue
+		}
+		if v, ok := Parse(txts); ok {
+			return v, nil
+		}
+	}
+	if lastErr != nil {
+		return "", fmt.Errorf("dnslink lookup %s: %w", domain, lastErr)
+	}
+	return "", fmt.Errorf("dnslink lookup %s: %w", domain, ErrNoRecord)
+}
+
+// Parse picks the DNSLink path out of TXT record values. When several are
+// published the lexically first wins, as the DNSLink spec asks.
+func Parse(txts []string) (string, bool) {
+	var paths []string
+	for _, txt := range txts {
+		v, ok := strings.CutPrefix(strings.TrimSpace(txt), "dnslink=")
+		if !ok {
+			continue
+		}
+		ns, rest, _ := strings.Cut(strings.TrimPrefix(v, "/"), "/")
+		if (ns == "ipfs" || ns == "ipns") && rest != "" && rest[0] != '/' && strings.HasPrefix(v, "/") {
+			paths = append(paths, v)
+		}
+	}
+	if len(paths) == 0 {
+		return "", false
+	}
+	return slices.Min(paths), true
+}
+
+// IsDomain reports whether name is a DNS name that can carry a DNSLink, as
+// opposed to an IPNS key or an IP address.
+func IsDomain(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 253 || !strings.Contains(name, ".") {
+		return false
+	}
+	if _, err := netip.ParseAddr(name); err == nil {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	for _, l := range labels {
+		if !validLabel(l) {
+			return false
+		}
+	}
+	tld := labels[len(labels)-1]
+	if strings.HasPrefix(tld, "xn--") {
+		return true
+	}
+	if len(tld) < 2 {
+		return false
+	}
+	for _, c := range tld {
+		if !isLetter(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func validLabel(l string) bool {
+	if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+		return false
+	}
+	for _, c := range l {
+		if !isLetter(c) && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c rune) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
@@ -0,0 +1,127 @@
+package dnslink
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		txts []string
+		want string
+	}{
+		{[]string{"v=spf1 -all", "dnslink=/ipfs/bafyb"}, "/ipfs/bafyb"},
+		{[]string{"dnslink=/ipns/b.example.com", "dnslink=/ipfs/bafyc/docs"}, "/ipfs/bafyc/docs"},
+		{[]string{"dnslink=/ipfs/", "dnslink=ipfs/bafy", "dnslink=/http/x"}, ""},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		got, ok := Parse(c.txts)
+		if got != c.want || ok != (c.want != "") {
+			t.Errorf("Parse(%q) = %q, %v; want %q", c.txts, got, ok, c.want)
+		}
+	}
+}
+
+func TestIsDomain(t *testing.T) {
+	for name, want := range map[string]bool{
+		"docs.ipfs.tech":            true,
+		"en.wikipedia-on-ipfs.org.": true,
+		"xn--80ak6aa92e.xn--p1ai":   true,
+		"k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8": false,
+		"10.0.0.1":   false,
+		"index.html": true,
+		"a.b1":       false,
+		"-bad.com":   false,
+		"":           false,
+	} {
+		if got := IsDomain(name); got != want {
+			t.Errorf("IsDomain(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestHostnames(t *testing.T) {
+	text := `<a href="https://Blog.Example.org/post?x=1">post</a>
+see http://user@example.net:8080/ and /ipns/docs.ipfs.tech/guide,
+ipns://app.example.com, https://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi.ipfs.dweb.link/ and
+https://10.1.2.3/ plus /ipns/k51qzi5uqu5dl and https://blog.example.org again`
+	got := Hostnames(text)
+	want := []string{"blog.example.org", "example.net", "docs.ipfs.tech", "app.example.com"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Hostnames = %q, want %q", got, want)
+	}
+}
+
+// serveTXT answers TXT queries from records on a local UDP socket, standing
+// in for a DNS server.
+func serveTXT(t *testing.T, records map[string][]string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			if txts, ok := records[q.Name.String()]; ok {
+				resp.RCode = dnsmessage.RCodeSuccess
+				if q.Type == dnsmessage.TypeTXT {
+					for _, txt := range txts {
+						resp.Answers = append(resp.Answers, dnsmessage.Resource{
+							Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60},
+							Body:   &dnsmessage.TXTResource{TXT: []string{txt}},
+						})
+					}
+				}
+			}
+			out, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = pc.WriteTo(out, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestResolverLookup(t *testing.T) {
+	addr := serveTXT(t, map[string][]string{
+		"_dnslink.site.example.": {"dnslink=/ipfs/bafysite"},
+		"legacy.example.":        {"dnslink=/ipns/site.example"},
+		"plain.example.":         {"v=spf1 -all"},
+	})
+	r := NewResolver(addr)
+	ctx := context.Background()
+
+	if got, err := r.Lookup(ctx, "Site.Example"); err != nil || got != "/ipfs/bafysite" {
+		t.Fatalf("site: %q, %v", got, err)
+	}
+	if got, err := r.Lookup(ctx, "legacy.example"); err != nil || got != "/ipns/site.example" {
+		t.Fatalf("legacy: %q, %v", got, err)
+	}
+	for _, domain := range []string{"plain.example", "missing.example"} {
+		if _, err := r.Lookup(ctx, domain); !errors.Is(err, ErrNoRecord) {
+			t.Fatalf("%s: want ErrNoRecord, got %v", domain, err)
+		}
+	}
+}
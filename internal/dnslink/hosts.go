@@ -0,0 +1,46 @@
+package dnslink
+
+import (
+	"regexp"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// maxHostnames bounds the candidates taken from one document.
+const maxHostnames = 64
+
+// hostRe matches the host of http(s) and ipns URLs and the name of /ipns/
+// paths, which is where domains show up in links and text.
+var hostRe = regexp.MustCompile(`(?i)(?:(?:https?|ipns)://(?:[^/@\s"'<>]*@)?|/ipns/)([a-z0-9][a-z0-9._-]*[a-z0-9])`)
+
+// Hostnames returns the distinct domains linked from texts, in order of
+// first appearance. Subdomain gateway hosts (<cid>.ipfs.<gateway>,
+// <key>.ipns.<gateway>) are skipped; their content is found by CID.
+func Hostnames(texts ...string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, m := range hostRe.FindAllStringSubmatch(text, -1) {
+			host := strings.ToLower(strings.TrimSuffix(m[1], "."))
+			if seen[host] || !IsDomain(host) || gatewayHost(host) {
+				continue
+			}
+			seen[host] = true
+			out = append(out, host)
+			if len(out) == maxHostnames {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+func gatewayHost(host string) bool {
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 || (labels[1] != "ipfs" && labels[1] != "ipns") {
+		return false
+	}
+	_, err := cid.Decode(labels[0])
+	return err == nil
+}
@@ -0,0 +1,94 @@
+package dnslink
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Watchlist is the set of DNSLink domains re-resolved every Interval. It is
+// a Redis sorted set scored by when each domain is next due, plus a hash of
+// the path each last resolved to. A nil *Watchlist watches nothing.
+type Watchlist struct {
+	Redis  *goredis.Client
+	Config Config
+}
+
+func (w *Watchlist) dueKey() string   { return w.Config.Prefix + ":watch" }
+func (w *Watchlist) valueKey() string { return w.Config.Prefix + ":value" }
+
+// Add watches domain, first due one Interval from now, since whoever adds a
+// domain has just resolved it. It reports false when the domain was already
+// watched or the watchlist is full.
+func (w *Watchlist) Add(ctx context.Context, domain string) (bool, error) {
+	if w == nil {
+		return false, nil
+	}
+	if w.Config.MaxDomains > 0 {
+		n, err := w.Redis.ZCard(ctx, w.dueKey()).Result()
+		if err != nil {
+			return false, fmt.Errorf("dnslink watchlist size: %w", err)
+		}
+		if n >= int64(w.Config.MaxDomains) {
+			return false, nil
+		}
+	}
+	due := time.Now().Add(w.Config.Interval).UnixMilli()
+	n, err := w.Redis.ZAddNX(ctx, w.dueKey(), goredis.Z{Score: float64(due), Member: domain}).Result()
+	if err != nil {
+		return false, fmt.Errorf("dnslink watch %s: %w", domain, err)
+	}
+	return n == 1, nil
+}
+
+// Remove stops watching domain.
+func (w *Watchlist) Remove(ctx context.Context, domain string) error {
+	if w == nil {
+		return nil
+	}
+	pipe := w.Redis.TxPipeline()
+	pipe.ZRem(ctx, w.dueKey(), domain)
+	pipe.HDel(ctx, w.valueKey(), domain)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("dnslink unwatch %s: %w", domain, err)
+	}
+	return nil
+}
+
+// Due claims up to n domains due at now, pushing each one Interval further,
+// so concurrent schedulers never claim the same domain twice.
+func (w *Watchlist) Due(ctx context.Context, now time.Time, n int) ([]string, error) {
+	next := now.Add(w.Config.Interval).UnixMilli()
+	res, err := w.Redis.Eval(ctx, claimScript, []string{w.dueKey()},
+		strconv.FormatInt(now.UnixMilli(), 10), n, next).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("dnslink due: %w", err)
+	}
+	return res, nil
+}
+
+const claimScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, d in ipairs(due) do redis.call('ZADD', KEYS[1], ARGV[3], d) end
+return due`
+
+// Update records the path domain resolved to and reports whether it
+// differs from the last one recorded.
+func (w *Watchlist) Update(ctx context.Context, domain, path string) (bool, error) {
+	if w == nil {
+		return true, nil
+	}
+	prev, err := w.Redis.Eval(ctx, swapScript, []string{w.valueKey()}, domain, path).Text()
+	if err != nil {
+		return false, fmt.Errorf("dnslink update %s: %w", domain, err)
+	}
+	return prev != path, nil
+}
+
+const swapScript = `
+local prev = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return prev`
@@ -48,7 +48,7 @@ func TestE2E_InlineFetchResultToSearch(t *testing.T) {
 	}
 	defer nc.Drain()
 
-	if err := internalnats.EnsureStream(ctx, js); err != nil {
+	if err := internalnats.EnsureStream(ctx, js, cfg.Streams); err != nil {
 		t.Fatalf("ensure stream: %v", err)
 	}
 
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
 	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/policy"
 	"github.com/Rorical/IPFSniffer/internal/redis"
 	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
 
@@ -22,18 +25,83 @@ import (
 //
 // This is the missing link that turns sniffed CIDs into actual fetching+indexing work.
 type FetchEnqueuer struct {
-	NATS  nats.JetStreamContext
+	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus   internalnats.Bus
 	Redis *goredis.Client
+	// Conn enables max-delivery advisory handling. Optional.
+	Conn *nats.Conn
 
 	Dedupe redis.Dedupe
+	// Dedupers picks the dedupe backend per prefix; nil uses Redis. Optional.
+	Dedupers *dedupe.Registry
 
 	Durable    string
 	MaxDeliver int
+	AckWait    time.Duration
+	// Concurrency bounds in-flight messages; Batch caps each pull. Both
+	// default to 1.
+	Concurrency int
+	Batch       int
 
 	// Default limits/policy for fetch jobs.
 	Limits FetchDefaults
 	Policy FetchPolicyDefaults
 	Inline InlineDefaults
+
+	// Policies, when set, overrides the defaults above live from the
+	// policy.KeyFetch key. Optional.
+	Policies nats.KeyValue
+
+	current atomic.Pointer[fetchSettings]
+	seen    dedupe.Deduper
+}
+
+// fetchSettings is the snapshot of defaults one message is enqueued with, so
+// a policy change never mixes old and new values within a job.
+type fetchSettings struct {
+	limits FetchDefaults
+	policy FetchPolicyDefaults
+	inline InlineDefaults
+}
+
+// with returns s overridden by p.
+func (s fetchSettings) with(p *policy.Fetch) fetchSettings {
+	if p == nil {
+		return s
+	}
+	if p.MaxTotalBytes > 0 {
+		s.limits.MaxTotalBytes = p.MaxTotalBytes
+	}
+	if p.MaxFileBytes > 0 {
+		s.limits.MaxFileBytes = p.MaxFileBytes
+	}
+	if p.MaxDAGNodes > 0 {
+		s.limits.MaxDAGNodes = p.MaxDAGNodes
+	}
+	if p.MaxDepth > 0 {
+		s.limits.MaxDepth = p.MaxDepth
+	}
+	if p.TimeoutMs > 0 {
+		s.limits.Timeout = time.Duration(p.TimeoutMs) * time.Millisecond
+	}
+	if p.InlineMaxBytes > 0 {
+		s.inline.InlineMaxBytes = p.InlineMaxBytes
+	}
+	if p.SkipExt != nil {
+		s.policy.SkipExt = p.SkipExt
+	}
+	if p.SkipMimePrefix != nil {
+		s.policy.SkipMimePrefix = p.SkipMimePrefix
+	}
+	return s
+}
+
+func (w *FetchEnqueuer) settings() fetchSettings {
+	if s := w.current.Load(); s != nil {
+		return *s
+	}
+	return fetchSettings{limits: w.Limits, policy: w.Policy, inline: w.Inline}
 }
 
 type FetchDefaults struct {
@@ -54,71 +122,62 @@ type InlineDefaults struct {
 }
 
 func (w *FetchEnqueuer) Run(ctx context.Context) error {
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
-	if w.Redis == nil {
-		return fmt.Errorf("redis required")
-	}
 	if w.Dedupe.Prefix == "" {
 		w.Dedupe.Prefix = "ipfsniffer:seen:fetch"
 	}
 	if w.Dedupe.TTL == 0 {
 		w.Dedupe.TTL = 24 * time.Hour
 	}
+	seen, err := dedupe.Default(w.Dedupers, w.Redis).For(w.Dedupe.Prefix, w.Dedupe.TTL)
+	if err != nil {
+		return err
+	}
+	w.seen = seen
 	w.applyDefaults()
 
-	logger := logging.FromContext(ctx)
+	base := fetchSettings{limits: w.Limits, policy: w.Policy, inline: w.Inline}
+	w.current.Store(&base)
+	if w.Policies != nil {
+		// In-flight messages keep the snapshot they started with.
+		err := policy.Watch(ctx, w.Policies, policy.KeyFetch, func(p *policy.Fetch, _ uint64) {
+			s := base.with(p)
+			w.current.Store(&s)
+		})
+		if err != nil {
+			return err
+		}
+	}
 
 	durable := w.Durable
 	if durable == "" {
 		durable = "enqueue-fetch"
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, w.NATS, internalnats.SubjectCidDiscovered, durable, w.MaxDeliver); err != nil {
-		return err
-	}
-
-	subD, err := w.NATS.PullSubscribe(internalnats.SubjectCidDiscovered, durable)
-	if err != nil {
-		return fmt.Errorf("pull subscribe discovered: %w", err)
-	}
-
-	logger.Info("fetch enqueuer started", "subject", internalnats.SubjectCidDiscovered)
-
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-
-		if err := w.pollDiscovered(ctx, subD); err != nil {
-			return err
-		}
-	}
-}
+	logging.FromContext(ctx).Info("fetch enqueuer started", "subject", internalnats.SubjectCidDiscovered)
 
-func (w *FetchEnqueuer) pollDiscovered(ctx context.Context, sub *nats.Subscription) error {
-	msgs, err := sub.Fetch(1, nats.MaxWait(1*time.Second))
-	if err != nil {
-		if err == nats.ErrTimeout {
-			return nil
-		}
-		return fmt.Errorf("fetch discovered: %w", err)
-	}
-	for _, msg := range msgs {
-		if err := w.handleDiscovered(ctx, msg); err != nil {
-			logging.FromContext(ctx).Error("handle discovered", "err", err)
-			continue
-		}
-		_ = msg.Ack()
+	c := &internalnats.Consumer{
+		NATS:        w.NATS,
+		Bus:         w.Bus,
+		Conn:        w.Conn,
+		Subject:     internalnats.SubjectCidDiscovered,
+		Durable:     durable,
+		MaxDeliver:  w.MaxDeliver,
+		AckWait:     w.AckWait,
+		Concurrency: w.Concurrency,
+		Batch:       w.Batch,
+		Handler:     w.handleDiscovered,
 	}
-	return nil
+	return c.Run(ctx)
 }
 
 func (w *FetchEnqueuer) handleDiscovered(ctx context.Context, msg *nats.Msg) error {
 	var in ipfsnifferv1.CidDiscovered
 	if err := codec.Unmarshal(msg.Data, &in); err != nil {
-		return err
+		return internalnats.Terminal(err)
 	}
 	d := in.GetData()
 	if d == nil {
@@ -156,17 +215,23 @@ func (w *FetchEnqueuer) handleDiscovered(ctx context.Context, msg *nats.Msg) err
 	}
 
 	logger.Info("enqueue-fetch: enqueuing fetch request", "root_cid", rootCID, "path", path)
-	return w.enqueueFetch(ctx, in.Trace, rootCID, path, d.GetObservedAt())
+	return w.enqueueFetch(ctx, internalnats.ParentMsgID(msg), in.Trace, rootCID, path, d.GetObservedAt(), d.GetIpnsName(), d.GetLimits(), d.GetForce())
 }
 
-func (w *FetchEnqueuer) enqueueFetch(ctx context.Context, trace *ipfsnifferv1.TraceContext, rootCID, path string, observedAt string) error {
+func (w *FetchEnqueuer) enqueueFetch(ctx context.Context, parent string, trace *ipfsnifferv1.TraceContext, rootCID, path string, observedAt, ipnsName string, override *ipfsnifferv1.FetchLimits, force bool) error {
 	// Per-target dedupe so we don't enqueue infinite work for hot CIDs.
+	// Forced (admin) submissions still mark the key but ignore the result.
+	s := w.settings()
 	key := rootCID + ":" + path
-	seen, err := w.Dedupe.Seen(ctx, w.Redis, key)
+	if ipnsName != "" {
+		// Fetched again under the name, so its documents carry it.
+		key += "@" + ipnsName
+	}
+	seen, err := w.seen.Seen(ctx, key)
 	if err != nil {
 		return err
 	}
-	if seen {
+	if seen && !force {
 		return nil
 	}
 
@@ -179,19 +244,14 @@ func (w *FetchEnqueuer) enqueueFetch(ctx context.Context, trace *ipfsnifferv1.Tr
 			RootCid:    rootCID,
 			Path:       path,
 			ObservedAt: observedAt,
-			Limits: &ipfsnifferv1.FetchLimits{
-				MaxTotalBytes: w.Limits.MaxTotalBytes,
-				MaxFileBytes:  w.Limits.MaxFileBytes,
-				MaxDagNodes:   w.Limits.MaxDAGNodes,
-				MaxDepth:      w.Limits.MaxDepth,
-				TimeoutMs:     w.Limits.Timeout.Milliseconds(),
-			},
+			IpnsName:   ipnsName,
+			Limits:     fetchLimits(s.limits, override),
 			Policy: &ipfsnifferv1.FetchPolicy{
-				SkipExt:        w.Policy.SkipExt,
-				SkipMimePrefix: w.Policy.SkipMimePrefix,
+				SkipExt:        s.policy.SkipExt,
+				SkipMimePrefix: s.policy.SkipMimePrefix,
 			},
 			Content: &ipfsnifferv1.FetchContent{
-				InlineMaxBytes: w.Inline.InlineMaxBytes,
+				InlineMaxBytes: s.inline.InlineMaxBytes,
 			},
 		},
 	}
@@ -200,13 +260,44 @@ func (w *FetchEnqueuer) enqueueFetch(ctx context.Context, trace *ipfsnifferv1.Tr
 	if err != nil {
 		return err
 	}
-	if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectFetchRequest, b); err != nil {
-		_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectFetchRequest, b)
+	id := internalnats.MsgID(parent, internalnats.SubjectFetchRequest, rootCID, path)
+	if _, err := internalnats.Publish(ctx, w.Bus, internalnats.SubjectFetchRequest, b, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectFetchRequest, id, b, err)
 		return err
 	}
 	return nil
 }
 
+// fetchLimits returns defaults with any non-zero fields of override applied.
+func fetchLimits(defaults FetchDefaults, override *ipfsnifferv1.FetchLimits) *ipfsnifferv1.FetchLimits {
+	l := &ipfsnifferv1.FetchLimits{
+		MaxTotalBytes: defaults.MaxTotalBytes,
+		MaxFileBytes:  defaults.MaxFileBytes,
+		MaxDagNodes:   defaults.MaxDAGNodes,
+		MaxDepth:      defaults.MaxDepth,
+		TimeoutMs:     defaults.Timeout.Milliseconds(),
+	}
+	if override == nil {
+		return l
+	}
+	if v := override.GetMaxTotalBytes(); v > 0 {
+		l.MaxTotalBytes = v
+	}
+	if v := override.GetMaxFileBytes(); v > 0 {
+		l.MaxFileBytes = v
+	}
+	if v := override.GetMaxDagNodes(); v > 0 {
+		l.MaxDagNodes = v
+	}
+	if v := override.GetMaxDepth(); v > 0 {
+		l.MaxDepth = v
+	}
+	if v := override.GetTimeoutMs(); v > 0 {
+		l.TimeoutMs = v
+	}
+	return l
+}
+
 func (w *FetchEnqueuer) applyDefaults() {
 	if w.Limits.MaxTotalBytes == 0 {
 		w.Limits.MaxTotalBytes = 100 * 1024 * 1024
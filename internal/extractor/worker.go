@@ -11,6 +11,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
 	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
 	"github.com/Rorical/IPFSniffer/internal/tika"
@@ -21,10 +22,23 @@ import (
 
 type Worker struct {
 	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus  internalnats.Bus
 	Tika *tika.Client
+	// Conn enables max-delivery advisory handling. Optional.
+	Conn *nats.Conn
 
 	Durable    string
 	MaxDeliver int
+	AckWait    time.Duration
+	// Concurrency bounds in-flight messages; Batch caps each pull. Both
+	// default to 1.
+	Concurrency int
+	Batch       int
+
+	// Claims moves large outputs to the object store and resolves claimed
+	// inputs. Optional.
+	Claims *internalnats.ClaimStore
 
 	// Stream settings
 	StreamMaxBytes int64
@@ -32,10 +46,19 @@ type Worker struct {
 	// Extract limits
 	TikaTimeout  time.Duration
 	MaxTextBytes int64
+
+	// Hostnames publishes the domains linked from extracted files to
+	// cid.discovered as DNSLink candidates. Optional.
+	Hostnames bool
 }
 
+// maxHostScanBytes bounds the raw markup of a text file scanned for links,
+// which the extracted text of HTML drops.
+const maxHostScanBytes = 1 << 20
+
 func (w *Worker) Run(ctx context.Context) error {
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats required")
 	}
 	if w.Tika == nil {
@@ -53,45 +76,28 @@ func (w *Worker) Run(ctx context.Context) error {
 		durable = "extractor"
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, w.NATS, internalnats.SubjectFetchResult, durable, w.MaxDeliver); err != nil {
-		return err
-	}
-
-	sub, err := w.NATS.PullSubscribe(internalnats.SubjectFetchResult, durable)
-	if err != nil {
-		return fmt.Errorf("pull subscribe: %w", err)
-	}
-
-	logger := logging.FromContext(ctx)
-	logger.Info("extractor started", "subject", internalnats.SubjectFetchResult, "durable", durable)
-
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-
-		msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
-		if err != nil {
-			if err == nats.ErrTimeout {
-				continue
-			}
-			return err
-		}
-
-		for _, msg := range msgs {
-			if err := w.handle(ctx, msg); err != nil {
-				logger.Error("extract handle", "err", err)
-				continue
-			}
-			_ = msg.Ack()
-		}
+	logging.FromContext(ctx).Info("extractor started", "subject", internalnats.SubjectFetchResult, "durable", durable)
+
+	c := &internalnats.Consumer{
+		NATS:        w.NATS,
+		Bus:         w.Bus,
+		Conn:        w.Conn,
+		Subject:     internalnats.SubjectFetchResult,
+		Durable:     durable,
+		MaxDeliver:  w.MaxDeliver,
+		AckWait:     w.AckWait,
+		Concurrency: w.Concurrency,
+		Batch:       w.Batch,
+		Claims:      w.Claims,
+		Handler:     w.handle,
 	}
+	return c.Run(ctx)
 }
 
 func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 	var fr ipfsnifferv1.FetchResult
 	if err := codec.Unmarshal(msg.Data, &fr); err != nil {
-		return err
+		return internalnats.Terminal(err)
 	}
 
 	d := fr.GetData()
@@ -111,6 +117,7 @@ func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 	contentIndexed := false
 	text := ""
 	textTruncated := false
+	var raw capBuffer
 
 	if d.GetNodeType() == "file" {
 		var r io.Reader
@@ -136,6 +143,10 @@ func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 			}
 			r = r2
 		}
+		if w.Hostnames && strings.HasPrefix(d.GetMime(), "text/") {
+			raw.max = maxHostScanBytes
+			r = io.TeeReader(r, &raw)
+		}
 
 		res, err := w.Tika.ExtractText(ctx, r, w.TikaTimeout, w.MaxTextBytes)
 		if err != nil {
@@ -175,7 +186,7 @@ func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 			Cid:            d.GetRootCid(),
 			FetchedAt:      d.GetFetchedAt(),
 			SkipReason:     d.GetSkipReason(),
-			IpnsName:       "",
+			IpnsName:       d.GetIpnsName(),
 		},
 	}
 
@@ -183,16 +194,60 @@ func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 	if err != nil {
 		return err
 	}
-	if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectDocReady, b); err != nil {
-		_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectDocReady, b)
+	id := internalnats.MsgID(internalnats.ParentMsgID(msg), internalnats.SubjectDocReady, d.GetRootCid(), d.GetPath())
+	if _, err := w.Claims.Publish(ctx, w.Bus, internalnats.SubjectDocReady, b, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectDocReady, id, b, err)
 		return err
 	}
 
+	if w.Hostnames && contentIndexed {
+		w.publishHostnames(ctx, internalnats.ParentMsgID(msg), fr.Trace, dnslink.Hostnames(string(raw.b), text))
+	}
 	return nil
 }
 
+// publishHostnames offers hosts to the resolver as /ipns/<domain>
+// candidates. Losing some is harmless, so failures are only logged.
+func (w *Worker) publishHostnames(ctx context.Context, parent string, trace *ipfsnifferv1.TraceContext, hosts []string) {
+	for _, host := range hosts {
+		env := &ipfsnifferv1.CidDiscovered{
+			V:     1,
+			Id:    uuid.NewString(),
+			Ts:    time.Now().UTC().Format(time.RFC3339Nano),
+			Trace: trace,
+			Data: &ipfsnifferv1.CidDiscoveredData{
+				Cid:          "/ipns/" + host,
+				Source:       dnslink.Source,
+				SourceDetail: "hostname",
+				ObservedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+			},
+		}
+		b, err := codec.Marshal(env)
+		if err != nil {
+			return
+		}
+		if _, err := internalnats.Publish(ctx, w.Bus, internalnats.SubjectCidDiscovered, b,
+			nats.MsgId(internalnats.MsgID(parent, internalnats.SubjectCidDiscovered, dnslink.Source, host))); err != nil {
+			logging.FromContext(ctx).Warn("extractor: publish hostname", "host", host, "err", err)
+		}
+	}
+}
+
+// capBuffer keeps the first max bytes written to it and drops the rest.
+type capBuffer struct {
+	b   []byte
+	max int
+}
+
+func (c *capBuffer) Write(p []byte) (int, error) {
+	if room := c.max - len(c.b); room > 0 {
+		c.b = append(c.b, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
 func (w *Worker) streamReader(ctx context.Context, rootCID string, p string, maxBytes int64) (io.Reader, error) {
-	if w.NATS == nil {
+	if w.Bus == nil {
 		return nil, fmt.Errorf("nats required")
 	}
 	if maxBytes <= 0 {
@@ -205,11 +260,10 @@ func (w *Worker) streamReader(ctx context.Context, rootCID string, p string, max
 	streamID := uuid.NewString()
 	chunkSubject := internalnats.StreamChunkSubject(streamID)
 
-	sub, err := w.NATS.SubscribeSync(chunkSubject)
+	sub, err := w.Bus.SubscribeSync(chunkSubject)
 	if err != nil {
 		return nil, fmt.Errorf("subscribe chunks: %w", err)
 	}
-	_ = sub.AutoUnsubscribe(100000)
 
 	get := &ipfsnifferv1.StreamGet{
 		V:    1,
@@ -219,9 +273,11 @@ func (w *Worker) streamReader(ctx context.Context, rootCID string, p string, max
 	}
 	b, err := codec.Marshal(get)
 	if err != nil {
+		_ = sub.Unsubscribe()
 		return nil, err
 	}
-	if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectStreamGet, b); err != nil {
+	if _, err := internalnats.Publish(ctx, w.Bus, internalnats.SubjectStreamGet, b); err != nil {
+		_ = sub.Unsubscribe()
 		return nil, err
 	}
 
@@ -230,7 +286,7 @@ func (w *Worker) streamReader(ctx context.Context, rootCID string, p string, max
 
 type chunkReader struct {
 	ctx context.Context
-	sub *nats.Subscription
+	sub internalnats.SyncSubscription
 	buf []byte
 	off int
 	eof bool
@@ -250,19 +306,21 @@ func (r *chunkReader) Read(p []byte) (int, error) {
 
 		msg, err := r.sub.NextMsgWithContext(r.ctx)
 		if err != nil {
+			r.close()
 			return 0, err
 		}
 		var ch ipfsnifferv1.StreamChunk
 		if err := codec.Unmarshal(msg.Data, &ch); err != nil {
+			r.close()
 			return 0, err
 		}
 		cd := ch.GetData()
 		if cd.GetError() != "" {
-			r.eof = true
+			r.close()
 			return 0, fmt.Errorf("stream error: %s", cd.GetError())
 		}
 		if cd.GetEof() {
-			r.eof = true
+			r.close()
 			return 0, io.EOF
 		}
 		r.buf = cd.GetData()
@@ -270,6 +328,12 @@ func (r *chunkReader) Read(p []byte) (int, error) {
 	}
 }
 
+// close ends the stream and drops the chunk subscription.
+func (r *chunkReader) close() {
+	r.eof = true
+	_ = r.sub.Unsubscribe()
+}
+
 type byteReader struct {
 	b []byte
 	i int
@@ -26,9 +26,23 @@ import (
 type Worker struct {
 	IPFS *ipfs.Node
 	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus internalnats.Bus
+	// Conn enables max-delivery advisory handling. Optional.
+	Conn *nats.Conn
 
 	Durable    string
 	MaxDeliver int
+	// AckWait should exceed the gap between InProgress heartbeats, not the
+	// fetch timeout; the consumer runner keeps long fetches alive.
+	AckWait time.Duration
+	// Concurrency bounds in-flight messages; Batch caps each pull. Both
+	// default to 1.
+	Concurrency int
+	Batch       int
+
+	// Claims moves large payloads to the object store. Optional.
+	Claims *internalnats.ClaimStore
 
 	// Retry settings for DHT lookups
 	MaxRetries     int
@@ -73,7 +87,8 @@ func (w *Worker) Run(ctx context.Context) error {
 	if w.IPFS == nil || w.IPFS.API == nil {
 		return fmt.Errorf("ipfs node required")
 	}
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
 
@@ -93,39 +108,22 @@ func (w *Worker) Run(ctx context.Context) error {
 		durable = "fetcher"
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, w.NATS, internalnats.SubjectFetchRequest, durable, w.MaxDeliver); err != nil {
-		return err
-	}
-
-	sub, err := w.NATS.PullSubscribe(internalnats.SubjectFetchRequest, durable)
-	if err != nil {
-		return fmt.Errorf("pull subscribe: %w", err)
-	}
-
-	logger := logging.FromContext(ctx)
-	logger.Info("fetcher started", "subject", internalnats.SubjectFetchRequest, "durable", durable, "max_retries", w.MaxRetries, "retry_base_delay", w.RetryBaseDelay)
-
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-
-		msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
-		if err != nil {
-			if err == nats.ErrTimeout {
-				continue
-			}
-			return fmt.Errorf("fetch: %w", err)
-		}
-
-		for _, msg := range msgs {
-			if err := w.handleMsg(ctx, msg); err != nil {
-				logger.Error("handle msg", "err", err)
-				continue
-			}
-			_ = msg.Ack()
-		}
+	logging.FromContext(ctx).Info("fetcher started", "subject", internalnats.SubjectFetchRequest, "durable", durable, "max_retries", w.MaxRetries, "retry_base_delay", w.RetryBaseDelay)
+
+	c := &internalnats.Consumer{
+		NATS:        w.NATS,
+		Bus:         w.Bus,
+		Conn:        w.Conn,
+		Subject:     internalnats.SubjectFetchRequest,
+		Durable:     durable,
+		MaxDeliver:  w.MaxDeliver,
+		AckWait:     w.AckWait,
+		Concurrency: w.Concurrency,
+		Batch:       w.Batch,
+		Claims:      w.Claims,
+		Handler:     w.handleMsg,
 	}
+	return c.Run(ctx)
 }
 
 // resolveNodeWithRetry wraps ResolveNode with retry logic
@@ -146,7 +144,7 @@ func (w *Worker) resolveNodeWithRetry(ctx context.Context, ipfsPath boxopath.Pat
 func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 	var in ipfsnifferv1.FetchRequest
 	if err := codec.Unmarshal(msg.Data, &in); err != nil {
-		return err
+		return internalnats.Terminal(err)
 	}
 
 	root := in.GetData().GetRootCid()
@@ -156,6 +154,7 @@ func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 	}
 
 	logger := logging.FromContext(ctx).With("root_cid", root, "path", p)
+	parent := internalnats.ParentMsgID(msg)
 
 	// Phase 2: recursively traverse the tree and emit one fetch.result per node.
 	// Timeout is honored by deriving a context with deadline (best-effort).
@@ -169,7 +168,7 @@ func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 	ipfsPath, err := parsePath(p)
 	if err != nil {
 		logger.Error("fetcher: invalid path", "err", err)
-		return w.emitFailed(ctx, &in, root, p, "failed", "invalid_path", err)
+		return w.emitFailed(ctx, parent, &in, root, p, "failed", "invalid_path", err)
 	}
 
 	pol := buildPolicy(&in)
@@ -196,7 +195,7 @@ func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 		if !isRetryableError(resolveErr) {
 			// Non-retryable error, fail immediately
 			logger.Error("fetcher: resolve failed (non-retryable)", "err", resolveErr, "attempt", attempt)
-			return w.emitFailed(ctx, &in, root, p, "failed", "fetch_failed", resolveErr)
+			return w.emitFailed(ctx, parent, &in, root, p, "failed", "fetch_failed", resolveErr)
 		}
 		if attempt < w.MaxRetries {
 			logger.Warn("fetcher: resolve failed, retrying", "err", resolveErr, "attempt", attempt+1, "max_retries", w.MaxRetries)
@@ -204,12 +203,12 @@ func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 	}
 	if resolveErr != nil {
 		logger.Error("fetcher: resolve failed after all retries", "err", resolveErr)
-		return w.emitFailed(ctx, &in, root, p, "failed", "fetch_failed", resolveErr)
+		return w.emitFailed(ctx, parent, &in, root, p, "failed", "fetch_failed", resolveErr)
 	}
 
 	node, err := unixfile.NewUnixfsFile(ctx, dagSvc, ipldNode)
 	if err != nil {
-		return w.emitFailed(ctx, &in, root, p, "failed", "fetch_failed", err)
+		return w.emitFailed(ctx, parent, &in, root, p, "failed", "fetch_failed", err)
 	}
 
 	emit := func(d *ipfsnifferv1.FetchResultData) error {
@@ -220,6 +219,9 @@ func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 		if d.ObservedAt == "" {
 			d.ObservedAt = in.GetData().GetObservedAt()
 		}
+		if d.IpnsName == "" {
+			d.IpnsName = in.GetData().GetIpnsName()
+		}
 		out := &ipfsnifferv1.FetchResult{
 			V:     1,
 			Id:    uuid.NewString(),
@@ -231,8 +233,9 @@ func (w *Worker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 		if err != nil {
 			return err
 		}
-		if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectFetchResult, b); err != nil {
-			_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectFetchResult, b)
+		id := internalnats.MsgID(parent, internalnats.SubjectFetchResult, d.GetRootCid(), d.GetPath(), d.GetStatus())
+		if _, err := w.Claims.Publish(ctx, w.Bus, internalnats.SubjectFetchResult, b, nats.MsgId(id)); err != nil {
+			_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectFetchResult, id, b, err)
 			return err
 		}
 		return nil
@@ -274,7 +277,7 @@ func depthOfPath(p string) int {
 	return strings.Count(strings.Trim(p, "/"), "/")
 }
 
-func (w *Worker) emitFailed(ctx context.Context, in *ipfsnifferv1.FetchRequest, root, p, status, reason string, cause error) error {
+func (w *Worker) emitFailed(ctx context.Context, parent string, in *ipfsnifferv1.FetchRequest, root, p, status, reason string, cause error) error {
 	res := &ipfsnifferv1.FetchResult{
 		V:     1,
 		Id:    uuid.NewString(),
@@ -301,8 +304,9 @@ func (w *Worker) emitFailed(ctx context.Context, in *ipfsnifferv1.FetchRequest,
 		return err
 	}
 
-	if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectFetchResult, b); err != nil {
-		_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectFetchResult, b)
+	id := internalnats.MsgID(parent, internalnats.SubjectFetchResult, root, p, status)
+	if _, err := w.Claims.Publish(ctx, w.Bus, internalnats.SubjectFetchResult, b, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectFetchResult, id, b, err)
 		return err
 	}
 
@@ -25,6 +25,8 @@ const defaultChunkSize = 32 * 1024
 type StreamServer struct {
 	IPFS *ipfs.Node
 	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus internalnats.Bus
 
 	ChunkSize int
 }
@@ -33,18 +35,15 @@ func (s *StreamServer) Run(ctx context.Context) error {
 	if s.IPFS == nil || s.IPFS.API == nil {
 		return fmt.Errorf("ipfs node required")
 	}
-	if s.NATS == nil {
+	s.Bus = internalnats.DefaultBus(s.Bus, s.NATS)
+	if s.Bus == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
 	if s.ChunkSize <= 0 {
 		s.ChunkSize = defaultChunkSize
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, s.NATS, internalnats.SubjectStreamGet, "stream-server", internalnats.DefaultMaxDeliver); err != nil {
-		return err
-	}
-
-	sub, err := s.NATS.PullSubscribe(internalnats.SubjectStreamGet, "stream-server")
+	sub, err := s.Bus.PullSubscribe(ctx, internalnats.SubjectStreamGet, "stream-server", internalnats.ConsumerOpts{MaxDeliver: internalnats.DefaultMaxDeliver})
 	if err != nil {
 		return err
 	}
@@ -57,20 +56,20 @@ func (s *StreamServer) Run(ctx context.Context) error {
 			return ctx.Err()
 		}
 
-		msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
+		msgs, err := sub.Fetch(ctx, 1, 2*time.Second)
 		if err != nil {
-			if err == nats.ErrTimeout {
-				continue
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
 			return err
 		}
 
-		for _, msg := range msgs {
-			if err := s.handle(ctx, msg); err != nil {
+		for _, d := range msgs {
+			if err := s.handle(ctx, d.Msg()); err != nil {
 				logger.Error("stream handle", "err", err)
 				continue
 			}
-			_ = msg.Ack()
+			_ = d.Ack()
 		}
 	}
 }
@@ -144,7 +143,7 @@ func (s *StreamServer) handle(ctx context.Context, msg *nats.Msg) error {
 			if err != nil {
 				return err
 			}
-			if _, err := internalnats.Publish(ctx, s.NATS, chunkSubject, b); err != nil {
+			if _, err := internalnats.Publish(ctx, s.Bus, chunkSubject, b); err != nil {
 				return err
 			}
 		}
@@ -170,7 +169,7 @@ func (s *StreamServer) sendEOF(ctx context.Context, trace *ipfsnifferv1.TraceCon
 	if err != nil {
 		return err
 	}
-	_, err = internalnats.Publish(ctx, s.NATS, subject, b)
+	_, err = internalnats.Publish(ctx, s.Bus, subject, b)
 	return err
 }
 
@@ -186,7 +185,7 @@ func (s *StreamServer) sendErr(ctx context.Context, trace *ipfsnifferv1.TraceCon
 	if mErr != nil {
 		return mErr
 	}
-	_, pErr := internalnats.Publish(ctx, s.NATS, subject, b)
+	_, pErr := internalnats.Publish(ctx, s.Bus, subject, b)
 	if pErr != nil {
 		return pErr
 	}
@@ -0,0 +1,177 @@
+// Package geoip tags peer addresses with country and autonomous system from
+// local MaxMind-format databases (e.g. GeoLite2-Country and GeoLite2-ASN).
+//
+// Lookups never touch the network: DNS multiaddrs are not resolved and are
+// skipped, as are private and loopback IPs. Relay (p2p-circuit) addresses
+// name the relay rather than the peer, so they are only used when a peer has
+// no direct public address.
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+type Config struct {
+	// CountryDB is the path of a country (or city) database. Optional.
+	CountryDB string
+	// ASNDB is the path of an ASN database. Optional.
+	ASNDB string
+}
+
+// Enabled reports whether any database is configured.
+func (c Config) Enabled() bool { return c.CountryDB != "" || c.ASNDB != "" }
+
+// Info is what the databases know about one address.
+type Info struct {
+	// Country is the ISO 3166-1 alpha-2 code.
+	Country string
+	ASN     uint32
+	// Org is the organization the ASN is registered to.
+	Org string
+}
+
+func (i Info) IsZero() bool { return i == Info{} }
+
+// DB looks up addresses in the configured databases. A nil *DB finds
+// nothing.
+type DB struct {
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+// Open opens the databases cfg names.
+func Open(cfg Config) (*DB, error) {
+	db := &DB{}
+	var err error
+	if cfg.CountryDB != "" {
+		if db.country, err = maxminddb.Open(cfg.CountryDB); err != nil {
+			return nil, fmt.Errorf("geoip open %s: %w", cfg.CountryDB, err)
+		}
+	}
+	if cfg.ASNDB != "" {
+		if db.asn, err = maxminddb.Open(cfg.ASNDB); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("geoip open %s: %w", cfg.ASNDB, err)
+		}
+	}
+	return db, nil
+}
+
+func (db *DB) Close() error {
+	if db == nil {
+		return nil
+	}
+	var err error
+	if db.country != nil {
+		err = db.country.Close()
+	}
+	if db.asn != nil {
+		if cerr := db.asn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+type asnRecord struct {
+	Number uint32 `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// LookupIP returns what the databases know about ip.
+func (db *DB) LookupIP(ip net.IP) Info {
+	var info Info
+	if db == nil || ip == nil {
+		return info
+	}
+	if db.country != nil {
+		var r countryRecord
+		if err := db.country.Lookup(ip, &r); err == nil {
+			info.Country = r.Country.ISOCode
+			if info.Country == "" {
+				info.Country = r.RegisteredCountry.ISOCode
+			}
+		}
+	}
+	if db.asn != nil {
+		var r asnRecord
+		if err := db.asn.Lookup(ip, &r); err == nil {
+			info.ASN, info.Org = r.Number, r.Org
+		}
+	}
+	return info
+}
+
+// Lookup returns the Info of the first address in addrs the databases know,
+// trying direct addresses before relay ones.
+func (db *DB) Lookup(addrs []string) Info {
+	if db == nil {
+		return Info{}
+	}
+	for _, ip := range IPs(addrs) {
+		if info := db.LookupIP(ip); !info.IsZero() {
+			return info
+		}
+	}
+	return Info{}
+}
+
+// IPs returns the public IPs in the multiaddrs addrs, those of direct
+// addresses first and then those of the relays in p2p-circuit addresses.
+// Unparseable, DNS, private and loopback addresses are skipped.
+func IPs(addrs []string) []net.IP {
+	var direct, relayed []net.IP
+	seen := map[string]bool{}
+	for _, s := range addrs {
+		m, err := ma.NewMultiaddr(s)
+		if err != nil {
+			continue
+		}
+		ip, relay := addrIP(m)
+		if ip == nil || !public(ip) || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		if relay {
+			relayed = append(relayed, ip)
+		} else {
+			direct = append(direct, ip)
+		}
+	}
+	return append(direct, relayed...)
+}
+
+// addrIP returns the first IP in m and whether m is a relay address, in
+// which case the IP is the relay's.
+func addrIP(m ma.Multiaddr) (net.IP, bool) {
+	var ip net.IP
+	relay := false
+	for _, c := range m {
+		switch c.Protocol().Code {
+		case ma.P_IP4, ma.P_IP6:
+			if ip == nil && !relay {
+				ip = net.IP(c.RawValue())
+			}
+		case ma.P_CIRCUIT:
+			relay = true
+		}
+	}
+	return ip, relay
+}
+
+func public(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
@@ -0,0 +1,44 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPs(t *testing.T) {
+	got := IPs([]string{
+		"/ip4/10.0.0.1/tcp/4001",
+		"/ip4/127.0.0.1/udp/4001/quic-v1",
+		"/dns4/node.example.com/tcp/4001",
+		"/ip4/198.51.100.7/tcp/4001/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN/p2p-circuit",
+		"/ip6/2001:db8::1/udp/4001/quic-v1",
+		"/ip4/203.0.113.9/tcp/4001",
+		"/ip4/203.0.113.9/udp/4001/quic-v1",
+		"not a multiaddr",
+	})
+	want := []string{"2001:db8::1", "203.0.113.9", "198.51.100.7"}
+	if len(got) != len(want) {
+		t.Fatalf("IPs = %v, want %v", got, want)
+	}
+	for i, ip := range got {
+		if !ip.Equal(net.ParseIP(want[i])) {
+			t.Fatalf("IPs = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNilDB(t *testing.T) {
+	var db *DB
+	if info := db.Lookup([]string{"/ip4/203.0.113.9/tcp/4001"}); !info.IsZero() {
+		t.Fatalf("nil db found %+v", info)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestOpen_MissingFile(t *testing.T) {
+	if _, err := Open(Config{CountryDB: t.TempDir() + "/missing.mmdb"}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
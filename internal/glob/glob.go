@@ -0,0 +1,32 @@
+// Package glob matches names against shell-style patterns in which * matches
+// any run of characters, including "/", and ? matches one character.
+package glob
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Compile compiles patterns into one anchored regexp matching a name any of
+// them matches. Blank patterns are ignored; with none left it returns nil.
+func Compile(patterns ...string) (*regexp.Regexp, error) {
+	var alts []string
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		q := regexp.QuoteMeta(p)
+		q = strings.ReplaceAll(q, `\*`, `.*`)
+		q = strings.ReplaceAll(q, `\?`, `.`)
+		alts = append(alts, q)
+	}
+	if len(alts) == 0 {
+		return nil, nil
+	}
+	re, err := regexp.Compile(`^(?:` + strings.Join(alts, "|") + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("glob %v: %w", patterns, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/tika"
+
+	nats "github.com/nats-io/nats.go"
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func NATSStream(js nats.JetStreamContext, stream string) Check {
+	return Check{
+		Name: "nats_stream:" + stream,
+		Fn: func(ctx context.Context) error {
+			return internalnats.CheckStream(ctx, js, stream)
+		},
+	}
+}
+
+func Redis(rdb *goredis.Client) Check {
+	return Check{
+		Name: "redis",
+		Fn: func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		},
+	}
+}
+
+func OpenSearch(c *osclient.Client) Check {
+	return Check{
+		Name: "opensearch",
+		Fn: func(ctx context.Context) error {
+			return opensearch.ClusterHealth(ctx, c)
+		},
+	}
+}
+
+func OpenSearchAlias(c *osclient.Client, alias string) Check {
+	return Check{
+		Name: "opensearch_alias",
+		Fn: func(ctx context.Context) error {
+			ok, err := opensearch.AliasExists(ctx, c, alias)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("alias %s not found", alias)
+			}
+			return nil
+		},
+	}
+}
+
+func Tika(c *tika.Client) Check {
+	return Check{
+		Name: "tika",
+		Fn: func(ctx context.Context) error {
+			_, err := c.Version(ctx)
+			return err
+		},
+	}
+}
+
+// MinPeers fails while count() reports fewer than min connected peers.
+// It is kept generic so this package does not depend on the Kubo node.
+func MinPeers(name string, count func() int, min int) Check {
+	return Check{
+		Name: name,
+		Fn: func(ctx context.Context) error {
+			if n := count(); n < min {
+				return fmt.Errorf("%d peers connected, want >= %d", n, min)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/httpjson"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// Check is a single named dependency probe. Fn should return nil when the
+// dependency is usable by this process.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Fn      func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == "ok"
+}
+
+// Checker runs a set of checks concurrently, each bounded by its own timeout.
+//
+// Checks may be added after the HTTP handler is already serving; roles
+// register what they depend on as they start up.
+type Checker struct {
+	// Timeout is the default per-check timeout.
+	Timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []Check
+}
+
+func (c *Checker) Add(checks ...Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, checks...)
+}
+
+// Starting adds a "starting" check that fails until the returned func is
+// called, so the handler does not report ready while the process is still
+// adding its checks.
+func (c *Checker) Starting() (done func()) {
+	var started atomic.Bool
+	c.Add(Check{
+		Name: "starting",
+		Fn: func(context.Context) error {
+			if started.Load() {
+				return nil
+			}
+			return fmt.Errorf("still starting")
+		},
+	})
+	return func() {
+		started.Store(true)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.checks = slices.DeleteFunc(c.checks, func(chk Check) bool { return chk.Name == "starting" })
+	}
+}
+
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	rep := Report{Status: "ok", Checks: make([]CheckResult, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk Check) {
+			defer wg.Done()
+			rep.Checks[i] = c.runOne(ctx, chk)
+		}(i, chk)
+	}
+	wg.Wait()
+
+	for _, r := range rep.Checks {
+		if r.Status != "ok" {
+			rep.Status = "fail"
+			break
+		}
+	}
+	return rep
+}
+
+func (c *Checker) runOne(ctx context.Context, chk Check) CheckResult {
+	timeout := chk.Timeout
+	if timeout <= 0 {
+		timeout = c.Timeout
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		errCh <- chk.Fn(cctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-cctx.Done():
+		// Some client calls ignore ctx; don't let them hold up the report.
+		err = fmt.Errorf("timeout after %s", timeout)
+	}
+
+	res := CheckResult{Name: chk.Name, Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Status = "fail"
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Handler serves the JSON report: 200 when all checks pass, 503 otherwise.
+func (c *Checker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		rep := c.Run(r.Context())
+		status := http.StatusOK
+		if !rep.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		httpjson.Write(w, status, rep)
+	})
+}
+
+// Liveness is the trivial /healthz handler: the process is up and serving.
+func Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
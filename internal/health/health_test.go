@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChecker_AllOK(t *testing.T) {
+	c := &Checker{}
+	c.Add(Check{Name: "a", Fn: func(ctx context.Context) error { return nil }})
+
+	rep := c.Run(context.Background())
+	if !rep.OK() {
+		t.Fatalf("expected ok: %+v", rep)
+	}
+	if len(rep.Checks) != 1 || rep.Checks[0].Name != "a" || rep.Checks[0].Status != "ok" {
+		t.Fatalf("checks: %+v", rep.Checks)
+	}
+}
+
+func TestChecker_FailureAndTimeout(t *testing.T) {
+	c := &Checker{Timeout: 20 * time.Millisecond}
+	c.Add(
+		Check{Name: "ok", Fn: func(ctx context.Context) error { return nil }},
+		Check{Name: "bad", Fn: func(ctx context.Context) error { return errors.New("boom") }},
+		Check{Name: "slow", Fn: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+	)
+
+	start := time.Now()
+	rep := c.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("slow check held up the report")
+	}
+	if rep.OK() {
+		t.Fatalf("expected failure")
+	}
+	if rep.Checks[1].Error != "boom" {
+		t.Fatalf("bad: %+v", rep.Checks[1])
+	}
+	if rep.Checks[2].Status != "fail" {
+		t.Fatalf("slow: %+v", rep.Checks[2])
+	}
+}
+
+func TestHandler_StatusCodes(t *testing.T) {
+	c := &Checker{}
+	c.Add(Check{Name: "x", Fn: func(ctx context.Context) error { return errors.New("down") }})
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d", w.Code)
+	}
+	var rep Report
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if rep.Status != "fail" || len(rep.Checks) != 1 {
+		t.Fatalf("report: %+v", rep)
+	}
+
+	w = httptest.NewRecorder()
+	(&Checker{}).Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+}
+
+func TestMinPeers(t *testing.T) {
+	n := 0
+	chk := MinPeers("peers", func() int { return n }, 1)
+	if err := chk.Fn(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+	n = 3
+	if err := chk.Fn(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestChecker_Starting(t *testing.T) {
+	c := &Checker{}
+	started := c.Starting()
+	if c.Run(context.Background()).OK() {
+		t.Fatalf("expected not ready while starting")
+	}
+	c.Add(Check{Name: "ok", Fn: func(ctx context.Context) error { return nil }})
+	started()
+	rep := c.Run(context.Background())
+	if !rep.OK() || len(rep.Checks) != 1 || rep.Checks[0].Name != "ok" {
+		t.Fatalf("report: %+v", rep)
+	}
+}
@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Mux returns a handler exposing /healthz (liveness) and /readyz (readiness).
+func Mux(c *Checker) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", Liveness)
+	mux.Handle("/readyz", c.Handler())
+	return mux
+}
+
+// Serve runs a small HTTP listener for worker processes that otherwise have no
+// HTTP surface. It returns when ctx is cancelled or the listener fails.
+func Serve(ctx context.Context, addr string, c *Checker) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           Mux(c),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		return nil
+	}
+}
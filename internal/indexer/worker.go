@@ -18,19 +18,29 @@ import (
 	osapi "github.com/opensearch-project/opensearch-go/v4/opensearchapi"
 )
 
+// DefaultAlias is the read alias the server queries; the indexer points it at
+// the concrete index on startup.
+const DefaultAlias = "ipfsniffer-docs"
+
 type Worker struct {
 	NATS nats.JetStreamContext
-	OS   *osclient.Client
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus internalnats.Bus
+	OS  *osclient.Client
 
 	Durable    string
 	MaxDeliver int
 
+	// Claims resolves claim-checked index requests. Optional.
+	Claims *internalnats.ClaimStore
+
 	BulkMax       int
 	FlushInterval time.Duration
 }
 
 func (w *Worker) Run(ctx context.Context) error {
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats required")
 	}
 	if w.OS == nil {
@@ -46,11 +56,7 @@ func (w *Worker) Run(ctx context.Context) error {
 		w.Durable = "indexer"
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, w.NATS, internalnats.SubjectIndexRequest, w.Durable, w.MaxDeliver); err != nil {
-		return err
-	}
-
-	sub, err := w.NATS.PullSubscribe(internalnats.SubjectIndexRequest, w.Durable)
+	sub, err := w.Bus.PullSubscribe(ctx, internalnats.SubjectIndexRequest, w.Durable, internalnats.ConsumerOpts{MaxDeliver: w.MaxDeliver})
 	if err != nil {
 		return err
 	}
@@ -58,7 +64,7 @@ func (w *Worker) Run(ctx context.Context) error {
 	logger := logging.FromContext(ctx)
 	logger.Info("indexer started", "subject", internalnats.SubjectIndexRequest, "durable", w.Durable)
 
-	var batch []*nats.Msg
+	var batch []internalnats.Delivery
 	lastFlush := time.Now()
 
 	flush := func() error {
@@ -87,18 +93,21 @@ func (w *Worker) Run(ctx context.Context) error {
 			return ctx.Err()
 		}
 
-		msgs, err := sub.Fetch(1, nats.MaxWait(200*time.Millisecond))
+		msgs, err := sub.Fetch(ctx, 1, 200*time.Millisecond)
 		if err != nil {
-			if err == nats.ErrTimeout {
-				if time.Since(lastFlush) >= w.FlushInterval {
-					if err := flush(); err != nil {
-						logger.Error("flush", "err", err)
-					}
-				}
-				continue
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
 			return err
 		}
+		if len(msgs) == 0 {
+			if time.Since(lastFlush) >= w.FlushInterval {
+				if err := flush(); err != nil {
+					logger.Error("flush", "err", err)
+				}
+			}
+			continue
+		}
 
 		batch = append(batch, msgs...)
 		if len(batch) >= w.BulkMax {
@@ -109,11 +118,11 @@ func (w *Worker) Run(ctx context.Context) error {
 	}
 }
 
-func (w *Worker) flushBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.Msg, error) {
+func (w *Worker) flushBatch(ctx context.Context, msgs []internalnats.Delivery) ([]internalnats.Delivery, error) {
 	logger := logging.FromContext(ctx)
 
 	type bulkItem struct {
-		msg *nats.Msg
+		msg internalnats.Delivery
 		id  string
 	}
 
@@ -121,10 +130,20 @@ func (w *Worker) flushBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.Msg,
 	var body bytes.Buffer
 
 	for _, m := range msgs {
+		data, err := w.Claims.Resolve(ctx, m.Msg())
+		if err != nil {
+			if !internalnats.IsTerminal(err) {
+				return nil, err
+			}
+			_, _ = internalnats.PublishDLQ(internalnats.WithBusDelivery(ctx, w.Durable, m), w.Bus, internalnats.SubjectIndexRequest, m.Msg().Data, err)
+			items = append(items, bulkItem{msg: m, id: ""})
+			continue
+		}
+
 		var in ipfsnifferv1.IndexRequest
-		if err := codec.Unmarshal(m.Data, &in); err != nil {
+		if err := codec.Unmarshal(data, &in); err != nil {
 			// Malformed message; DLQ and continue.
-			_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectIndexRequest, m.Data)
+			_, _ = internalnats.PublishDLQ(internalnats.WithBusDelivery(ctx, w.Durable, m), w.Bus, internalnats.SubjectIndexRequest, m.Msg().Data, err)
 			items = append(items, bulkItem{msg: m, id: ""})
 			continue
 		}
@@ -165,7 +184,7 @@ func (w *Worker) flushBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.Msg,
 
 	// Happy path: ack everything.
 	if !resp.Errors {
-		acks := make([]*nats.Msg, 0, len(items))
+		acks := make([]internalnats.Delivery, 0, len(items))
 		for _, it := range items {
 			acks = append(acks, it.msg)
 		}
@@ -178,7 +197,7 @@ func (w *Worker) flushBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.Msg,
 		return nil, fmt.Errorf("bulk items mismatch: got %d want %d", len(resp.Items), len(items))
 	}
 
-	acks := make([]*nats.Msg, 0, len(items))
+	acks := make([]internalnats.Delivery, 0, len(items))
 	failed := 0
 	for i := range items {
 		// Each entry is like {"index": {...}}
@@ -194,16 +213,18 @@ func (w *Worker) flushBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.Msg,
 		}
 
 		failed++
-		// DLQ the original IndexRequest payload for inspection/replay.
-		_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectIndexRequest, items[i].msg.Data)
-		acks = append(acks, items[i].msg)
-
 		errType := ""
 		errReason := ""
 		if item.Error != nil {
 			errType = item.Error.Type
 			errReason = item.Error.Reason
 		}
+
+		// DLQ the original IndexRequest payload for inspection/replay.
+		cause := fmt.Errorf("bulk item status %d: %s: %s", item.Status, errType, errReason)
+		_, _ = internalnats.PublishDLQ(internalnats.WithBusDelivery(ctx, w.Durable, items[i].msg), w.Bus, internalnats.SubjectIndexRequest, items[i].msg.Msg().Data, cause)
+		acks = append(acks, items[i].msg)
+
 		logger.Error("bulk item failed", "doc_id", items[i].id, "status", item.Status, "err_type", errType, "err_reason", errReason)
 	}
 
@@ -212,7 +233,10 @@ func (w *Worker) flushBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.Msg,
 }
 
 // Optional helper: ensure index exists on startup.
-func EnsureDefaultIndex(ctx context.Context, c *osclient.Client, indexName string) error {
-	spec := opensearch.IndexSpec{IndexName: indexName, AliasName: "ipfsniffer-docs"}
+func EnsureDefaultIndex(ctx context.Context, c *osclient.Client, indexName, alias string) error {
+	if alias == "" {
+		alias = DefaultAlias
+	}
+	spec := opensearch.IndexSpec{IndexName: indexName, AliasName: alias}
 	return opensearch.EnsureIndex(ctx, c, spec, opensearch.DefaultMappingJSON)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
 	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
 
@@ -20,15 +21,29 @@ import (
 )
 
 type Worker struct {
-	NATS       nats.JetStreamContext
+	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus internalnats.Bus
+	// Conn enables max-delivery advisory handling. Optional.
+	Conn       *nats.Conn
 	Durable    string
 	MaxDeliver int
+	AckWait    time.Duration
+	// Concurrency bounds in-flight messages; Batch caps each pull. Both
+	// default to 1.
+	Concurrency int
+	Batch       int
+
+	// Claims moves large outputs to the object store and resolves claimed
+	// inputs. Optional.
+	Claims *internalnats.ClaimStore
 
 	IndexName string
 }
 
 func (w *Worker) Run(ctx context.Context) error {
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats required")
 	}
 	if w.IndexName == "" {
@@ -38,40 +53,28 @@ func (w *Worker) Run(ctx context.Context) error {
 		w.Durable = "index-prep"
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, w.NATS, internalnats.SubjectDocReady, w.Durable, w.MaxDeliver); err != nil {
-		return err
-	}
-
-	sub, err := w.NATS.PullSubscribe(internalnats.SubjectDocReady, w.Durable)
-	if err != nil {
-		return err
-	}
-
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
-		if err != nil {
-			if err == nats.ErrTimeout {
-				continue
-			}
-			return err
-		}
-
-		for _, msg := range msgs {
-			if err := w.handle(ctx, msg); err != nil {
-				continue
-			}
-			_ = msg.Ack()
-		}
+	logging.FromContext(ctx).Info("index-prep started", "subject", internalnats.SubjectDocReady, "durable", w.Durable)
+
+	c := &internalnats.Consumer{
+		NATS:        w.NATS,
+		Bus:         w.Bus,
+		Conn:        w.Conn,
+		Subject:     internalnats.SubjectDocReady,
+		Durable:     w.Durable,
+		MaxDeliver:  w.MaxDeliver,
+		AckWait:     w.AckWait,
+		Concurrency: w.Concurrency,
+		Batch:       w.Batch,
+		Claims:      w.Claims,
+		Handler:     w.handle,
 	}
+	return c.Run(ctx)
 }
 
 func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 	var in ipfsnifferv1.DocReady
 	if err := codec.Unmarshal(msg.Data, &in); err != nil {
-		return err
+		return internalnats.Terminal(err)
 	}
 	d := in.GetData()
 	if d == nil {
@@ -139,8 +142,9 @@ func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
 		return err
 	}
 
-	if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectIndexRequest, payload); err != nil {
-		_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectIndexRequest, payload)
+	id := internalnats.MsgID(internalnats.ParentMsgID(msg), internalnats.SubjectIndexRequest, docID)
+	if _, err := w.Claims.Publish(ctx, w.Bus, internalnats.SubjectIndexRequest, payload, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectIndexRequest, id, payload, err)
 		return err
 	}
 	return nil
@@ -0,0 +1,205 @@
+//go:build integration
+
+package ipnsreg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// newTestRegistry returns a Registry under a fresh prefix on the test Redis
+// and deletes its keys when the test ends.
+func newTestRegistry(t *testing.T, cfg Config) *Registry {
+	t.Helper()
+	addr := os.Getenv("IPFSNIFFER_IT_REDIS_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:6379"
+	}
+	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("redis: %v", err)
+	}
+
+	cfg.Prefix = fmt.Sprintf("{ipfsniffer-it:ipns:%d}", time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx := context.Background()
+		keys, _ := rdb.Keys(ctx, cfg.Prefix+":*").Result()
+		if len(keys) > 0 {
+			_ = rdb.Del(ctx, keys...).Err()
+		}
+	})
+	return &Registry{Redis: rdb, Config: cfg}
+}
+
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.MinInterval = time.Minute
+	cfg.MaxInterval = 4 * time.Minute
+	return cfg
+}
+
+func TestIntegration_EvictsLeastRecentlySeen(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.MaxNames = 2
+	r := newTestRegistry(t, cfg)
+
+	for _, n := range []string{"a", "b", "a", "c"} {
+		if err := r.Observe(ctx, n); err != nil {
+			t.Fatalf("observe %s: %v", n, err)
+		}
+		// Last-seen times are in milliseconds.
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, _, err := r.Resolved(ctx, "a", Record{Path: "/ipfs/a", Seq: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for n, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		_, ok, err := r.Get(ctx, n)
+		if err != nil || ok != want {
+			t.Fatalf("Get(%s) = %v, %v; want %v", n, ok, err, want)
+		}
+	}
+	s, err := r.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Names != 2 || s.Evicted != 1 {
+		t.Fatalf("stats: %+v", s)
+	}
+	active, err := r.Active(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(active, "b") || len(active) != 2 {
+		t.Fatalf("active = %q", active)
+	}
+}
+
+func TestIntegration_IgnoresOlderSeq(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t, testConfig())
+
+	for _, tc := range []struct {
+		path    string
+		seq     uint64
+		value   string
+		changed bool
+	}{
+		{"/ipfs/nine", 9, "/ipfs/nine", true},
+		{"/ipfs/eight", 8, "/ipfs/nine", false},
+		// Compared as numbers, not strings: "10" < "9".
+		{"/ipfs/ten", 10, "/ipfs/ten", true},
+		{"/ipfs/nine", 9, "/ipfs/ten", false},
+	} {
+		value, changed, err := r.Resolved(ctx, "name", Record{Path: tc.path, Seq: tc.seq})
+		if err != nil || value != tc.value || changed != tc.changed {
+			t.Fatalf("Resolved(%s, %d) = %q, %v, %v; want %q, %v", tc.path, tc.seq, value, changed, err, tc.value, tc.changed)
+		}
+	}
+	n, ok, err := r.Get(ctx, "name")
+	if err != nil || !ok {
+		t.Fatalf("Get = %v, %v", ok, err)
+	}
+	if n.Value != "/ipfs/ten" || n.Seq != 10 || n.Changes != 2 {
+		t.Fatalf("entry: %+v", n)
+	}
+}
+
+func TestIntegration_IntervalBounds(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t, testConfig())
+
+	interval := func() float64 {
+		t.Helper()
+		n, _, err := r.Get(ctx, "name")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.IntervalSeconds
+	}
+	seq := uint64(0)
+	resolve := func(path string) {
+		t.Helper()
+		seq++
+		if _, _, err := r.Resolved(ctx, "name", Record{Path: path, Seq: seq}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unchanged values double the interval up to MaxInterval, changes halve
+	// it down to MinInterval.
+	for _, tc := range []struct {
+		path string
+		want float64
+	}{
+		{"/ipfs/a", 60},
+		{"/ipfs/a", 120},
+		{"/ipfs/a", 240},
+		{"/ipfs/a", 240},
+		{"/ipfs/b", 120},
+		{"/ipfs/c", 60},
+		{"/ipfs/d", 60},
+	} {
+		resolve(tc.path)
+		if got := interval(); got != tc.want {
+			t.Fatalf("after %s: interval %vs, want %vs", tc.path, got, tc.want)
+		}
+	}
+
+	// Failures back off up to MaxInterval too.
+	for _, want := range []float64{120, 240, 240} {
+		if err := r.Failed(ctx, "name"); err != nil {
+			t.Fatal(err)
+		}
+		if got := interval(); got != want {
+			t.Fatalf("after failure: interval %vs, want %vs", got, want)
+		}
+	}
+}
+
+func TestIntegration_HistoryTrimAndPaging(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.HistoryMax = 3
+	r := newTestRegistry(t, cfg)
+
+	for i := 1; i <= 5; i++ {
+		if _, _, err := r.Resolved(ctx, "name", Record{Path: fmt.Sprintf("/ipfs/v%d", i), Seq: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := func(from, size int) []string {
+		t.Helper()
+		page, ok, err := r.History(ctx, "name", from, size)
+		if err != nil || !ok {
+			t.Fatalf("History(%d, %d) = %v, %v", from, size, ok, err)
+		}
+		if page.Total != 3 {
+			t.Fatalf("total = %d, want 3", page.Total)
+		}
+		var out []string
+		for _, c := range page.Changes {
+			out = append(out, c.Path)
+		}
+		return out
+	}
+	if got := paths(0, 2); !slices.Equal(got, []string{"/ipfs/v5", "/ipfs/v4"}) {
+		t.Fatalf("first page = %q", got)
+	}
+	if got := paths(2, 2); !slices.Equal(got, []string{"/ipfs/v3"}) {
+		t.Fatalf("second page = %q", got)
+	}
+	if _, ok, err := r.History(ctx, "unknown", 0, 2); err != nil || ok {
+		t.Fatalf("unknown name: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,517 @@
+// Package ipnsreg is the registry of observed IPNS names.
+//
+// Every name the sniffers or the resolver see gets a Redis hash with the
+// value, sequence number, validity and TTL of its latest record, plus
+// first/last seen times and observation and change counts. Each change of
+// value is appended to the name's history. A sorted set schedules the
+// re-resolution of every name: the interval halves each time the value
+// changed and doubles each time it did not, within MinInterval and
+// MaxInterval, and a fresh observation pulls a name due within MinInterval.
+// Another ranks the names by activity, each observation and change adding
+// weight that halves every ActivityHalfLife.
+package ipnsreg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+
+	boxoipns "github.com/ipfs/boxo/ipns"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	Enabled bool
+	// Prefix namespaces the Redis keys. On Redis Cluster it needs a hash
+	// tag, e.g. "{ipfsniffer:ipns}", so that every key shares a slot.
+	Prefix string
+	// MinInterval and MaxInterval bound how often a name is re-resolved.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// MaxNames caps the registered names; once it is reached each new name
+	// evicts the one seen least recently. 0 is unlimited.
+	MaxNames int
+	// MaxFailures drops a name after that many failed resolutions in a
+	// row; 0 keeps retrying it.
+	MaxFailures int
+	// HistoryMax caps the changes kept per name; 0 keeps them all.
+	HistoryMax int
+	// ActivityHalfLife is how fast past observations and changes lose
+	// weight in the activity ranking.
+	ActivityHalfLife time.Duration
+	// StatsInterval is how often the resolver logs the registry's counters.
+	// 0 disables it.
+	StatsInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:     true,
+		Prefix:      "ipfsniffer:ipns",
+		MinInterval: 10 * time.Minute,
+		MaxInterval: 24 * time.Hour,
+		MaxNames:    100000,
+		HistoryMax:  1000,
+
+		MaxFailures: 10,
+
+		ActivityHalfLife: 6 * time.Hour,
+		StatsInterval:    5 * time.Minute,
+	}
+}
+
+// Record is what an IPNS record says about its name.
+type Record struct {
+	// Path is the record's value, /ipfs/... or /ipns/....
+	Path     string
+	Seq      uint64
+	Validity time.Time
+	TTL      time.Duration
+}
+
+// FromIPNS reads the fields of rec.
+func FromIPNS(rec *boxoipns.Record) (Record, error) {
+	v, err := rec.Value()
+	if err != nil {
+		return Record{}, fmt.Errorf("ipns record value: %w", err)
+	}
+	r := Record{Path: v.String()}
+	if r.Seq, err = rec.Sequence(); err != nil {
+		return Record{}, fmt.Errorf("ipns record sequence: %w", err)
+	}
+	if r.Validity, err = rec.Validity(); err != nil {
+		return Record{}, fmt.Errorf("ipns record validity: %w", err)
+	}
+	// The TTL is optional in older records.
+	r.TTL, _ = rec.TTL()
+	return r, nil
+}
+
+// Name is the registry entry of one name.
+type Name struct {
+	Name         string    `json:"name"`
+	Value        string    `json:"value,omitempty"`
+	Seq          uint64    `json:"seq"`
+	Validity     time.Time `json:"validity,omitzero"`
+	TTLSeconds   float64   `json:"ttl_seconds,omitempty"`
+	FirstSeen    time.Time `json:"first_seen,omitzero"`
+	LastSeen     time.Time `json:"last_seen,omitzero"`
+	LastResolved time.Time `json:"last_resolved,omitzero"`
+	LastChanged  time.Time `json:"last_changed,omitzero"`
+	Observations int64     `json:"observations"`
+	Changes      int64     `json:"changes"`
+	Failures     int64     `json:"failures"`
+	// IntervalSeconds is the current re-resolution interval.
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+}
+
+// Change is one history entry: the value name changed to.
+type Change struct {
+	Path     string    `json:"path"`
+	Seq      uint64    `json:"seq"`
+	Validity time.Time `json:"validity,omitzero"`
+	At       time.Time `json:"at"`
+}
+
+// HistoryPage is one page of a name's changes, newest first.
+type HistoryPage struct {
+	Name    Name     `json:"name"`
+	Total   int64    `json:"total"`
+	From    int      `json:"from"`
+	Size    int      `json:"size"`
+	Changes []Change `json:"changes"`
+}
+
+// Registry keeps the names in Redis. A nil *Registry records nothing.
+type Registry struct {
+	Redis  *goredis.Client
+	Config Config
+}
+
+func (r *Registry) nameKey(name string) string    { return r.Config.Prefix + ":name:" + name }
+func (r *Registry) historyKey(name string) string { return r.Config.Prefix + ":history:" + name }
+func (r *Registry) dueKey() string                { return r.Config.Prefix + ":due" }
+func (r *Registry) activeKey() string             { return r.Config.Prefix + ":active" }
+func (r *Registry) seenKey() string               { return r.Config.Prefix + ":seen" }
+func (r *Registry) statsKey() string              { return r.Config.Prefix + ":stats" }
+
+// activity is the weight of an event at now in the ranking, as a base 2
+// logarithm: the weight itself, 2^(t/ActivityHalfLife), would overflow.
+func (r *Registry) activity(now time.Time) float64 {
+	return float64(now.UnixMilli()) / float64(r.Config.ActivityHalfLife.Milliseconds())
+}
+
+// Key is the registry key of name, an IPNS key with or without /ipns/: its
+// canonical string form, so that every encoding of a key maps to one entry.
+func Key(name string) string {
+	name = strings.TrimPrefix(name, "/ipns/")
+	if n, err := boxoipns.NameFromString(name); err == nil {
+		return n.String()
+	}
+	return name
+}
+
+// keys returns the KEYS of the registry scripts for name and, when set,
+// victim, the name evicted to make room for it: Redis Cluster requires
+// every key a script touches to be passed in KEYS.
+func (r *Registry) keys(name, victim string) []string {
+	keys := []string{r.dueKey(), r.seenKey(), r.activeKey(), r.statsKey(), r.nameKey(name), r.historyKey(name)}
+	if victim != "" {
+		keys = append(keys, r.nameKey(victim), r.historyKey(victim))
+	}
+	return keys
+}
+
+// maxEvictTries bounds the runs of a script that keeps finding another
+// name to evict, when concurrent scripts race for the same slot.
+const maxEvictTries = 3
+
+// evalAdmit runs script, which may register name, and returns its reply.
+// The name to evict is only known inside the script, so when the registry
+// is full and it was not given that name's keys, it replies {-1, name} and
+// is run again with them.
+func (r *Registry) evalAdmit(ctx context.Context, script, name string, args ...any) ([]any, error) {
+	victim := ""
+	for range maxEvictTries {
+		argv := append([]any{victim, r.Config.MaxNames, name}, args...)
+		res, err := r.Redis.Eval(ctx, script, r.keys(name, victim), argv...).Slice()
+		if err != nil {
+			return nil, err
+		}
+		if len(res) == 2 && res[0] == int64(-1) {
+			victim, _ = res[1].(string)
+			continue
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("no eviction after %d tries", maxEvictTries)
+}
+
+// registryScript is the prelude of the scripts; they take the keys listed
+// by keys and, as ARGV[1] to ARGV[3], the name to evict, MaxNames and the
+// name. A sorted set of when each name was last seen picks the name
+// evicted when the registry is full.
+const registryScript = `
+local victim, maxNames = ARGV[1], tonumber(ARGV[2])
+local dueKey, seenKey, activeKey, statsKey = KEYS[1], KEYS[2], KEYS[3], KEYS[4]
+local nameKey, historyKey = KEYS[5], KEYS[6]
+local function drop(n, nk, hk)
+  redis.call('DEL', nk, hk)
+  redis.call('ZREM', dueKey, n)
+  redis.call('ZREM', seenKey, n)
+  redis.call('ZREM', activeKey, n)
+end
+-- admit returns true once n is registered, false when it cannot be and
+-- the name to evict when that is not victim, whose keys were passed.
+local function admit(n, now)
+  if redis.call('ZSCORE', dueKey, n) then return true end
+  if maxNames > 0 and redis.call('ZCARD', dueKey) >= maxNames then
+    local oldest = redis.call('ZRANGE', seenKey, 0, 0)
+    -- Names registered before the seen set existed: the one due last.
+    if #oldest == 0 then oldest = redis.call('ZREVRANGE', dueKey, 0, 0) end
+    if #oldest == 0 then
+      redis.call('HINCRBY', statsKey, 'refused', 1)
+      return false
+    end
+    if oldest[1] ~= victim then return oldest[1] end
+    drop(victim, KEYS[7], KEYS[8])
+    redis.call('HINCRBY', statsKey, 'evicted', 1)
+  end
+  redis.call('HSETNX', nameKey, 'first_seen', now)
+  redis.call('ZADD', seenKey, 'NX', now, n)
+  return true
+end
+-- bump adds 2^x to the score of member, both held as base 2 logarithms,
+-- and keeps the maxNames best scores.
+local function bump(key, member, x)
+  local s = tonumber(redis.call('ZSCORE', key, member))
+  if s then
+    local hi, lo = math.max(s, x), math.min(s, x)
+    x = hi + math.log(1 + 2 ^ (lo - hi)) / math.log(2)
+  end
+  redis.call('ZADD', key, x, member)
+  if maxNames > 0 then redis.call('ZREMRANGEBYRANK', key, 0, -(maxNames + 1)) end
+end
+`
+
+// Observe records a sighting of name, an IPNS key with or without /ipns/.
+// A new name evicts the one seen least recently when the registry is full.
+func (r *Registry) Observe(ctx context.Context, name string) error {
+	if r == nil {
+		return nil
+	}
+	name = Key(name)
+	now := time.Now()
+	_, err := r.evalAdmit(ctx, observeScript, name,
+		now.UnixMilli(), now.Add(r.Config.MinInterval).UnixMilli(), r.activity(now))
+	if err != nil {
+		return fmt.Errorf("ipns observe %s: %w", name, err)
+	}
+	return nil
+}
+
+const observeScript = registryScript + `
+local n, now = ARGV[3], ARGV[4]
+local admitted = admit(n, now)
+if admitted == false then return {0} end
+if admitted ~= true then return {-1, admitted} end
+local due = redis.call('ZSCORE', dueKey, n)
+if not due or tonumber(due) > tonumber(ARGV[5]) then
+  redis.call('ZADD', dueKey, ARGV[5], n)
+end
+redis.call('ZADD', seenKey, now, n)
+redis.call('HSET', nameKey, 'last_seen', now)
+redis.call('HINCRBY', nameKey, 'observations', 1)
+bump(activeKey, n, tonumber(ARGV[6]))
+return {1}`
+
+// Resolved stores rec as the latest record of name and schedules its next
+// resolution. It returns the current value of name and reports whether it
+// changed, appending the change to the history. A record older than the
+// stored one is ignored, and the stored value returned.
+func (r *Registry) Resolved(ctx context.Context, name string, rec Record) (string, bool, error) {
+	if r == nil {
+		return rec.Path, false, nil
+	}
+	name = Key(name)
+	now := time.Now()
+	var validity int64
+	if !rec.Validity.IsZero() {
+		validity = rec.Validity.UnixMilli()
+	}
+	entry, err := json.Marshal(Change{Path: rec.Path, Seq: rec.Seq, Validity: rec.Validity.UTC(), At: now.UTC()})
+	if err != nil {
+		return "", false, err
+	}
+	res, err := r.evalAdmit(ctx, resolvedScript, name, now.UnixMilli(),
+		rec.Path, strconv.FormatUint(rec.Seq, 10), validity, rec.TTL.Milliseconds(),
+		r.Config.MinInterval.Milliseconds(), r.Config.MaxInterval.Milliseconds(), r.Config.HistoryMax,
+		string(entry), r.activity(now))
+	if err != nil {
+		return "", false, fmt.Errorf("ipns resolved %s: %w", name, err)
+	}
+	value := rec.Path
+	if len(res) == 2 {
+		if v, ok := res[1].(string); ok {
+			value = v
+		}
+	}
+	return value, res[0] == int64(1), nil
+}
+
+// Sequence numbers are compared as decimal strings: they are uint64, which
+// Lua numbers cannot hold exactly.
+const resolvedScript = registryScript + `
+local function older(a, b)
+  if #a ~= #b then return #a < #b end
+  return a < b
+end
+local n, now = ARGV[3], ARGV[4]
+local admitted = admit(n, now)
+if admitted == false then return {0, ARGV[5]} end
+if admitted ~= true then return {-1, admitted} end
+local seq = redis.call('HGET', nameKey, 'seq')
+if seq and older(ARGV[6], seq) then
+  return {0, redis.call('HGET', nameKey, 'value') or ARGV[5]}
+end
+local prev = redis.call('HGET', nameKey, 'value')
+local interval = tonumber(redis.call('HGET', nameKey, 'interval_ms') or ARGV[9])
+local changed = 0
+if prev ~= ARGV[5] then
+  changed = 1
+  redis.call('RPUSH', historyKey, ARGV[12])
+  if tonumber(ARGV[11]) > 0 then redis.call('LTRIM', historyKey, -tonumber(ARGV[11]), -1) end
+  redis.call('HINCRBY', nameKey, 'changes', 1)
+  redis.call('HSET', nameKey, 'last_changed', now)
+  bump(activeKey, n, tonumber(ARGV[13]))
+  if prev then interval = math.max(tonumber(ARGV[9]), math.floor(interval / 2)) end
+else
+  interval = math.min(tonumber(ARGV[10]), interval * 2)
+end
+redis.call('HSET', nameKey, 'value', ARGV[5], 'seq', ARGV[6], 'validity', ARGV[7], 'ttl_ms', ARGV[8],
+  'last_resolved', now, 'interval_ms', interval, 'failures', 0)
+redis.call('ZADD', dueKey, tonumber(now) + interval, n)
+return {changed, ARGV[5]}`
+
+// Failed backs off the next resolution of name after a failed one. After
+// MaxFailures failures in a row the name is dropped.
+func (r *Registry) Failed(ctx context.Context, name string) error {
+	if r == nil {
+		return nil
+	}
+	name = Key(name)
+	now := time.Now()
+	err := r.Redis.Eval(ctx, failedScript, r.keys(name, ""),
+		"", r.Config.MaxNames, name, now.UnixMilli(),
+		r.Config.MinInterval.Milliseconds(), r.Config.MaxInterval.Milliseconds(), r.Config.MaxFailures).Err()
+	if err != nil {
+		return fmt.Errorf("ipns failed %s: %w", name, err)
+	}
+	return nil
+}
+
+const failedScript = registryScript + `
+local n, now = ARGV[3], ARGV[4]
+if not redis.call('ZSCORE', dueKey, n) then return 0 end
+local failures = redis.call('HINCRBY', nameKey, 'failures', 1)
+if tonumber(ARGV[7]) > 0 and failures >= tonumber(ARGV[7]) then
+  drop(n, nameKey, historyKey)
+  redis.call('HINCRBY', statsKey, 'dropped', 1)
+  return 2
+end
+local interval = math.min(tonumber(ARGV[6]), tonumber(redis.call('HGET', nameKey, 'interval_ms') or ARGV[5]) * 2)
+redis.call('HSET', nameKey, 'interval_ms', interval)
+redis.call('ZADD', dueKey, tonumber(now) + interval, n)
+return 1`
+
+// Stats counts the registered names and those the cap turned away.
+type Stats struct {
+	Names int64 `json:"names"`
+	// Evicted counts the names dropped to make room for new ones, Dropped
+	// those dropped after MaxFailures failures and Refused the new names
+	// not registered because no name could be evicted.
+	Evicted int64 `json:"evicted"`
+	Dropped int64 `json:"dropped"`
+	Refused int64 `json:"refused"`
+}
+
+// Stats returns the registry's counters, shared by every process using it.
+func (r *Registry) Stats(ctx context.Context) (Stats, error) {
+	pipe := r.Redis.Pipeline()
+	names := pipe.ZCard(ctx, r.dueKey())
+	counts := pipe.HMGet(ctx, r.statsKey(), "evicted", "dropped", "refused")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Stats{}, fmt.Errorf("ipns stats: %w", err)
+	}
+	s := Stats{Names: names.Val()}
+	for i, p := range []*int64{&s.Evicted, &s.Dropped, &s.Refused} {
+		if v, ok := counts.Val()[i].(string); ok {
+			*p, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return s, nil
+}
+
+// LogStats logs Stats every interval until ctx is done.
+func (r *Registry) LogStats(ctx context.Context, interval time.Duration) {
+	if r == nil || interval <= 0 {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		s, err := r.Stats(ctx)
+		if err != nil {
+			logger.Warn("ipns registry stats", "err", err)
+			continue
+		}
+		logger.Info("ipns registry stats", "names", s.Names, "evicted", s.Evicted, "dropped", s.Dropped, "refused", s.Refused)
+	}
+}
+
+// Due claims up to n names due at now. Each is leased for MinInterval, so
+// concurrent schedulers do not claim it twice; Resolved or Failed then set
+// its real next time.
+func (r *Registry) Due(ctx context.Context, now time.Time, n int) ([]string, error) {
+	res, err := r.Redis.Eval(ctx, claimScript, []string{r.dueKey()},
+		now.UnixMilli(), n, now.Add(r.Config.MinInterval).UnixMilli()).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("ipns due: %w", err)
+	}
+	return res, nil
+}
+
+const claimScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, d in ipairs(due) do redis.call('ZADD', KEYS[1], ARGV[3], d) end
+return due`
+
+// Active returns up to n names, most active first.
+func (r *Registry) Active(ctx context.Context, n int) ([]string, error) {
+	if r == nil || n <= 0 {
+		return nil, nil
+	}
+	names, err := r.Redis.ZRevRange(ctx, r.activeKey(), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ipns active: %w", err)
+	}
+	return names, nil
+}
+
+// Get returns the entry of name. It reports false when the name was never
+// registered.
+func (r *Registry) Get(ctx context.Context, name string) (Name, bool, error) {
+	name = Key(name)
+	m, err := r.Redis.HGetAll(ctx, r.nameKey(name)).Result()
+	if err != nil {
+		return Name{}, false, fmt.Errorf("ipns get %s: %w", name, err)
+	}
+	if len(m) == 0 {
+		return Name{}, false, nil
+	}
+	return parseName(name, m), true, nil
+}
+
+// History returns the changes of name, newest first. It reports false when
+// the name was never registered.
+func (r *Registry) History(ctx context.Context, name string, from, size int) (HistoryPage, bool, error) {
+	name = Key(name)
+	pipe := r.Redis.Pipeline()
+	fields := pipe.HGetAll(ctx, r.nameKey(name))
+	total := pipe.LLen(ctx, r.historyKey(name))
+	entries := pipe.LRange(ctx, r.historyKey(name), int64(-(from + size)), int64(-(from + 1)))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return HistoryPage{}, false, fmt.Errorf("ipns history %s: %w", name, err)
+	}
+	if len(fields.Val()) == 0 {
+		return HistoryPage{}, false, nil
+	}
+
+	page := HistoryPage{Name: parseName(name, fields.Val()), Total: total.Val(), From: from, Size: size, Changes: []Change{}}
+	vals := entries.Val()
+	for i := len(vals) - 1; i >= 0; i-- {
+		var c Change
+		if err := json.Unmarshal([]byte(vals[i]), &c); err != nil {
+			continue
+		}
+		page.Changes = append(page.Changes, c)
+	}
+	return page, true, nil
+}
+
+func parseName(name string, m map[string]string) Name {
+	n := Name{Name: name, Value: m["value"]}
+	n.Seq, _ = strconv.ParseUint(m["seq"], 10, 64)
+	ms := func(k string) int64 {
+		v, _ := strconv.ParseInt(m[k], 10, 64)
+		return v
+	}
+	at := func(k string) time.Time {
+		if v := ms(k); v > 0 {
+			return time.UnixMilli(v).UTC()
+		}
+		return time.Time{}
+	}
+	n.Validity = at("validity")
+	n.TTLSeconds = time.Duration(ms("ttl_ms") * int64(time.Millisecond)).Seconds()
+	n.FirstSeen = at("first_seen")
+	n.LastSeen = at("last_seen")
+	n.LastResolved = at("last_resolved")
+	n.LastChanged = at("last_changed")
+	n.Observations = ms("observations")
+	n.Changes = ms("changes")
+	n.Failures = ms("failures")
+	n.IntervalSeconds = time.Duration(ms("interval_ms") * int64(time.Millisecond)).Seconds()
+	return n
+}
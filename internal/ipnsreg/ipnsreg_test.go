@@ -0,0 +1,55 @@
+package ipnsreg
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	boxoipns "github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestFromIPNS(t *testing.T) {
+	sk, _, err := ic.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := path.NewPath("/ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eol := time.Now().Add(time.Hour).Truncate(time.Second)
+	rec, err := boxoipns.NewRecord(sk, p, 7, eol, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromIPNS(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != p.String() || got.Seq != 7 || !got.Validity.Equal(eol) || got.TTL != 5*time.Minute {
+		t.Fatalf("record %+v", got)
+	}
+}
+
+func TestKey(t *testing.T) {
+	sk, _, err := ic.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := boxoipns.NameFromPeer(id).String()
+	for _, in := range []string{want, "/ipns/" + want, id.String()} {
+		if got := Key(in); got != want {
+			t.Fatalf("Key(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := Key("/ipns/not-a-key"); got != "not-a-key" {
+		t.Fatalf("Key(not-a-key) = %q", got)
+	}
+}
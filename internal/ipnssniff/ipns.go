@@ -3,6 +3,8 @@ package ipnssniff
 import (
 	"strings"
 
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
+
 	boxoipns "github.com/ipfs/boxo/ipns"
 )
 
@@ -22,6 +24,21 @@ func ExtractIPFSPathFromIPNSRecord(recordBytes []byte) (string, bool) {
 	return "", false
 }
 
+// ParseIPNSRecord parses recordBytes as a record of namePath (/ipns/<key>),
+// reporting false unless it is validly signed by the name and unexpired.
+func ParseIPNSRecord(namePath string, recordBytes []byte) (ipnsreg.Record, bool) {
+	name, err := boxoipns.NameFromString(strings.TrimPrefix(namePath, "/ipns/"))
+	if err != nil {
+		return ipnsreg.Record{}, false
+	}
+	rec, err := boxoipns.UnmarshalRecord(recordBytes)
+	if err != nil || boxoipns.ValidateWithName(rec, name) != nil {
+		return ipnsreg.Record{}, false
+	}
+	r, err := ipnsreg.FromIPNS(rec)
+	return r, err == nil
+}
+
 func IPNSRoutingKeyToNamePath(key string) (string, bool) {
 	// key is expected to be "/ipns/" + binary peerid bytes.
 	// It is important we pass raw bytes (not an UTF-8 string of the key path).
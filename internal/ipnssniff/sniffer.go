@@ -2,37 +2,199 @@ package ipnssniff
 
 import (
 	"context"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
+	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
-	"github.com/Rorical/IPFSniffer/internal/redis"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
 	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
 
 	nats "github.com/nats-io/nats.go"
-	goredis "github.com/redis/go-redis/v9"
 )
 
+// DefaultNameQueueSize bounds the name sightings a Sniffer holds for Run.
+const DefaultNameQueueSize = 4096
+
+// recentMax bounds the sightings remembered for dedupe.
+const recentMax = 65536
+
+// dropLogInterval is how often Run logs the sightings dropped since it last
+// did.
+const dropLogInterval = time.Minute
+
 type Sniffer struct {
-	NATS   nats.JetStreamContext
-	Redis  *goredis.Client
-	Dedupe redis.Dedupe
+	NATS    nats.JetStreamContext
+	Deduper dedupe.Deduper
+	// Popularity counts every observation, duplicates included. Optional.
+	Popularity *popularity.Tracker
+	// Names registers the IPNS names seen and their records. Optional.
+	Names *ipnsreg.Registry
+	// NameQueueSize bounds the name sightings waiting for Run; 0 uses
+	// DefaultNameQueueSize.
+	NameQueueSize int
+
+	once    sync.Once
+	queue   chan sighting
+	dropped atomic.Uint64
+
+	mu     sync.Mutex
+	recent map[string]time.Time
+	seed   maphash.Seed
 }
 
-func (s *Sniffer) PublishCID(ctx context.Context, cidOrPath, source, sourceDetail, peerID string) error {
-	if s.NATS == nil || s.Redis == nil {
+// sighting is a name to observe, a record of it to store, or both.
+type sighting struct {
+	name    string
+	observe bool
+	record  []byte
+}
+
+func (s *Sniffer) init() {
+	s.once.Do(func() {
+		n := s.NameQueueSize
+		if n <= 0 {
+			n = DefaultNameQueueSize
+		}
+		s.queue = make(chan sighting, n)
+		s.recent = map[string]time.Time{}
+		s.seed = maphash.MakeSeed()
+	})
+}
+
+// ObserveName queues a sighting of namePath (/ipns/<key>) for Names,
+// together with record when it is a valid record of the name. It never
+// blocks, as it runs inside DHT operations: a name is queued once per
+// MinInterval of Names, and a record once per interval too, so a lookup
+// touching the datastore several times counts once. Sightings arriving
+// while the queue is full are dropped and counted.
+func (s *Sniffer) ObserveName(namePath string, record []byte) {
+	if s == nil || s.Names == nil {
+		return
+	}
+	s.init()
+	now := time.Now()
+	recKey := ""
+	if len(record) > 0 {
+		recKey = namePath + "#" + strconv.FormatUint(maphash.Bytes(s.seed, record), 16)
+	}
+	sg := sighting{name: namePath, observe: s.fresh(namePath, now)}
+	if recKey != "" && s.fresh(recKey, now) {
+		sg.record = record
+	}
+	if !sg.observe && sg.record == nil {
+		return
+	}
+	select {
+	case s.queue <- sg:
+	default:
+		s.dropped.Add(1)
+		// Let the next sighting try again.
+		s.mu.Lock()
+		if sg.observe {
+			delete(s.recent, namePath)
+		}
+		if sg.record != nil {
+			delete(s.recent, recKey)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// fresh reports whether key was not seen within MinInterval, remembering
+// it if so.
+func (s *Sniffer) fresh(key string, now time.Time) bool {
+	interval := s.Names.Config.MinInterval
+	if interval <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if at, ok := s.recent[key]; ok && now.Sub(at) < interval {
+		return false
+	}
+	if len(s.recent) >= recentMax {
+		for k, at := range s.recent {
+			if now.Sub(at) >= interval {
+				delete(s.recent, k)
+			}
+		}
+		if len(s.recent) >= recentMax {
+			clear(s.recent)
+		}
+	}
+	s.recent[key] = now
+	return true
+}
+
+// DroppedNames counts the name sightings dropped because the queue was
+// full.
+func (s *Sniffer) DroppedNames() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
+
+// Run registers the queued name sightings with Names until ctx is done.
+func (s *Sniffer) Run(ctx context.Context) {
+	if s == nil || s.Names == nil {
+		return
+	}
+	s.init()
+	logger := logging.FromContext(ctx)
+	tick := time.NewTicker(dropLogInterval)
+	defer tick.Stop()
+	var logged uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if n := s.DroppedNames(); n > logged {
+				logger.Warn("ipns name sightings dropped, queue full", "dropped", n-logged, "total", n)
+				logged = n
+			}
+		case sg := <-s.queue:
+			if err := s.register(ctx, sg); err != nil {
+				logger.Warn("ipnssniff: register IPNS name", "name", sg.name, "err", err)
+			}
+		}
+	}
+}
+
+func (s *Sniffer) register(ctx context.Context, sg sighting) error {
+	if sg.observe {
+		if err := s.Names.Observe(ctx, sg.name); err != nil {
+			return err
+		}
+	}
+	if sg.record == nil {
 		return nil
 	}
-	if s.Dedupe.Prefix == "" {
-		s.Dedupe.Prefix = "ipfsniffer:seen:cid"
+	rec, ok := ParseIPNSRecord(sg.name, sg.record)
+	if !ok {
+		return nil
 	}
-	if s.Dedupe.TTL == 0 {
-		s.Dedupe.TTL = 24 * time.Hour
+	_, _, err := s.Names.Resolved(ctx, sg.name, rec)
+	return err
+}
+
+func (s *Sniffer) PublishCID(ctx context.Context, cidOrPath, source, sourceDetail, peerID string) error {
+	if s.NATS == nil || s.Deduper == nil {
+		return nil
 	}
 
-	seen, err := s.Dedupe.Seen(ctx, s.Redis, source+":"+cidOrPath)
+	s.Popularity.Observe(cidOrPath, source, sourceDetail, peerID)
+	seen, err := s.Deduper.Seen(ctx, source+":"+cidOrPath)
 	if err != nil {
 		return err
 	}
@@ -57,8 +219,9 @@ func (s *Sniffer) PublishCID(ctx context.Context, cidOrPath, source, sourceDetai
 	if err != nil {
 		return err
 	}
-	if _, err := internalnats.Publish(ctx, s.NATS, internalnats.SubjectCidDiscovered, b); err != nil {
-		_, _ = internalnats.PublishDLQ(ctx, s.NATS, internalnats.SubjectCidDiscovered, b)
+	id := internalnats.MsgID("", internalnats.SubjectCidDiscovered, source, cidOrPath)
+	if _, err := internalnats.Publish(ctx, s.NATS, internalnats.SubjectCidDiscovered, b, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, s.NATS, internalnats.SubjectCidDiscovered, id, b, err)
 		return err
 	}
 	return nil
@@ -0,0 +1,42 @@
+package ipnssniff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
+)
+
+func TestSniffer_ObserveNameOncePerInterval(t *testing.T) {
+	s := &Sniffer{Names: &ipnsreg.Registry{Config: ipnsreg.Config{MinInterval: time.Hour}}}
+	s.ObserveName("/ipns/k51a", nil)
+	s.ObserveName("/ipns/k51a", nil)
+	s.ObserveName("/ipns/k51a", []byte("record"))
+	s.ObserveName("/ipns/k51a", []byte("record"))
+
+	if got := len(s.queue); got != 2 {
+		t.Fatalf("queued = %d, want 2", got)
+	}
+	if sg := <-s.queue; !sg.observe || sg.record != nil {
+		t.Fatalf("first sighting = %+v, want the bare name", sg)
+	}
+	if sg := <-s.queue; sg.observe || string(sg.record) != "record" {
+		t.Fatalf("second sighting = %+v, want only the record", sg)
+	}
+}
+
+func TestSniffer_DropsNamesWhenQueueFull(t *testing.T) {
+	s := &Sniffer{Names: &ipnsreg.Registry{Config: ipnsreg.Config{MinInterval: time.Hour}}, NameQueueSize: 2}
+	for _, n := range []string{"/ipns/a", "/ipns/b", "/ipns/c", "/ipns/d"} {
+		s.ObserveName(n, nil)
+	}
+	if got := s.DroppedNames(); got != 2 {
+		t.Fatalf("dropped = %d, want 2", got)
+	}
+	// A dropped name is not remembered, so its next sighting is queued.
+	<-s.queue
+	s.ObserveName("/ipns/c", nil)
+	if got := s.DroppedNames(); got != 2 {
+		t.Fatalf("dropped = %d after draining, want 2", got)
+	}
+}
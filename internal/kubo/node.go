@@ -24,6 +24,8 @@ type Node struct {
 	RepoPath string
 	API      icore.CoreAPI
 	Raw      *core.IpfsNode
+	// PubSubTopics is nil unless Options.TrackPubSubTopics was set.
+	PubSubTopics *TopicTracker
 
 	repo io.Closer
 }
@@ -48,6 +50,9 @@ func ensurePlugins(externalPluginsPath string) error {
 type Options struct {
 	EnablePubSub     bool
 	EnableIPNSPubSub bool
+	// TrackPubSubTopics records the topics connected peers subscribe to.
+	// It requires pubsub.
+	TrackPubSubTopics bool
 }
 
 // OpenOrInit opens an existing repo at repoPath or initializes it with defaults.
@@ -66,6 +71,12 @@ func OpenOrInitIPNSPubSub(ctx context.Context, repoPath string) (*Node, error) {
 	return OpenOrInitWithRoutingAndOptions(ctx, repoPath, libp2p.DHTClientOption, Options{EnableIPNSPubSub: true})
 }
 
+// OpenOrInitWithOptions opens the repo as a DHT client with the given
+// features, e.g. the union of what several roles sharing the node need.
+func OpenOrInitWithOptions(ctx context.Context, repoPath string, opts Options) (*Node, error) {
+	return OpenOrInitWithRoutingAndOptions(ctx, repoPath, libp2p.DHTClientOption, opts)
+}
+
 // OpenOrInitWithRouting opens an existing repo at repoPath or initializes it with defaults.
 // The routing option controls DHT client vs server participation.
 func OpenOrInitWithRouting(ctx context.Context, repoPath string, routingOpt libp2p.RoutingOption) (*Node, error) {
@@ -141,7 +152,11 @@ func OpenOrInitWithRoutingAndOptions(ctx context.Context, repoPath string, routi
 		nodeOptions.ExtraOpts["ipnsps"] = true
 	}
 
-	raw, err := core.NewNode(ctx, nodeOptions)
+	var topics *TopicTracker
+	if opts.TrackPubSubTopics && (opts.EnablePubSub || opts.EnableIPNSPubSub) {
+		topics = &TopicTracker{}
+	}
+	raw, err := newNode(ctx, nodeOptions, topics)
 	if err != nil {
 		_ = repo.Close()
 		return nil, fmt.Errorf("core new node: %w", err)
@@ -159,6 +174,8 @@ func OpenOrInitWithRoutingAndOptions(ctx context.Context, repoPath string, routi
 		API:      api,
 		Raw:      raw,
 		repo:     repo,
+
+		PubSubTopics: topics,
 	}, nil
 }
 
@@ -175,6 +192,14 @@ func (n *Node) Close() error {
 	return nil
 }
 
+// PeerCount returns the number of currently connected swarm peers.
+func (n *Node) PeerCount() int {
+	if n == nil || n.Raw == nil || n.Raw.PeerHost == nil {
+		return 0
+	}
+	return len(n.Raw.PeerHost.Network().Peers())
+}
+
 func getenvDefault(key, def string) string {
 	v, ok := os.LookupEnv(key)
 	if !ok {
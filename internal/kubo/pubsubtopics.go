@@ -0,0 +1,150 @@
+package kubo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/core/node/libp2p"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"go.uber.org/fx"
+)
+
+// maxTrackedTopics bounds the topic names a TopicTracker holds, so peers
+// announcing junk topics cannot grow it without limit.
+const maxTrackedTopics = 4096
+
+// TopicTracker records the names of the pubsub topics connected peers
+// announce subscriptions to. Which peers are subscribed is left to the
+// router: PubSub.ListPeers answers it for any topic, joined or not.
+type TopicTracker struct {
+	mu     sync.Mutex
+	topics map[string]struct{}
+}
+
+// Topics returns the announced topic names, sorted.
+func (t *TopicTracker) Topics() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]string, 0, len(t.topics))
+	for topic := range t.topics {
+		out = append(out, topic)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Forget drops topic until a peer announces it again.
+func (t *TopicTracker) Forget(topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.topics, topic)
+}
+
+// RecvRPC runs on the router's event loop, so it only records names.
+func (t *TopicTracker) RecvRPC(rpc *pubsub.RPC) {
+	subs := rpc.GetSubscriptions()
+	if len(subs) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.topics == nil {
+		t.topics = map[string]struct{}{}
+	}
+	for _, s := range subs {
+		if s.GetSubscribe() && len(t.topics) < maxTrackedTopics {
+			t.topics[s.GetTopicid()] = struct{}{}
+		}
+	}
+}
+
+func (t *TopicTracker) AddPeer(peer.ID, protocol.ID)          {}
+func (t *TopicTracker) RemovePeer(peer.ID)                    {}
+func (t *TopicTracker) Join(string)                           {}
+func (t *TopicTracker) Leave(string)                          {}
+func (t *TopicTracker) Graft(peer.ID, string)                 {}
+func (t *TopicTracker) Prune(peer.ID, string)                 {}
+func (t *TopicTracker) ValidateMessage(*pubsub.Message)       {}
+func (t *TopicTracker) DeliverMessage(*pubsub.Message)        {}
+func (t *TopicTracker) RejectMessage(*pubsub.Message, string) {}
+func (t *TopicTracker) DuplicateMessage(*pubsub.Message)      {}
+func (t *TopicTracker) ThrottlePeer(peer.ID)                  {}
+func (t *TopicTracker) SendRPC(*pubsub.RPC, peer.ID)          {}
+func (t *TopicTracker) DropRPC(*pubsub.RPC, peer.ID)          {}
+func (t *TopicTracker) UndeliverableMessage(*pubsub.Message)  {}
+
+var _ pubsub.RawTracer = (*TopicTracker)(nil)
+
+// Kubo builds its pubsub router inside its fx graph with no way to pass a
+// tracer, so a node that tracks topics has the router rebuilt with Kubo's
+// options plus the tracker. The fx hook is global; building is set only
+// while such a node is constructed.
+var (
+	registerHookOnce sync.Once
+	buildMu          sync.Mutex
+	building         *TopicTracker
+)
+
+func newNode(ctx context.Context, cfg *core.BuildCfg, topics *TopicTracker) (*core.IpfsNode, error) {
+	registerHookOnce.Do(func() {
+		core.RegisterFXOptionFunc(func(info core.FXNodeInfo) ([]fx.Option, error) {
+			if building == nil {
+				return info.FXOptions, nil
+			}
+			return append(info.FXOptions, fx.Decorate(tracedPubSub(building))), nil
+		})
+	})
+
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	building = topics
+	defer func() { building = nil }()
+	return core.NewNode(ctx, cfg)
+}
+
+// tracedPubSub mirrors how Kubo configures its router, adding t.
+func tracedPubSub(t *TopicTracker) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, discovery.Discovery, *config.Config) (*pubsub.PubSub, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, disc discovery.Discovery, cfg *config.Config) (*pubsub.PubSub, error) {
+		opts := []pubsub.Option{
+			pubsub.WithMessageSigning(!cfg.Pubsub.DisableSigning),
+			pubsub.WithSeenMessagesTTL(cfg.Pubsub.SeenMessagesTTL.WithDefault(pubsub.TimeCacheDuration)),
+			pubsub.WithRawTracer(t),
+		}
+		switch s := cfg.Pubsub.SeenMessagesStrategy.WithDefault(config.DefaultSeenMessagesStrategy); s {
+		case config.LastSeenMessagesStrategy:
+			opts = append(opts, pubsub.WithSeenMessagesStrategy(timecache.Strategy_LastSeen))
+		case config.FirstSeenMessagesStrategy:
+			opts = append(opts, pubsub.WithSeenMessagesStrategy(timecache.Strategy_FirstSeen))
+		default:
+			return nil, fmt.Errorf("unsupported Pubsub.SeenMessagesStrategy %q", s)
+		}
+
+		var ctor any
+		switch cfg.Pubsub.Router {
+		case "", "gossipsub":
+			ctor = libp2p.GossipSub(opts...)
+		case "floodsub":
+			ctor = libp2p.FloodSub(opts...)
+		default:
+			return nil, fmt.Errorf("unknown pubsub router %s", cfg.Pubsub.Router)
+		}
+		// Kubo's constructors are typed any; a signature change there must
+		// fail the build of the node rather than panic.
+		build, ok := ctor.(func(helpers.MetricsCtx, fx.Lifecycle, host.Host, discovery.Discovery) (*pubsub.PubSub, error))
+		if !ok {
+			return nil, fmt.Errorf("kubo pubsub constructor has unexpected type %T", ctor)
+		}
+		return build(mctx, lc, h, disc)
+	}
+}
@@ -0,0 +1,90 @@
+package kubo
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	kubolibp2p "github.com/ipfs/kubo/core/node/libp2p"
+	"github.com/ipfs/kubo/repo/fsrepo"
+
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// initTestRepo initializes a repo that listens on loopback only and dials
+// no bootstrap peers.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	loadPluginsOnce.Do(func() {
+		_ = ensurePlugins("")
+	})
+	repoPath := filepath.Join(t.TempDir(), "repo")
+	cfg, err := config.Init(io.Discard, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Addresses.Swarm = []string{"/ip4/127.0.0.1/tcp/0"}
+	cfg.Addresses.API = []string{"/ip4/127.0.0.1/tcp/0"}
+	cfg.Addresses.Gateway = []string{"/ip4/127.0.0.1/tcp/0"}
+	cfg.Bootstrap = nil
+	cfg.Discovery.MDNS.Enabled = false
+	cfg.AutoTLS.Enabled = config.False
+	cfg.Pubsub.Enabled = config.True
+	if err := fsrepo.Init(repoPath, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return repoPath
+}
+
+func TestTrackPubSubTopics_SeesPeerSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	n, err := OpenOrInitWithRoutingAndOptions(ctx, initTestRepo(t), kubolibp2p.NilRouterOption,
+		Options{EnablePubSub: true, TrackPubSubTopics: true})
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	defer n.Close()
+	if n.PubSubTopics == nil {
+		t.Fatal("no topic tracker")
+	}
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := ps.Join("ipfsniffer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel()
+
+	self := n.Raw.PeerHost
+	if err := h.Connect(ctx, peer.AddrInfo{ID: self.ID(), Addrs: self.Addrs()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	for !slices.Contains(n.PubSubTopics.Topics(), "ipfsniffer-test") {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("tracker never saw the subscription; topics = %q", n.PubSubTopics.Topics())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
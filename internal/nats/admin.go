@@ -0,0 +1,237 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+type ConsumerStats struct {
+	Stream         string `json:"stream"`
+	Name           string `json:"name"`
+	FilterSubject  string `json:"filter_subject,omitempty"`
+	NumPending     uint64 `json:"num_pending"`
+	NumAckPending  int    `json:"num_ack_pending"`
+	NumRedelivered int    `json:"num_redelivered"`
+	NumWaiting     int    `json:"num_waiting"`
+	DeliveredSeq   uint64 `json:"delivered_stream_seq"`
+	AckFloorSeq    uint64 `json:"ack_floor_stream_seq"`
+}
+
+// ListConsumers reports backlog and redelivery counters for every consumer on
+// stream, or on the pipeline and chunk streams when stream is empty.
+func ListConsumers(ctx context.Context, js nats.JetStreamContext, stream string) ([]ConsumerStats, error) {
+	streams := []string{stream}
+	if stream == "" {
+		streams = []string{StreamName, ChunkStreamName}
+	}
+
+	var out []ConsumerStats
+	for _, stream := range streams {
+		for ci := range js.Consumers(stream, nats.Context(ctx)) {
+			out = append(out, ConsumerStats{
+				Stream:         ci.Stream,
+				Name:           ci.Name,
+				FilterSubject:  ci.Config.FilterSubject,
+				NumPending:     ci.NumPending,
+				NumAckPending:  ci.NumAckPending,
+				NumRedelivered: ci.NumRedelivered,
+				NumWaiting:     ci.NumWaiting,
+				DeliveredSeq:   ci.Delivered.Stream,
+				AckFloorSeq:    ci.AckFloor.Stream,
+			})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type DLQInfo struct {
+	Subject  string `json:"subject"`
+	Stream   string `json:"stream"`
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+}
+
+type DLQMessage struct {
+	Seq     uint64      `json:"seq"`
+	Subject string      `json:"subject"`
+	Time    time.Time   `json:"time"`
+	Header  nats.Header `json:"header,omitempty"`
+	Data    []byte      `json:"data"`
+}
+
+// OriginalSubject is the pipeline subject the entry was dead-lettered from.
+func (m DLQMessage) OriginalSubject() string {
+	if s := m.Header.Get(HeaderDLQSubject); s != "" {
+		return s
+	}
+	return strings.TrimSuffix(m.Subject, ".dlq")
+}
+
+// DLQStreamName returns the DLQ stream that captures subject's failures.
+func DLQStreamName(subject string) (string, error) {
+	return dlqStreamFor(subject)
+}
+
+// ListDLQ returns the state of each per-subject DLQ stream created by EnsureStream.
+func ListDLQ(ctx context.Context, js nats.JetStreamContext) ([]DLQInfo, error) {
+	out := make([]DLQInfo, 0, len(PipelineSubjects))
+	for _, subject := range PipelineSubjects {
+		name := dlqStreamName(subject)
+		si, err := js.StreamInfo(name, nats.Context(ctx))
+		if err != nil {
+			if errors.Is(err, nats.ErrStreamNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("dlq stream %s: %w", name, err)
+		}
+		out = append(out, DLQInfo{
+			Subject:  subject,
+			Stream:   name,
+			Messages: si.State.Msgs,
+			Bytes:    si.State.Bytes,
+			FirstSeq: si.State.FirstSeq,
+			LastSeq:  si.State.LastSeq,
+		})
+	}
+	return out, nil
+}
+
+// ReadDLQ returns up to limit messages from the DLQ of subject, oldest first.
+func ReadDLQ(ctx context.Context, js nats.JetStreamContext, subject string, limit int) ([]DLQMessage, error) {
+	name, err := dlqStreamFor(subject)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	si, err := js.StreamInfo(name, nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("dlq stream %s: %w", name, err)
+	}
+
+	out := make([]DLQMessage, 0, min(uint64(limit), si.State.Msgs))
+	for seq := si.State.FirstSeq; seq <= si.State.LastSeq && len(out) < limit; seq++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		m, err := js.GetMsg(name, seq, nats.Context(ctx))
+		if err != nil {
+			// Interior gaps are left by replayed or deleted messages.
+			if errors.Is(err, nats.ErrMsgNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("get dlq msg %d: %w", seq, err)
+		}
+		out = append(out, DLQMessage{Seq: m.Sequence, Subject: m.Subject, Time: m.Time, Header: m.Header, Data: m.Data})
+	}
+	return out, nil
+}
+
+// ReplayDLQ republishes up to limit DLQ messages to their original subject
+// and removes each one from the DLQ once the publish is acknowledged.
+func ReplayDLQ(ctx context.Context, js nats.JetStreamContext, subject string, limit int) (int, error) {
+	name, err := dlqStreamFor(subject)
+	if err != nil {
+		return 0, err
+	}
+	msgs, err := ReadDLQ(ctx, js, subject, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, m := range msgs {
+		if err := ReplayDLQMsg(ctx, js, name, m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ReplayDLQMsg republishes one DLQ entry to its original subject with the
+// replay count incremented, then deletes it from dlqStream.
+func ReplayDLQMsg(ctx context.Context, js nats.JetStreamContext, dlqStream string, m DLQMessage) error {
+	if err := publishReplay(ctx, js, m); err != nil {
+		return err
+	}
+	if err := js.DeleteMsg(dlqStream, m.Seq, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("delete dlq msg %d: %w", m.Seq, err)
+	}
+	return nil
+}
+
+// publishReplay republishes m under its original message ID, so later
+// stages derive the same IDs as in the first run. When the stream still
+// holds that ID, as for a consumed message replayed inside the duplicate
+// window, it republishes under an ID derived from it and the replay count.
+func publishReplay(ctx context.Context, js Publisher, m DLQMessage) error {
+	replays := strconv.Itoa(Replays(m.Header) + 1)
+	h := nats.Header{}
+	h.Set(HeaderReplays, replays)
+	if claim := m.Header.Get(HeaderClaim); claim != "" {
+		h.Set(HeaderClaim, claim)
+	}
+	id := m.Header.Get(HeaderDLQMsgID)
+	if id != "" {
+		h.Set(nats.MsgIdHdr, id)
+	}
+	msg := &nats.Msg{Subject: m.OriginalSubject(), Header: h, Data: m.Data}
+	ack, err := PublishMsg(ctx, js, msg)
+	if err != nil || id == "" || ack == nil || !ack.Duplicate {
+		return err
+	}
+	h.Set(nats.MsgIdHdr, MsgID(id, "replay", replays))
+	_, err = PublishMsg(ctx, js, msg)
+	return err
+}
+
+// QuarantineDLQMsg moves one DLQ entry, headers included, to the quarantine
+// stream so it is no longer considered for replay.
+func QuarantineDLQMsg(ctx context.Context, js nats.JetStreamContext, dlqStream string, m DLQMessage) error {
+	h := nats.Header{}
+	for k, v := range m.Header {
+		h[k] = v
+	}
+	if _, err := PublishMsg(ctx, js, &nats.Msg{Subject: QuarantineSubject(m.OriginalSubject()), Header: h, Data: m.Data}); err != nil {
+		return err
+	}
+	if err := js.DeleteMsg(dlqStream, m.Seq, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("delete dlq msg %d: %w", m.Seq, err)
+	}
+	return nil
+}
+
+// PurgeDLQ drops every message in the DLQ of subject.
+func PurgeDLQ(ctx context.Context, js nats.JetStreamContext, subject string) error {
+	name, err := dlqStreamFor(subject)
+	if err != nil {
+		return err
+	}
+	if err := js.PurgeStream(name, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("purge %s: %w", name, err)
+	}
+	return nil
+}
+
+func dlqStreamFor(subject string) (string, error) {
+	for _, s := range PipelineSubjects {
+		if s == subject {
+			return dlqStreamName(s), nil
+		}
+	}
+	return "", fmt.Errorf("unknown pipeline subject %q", subject)
+}
@@ -0,0 +1,137 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Bus is the subset of JetStream the pipeline workers use. JetStreamBus backs
+// it with NATS; MemoryBus runs the pipeline inside a single process.
+type Bus interface {
+	Publisher
+	// PullSubscribe binds to the durable consumer for subject, creating or
+	// updating it first.
+	PullSubscribe(ctx context.Context, subject, durable string, opts ConsumerOpts) (PullSubscription, error)
+	// SubscribeSync receives messages published on subject from now on.
+	SubscribeSync(subject string) (SyncSubscription, error)
+}
+
+type ConsumerOpts struct {
+	MaxDeliver int
+	AckWait    time.Duration
+}
+
+type PullSubscription interface {
+	// Fetch waits up to wait for at most n messages. A timeout returns no
+	// messages and no error.
+	Fetch(ctx context.Context, n int, wait time.Duration) ([]Delivery, error)
+	Unsubscribe() error
+}
+
+type SyncSubscription interface {
+	NextMsgWithContext(ctx context.Context) (*nats.Msg, error)
+	Unsubscribe() error
+}
+
+// Delivery is one delivery of a message to a pull consumer.
+type Delivery interface {
+	// Msg carries the subject, headers and payload.
+	Msg() *nats.Msg
+	NumDelivered() uint64
+	StreamSeq() uint64
+
+	Ack() error
+	NakWithDelay(delay time.Duration) error
+	Term() error
+	InProgress() error
+}
+
+// DefaultBus returns b, or a JetStreamBus over js when b is nil. It returns
+// nil when neither is set.
+func DefaultBus(b Bus, js nats.JetStreamContext) Bus {
+	if b != nil {
+		return b
+	}
+	if js != nil {
+		return &JetStreamBus{JS: js}
+	}
+	return nil
+}
+
+// JetStreamBus implements Bus on a JetStream context.
+type JetStreamBus struct {
+	JS nats.JetStreamContext
+}
+
+func (b *JetStreamBus) Publish(subject string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	return b.JS.Publish(subject, data, opts...)
+}
+
+func (b *JetStreamBus) PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	return b.JS.PublishMsg(m, opts...)
+}
+
+func (b *JetStreamBus) PullSubscribe(ctx context.Context, subject, durable string, opts ConsumerOpts) (PullSubscription, error) {
+	if err := ensureConsumer(ctx, b.JS, subject, durable, opts.MaxDeliver, opts.AckWait); err != nil {
+		return nil, err
+	}
+	sub, err := b.JS.PullSubscribe(subject, durable)
+	if err != nil {
+		return nil, fmt.Errorf("pull subscribe %s: %w", subject, err)
+	}
+	return jsPull{sub: sub}, nil
+}
+
+func (b *JetStreamBus) SubscribeSync(subject string) (SyncSubscription, error) {
+	return b.JS.SubscribeSync(subject)
+}
+
+type jsPull struct {
+	sub *nats.Subscription
+}
+
+func (p jsPull) Fetch(ctx context.Context, n int, wait time.Duration) ([]Delivery, error) {
+	msgs, err := p.sub.Fetch(n, nats.MaxWait(wait))
+	if err != nil {
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]Delivery, len(msgs))
+	for i, m := range msgs {
+		out[i] = jsDelivery{m: m}
+	}
+	return out, nil
+}
+
+func (p jsPull) Unsubscribe() error { return p.sub.Unsubscribe() }
+
+type jsDelivery struct {
+	m *nats.Msg
+}
+
+func (d jsDelivery) Msg() *nats.Msg { return d.m }
+
+func (d jsDelivery) NumDelivered() uint64 {
+	if md, err := d.m.Metadata(); err == nil {
+		return md.NumDelivered
+	}
+	return 1
+}
+
+func (d jsDelivery) StreamSeq() uint64 {
+	if md, err := d.m.Metadata(); err == nil {
+		return md.Sequence.Stream
+	}
+	return 0
+}
+
+func (d jsDelivery) Ack() error                             { return d.m.Ack() }
+func (d jsDelivery) NakWithDelay(delay time.Duration) error { return d.m.NakWithDelay(delay) }
+func (d jsDelivery) Term() error                            { return d.m.Term() }
+func (d jsDelivery) InProgress() error                      { return d.m.InProgress() }
@@ -0,0 +1,131 @@
+package nats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// HeaderClaim names the object holding a message's real payload. The message
+// body is then just the object name.
+const HeaderClaim = "Ipfsniffer-Claim"
+
+type ClaimConfig struct {
+	Bucket string
+	// Threshold is the payload size in bytes above which payloads are moved
+	// to the bucket. 0 disables claiming; claimed messages already in flight
+	// are still resolved.
+	Threshold int
+	// TTL bounds how long claimed payloads are kept. It should outlive the
+	// longest time a message can sit in a stream or DLQ.
+	TTL      time.Duration
+	Replicas int
+}
+
+func DefaultClaimConfig() ClaimConfig {
+	return ClaimConfig{
+		Bucket:    "IPFSNIFFER_PAYLOADS",
+		Threshold: 512 * 1024,
+		TTL:       72 * time.Hour,
+		Replicas:  1,
+	}
+}
+
+// ClaimStore implements the claim-check pattern on a JetStream Object Store:
+// large payloads are stored once in the bucket and messages carry a
+// reference. A nil *ClaimStore publishes everything inline.
+type ClaimStore struct {
+	Store     nats.ObjectStore
+	Threshold int
+}
+
+// EnsureClaimStore creates the claim bucket or brings its TTL in line with cfg.
+func EnsureClaimStore(ctx context.Context, js nats.JetStreamContext, cfg ClaimConfig) (*ClaimStore, error) {
+	if cfg.Bucket == "" {
+		cfg.Bucket = DefaultClaimConfig().Bucket
+	}
+
+	store, err := js.ObjectStore(cfg.Bucket)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		store, err = js.CreateObjectStore(&nats.ObjectStoreConfig{
+			Bucket:      cfg.Bucket,
+			Description: "ipfsniffer claim-checked payloads",
+			TTL:         cfg.TTL,
+			Storage:     nats.FileStorage,
+			Replicas:    max(cfg.Replicas, 1),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create object store %s: %w", cfg.Bucket, err)
+		}
+		return &ClaimStore{Store: store, Threshold: cfg.Threshold}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object store %s: %w", cfg.Bucket, err)
+	}
+
+	status, err := store.Status()
+	if err != nil {
+		return nil, fmt.Errorf("object store %s: %w", cfg.Bucket, err)
+	}
+	if status.TTL() != cfg.TTL {
+		// Object stores are plain streams; the TTL is the stream's MaxAge.
+		name := "OBJ_" + cfg.Bucket
+		si, err := js.StreamInfo(name, nats.Context(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("lookup stream %s: %w", name, err)
+		}
+		sc := si.Config
+		sc.MaxAge = cfg.TTL
+		if _, err := js.UpdateStream(&sc, nats.Context(ctx)); err != nil {
+			return nil, fmt.Errorf("update stream %s: %w", name, err)
+		}
+	}
+	return &ClaimStore{Store: store, Threshold: cfg.Threshold}, nil
+}
+
+// Publish publishes payload to subject, moving it to the store first when it
+// exceeds the threshold. Objects are named by content hash, so re-publishing
+// the same payload reuses the object.
+func (c *ClaimStore) Publish(ctx context.Context, js Publisher, subject string, payload []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if c == nil || c.Store == nil || c.Threshold <= 0 || len(payload) <= c.Threshold {
+		return Publish(ctx, js, subject, payload, opts...)
+	}
+
+	name := claimName(payload)
+	if _, err := c.Store.PutBytes(name, payload, nats.Context(ctx)); err != nil {
+		return nil, fmt.Errorf("claim put %s: %w", name, err)
+	}
+	h := nats.Header{}
+	h.Set(HeaderClaim, name)
+	return PublishMsg(ctx, js, &nats.Msg{Subject: subject, Header: h, Data: []byte(name)}, opts...)
+}
+
+// Resolve returns the payload of msg, loading it from the store when msg
+// carries a claim. A claim whose object has expired is a Terminal error.
+func (c *ClaimStore) Resolve(ctx context.Context, msg *nats.Msg) ([]byte, error) {
+	name := msg.Header.Get(HeaderClaim)
+	if name == "" {
+		return msg.Data, nil
+	}
+	if c == nil || c.Store == nil {
+		return nil, fmt.Errorf("claim %s: no claim store configured", name)
+	}
+	b, err := c.Store.GetBytes(name, nats.Context(ctx))
+	if err != nil {
+		if errors.Is(err, nats.ErrObjectNotFound) {
+			return nil, Terminal(fmt.Errorf("claim %s: %w", name, err))
+		}
+		return nil, fmt.Errorf("claim %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func claimName(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
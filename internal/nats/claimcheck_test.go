@@ -0,0 +1,93 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	natslib "github.com/nats-io/nats.go"
+)
+
+// fakeObjectStore implements the byte-slice subset of nats.ObjectStore.
+type fakeObjectStore struct {
+	natslib.ObjectStore
+	objects map[string][]byte
+}
+
+func (f *fakeObjectStore) PutBytes(name string, data []byte, opts ...natslib.ObjectOpt) (*natslib.ObjectInfo, error) {
+	f.objects[name] = append([]byte(nil), data...)
+	return &natslib.ObjectInfo{}, nil
+}
+
+func (f *fakeObjectStore) GetBytes(name string, opts ...natslib.GetObjectOpt) ([]byte, error) {
+	b, ok := f.objects[name]
+	if !ok {
+		return nil, natslib.ErrObjectNotFound
+	}
+	return b, nil
+}
+
+func TestClaimStore_PublishAndResolve(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeObjectStore{objects: map[string][]byte{}}
+	c := &ClaimStore{Store: store, Threshold: 4}
+	fp := &fakePublisher{}
+
+	if _, err := c.Publish(ctx, fp, "doc.ready", []byte("tiny")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if string(fp.lastData) != "tiny" || len(store.objects) != 0 {
+		t.Fatalf("small payload should be inline")
+	}
+
+	big := []byte("larger than the threshold")
+	if _, err := c.Publish(ctx, fp, "doc.ready", big); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	name := fp.lastHeader.Get(HeaderClaim)
+	if name == "" || string(fp.lastData) != name || len(store.objects) != 1 {
+		t.Fatalf("large payload should be claimed: header=%q data=%q", name, fp.lastData)
+	}
+
+	got, err := c.Resolve(ctx, &natslib.Msg{Header: fp.lastHeader, Data: fp.lastData})
+	if err != nil || !bytes.Equal(got, big) {
+		t.Fatalf("resolve: %q %v", got, err)
+	}
+
+	delete(store.objects, name)
+	if _, err := c.Resolve(ctx, &natslib.Msg{Header: fp.lastHeader, Data: fp.lastData}); !IsTerminal(err) || !errors.Is(err, natslib.ErrObjectNotFound) {
+		t.Fatalf("expired claim should be terminal: %v", err)
+	}
+}
+
+func TestClaimStore_Nil(t *testing.T) {
+	var c *ClaimStore
+	fp := &fakePublisher{}
+	if _, err := c.Publish(context.Background(), fp, "s", []byte("payload")); err != nil || string(fp.lastData) != "payload" {
+		t.Fatalf("nil store should publish inline: %v", err)
+	}
+	got, err := c.Resolve(context.Background(), &natslib.Msg{Data: []byte("x")})
+	if err != nil || string(got) != "x" {
+		t.Fatalf("resolve: %q %v", got, err)
+	}
+	h := natslib.Header{}
+	h.Set(HeaderClaim, "abc")
+	if _, err := c.Resolve(context.Background(), &natslib.Msg{Header: h, Data: []byte("abc")}); err == nil {
+		t.Fatalf("claimed message without a store should fail")
+	}
+}
+
+func TestDLQHeader_KeepsClaim(t *testing.T) {
+	h := natslib.Header{}
+	h.Set(HeaderClaim, "abc")
+	msg := &natslib.Msg{Header: h, Data: []byte("abc")}
+	ctx := WithDelivery(context.Background(), "extractor", msg)
+
+	if got := dlqHeader(ctx, "fetch.result", "", msg.Data, nil).Get(HeaderClaim); got != "abc" {
+		t.Fatalf("claim: %q", got)
+	}
+	if got := dlqHeader(ctx, "doc.ready", "", []byte("other"), nil).Get(HeaderClaim); got != "" {
+		t.Fatalf("unrelated payload must not inherit claim: %q", got)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/tlsconfig"
+
 	nats "github.com/nats-io/nats.go"
 )
 
@@ -12,6 +14,36 @@ type ConnConfig struct {
 	URL     string
 	Name    string
 	Timeout time.Duration
+
+	// At most one of CredsFile (a .creds JWT file), NKeyFile (an nkey seed
+	// file) and Token authenticates the connection.
+	CredsFile string
+	NKeyFile  string
+	Token     string
+
+	TLS tlsconfig.Config
+}
+
+// Validate reports conflicting authentication or TLS settings.
+func (c ConnConfig) Validate() error {
+	if err := c.ValidateAuth(); err != nil {
+		return err
+	}
+	return c.TLS.Validate()
+}
+
+// ValidateAuth reports conflicting authentication settings.
+func (c ConnConfig) ValidateAuth() error {
+	n := 0
+	for _, s := range []string{c.CredsFile, c.NKeyFile, c.Token} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("set only one of creds_file, nkey_file and token")
+	}
+	return nil
 }
 
 func DefaultConnConfig() ConnConfig {
@@ -33,10 +65,33 @@ func Connect(ctx context.Context, cfg ConnConfig) (*nats.Conn, nats.JetStreamCon
 		cfg.Timeout = DefaultConnConfig().Timeout
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("nats config: %w", err)
+	}
+
 	opts := []nats.Option{
 		nats.Name(cfg.Name),
 		nats.Timeout(cfg.Timeout),
 	}
+	switch {
+	case cfg.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	case cfg.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("nats nkey: %w", err)
+		}
+		opts = append(opts, opt)
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+	tlsCfg, err := cfg.TLS.Client()
+	if err != nil {
+		return nil, nil, fmt.Errorf("nats tls: %w", err)
+	}
+	if tlsCfg != nil {
+		opts = append(opts, nats.Secure(tlsCfg))
+	}
 
 	nc, err := nats.Connect(cfg.URL, opts...)
 	if err != nil {
@@ -0,0 +1,331 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	DefaultAckWait     = 30 * time.Second
+	DefaultBackoffBase = time.Second
+	DefaultBackoffMax  = 5 * time.Minute
+)
+
+type terminalError struct{ err error }
+
+func (e terminalError) Error() string { return e.err.Error() }
+func (e terminalError) Unwrap() error { return e.err }
+
+// Terminal marks err as one that redelivery cannot fix (malformed payload,
+// invalid input). The consumer runner DLQs and terminates such messages
+// instead of retrying them.
+func Terminal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return terminalError{err: err}
+}
+
+func IsTerminal(err error) bool {
+	var t terminalError
+	return errors.As(err, &t)
+}
+
+// Handler processes one message. A nil error acks it; see Consumer for how
+// errors are treated.
+type Handler func(ctx context.Context, msg *nats.Msg) error
+
+// Consumer runs a durable pull consumer with uniform ack handling:
+//
+//   - success: Ack
+//   - Terminal error, or a retryable error on the last allowed delivery:
+//     DLQ then Term
+//   - retryable error: NakWithDelay with exponential backoff
+//
+// Up to Concurrency handlers run at once. Each pull requests as many
+// messages as there are free slots (at most Batch), so messages are never
+// held by a process that cannot start them yet.
+//
+// While the handler runs the message is kept alive with InProgress so long
+// jobs are not redelivered mid-flight. If Conn is set, max-delivery
+// advisories for the consumer are also watched and the affected messages
+// are DLQ'd, covering deliveries that timed out rather than failed.
+type Consumer struct {
+	NATS nats.JetStreamContext
+	// Bus carries the messages; it defaults to a JetStreamBus over NATS.
+	Bus Bus
+	// Conn is the core connection used for advisories. Optional.
+	Conn *nats.Conn
+
+	Subject    string
+	Durable    string
+	MaxDeliver int
+	AckWait    time.Duration
+
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+
+	// FetchWait bounds each pull request.
+	FetchWait time.Duration
+
+	// Concurrency is the number of messages handled in parallel (default 1).
+	Concurrency int
+	// Batch caps the messages requested per pull (default Concurrency).
+	Batch int
+
+	// Claims resolves claim-checked payloads before the handler sees them.
+	Claims *ClaimStore
+
+	Handler Handler
+}
+
+func (c *Consumer) Run(ctx context.Context) error {
+	c.Bus = DefaultBus(c.Bus, c.NATS)
+	if c.Bus == nil {
+		return fmt.Errorf("nats jetstream required")
+	}
+	if c.Subject == "" || c.Durable == "" {
+		return fmt.Errorf("subject and durable required")
+	}
+	if c.Handler == nil {
+		return fmt.Errorf("handler required")
+	}
+	c.applyDefaults()
+
+	sub, err := c.Bus.PullSubscribe(ctx, c.Subject, c.Durable, ConsumerOpts{MaxDeliver: c.MaxDeliver, AckWait: c.AckWait})
+	if err != nil {
+		return err
+	}
+
+	if c.Conn != nil && c.NATS != nil {
+		adv, err := c.watchMaxDeliveries(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = adv.Unsubscribe() }()
+	}
+
+	slots := make(chan struct{}, c.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		// Block for one free slot, then take any others that are free.
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		n := 1
+	fill:
+		for n < c.Batch {
+			select {
+			case slots <- struct{}{}:
+				n++
+			default:
+				break fill
+			}
+		}
+
+		msgs, err := sub.Fetch(ctx, n, c.FetchWait)
+		for i := len(msgs); i < n; i++ {
+			<-slots
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("fetch %s: %w", c.Subject, err)
+		}
+
+		for _, d := range msgs {
+			wg.Add(1)
+			go func(d Delivery) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				c.handle(ctx, d)
+			}(d)
+		}
+	}
+}
+
+func (c *Consumer) applyDefaults() {
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = DefaultMaxDeliver
+	}
+	if c.AckWait <= 0 {
+		c.AckWait = DefaultAckWait
+	}
+	if c.BackoffBase <= 0 {
+		c.BackoffBase = DefaultBackoffBase
+	}
+	if c.BackoffMax <= 0 {
+		c.BackoffMax = DefaultBackoffMax
+	}
+	if c.FetchWait <= 0 {
+		c.FetchWait = 2 * time.Second
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.Batch <= 0 || c.Batch > c.Concurrency {
+		c.Batch = c.Concurrency
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, d Delivery) {
+	logger := logging.FromContext(ctx).With("subject", c.Subject, "durable", c.Durable)
+	msg := d.Msg()
+	hctx := WithBusDelivery(ctx, c.Durable, d)
+
+	stop := keepAlive(d, c.AckWait/3)
+	err := c.run(hctx, msg)
+	stop()
+
+	if err == nil {
+		_ = d.Ack()
+		return
+	}
+
+	delivered := max(d.NumDelivered(), 1)
+	switch {
+	case IsTerminal(err):
+		logger.Error("handle failed (terminal)", "err", err)
+		c.deadLetter(hctx, d, err)
+	case delivered >= uint64(c.MaxDeliver):
+		logger.Error("handle failed (deliveries exhausted)", "err", err, "deliveries", delivered)
+		c.deadLetter(hctx, d, err)
+	default:
+		delay := Backoff(int(delivered), c.BackoffBase, c.BackoffMax)
+		logger.Warn("handle failed, retrying", "err", err, "deliveries", delivered, "delay", delay)
+		_ = d.NakWithDelay(delay)
+	}
+}
+
+// run calls the handler with the claim-checked payload resolved. The handler
+// gets a copy so msg keeps the reference for dead-lettering.
+func (c *Consumer) run(ctx context.Context, msg *nats.Msg) error {
+	if msg.Header.Get(HeaderClaim) == "" {
+		return c.Handler(ctx, msg)
+	}
+	data, err := c.Claims.Resolve(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return c.Handler(ctx, &nats.Msg{Subject: msg.Subject, Reply: msg.Reply, Header: msg.Header, Data: data, Sub: msg.Sub})
+}
+
+// deadLetter DLQs msg and terminates it. If the DLQ publish fails the message
+// is Nak'd instead so it is not lost.
+func (c *Consumer) deadLetter(ctx context.Context, d Delivery, cause error) {
+	if _, err := PublishDLQ(ctx, c.Bus, c.Subject, d.Msg().Data, cause); err != nil {
+		logging.FromContext(ctx).Error("dlq publish", "subject", c.Subject, "err", err)
+		_ = d.NakWithDelay(c.BackoffMax)
+		return
+	}
+	_ = d.Term()
+}
+
+// keepAlive sends InProgress every interval until the returned func is called.
+func keepAlive(msg Delivery, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_ = msg.InProgress()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Backoff returns base * 2^(deliveries-1), capped at max.
+func Backoff(deliveries int, base, max time.Duration) time.Duration {
+	if deliveries < 1 {
+		deliveries = 1
+	}
+	d := base
+	for i := 1; i < deliveries; i++ {
+		d *= 2
+		if d >= max || d <= 0 {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// maxDeliveriesAdvisory is the subset of
+// io.nats.jetstream.advisory.v1.max_deliver that we use.
+type maxDeliveriesAdvisory struct {
+	Stream     string `json:"stream"`
+	Consumer   string `json:"consumer"`
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries uint64 `json:"deliveries"`
+}
+
+func maxDeliveriesSubject(stream, durable string) string {
+	return fmt.Sprintf("$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.%s.%s", stream, durable)
+}
+
+// watchMaxDeliveries DLQs messages the server gave up on. Replicas share a
+// queue group so each advisory is handled once.
+func (c *Consumer) watchMaxDeliveries(ctx context.Context) (*nats.Subscription, error) {
+	subject := maxDeliveriesSubject(StreamForSubject(c.Subject), c.Durable)
+	sub, err := c.Conn.QueueSubscribe(subject, c.Durable, func(m *nats.Msg) {
+		var adv maxDeliveriesAdvisory
+		if err := json.Unmarshal(m.Data, &adv); err != nil {
+			return
+		}
+		c.deadLetterSeq(ctx, adv)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscribe %s: %w", subject, err)
+	}
+	return sub, nil
+}
+
+func (c *Consumer) deadLetterSeq(ctx context.Context, adv maxDeliveriesAdvisory) {
+	logger := logging.FromContext(ctx).With("subject", c.Subject, "durable", c.Durable, "stream_seq", adv.StreamSeq)
+
+	raw, err := c.NATS.GetMsg(adv.Stream, adv.StreamSeq, nats.Context(ctx))
+	if err != nil {
+		logger.Error("max deliveries: load message", "err", err)
+		return
+	}
+
+	h := dlqHeader(nil, c.Subject, raw.Header.Get(nats.MsgIdHdr), nil, fmt.Errorf("max deliveries exceeded (ack wait expired)"))
+	h.Set(HeaderDLQDurable, c.Durable)
+	h.Set(HeaderDLQDeliveries, fmt.Sprint(adv.Deliveries))
+	h.Set(HeaderDLQStreamSeq, fmt.Sprint(adv.StreamSeq))
+	if r := raw.Header.Get(HeaderReplays); r != "" {
+		h.Set(HeaderReplays, r)
+	}
+	if claim := raw.Header.Get(HeaderClaim); claim != "" {
+		h.Set(HeaderClaim, claim)
+	}
+
+	if _, err := PublishMsg(ctx, c.NATS, &nats.Msg{Subject: DLQSubject(c.Subject), Header: h, Data: raw.Data}); err != nil {
+		logger.Error("max deliveries: dlq publish", "err", err)
+		return
+	}
+	logger.Warn("max deliveries exceeded; message moved to dlq", "deliveries", adv.Deliveries)
+}
@@ -0,0 +1,50 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTerminal(t *testing.T) {
+	base := errors.New("bad payload")
+	err := fmt.Errorf("handle: %w", Terminal(base))
+	if !IsTerminal(err) {
+		t.Fatalf("expected terminal")
+	}
+	if !errors.Is(err, base) {
+		t.Fatalf("terminal should unwrap to cause")
+	}
+	if IsTerminal(base) {
+		t.Fatalf("plain error is not terminal")
+	}
+	if Terminal(nil) != nil {
+		t.Fatalf("Terminal(nil) should be nil")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, 30 * time.Second},
+		{1000, 30 * time.Second},
+	}
+	for _, c := range cases {
+		if got := Backoff(c.n, time.Second, 30*time.Second); got != c.want {
+			t.Fatalf("Backoff(%d) = %v, want %v", c.n, got, c.want)
+		}
+	}
+}
+
+func TestMaxDeliveriesSubject(t *testing.T) {
+	if got := maxDeliveriesSubject("S", "d"); got != "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.S.d" {
+		t.Fatalf("subject: %q", got)
+	}
+}
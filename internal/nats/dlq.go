@@ -0,0 +1,117 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Headers attached to every DLQ entry.
+const (
+	HeaderDLQError      = "Ipfsniffer-Dlq-Error"
+	HeaderDLQSubject    = "Ipfsniffer-Dlq-Subject"
+	HeaderDLQDurable    = "Ipfsniffer-Dlq-Durable"
+	HeaderDLQDeliveries = "Ipfsniffer-Dlq-Deliveries"
+	HeaderDLQStreamSeq  = "Ipfsniffer-Dlq-Stream-Seq"
+	HeaderDLQTime       = "Ipfsniffer-Dlq-Ts"
+	// HeaderDLQMsgID is the Nats-Msg-Id the message was, or was to be,
+	// published with. A replay restores it.
+	HeaderDLQMsgID = "Ipfsniffer-Dlq-Msg-Id"
+
+	// HeaderReplays counts how often a message has been replayed out of a
+	// DLQ. It rides along on the replayed message so a later DLQ entry for
+	// the same work keeps the count.
+	HeaderReplays = "Ipfsniffer-Replays"
+)
+
+// QuarantineStreamName holds messages that exceeded the replay limit.
+const QuarantineStreamName = StreamName + "_QUARANTINE"
+
+const quarantinePrefix = "quarantine."
+
+func QuarantineSubject(subject string) string {
+	return quarantinePrefix + subject
+}
+
+type deliveryKey struct{}
+
+type delivery struct {
+	durable   string
+	msg       *nats.Msg
+	delivered uint64
+	streamSeq uint64
+}
+
+// WithDelivery records the message being handled so PublishDLQ can attach
+// its durable, delivery count, stream sequence and replay count.
+func WithDelivery(ctx context.Context, durable string, msg *nats.Msg) context.Context {
+	d := delivery{durable: durable, msg: msg}
+	if md, err := msg.Metadata(); err == nil {
+		d.delivered = md.NumDelivered
+		d.streamSeq = md.Sequence.Stream
+	}
+	return context.WithValue(ctx, deliveryKey{}, d)
+}
+
+// WithBusDelivery is WithDelivery for a message received through a Bus.
+func WithBusDelivery(ctx context.Context, durable string, d Delivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, delivery{
+		durable:   durable,
+		msg:       d.Msg(),
+		delivered: d.NumDelivered(),
+		streamSeq: d.StreamSeq(),
+	})
+}
+
+func dlqHeader(ctx context.Context, subject, msgID string, payload []byte, cause error) nats.Header {
+	h := nats.Header{}
+	h.Set(HeaderDLQSubject, subject)
+	if msgID != "" {
+		h.Set(HeaderDLQMsgID, msgID)
+	}
+	h.Set(HeaderDLQTime, time.Now().UTC().Format(time.RFC3339Nano))
+	if cause != nil {
+		h.Set(HeaderDLQError, cause.Error())
+	}
+
+	if ctx == nil {
+		return h
+	}
+	d, ok := ctx.Value(deliveryKey{}).(delivery)
+	if !ok || d.msg == nil {
+		return h
+	}
+	if d.durable != "" {
+		h.Set(HeaderDLQDurable, d.durable)
+	}
+	if d.delivered > 0 {
+		h.Set(HeaderDLQDeliveries, strconv.FormatUint(d.delivered, 10))
+	}
+	if d.streamSeq > 0 {
+		h.Set(HeaderDLQStreamSeq, strconv.FormatUint(d.streamSeq, 10))
+	}
+	if r := d.msg.Header.Get(HeaderReplays); r != "" {
+		h.Set(HeaderReplays, r)
+	}
+	// Dead-lettering the delivered message itself: keep its claim so the
+	// entry still points at the stored payload, and its ID.
+	if !bytes.Equal(payload, d.msg.Data) {
+		return h
+	}
+	if claim := d.msg.Header.Get(HeaderClaim); claim != "" {
+		h.Set(HeaderClaim, claim)
+	}
+	if id := ParentMsgID(d.msg); id != "" && msgID == "" {
+		h.Set(HeaderDLQMsgID, id)
+	}
+	return h
+}
+
+// Replays returns the replay count carried in h.
+func Replays(h nats.Header) int {
+	n, _ := strconv.Atoi(h.Get(HeaderReplays))
+	return n
+}
@@ -0,0 +1,385 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// MemoryBus is an in-process Bus for single-process deployments and tests.
+//
+// Durable consumers get at-least-once delivery with AckWait redelivery, Nak
+// delays and MaxDeliver, but nothing survives a restart. Messages published
+// before any consumer or subscriber binds to their subject are held and
+// handed to the first consumer that does, except dead letters: nothing
+// replays them in memory, so they are logged and dropped. Publish options
+// such as MsgId are accepted and ignored. As with core NATS, a SubscribeSync
+// subscriber whose buffer is full misses messages rather than slowing down
+// the publisher; SyncDropped counts them.
+type MemoryBus struct {
+	// MaxBytes caps the payload bytes held per subject, unclaimed or queued
+	// for a consumer until acked; each consumer's copy counts. Once a
+	// subject reaches it, publishing to that subject fails with
+	// ErrMemoryBusFull, so a backlog on one stage does not fail the
+	// publishes of the others. 0 is unlimited.
+	MaxBytes int64
+
+	mu        sync.Mutex
+	seq       uint64
+	consumers map[string]*memConsumer
+	syncSubs  map[*memSyncSub]struct{}
+	unclaimed []*memEntry
+	// held counts the bytes held per subject. The counters are updated
+	// without mu when entries are settled.
+	held map[string]*atomic.Int64
+
+	syncDropped atomic.Uint64
+}
+
+// ErrMemoryBusFull is returned by Publish when a subject holds MaxBytes.
+var ErrMemoryBusFull = errors.New("memory bus full")
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		MaxBytes:  64 << 20,
+		consumers: map[string]*memConsumer{},
+		syncSubs:  map[*memSyncSub]struct{}{},
+		held:      map[string]*atomic.Int64{},
+	}
+}
+
+// SyncDropped counts the messages SubscribeSync subscribers missed because
+// their buffer was full.
+func (b *MemoryBus) SyncDropped() uint64 {
+	return b.syncDropped.Load()
+}
+
+func (b *MemoryBus) Publish(subject string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	return b.PublishMsg(&nats.Msg{Subject: subject, Data: data}, opts...)
+}
+
+func (b *MemoryBus) PublishMsg(m *nats.Msg, _ ...nats.PubOpt) (*nats.PubAck, error) {
+	b.mu.Lock()
+	var claimers []*memConsumer
+	for _, c := range b.consumers {
+		if subjectMatches(c.filter, m.Subject) {
+			claimers = append(claimers, c)
+		}
+	}
+	var subs []*memSyncSub
+	for s := range b.syncSubs {
+		if subjectMatches(s.subject, m.Subject) {
+			subs = append(subs, s)
+		}
+	}
+	// Held for a later consumer unless a subscriber takes it now.
+	hold := len(claimers) == 0 && len(subs) == 0
+	dropped := hold && strings.HasSuffix(m.Subject, ".dlq")
+	if dropped {
+		hold = false
+	}
+	size := int64(len(m.Data)) * int64(len(claimers))
+	if hold {
+		size = int64(len(m.Data))
+	}
+	held := b.held[m.Subject]
+	if held == nil {
+		held = &atomic.Int64{}
+		b.held[m.Subject] = held
+	}
+	if b.MaxBytes > 0 && size > 0 && held.Load()+size > b.MaxBytes {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("publish %s: %w", m.Subject, ErrMemoryBusFull)
+	}
+	held.Add(size)
+	b.seq++
+	seq := b.seq
+	msg := &nats.Msg{Subject: m.Subject, Header: m.Header, Data: append([]byte(nil), m.Data...)}
+
+	for _, c := range claimers {
+		c.push(&memEntry{msg: msg, seq: seq, held: held})
+	}
+	if hold {
+		b.unclaimed = append(b.unclaimed, &memEntry{msg: msg, seq: seq, held: held})
+	}
+	b.mu.Unlock()
+
+	if dropped {
+		slog.Warn("memory bus: dropping dead letter", "subject", m.Subject, "error", m.Header.Get(HeaderDLQError))
+	}
+	for _, s := range subs {
+		s.deliver(msg)
+	}
+	return &nats.PubAck{Stream: "memory", Sequence: seq}, nil
+}
+
+func (b *MemoryBus) PullSubscribe(_ context.Context, subject, durable string, opts ConsumerOpts) (PullSubscription, error) {
+	if subject == "" || durable == "" {
+		return nil, fmt.Errorf("subject and durable required")
+	}
+	if opts.MaxDeliver <= 0 {
+		opts.MaxDeliver = DefaultMaxDeliver
+	}
+	if opts.AckWait <= 0 {
+		opts.AckWait = DefaultAckWait
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.consumers[durable]
+	if !ok {
+		c = &memConsumer{bus: b, filter: subject, notify: make(chan struct{}, 1)}
+		b.consumers[durable] = c
+
+		kept := b.unclaimed[:0]
+		for _, e := range b.unclaimed {
+			if subjectMatches(subject, e.msg.Subject) {
+				c.push(e)
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		b.unclaimed = kept
+	} else if c.filter != subject {
+		return nil, fmt.Errorf("durable %s already bound to %s", durable, c.filter)
+	}
+	c.mu.Lock()
+	c.opts = opts
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (b *MemoryBus) SubscribeSync(subject string) (SyncSubscription, error) {
+	s := &memSyncSub{bus: b, subject: subject, ch: make(chan *nats.Msg, 1024)}
+	b.mu.Lock()
+	b.syncSubs[s] = struct{}{}
+	b.mu.Unlock()
+	return s, nil
+}
+
+// subjectMatches reports whether subject matches filter, honouring the '*'
+// and '>' wildcards.
+func subjectMatches(filter, subject string) bool {
+	ft := strings.Split(filter, ".")
+	st := strings.Split(subject, ".")
+	for i, f := range ft {
+		if f == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) || (f != "*" && f != st[i]) {
+			return false
+		}
+	}
+	return len(ft) == len(st)
+}
+
+type memEntry struct {
+	msg *nats.Msg
+	seq uint64
+	// held is the byte counter of the entry's subject.
+	held      *atomic.Int64
+	delivered uint64
+	readyAt   time.Time
+	// current is the outstanding delivery; acks from older ones are ignored.
+	current *memDelivery
+}
+
+type memConsumer struct {
+	bus    *MemoryBus
+	filter string
+	notify chan struct{}
+
+	mu    sync.Mutex
+	opts  ConsumerOpts
+	ready []*memEntry
+}
+
+func (c *memConsumer) push(e *memEntry) {
+	c.mu.Lock()
+	c.ready = append(c.ready, e)
+	c.mu.Unlock()
+	c.wake()
+}
+
+func (c *memConsumer) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (c *memConsumer) Fetch(ctx context.Context, n int, wait time.Duration) ([]Delivery, error) {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		out, next := c.take(n)
+		if len(out) > 0 {
+			return out, nil
+		}
+
+		var delayed <-chan time.Time
+		var t *time.Timer
+		if !next.IsZero() {
+			t = time.NewTimer(time.Until(next))
+			delayed = t.C
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, nil
+		case <-c.notify:
+		case <-delayed:
+		}
+		if t != nil {
+			t.Stop()
+		}
+	}
+}
+
+// take removes up to n ready entries and returns them as deliveries, along
+// with the earliest time a delayed entry becomes ready.
+func (c *memConsumer) take(n int) ([]Delivery, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var out []Delivery
+	var next time.Time
+	kept := c.ready[:0]
+	for _, e := range c.ready {
+		if len(out) >= n || e.readyAt.After(now) {
+			if e.readyAt.After(now) && (next.IsZero() || e.readyAt.Before(next)) {
+				next = e.readyAt
+			}
+			kept = append(kept, e)
+			continue
+		}
+		e.delivered++
+		d := &memDelivery{c: c, e: e, delivered: e.delivered}
+		e.current = d
+		d.timer = time.AfterFunc(c.opts.AckWait, d.expire)
+		out = append(out, d)
+	}
+	c.ready = kept
+	return out, next
+}
+
+// redeliver puts e back after delay unless it has used up its deliveries.
+// Callers hold c.mu.
+func (c *memConsumer) redeliver(e *memEntry, delay time.Duration) {
+	e.current = nil
+	if e.delivered >= uint64(c.opts.MaxDeliver) {
+		c.release(e)
+		return
+	}
+	e.readyAt = time.Now().Add(delay)
+	c.ready = append(c.ready, e)
+	c.wake()
+}
+
+// release stops counting e against its subject's MaxBytes once it is
+// settled.
+func (c *memConsumer) release(e *memEntry) {
+	e.held.Add(-int64(len(e.msg.Data)))
+}
+
+func (c *memConsumer) Unsubscribe() error { return nil }
+
+type memDelivery struct {
+	c         *memConsumer
+	e         *memEntry
+	delivered uint64
+	timer     *time.Timer
+}
+
+func (d *memDelivery) Msg() *nats.Msg       { return d.e.msg }
+func (d *memDelivery) NumDelivered() uint64 { return d.delivered }
+func (d *memDelivery) StreamSeq() uint64    { return d.e.seq }
+
+// settle runs fn if d is still the outstanding delivery of its entry.
+func (d *memDelivery) settle(fn func()) error {
+	d.c.mu.Lock()
+	defer d.c.mu.Unlock()
+	if d.e.current != d {
+		return nats.ErrMsgAlreadyAckd
+	}
+	d.timer.Stop()
+	fn()
+	return nil
+}
+
+func (d *memDelivery) Ack() error {
+	return d.settle(func() {
+		d.e.current = nil
+		d.c.release(d.e)
+	})
+}
+
+func (d *memDelivery) Term() error { return d.Ack() }
+
+func (d *memDelivery) NakWithDelay(delay time.Duration) error {
+	return d.settle(func() { d.c.redeliver(d.e, delay) })
+}
+
+func (d *memDelivery) InProgress() error {
+	d.c.mu.Lock()
+	defer d.c.mu.Unlock()
+	if d.e.current != d {
+		return nats.ErrMsgAlreadyAckd
+	}
+	d.timer.Reset(d.c.opts.AckWait)
+	return nil
+}
+
+// expire redelivers a message whose ack wait ran out.
+func (d *memDelivery) expire() {
+	d.c.mu.Lock()
+	defer d.c.mu.Unlock()
+	if d.e.current == d {
+		d.c.redeliver(d.e, 0)
+	}
+}
+
+type memSyncSub struct {
+	bus     *MemoryBus
+	subject string
+	ch      chan *nats.Msg
+}
+
+// deliver hands m to the subscriber without blocking, dropping it when the
+// subscriber's buffer is full.
+func (s *memSyncSub) deliver(m *nats.Msg) {
+	select {
+	case s.ch <- m:
+	default:
+		if s.bus.syncDropped.Add(1) == 1 {
+			slog.Warn("memory bus: subscriber too slow, dropping messages", "subject", s.subject)
+		}
+	}
+}
+
+func (s *memSyncSub) NextMsgWithContext(ctx context.Context) (*nats.Msg, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case m := <-s.ch:
+		return m, nil
+	}
+}
+
+func (s *memSyncSub) Unsubscribe() error {
+	s.bus.mu.Lock()
+	delete(s.bus.syncSubs, s)
+	s.bus.mu.Unlock()
+	return nil
+}
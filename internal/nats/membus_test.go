@@ -0,0 +1,236 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func fetchOne(t *testing.T, sub PullSubscription) Delivery {
+	t.Helper()
+	msgs, err := sub.Fetch(context.Background(), 1, time.Second)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("fetched %d messages, want 1", len(msgs))
+	}
+	return msgs[0]
+}
+
+func TestMemoryBus_PublishFetchAck(t *testing.T) {
+	b := NewMemoryBus()
+	sub, err := b.PullSubscribe(context.Background(), SubjectFetchRequest, "fetcher", ConsumerOpts{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := b.Publish(SubjectFetchRequest, []byte("a")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := b.Publish(SubjectDocReady, []byte("other")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	d := fetchOne(t, sub)
+	if string(d.Msg().Data) != "a" || d.NumDelivered() != 1 || d.StreamSeq() != 1 {
+		t.Fatalf("delivery: data=%q delivered=%d seq=%d", d.Msg().Data, d.NumDelivered(), d.StreamSeq())
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := d.Ack(); !errors.Is(err, nats.ErrMsgAlreadyAckd) {
+		t.Fatalf("second ack: %v", err)
+	}
+
+	msgs, err := sub.Fetch(context.Background(), 1, 20*time.Millisecond)
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("expected empty timeout, got %d msgs err=%v", len(msgs), err)
+	}
+}
+
+func TestMemoryBus_NakRedeliversUntilMaxDeliver(t *testing.T) {
+	b := NewMemoryBus()
+	sub, _ := b.PullSubscribe(context.Background(), SubjectFetchRequest, "fetcher", ConsumerOpts{MaxDeliver: 2})
+	_, _ = b.Publish(SubjectFetchRequest, []byte("a"))
+
+	d := fetchOne(t, sub)
+	if err := d.NakWithDelay(10 * time.Millisecond); err != nil {
+		t.Fatalf("nak: %v", err)
+	}
+	d = fetchOne(t, sub)
+	if d.NumDelivered() != 2 {
+		t.Fatalf("delivered = %d, want 2", d.NumDelivered())
+	}
+	_ = d.NakWithDelay(0)
+
+	msgs, _ := sub.Fetch(context.Background(), 1, 20*time.Millisecond)
+	if len(msgs) != 0 {
+		t.Fatalf("message redelivered past MaxDeliver")
+	}
+}
+
+func TestMemoryBus_AckWaitRedelivers(t *testing.T) {
+	b := NewMemoryBus()
+	sub, _ := b.PullSubscribe(context.Background(), SubjectFetchRequest, "fetcher", ConsumerOpts{AckWait: 20 * time.Millisecond})
+	_, _ = b.Publish(SubjectFetchRequest, []byte("a"))
+
+	stale := fetchOne(t, sub)
+	d := fetchOne(t, sub)
+	if d.NumDelivered() != 2 {
+		t.Fatalf("delivered = %d, want 2", d.NumDelivered())
+	}
+	if err := stale.Ack(); err == nil {
+		t.Fatalf("ack of an expired delivery should fail")
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+}
+
+func TestMemoryBus_UnclaimedHandoff(t *testing.T) {
+	b := NewMemoryBus()
+	_, _ = b.Publish(SubjectIndexRequest, []byte("early"))
+
+	sub, _ := b.PullSubscribe(context.Background(), SubjectIndexRequest, "indexer", ConsumerOpts{})
+	if d := fetchOne(t, sub); string(d.Msg().Data) != "early" {
+		t.Fatalf("data = %q", d.Msg().Data)
+	}
+}
+
+func TestMemoryBus_MaxBytes(t *testing.T) {
+	b := NewMemoryBus()
+	b.MaxBytes = 4
+	sub, _ := b.PullSubscribe(context.Background(), SubjectFetchRequest, "fetcher", ConsumerOpts{})
+	if _, err := b.Publish(SubjectFetchRequest, []byte("abc")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := b.Publish(SubjectFetchRequest, []byte("de")); !errors.Is(err, ErrMemoryBusFull) {
+		t.Fatalf("publish past MaxBytes: %v", err)
+	}
+	// Other subjects have their own budget.
+	if _, err := b.Publish(SubjectIndexRequest, []byte("de")); err != nil {
+		t.Fatalf("publish to another subject: %v", err)
+	}
+	if _, err := b.Publish(SubjectIndexRequest, []byte("fgh")); !errors.Is(err, ErrMemoryBusFull) {
+		t.Fatalf("unclaimed publish past MaxBytes: %v", err)
+	}
+
+	if err := fetchOne(t, sub).Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, err := b.Publish(SubjectFetchRequest, []byte("de")); err != nil {
+		t.Fatalf("publish after ack: %v", err)
+	}
+}
+
+func TestMemoryBus_DropsUnclaimedDeadLetters(t *testing.T) {
+	b := NewMemoryBus()
+	_, _ = b.Publish(DLQSubject(SubjectDocReady), []byte("dead"))
+
+	sub, _ := b.PullSubscribe(context.Background(), DLQSubject(SubjectDocReady), "dlq", ConsumerOpts{})
+	msgs, _ := sub.Fetch(context.Background(), 1, 20*time.Millisecond)
+	if len(msgs) != 0 {
+		t.Fatalf("dead letter held without a consumer")
+	}
+}
+
+func TestMemoryBus_SubscribeSync(t *testing.T) {
+	b := NewMemoryBus()
+	subject := StreamChunkSubject("s1")
+	sub, _ := b.SubscribeSync(subject)
+	_, _ = b.Publish(subject, []byte("chunk"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := sub.NextMsgWithContext(ctx)
+	if err != nil || string(m.Data) != "chunk" {
+		t.Fatalf("next: %v %v", m, err)
+	}
+
+	_ = sub.Unsubscribe()
+	_, _ = b.Publish(subject, []byte("late"))
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	if _, err := sub.NextMsgWithContext(short); err == nil {
+		t.Fatalf("unsubscribed subscription still received")
+	}
+}
+
+func TestMemoryBus_SlowSubscriberDoesNotBlockPublish(t *testing.T) {
+	b := NewMemoryBus()
+	subject := StreamChunkSubject("s1")
+	sub, _ := b.SubscribeSync(subject)
+	defer sub.Unsubscribe()
+
+	start := time.Now()
+	for range 1100 {
+		if _, err := b.Publish(subject, []byte("chunk")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("publishing to an unread subscriber took %v", d)
+	}
+	if got := b.SyncDropped(); got != 1100-1024 {
+		t.Fatalf("dropped = %d, want %d", got, 1100-1024)
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	cases := []struct {
+		filter, subject string
+		want            bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a.b.c", false},
+		{"a.>", "a.b.c", true},
+		{"a.>", "a", false},
+		{"a.b", "a.b.c", false},
+	}
+	for _, c := range cases {
+		if got := subjectMatches(c.filter, c.subject); got != c.want {
+			t.Fatalf("subjectMatches(%q, %q) = %v, want %v", c.filter, c.subject, got, c.want)
+		}
+	}
+}
+
+func TestConsumer_MemoryBusDeadLetters(t *testing.T) {
+	b := NewMemoryBus()
+	dlq, _ := b.PullSubscribe(context.Background(), DLQSubject(SubjectDocReady), "dlq", ConsumerOpts{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Consumer{
+		Bus:       b,
+		Subject:   SubjectDocReady,
+		Durable:   "index-prep",
+		FetchWait: 20 * time.Millisecond,
+		Handler: func(context.Context, *nats.Msg) error {
+			return Terminal(errors.New("bad payload"))
+		},
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	_, _ = b.Publish(SubjectDocReady, []byte("doc"))
+	d := fetchOne(t, dlq)
+	if string(d.Msg().Data) != "doc" {
+		t.Fatalf("dlq data = %q", d.Msg().Data)
+	}
+	if got := d.Msg().Header.Get(HeaderDLQDurable); got != "index-prep" {
+		t.Fatalf("dlq durable = %q", got)
+	}
+	if got := d.Msg().Header.Get(HeaderDLQDeliveries); got != "1" {
+		t.Fatalf("dlq deliveries = %q", got)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run: %v", err)
+	}
+}
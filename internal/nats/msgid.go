@@ -0,0 +1,36 @@
+package nats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// MsgID derives a Nats-Msg-Id from the pipeline stage and the content that
+// identifies a message (CID, path, ...). Publishing the same output twice,
+// e.g. after a redelivery, then produces the same ID and the stream drops the
+// copy inside its duplicate window.
+//
+// parent is the Nats-Msg-Id of the message being handled (see ParentMsgID).
+// Chaining it keeps redeliveries idempotent while still letting a deliberate
+// upstream re-run, which carries a new ID, flow through.
+func MsgID(parent, stage string, parts ...string) string {
+	h := sha256.New()
+	h.Write([]byte(parent))
+	h.Write([]byte{0})
+	h.Write([]byte(stage))
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ParentMsgID returns the Nats-Msg-Id msg was published with, if any.
+func ParentMsgID(msg *nats.Msg) string {
+	if msg == nil || msg.Header == nil {
+		return ""
+	}
+	return msg.Header.Get(nats.MsgIdHdr)
+}
@@ -0,0 +1,35 @@
+package nats
+
+import (
+	"testing"
+
+	natslib "github.com/nats-io/nats.go"
+)
+
+func TestMsgID(t *testing.T) {
+	a := MsgID("", SubjectFetchRequest, "bafy", "/ipfs/bafy")
+	if a != MsgID("", SubjectFetchRequest, "bafy", "/ipfs/bafy") {
+		t.Fatalf("msg id must be deterministic")
+	}
+	if a == MsgID("", SubjectFetchResult, "bafy", "/ipfs/bafy") {
+		t.Fatalf("stage must change the id")
+	}
+	if a == MsgID("p1", SubjectFetchRequest, "bafy", "/ipfs/bafy") {
+		t.Fatalf("parent must change the id")
+	}
+	// Parts are delimited so shifting bytes between them changes the id.
+	if MsgID("", "s", "ab", "c") == MsgID("", "s", "a", "bc") {
+		t.Fatalf("parts must be delimited")
+	}
+}
+
+func TestParentMsgID(t *testing.T) {
+	if ParentMsgID(nil) != "" || ParentMsgID(&natslib.Msg{}) != "" {
+		t.Fatalf("expected empty parent")
+	}
+	m := &natslib.Msg{Header: natslib.Header{}}
+	m.Header.Set(natslib.MsgIdHdr, "abc")
+	if ParentMsgID(m) != "abc" {
+		t.Fatalf("parent: %q", ParentMsgID(m))
+	}
+}
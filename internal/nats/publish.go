@@ -9,9 +9,12 @@ import (
 
 type Publisher interface {
 	Publish(subject string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error)
+	PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error)
 }
 
-func Publish(ctx context.Context, js Publisher, subject string, payload []byte) (*nats.PubAck, error) {
+// Publish publishes payload to subject. Pass nats.MsgId(MsgID(...)) in opts
+// to have the stream drop re-publishes inside its duplicate window.
+func Publish(ctx context.Context, js Publisher, subject string, payload []byte, opts ...nats.PubOpt) (*nats.PubAck, error) {
 	if subject == "" {
 		return nil, fmt.Errorf("subject required")
 	}
@@ -19,13 +22,40 @@ func Publish(ctx context.Context, js Publisher, subject string, payload []byte)
 		return nil, fmt.Errorf("payload required")
 	}
 
-	ack, err := js.Publish(subject, payload)
+	ack, err := js.Publish(subject, payload, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("publish %s: %w", subject, err)
 	}
 	return ack, nil
 }
 
-func PublishDLQ(ctx context.Context, js Publisher, subject string, payload []byte) (*nats.PubAck, error) {
-	return Publish(ctx, js, DLQSubject(subject), payload)
+// PublishDLQ copies payload to the DLQ of subject. The entry carries cause and,
+// when ctx came from WithDelivery, the consumer and delivery that failed.
+func PublishDLQ(ctx context.Context, js Publisher, subject string, payload []byte, cause error) (*nats.PubAck, error) {
+	return PublishDLQWithID(ctx, js, subject, "", payload, cause)
+}
+
+// PublishDLQWithID is PublishDLQ for a payload whose publish with message ID
+// msgID failed; a replay publishes it with that ID.
+func PublishDLQWithID(ctx context.Context, js Publisher, subject, msgID string, payload []byte, cause error) (*nats.PubAck, error) {
+	return PublishMsg(ctx, js, &nats.Msg{
+		Subject: DLQSubject(subject),
+		Header:  dlqHeader(ctx, subject, msgID, payload, cause),
+		Data:    payload,
+	})
+}
+
+func PublishMsg(ctx context.Context, js Publisher, m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	if m == nil || m.Subject == "" {
+		return nil, fmt.Errorf("subject required")
+	}
+	if len(m.Data) == 0 {
+		return nil, fmt.Errorf("payload required")
+	}
+
+	ack, err := js.PublishMsg(m, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("publish %s: %w", m.Subject, err)
+	}
+	return ack, nil
 }
@@ -1,6 +1,8 @@
 package nats
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	natslib "github.com/nats-io/nats.go"
@@ -9,15 +11,23 @@ import (
 type fakePublisher struct {
 	lastSubject string
 	lastData    []byte
+	lastHeader  natslib.Header
+	lastOpts    int
 	err         error
 }
 
 func (f *fakePublisher) Publish(subject string, data []byte, opts ...natslib.PubOpt) (*natslib.PubAck, error) {
 	f.lastSubject = subject
 	f.lastData = append([]byte(nil), data...)
+	f.lastOpts = len(opts)
 	return &natslib.PubAck{}, f.err
 }
 
+func (f *fakePublisher) PublishMsg(m *natslib.Msg, opts ...natslib.PubOpt) (*natslib.PubAck, error) {
+	f.lastHeader = m.Header
+	return f.Publish(m.Subject, m.Data, opts...)
+}
+
 func TestPublish_ValidatesInputs(t *testing.T) {
 	fp := &fakePublisher{}
 	if _, err := Publish(nil, fp, "", []byte("x")); err == nil {
@@ -42,9 +52,19 @@ func TestPublish_Publishes(t *testing.T) {
 	}
 }
 
+func TestPublish_PassesOptions(t *testing.T) {
+	fp := &fakePublisher{}
+	if _, err := Publish(nil, fp, "a", []byte("b"), natslib.MsgId("id")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if fp.lastOpts != 1 {
+		t.Fatalf("opts: %d", fp.lastOpts)
+	}
+}
+
 func TestPublishDLQ_UsesDLQSubject(t *testing.T) {
 	fp := &fakePublisher{}
-	_, err := PublishDLQ(nil, fp, "x.y", []byte("z"))
+	_, err := PublishDLQ(nil, fp, "x.y", []byte("z"), nil)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -52,3 +72,91 @@ func TestPublishDLQ_UsesDLQSubject(t *testing.T) {
 		t.Fatalf("subject: %q", fp.lastSubject)
 	}
 }
+
+func TestPublishDLQ_AttachesMetadata(t *testing.T) {
+	fp := &fakePublisher{}
+	in := &natslib.Msg{Subject: "x.y", Header: natslib.Header{HeaderReplays: []string{"2"}}}
+	ctx := WithDelivery(context.Background(), "worker", in)
+
+	if _, err := PublishDLQ(ctx, fp, "x.y", []byte("z"), errors.New("boom")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	h := fp.lastHeader
+	if h.Get(HeaderDLQError) != "boom" || h.Get(HeaderDLQSubject) != "x.y" || h.Get(HeaderDLQDurable) != "worker" {
+		t.Fatalf("header: %v", h)
+	}
+	if Replays(h) != 2 {
+		t.Fatalf("replays: %v", h)
+	}
+	if h.Get(HeaderDLQTime) == "" {
+		t.Fatalf("missing timestamp")
+	}
+}
+
+func TestPublishDLQ_KeepsMsgID(t *testing.T) {
+	fp := &fakePublisher{}
+	if _, err := PublishDLQWithID(nil, fp, "x.y", "id1", []byte("z"), nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := fp.lastHeader.Get(HeaderDLQMsgID); got != "id1" {
+		t.Fatalf("msg id: %q", got)
+	}
+
+	// Dead-lettering a delivered message keeps the ID it was published with.
+	in := &natslib.Msg{Subject: "x.y", Header: natslib.Header{natslib.MsgIdHdr: []string{"id2"}}, Data: []byte("z")}
+	if _, err := PublishDLQ(WithDelivery(context.Background(), "worker", in), fp, "x.y", in.Data, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := fp.lastHeader.Get(HeaderDLQMsgID); got != "id2" {
+		t.Fatalf("delivered msg id: %q", got)
+	}
+}
+
+// dedupPublisher acks IDs it already holds as duplicates, like a stream
+// inside its duplicate window.
+type dedupPublisher struct {
+	ids  map[string]bool
+	msgs []*natslib.Msg
+}
+
+func (d *dedupPublisher) Publish(subject string, data []byte, opts ...natslib.PubOpt) (*natslib.PubAck, error) {
+	return d.PublishMsg(&natslib.Msg{Subject: subject, Data: data}, opts...)
+}
+
+func (d *dedupPublisher) PublishMsg(m *natslib.Msg, _ ...natslib.PubOpt) (*natslib.PubAck, error) {
+	id := m.Header.Get(natslib.MsgIdHdr)
+	if id != "" && d.ids[id] {
+		return &natslib.PubAck{Duplicate: true}, nil
+	}
+	d.ids[id] = true
+	h := natslib.Header{}
+	for k, v := range m.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	d.msgs = append(d.msgs, &natslib.Msg{Subject: m.Subject, Header: h, Data: m.Data})
+	return &natslib.PubAck{}, nil
+}
+
+func TestPublishReplay_RestoresMsgID(t *testing.T) {
+	h := natslib.Header{}
+	h.Set(HeaderDLQSubject, "x.y")
+	h.Set(HeaderDLQMsgID, "id1")
+	m := DLQMessage{Subject: "x.y.dlq", Header: h, Data: []byte("z")}
+
+	d := &dedupPublisher{ids: map[string]bool{}}
+	if err := publishReplay(context.Background(), d, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.msgs) != 1 || ParentMsgID(d.msgs[0]) != "id1" || d.msgs[0].Subject != "x.y" {
+		t.Fatalf("replayed: %+v", d.msgs)
+	}
+
+	// The stream still holds id1, so a second replay gets an ID derived
+	// from it.
+	if err := publishReplay(context.Background(), d, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.msgs) != 2 || ParentMsgID(d.msgs[1]) != MsgID("id1", "replay", "1") {
+		t.Fatalf("replayed inside the duplicate window: %+v", d.msgs)
+	}
+}
@@ -2,68 +2,316 @@ package nats
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	nats "github.com/nats-io/nats.go"
 )
 
 const DefaultMaxDeliver = 5
 
-func EnsureStream(ctx context.Context, js nats.JetStreamContext) error {
-	stream, err := js.StreamInfo(StreamName)
-	if err == nil && stream != nil {
-		return nil
+// StreamSettings controls retention and placement of a JetStream stream.
+// Zero limits mean unlimited.
+type StreamSettings struct {
+	// Retention is "limits", "workqueue" or "interest". Workqueue only
+	// suits streams with a single consumer per subject.
+	Retention string
+	// Storage is "file" or "memory".
+	Storage  string
+	MaxAge   time.Duration
+	MaxBytes int64
+	MaxMsgs  int64
+	Replicas int
+	// Duplicates is the window in which a repeated Nats-Msg-Id is dropped
+	// (0 keeps the server default of 2m). It must cover the longest gap
+	// between redeliveries for idempotent publishing to hold.
+	Duplicates time.Duration
+}
+
+// StreamsConfig holds the settings for every stream EnsureStream manages.
+// Every worker reconciles the streams on start, so all roles must be given
+// the same values.
+type StreamsConfig struct {
+	// Pipeline is the IPFSNIFFER stream carrying pipeline events.
+	Pipeline StreamSettings
+	// Chunks carries stream.get requests and stream.chunk.* replies. The
+	// bytes are only useful while the requester is reading them.
+	Chunks StreamSettings
+	// DLQ applies to each per-subject DLQ stream and the quarantine stream.
+	DLQ StreamSettings
+}
+
+func DefaultStreamsConfig() StreamsConfig {
+	return StreamsConfig{
+		Pipeline: StreamSettings{Retention: "limits", Storage: "file", Replicas: 1, Duplicates: 10 * time.Minute},
+		Chunks: StreamSettings{
+			Retention: "limits",
+			Storage:   "memory",
+			MaxAge:    10 * time.Minute,
+			MaxBytes:  1 << 30,
+			Replicas:  1,
+		},
+		DLQ: StreamSettings{Retention: "limits", Storage: "file", Replicas: 1},
+	}
+}
+
+func (s StreamSettings) Validate() error {
+	if _, err := retentionPolicy(s.Retention); err != nil {
+		return err
+	}
+	if _, err := storageType(s.Storage); err != nil {
+		return err
+	}
+	if s.MaxAge < 0 || s.MaxBytes < 0 || s.MaxMsgs < 0 || s.Replicas < 0 || s.Duplicates < 0 {
+		return fmt.Errorf("stream limits must not be negative")
+	}
+	if s.MaxAge > 0 && s.Duplicates > s.MaxAge {
+		return fmt.Errorf("duplicate window %s exceeds max age %s", s.Duplicates, s.MaxAge)
+	}
+	return nil
+}
+
+// ValidateShared is Validate for a stream whose subjects several consumers
+// read, such as the pipeline stream, where enqueue-fetch and resolver-ipns
+// both consume cid.discovered. Workqueue retention cannot serve it: it hands
+// each message to one consumer only, and JetStream rejects overlapping
+// consumers on such a stream.
+func (s StreamSettings) ValidateShared() error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if p, _ := retentionPolicy(s.Retention); p == nats.WorkQueuePolicy {
+		return fmt.Errorf("workqueue retention needs a single consumer per subject; use limits or interest")
+	}
+	return nil
+}
+
+func (s StreamSettings) streamConfig(name string, subjects []string) (*nats.StreamConfig, error) {
+	retention, err := retentionPolicy(s.Retention)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := storageType(s.Storage)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &nats.StreamConfig{
+		Name:       name,
+		Subjects:   subjects,
+		Retention:  retention,
+		Storage:    storage,
+		MaxAge:     s.MaxAge,
+		MaxBytes:   -1,
+		MaxMsgs:    -1,
+		Replicas:   max(s.Replicas, 1),
+		Duplicates: s.Duplicates,
+	}
+	if s.MaxBytes > 0 {
+		cfg.MaxBytes = s.MaxBytes
 	}
-	if err != nil && err != nats.ErrStreamNotFound {
-		return fmt.Errorf("lookup stream: %w", err)
+	if s.MaxMsgs > 0 {
+		cfg.MaxMsgs = s.MaxMsgs
 	}
+	return cfg, nil
+}
 
-	_, err = js.AddStream(&nats.StreamConfig{
-		Name:      StreamName,
-		Subjects:  PipelineSubjects,
-		Retention: nats.LimitsPolicy,
-		Storage:   nats.FileStorage,
-		MaxMsgs:   -1,
-		MaxBytes:  -1,
-		MaxAge:    0,
-	})
+func retentionPolicy(s string) (nats.RetentionPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "limits":
+		return nats.LimitsPolicy, nil
+	case "workqueue", "work-queue", "work_queue":
+		return nats.WorkQueuePolicy, nil
+	case "interest":
+		return nats.InterestPolicy, nil
+	}
+	return 0, fmt.Errorf("unknown retention %q (want limits, workqueue or interest)", s)
+}
+
+func storageType(s string) (nats.StorageType, error) {
+	switch strings.ToLower(s) {
+	case "", "file":
+		return nats.FileStorage, nil
+	case "memory":
+		return nats.MemoryStorage, nil
+	}
+	return 0, fmt.Errorf("unknown storage %q (want file or memory)", s)
+}
+
+// EnsureStream creates or reconciles the pipeline, chunk, DLQ and quarantine
+// streams so that their retention and limits match cfg.
+//
+// Deployments that predate the chunk stream carry stream.* on the pipeline
+// stream; those subjects, their stored messages and their consumers are
+// moved off it first.
+func EnsureStream(ctx context.Context, js nats.JetStreamContext, cfg StreamsConfig) error {
+	pipeline, err := cfg.Pipeline.streamConfig(StreamName, EventSubjects)
+	if err != nil {
+		return fmt.Errorf("stream %s: %w", StreamName, err)
+	}
+	chunks, err := cfg.Chunks.streamConfig(ChunkStreamName, ChunkSubjects)
 	if err != nil {
-		return fmt.Errorf("add stream: %w", err)
+		return fmt.Errorf("stream %s: %w", ChunkStreamName, err)
+	}
+
+	if err := migrateChunkSubjects(ctx, js); err != nil {
+		return err
+	}
+	if err := reconcileStream(ctx, js, pipeline); err != nil {
+		return err
+	}
+	if err := reconcileStream(ctx, js, chunks); err != nil {
+		return err
 	}
 
 	for _, subject := range PipelineSubjects {
-		_, err = js.AddStream(&nats.StreamConfig{
-			Name:      dlqStreamName(subject),
-			Subjects:  []string{DLQSubject(subject)},
-			Retention: nats.LimitsPolicy,
-			Storage:   nats.FileStorage,
-			MaxMsgs:   -1,
-			MaxBytes:  -1,
-			MaxAge:    0,
-		})
-		if err != nil && err != nats.ErrStreamNameAlreadyInUse {
-			return fmt.Errorf("add dlq stream for %s: %w", subject, err)
+		dlq, err := cfg.DLQ.streamConfig(dlqStreamName(subject), []string{DLQSubject(subject)})
+		if err != nil {
+			return fmt.Errorf("dlq stream for %s: %w", subject, err)
+		}
+		if err := reconcileStream(ctx, js, dlq); err != nil {
+			return err
+		}
+	}
+
+	quarantine, err := cfg.DLQ.streamConfig(QuarantineStreamName, []string{quarantinePrefix + ">"})
+	if err != nil {
+		return fmt.Errorf("stream %s: %w", QuarantineStreamName, err)
+	}
+	return reconcileStream(ctx, js, quarantine)
+}
+
+// reconcileStream adds want, or updates an existing stream whose subjects or
+// limits differ. Retention and storage cannot be changed in place; a
+// mismatch is reported rather than silently ignored.
+func reconcileStream(ctx context.Context, js nats.JetStreamContext, want *nats.StreamConfig) error {
+	si, err := js.StreamInfo(want.Name, nats.Context(ctx))
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := js.AddStream(want, nats.Context(ctx)); err != nil && !errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+			return fmt.Errorf("add stream %s: %w", want.Name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("lookup stream %s: %w", want.Name, err)
+	}
+
+	have := si.Config
+	if have.Retention != want.Retention {
+		return fmt.Errorf("stream %s: retention is %s, config wants %s; recreate the stream to change it", want.Name, have.Retention, want.Retention)
+	}
+	if have.Storage != want.Storage {
+		return fmt.Errorf("stream %s: storage is %s, config wants %s; recreate the stream to change it", want.Name, have.Storage, want.Storage)
+	}
+	if !streamNeedsUpdate(have, *want) {
+		return nil
+	}
+
+	have.Subjects = want.Subjects
+	have.MaxAge = want.MaxAge
+	have.MaxBytes = want.MaxBytes
+	have.MaxMsgs = want.MaxMsgs
+	have.Replicas = want.Replicas
+	if want.Duplicates > 0 {
+		have.Duplicates = want.Duplicates
+	}
+	if _, err := js.UpdateStream(&have, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("update stream %s: %w", want.Name, err)
+	}
+	return nil
+}
+
+func streamNeedsUpdate(have, want nats.StreamConfig) bool {
+	return !slices.Equal(have.Subjects, want.Subjects) ||
+		have.MaxAge != want.MaxAge ||
+		have.MaxBytes != want.MaxBytes ||
+		have.MaxMsgs != want.MaxMsgs ||
+		have.Replicas != want.Replicas ||
+		(want.Duplicates > 0 && have.Duplicates != want.Duplicates)
+}
+
+// migrateChunkSubjects removes the chunk subjects from an older pipeline
+// stream: consumers filtering on them are deleted, stored chunks purged and
+// the subjects dropped so the chunk stream can claim them.
+func migrateChunkSubjects(ctx context.Context, js nats.JetStreamContext) error {
+	si, err := js.StreamInfo(StreamName, nats.Context(ctx))
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("lookup stream %s: %w", StreamName, err)
+	}
+	if !slices.ContainsFunc(si.Config.Subjects, isChunkSubject) {
+		return nil
+	}
+
+	for ci := range js.Consumers(StreamName, nats.Context(ctx)) {
+		if isChunkSubject(ci.Config.FilterSubject) {
+			if err := js.DeleteConsumer(StreamName, ci.Name, nats.Context(ctx)); err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+				return fmt.Errorf("delete consumer %s: %w", ci.Name, err)
+			}
 		}
 	}
+	if err := js.PurgeStream(StreamName, &nats.StreamPurgeRequest{Subject: "stream.>"}, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("purge chunk subjects from %s: %w", StreamName, err)
+	}
 
+	cfg := si.Config
+	cfg.Subjects = slices.DeleteFunc(slices.Clone(cfg.Subjects), isChunkSubject)
+	if _, err := js.UpdateStream(&cfg, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("update stream %s: %w", StreamName, err)
+	}
 	return nil
 }
 
+func isChunkSubject(subject string) bool {
+	return slices.Contains(ChunkSubjects, subject)
+}
+
 func EnsureConsumer(ctx context.Context, js nats.JetStreamContext, subject, durable string, maxDeliver int) error {
+	return ensureConsumer(ctx, js, subject, durable, maxDeliver, 0)
+}
+
+// ensureConsumer creates the durable, or brings MaxDeliver and AckWait of an
+// existing one in line with the requested values. ackWait 0 keeps the server
+// default.
+func ensureConsumer(ctx context.Context, js nats.JetStreamContext, subject, durable string, maxDeliver int, ackWait time.Duration) error {
 	if maxDeliver <= 0 {
 		maxDeliver = DefaultMaxDeliver
 	}
 
+	stream := StreamForSubject(subject)
+	ci, err := js.ConsumerInfo(stream, durable, nats.Context(ctx))
+	if err == nil {
+		cfg := ci.Config
+		if cfg.MaxDeliver == maxDeliver && (ackWait == 0 || cfg.AckWait == ackWait) {
+			return nil
+		}
+		cfg.MaxDeliver = maxDeliver
+		if ackWait > 0 {
+			cfg.AckWait = ackWait
+		}
+		if _, err := js.UpdateConsumer(stream, &cfg, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("update consumer %s: %w", durable, err)
+		}
+		return nil
+	}
+	if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return fmt.Errorf("lookup consumer %s: %w", durable, err)
+	}
+
 	cfg := &nats.ConsumerConfig{
 		Durable:       durable,
 		Description:   fmt.Sprintf("%s consumer", subject),
 		AckPolicy:     nats.AckExplicitPolicy,
 		FilterSubject: subject,
 		MaxDeliver:    maxDeliver,
+		AckWait:       ackWait,
 	}
 
-	_, err := js.AddConsumer(StreamName, cfg)
+	_, err = js.AddConsumer(stream, cfg, nats.Context(ctx))
 	if err != nil && err != nats.ErrConsumerNameAlreadyInUse {
 		return fmt.Errorf("add consumer %s: %w", durable, err)
 	}
@@ -78,3 +326,11 @@ func dlqStreamName(subject string) string {
 	n = strings.ReplaceAll(n, "*", "STAR")
 	return fmt.Sprintf("%s_%s_DLQ", StreamName, n)
 }
+
+// CheckStream verifies that the named stream exists and is reachable.
+func CheckStream(ctx context.Context, js nats.JetStreamContext, name string) error {
+	if _, err := js.StreamInfo(name, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("stream %s: %w", name, err)
+	}
+	return nil
+}
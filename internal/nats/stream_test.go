@@ -0,0 +1,83 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestStreamForSubject(t *testing.T) {
+	cases := map[string]string{
+		SubjectFetchRequest:                   StreamName,
+		SubjectIndexRequest:                   StreamName,
+		SubjectStreamGet:                      ChunkStreamName,
+		StreamChunkSubject("abc"):             ChunkStreamName,
+		DLQSubject(SubjectFetchRequest):       dlqStreamName(SubjectFetchRequest),
+		DLQSubject(StreamChunkSubject("abc")): dlqStreamName(SubjectStreamChunkPrefix + "*"),
+		QuarantineSubject(SubjectDocReady):    QuarantineStreamName,
+	}
+	for subject, want := range cases {
+		if got := StreamForSubject(subject); got != want {
+			t.Fatalf("%s: got %s want %s", subject, got, want)
+		}
+	}
+}
+
+func TestStreamSettings(t *testing.T) {
+	cfg, err := StreamSettings{Retention: "workqueue", Storage: "memory", MaxAge: time.Hour, MaxBytes: 1024}.streamConfig("X", []string{"x"})
+	if err != nil {
+		t.Fatalf("streamConfig: %v", err)
+	}
+	if cfg.Retention != nats.WorkQueuePolicy || cfg.Storage != nats.MemoryStorage {
+		t.Fatalf("policy: %+v", cfg)
+	}
+	if cfg.MaxAge != time.Hour || cfg.MaxBytes != 1024 || cfg.MaxMsgs != -1 || cfg.Replicas != 1 {
+		t.Fatalf("limits: %+v", cfg)
+	}
+
+	for _, s := range []StreamSettings{{Retention: "forever"}, {Storage: "tape"}, {MaxBytes: -5}, {MaxAge: time.Minute, Duplicates: time.Hour}} {
+		if err := s.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", s)
+		}
+	}
+	if err := (StreamSettings{Retention: "workqueue"}).ValidateShared(); err == nil {
+		t.Fatalf("expected workqueue to be rejected for a shared stream")
+	}
+	if err := (StreamSettings{Retention: "interest"}).ValidateShared(); err != nil {
+		t.Fatalf("interest: %v", err)
+	}
+}
+
+func TestStreamNeedsUpdate(t *testing.T) {
+	have := nats.StreamConfig{Subjects: []string{"a", "b"}, MaxBytes: -1, MaxMsgs: -1, Replicas: 1}
+	if streamNeedsUpdate(have, have) {
+		t.Fatalf("identical configs should not need update")
+	}
+	want := have
+	want.MaxAge = time.Hour
+	if !streamNeedsUpdate(have, want) {
+		t.Fatalf("max age change should need update")
+	}
+	want = have
+	want.Duplicates = 10 * time.Minute
+	if !streamNeedsUpdate(have, want) {
+		t.Fatalf("duplicate window change should need update")
+	}
+	want = have
+	want.Subjects = []string{"a"}
+	if !streamNeedsUpdate(have, want) {
+		t.Fatalf("subject change should need update")
+	}
+}
+
+func TestSubjectPartition(t *testing.T) {
+	if len(EventSubjects)+len(ChunkSubjects) != len(PipelineSubjects) {
+		t.Fatalf("pipeline subjects must be split between the two streams")
+	}
+	for _, s := range EventSubjects {
+		if isChunkSubject(s) {
+			t.Fatalf("%s on both streams", s)
+		}
+	}
+}
@@ -1,28 +1,62 @@
 package nats
 
+import (
+	"slices"
+	"strings"
+)
+
 const (
 	StreamName = "IPFSNIFFER"
+	// ChunkStreamName holds streaming requests and their byte chunks.
+	ChunkStreamName = StreamName + "_CHUNKS"
 
 	SubjectCidDiscovered = "cid.discovered"
 	SubjectFetchRequest  = "fetch.request"
 	SubjectFetchResult   = "fetch.result"
 	SubjectDocReady      = "doc.ready"
 	SubjectIndexRequest  = "index.request"
+	SubjectPeerObserved  = "peer.observed"
 
 	SubjectStreamGet         = "stream.get"
 	SubjectStreamChunkPrefix = "stream.chunk."
 )
 
-var PipelineSubjects = []string{
+// PipelineSubjects is every subject the workers publish, each with its own DLQ.
+var PipelineSubjects = append(slices.Clone(EventSubjects), ChunkSubjects...)
+
+// EventSubjects are stored on StreamName.
+var EventSubjects = []string{
 	SubjectCidDiscovered,
 	SubjectFetchRequest,
 	SubjectFetchResult,
 	SubjectDocReady,
 	SubjectIndexRequest,
+	SubjectPeerObserved,
+}
+
+// ChunkSubjects are stored on ChunkStreamName.
+var ChunkSubjects = []string{
 	SubjectStreamGet,
 	SubjectStreamChunkPrefix + "*",
 }
 
+// StreamForSubject returns the stream that stores subject.
+func StreamForSubject(subject string) string {
+	switch {
+	case strings.HasPrefix(subject, quarantinePrefix):
+		return QuarantineStreamName
+	case strings.HasSuffix(subject, ".dlq"):
+		orig := strings.TrimSuffix(subject, ".dlq")
+		if strings.HasPrefix(orig, SubjectStreamChunkPrefix) {
+			orig = SubjectStreamChunkPrefix + "*"
+		}
+		return dlqStreamName(orig)
+	case subject == SubjectStreamGet || strings.HasPrefix(subject, SubjectStreamChunkPrefix):
+		return ChunkStreamName
+	}
+	return StreamName
+}
+
 func StreamChunkSubject(streamID string) string {
 	return SubjectStreamChunkPrefix + streamID
 }
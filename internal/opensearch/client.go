@@ -5,14 +5,22 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/Rorical/IPFSniffer/internal/tlsconfig"
+
 	opensearch "github.com/opensearch-project/opensearch-go/v4"
 )
 
 type Config struct {
-	URL      string
+	URL string
+	// Username and Password enable HTTP basic auth.
 	Username string
 	Password string
+	// Insecure skips TLS certificate verification.
 	Insecure bool
+
+	// TLS verifies https URLs against a CA and may present a client
+	// certificate.
+	TLS tlsconfig.Config
 }
 
 func New(cfg Config) (*opensearch.Client, error) {
@@ -20,10 +28,17 @@ func New(cfg Config) (*opensearch.Client, error) {
 		return nil, fmt.Errorf("opensearch url required")
 	}
 
-	tr := &http.Transport{}
+	tlsCfg, err := cfg.TLS.Client()
+	if err != nil {
+		return nil, fmt.Errorf("opensearch tls: %w", err)
+	}
 	if cfg.Insecure {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		if tlsCfg == nil {
+			tlsCfg = &tls.Config{}
+		}
+		tlsCfg.InsecureSkipVerify = true
 	}
+	tr := &http.Transport{TLSClientConfig: tlsCfg}
 
 	c, err := opensearch.NewClient(opensearch.Config{
 		Addresses: []string{cfg.URL},
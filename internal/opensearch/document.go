@@ -0,0 +1,140 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	opensearch "github.com/opensearch-project/opensearch-go/v4"
+	opensearchapi "github.com/opensearch-project/opensearch-go/v4/opensearchapi"
+)
+
+// DeleteDocument removes a single document. It reports false when the
+// document did not exist.
+func DeleteDocument(ctx context.Context, c *opensearch.Client, index, docID string) (bool, error) {
+	if index == "" || docID == "" {
+		return false, fmt.Errorf("index and doc id required")
+	}
+	res, err := c.Do(ctx, opensearchapi.DocumentDeleteReq{Index: index, DocumentID: docID}, nil)
+	if err != nil {
+		return false, fmt.Errorf("delete doc: %w", err)
+	}
+	_ = res.Body.Close()
+
+	switch {
+	case res.StatusCode == 404:
+		return false, nil
+	case res.StatusCode < 200 || res.StatusCode >= 300:
+		return false, fmt.Errorf("delete doc status %d", res.StatusCode)
+	}
+	return true, nil
+}
+
+// DeleteByRootCID removes every document indexed under rootCID and returns
+// the number deleted.
+func DeleteByRootCID(ctx context.Context, c *opensearch.Client, index, rootCID string) (int, error) {
+	if index == "" || rootCID == "" {
+		return 0, fmt.Errorf("index and root cid required")
+	}
+	body, _ := json.Marshal(map[string]any{
+		"query": map[string]any{"term": map[string]any{"root_cid": rootCID}},
+	})
+
+	var out opensearchapi.DocumentDeleteByQueryResp
+	res, err := c.Do(ctx, opensearchapi.DocumentDeleteByQueryReq{Indices: []string{index}, Body: bytes.NewReader(body)}, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("delete by query: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return 0, fmt.Errorf("delete by query status %d", res.StatusCode)
+	}
+	return out.Deleted, nil
+}
+
+// ExistingRootCIDs reports which of roots have at least one document.
+func ExistingRootCIDs(ctx context.Context, c *opensearch.Client, index string, roots []string) (map[string]bool, error) {
+	if index == "" {
+		return nil, fmt.Errorf("index required")
+	}
+	found := map[string]bool{}
+	if len(roots) == 0 {
+		return found, nil
+	}
+	body, _ := json.Marshal(map[string]any{
+		"size":  0,
+		"query": map[string]any{"terms": map[string]any{"root_cid": roots}},
+		"aggs": map[string]any{
+			"roots": map[string]any{"terms": map[string]any{"field": "root_cid", "size": len(roots)}},
+		},
+	})
+
+	var out struct {
+		Aggregations struct {
+			Roots struct {
+				Buckets []struct {
+					Key string `json:"key"`
+				} `json:"buckets"`
+			} `json:"roots"`
+		} `json:"aggregations"`
+	}
+	res, err := c.Do(ctx, opensearchapi.SearchReq{Indices: []string{index}, Body: bytes.NewReader(body)}, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search root cids: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("search root cids status %d", res.StatusCode)
+	}
+	for _, b := range out.Aggregations.Roots.Buckets {
+		found[b.Key] = true
+	}
+	return found, nil
+}
+
+// SetFieldByRootCID sets field on every document of each root CID in values
+// to that root's value and returns the number of documents updated.
+func SetFieldByRootCID(ctx context.Context, c *opensearch.Client, index, field string, values map[string]any) (int, error) {
+	if index == "" || field == "" {
+		return 0, fmt.Errorf("index and field required")
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	roots := make([]string, 0, len(values))
+	for root := range values {
+		roots = append(roots, root)
+	}
+	body, _ := json.Marshal(map[string]any{
+		"query": map[string]any{"terms": map[string]any{"root_cid": roots}},
+		"script": map[string]any{
+			"lang":   "painless",
+			"source": "ctx._source[params.field] = params.values[ctx._source.root_cid]",
+			"params": map[string]any{"field": field, "values": values},
+		},
+	})
+
+	var out opensearchapi.UpdateByQueryResp
+	req := opensearchapi.UpdateByQueryReq{
+		Indices: []string{index},
+		Body:    bytes.NewReader(body),
+		// A document re-indexed meanwhile is picked up on the next pass.
+		Params: opensearchapi.UpdateByQueryParams{Conflicts: "proceed"},
+	}
+	res, err := c.Do(ctx, req, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("update by query: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return 0, fmt.Errorf("update by query status %d", res.StatusCode)
+	}
+	return out.Updated, nil
+}
@@ -0,0 +1,49 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+
+	opensearch "github.com/opensearch-project/opensearch-go/v4"
+	opensearchapi "github.com/opensearch-project/opensearch-go/v4/opensearchapi"
+)
+
+// ClusterHealth returns an error when the cluster is unreachable or red.
+// Yellow is accepted: single-node deployments never allocate replicas.
+func ClusterHealth(ctx context.Context, c *opensearch.Client) error {
+	var out opensearchapi.ClusterHealthResp
+	res, err := c.Do(ctx, opensearchapi.ClusterHealthReq{}, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("cluster health: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("cluster health status %d", res.StatusCode)
+	}
+	if out.Status == "red" {
+		return fmt.Errorf("cluster status red")
+	}
+	return nil
+}
+
+func AliasExists(ctx context.Context, c *opensearch.Client, alias string) (bool, error) {
+	if alias == "" {
+		return false, fmt.Errorf("alias required")
+	}
+	res, err := c.Do(ctx, opensearchapi.AliasExistsReq{Alias: []string{alias}}, nil)
+	if err != nil {
+		return false, fmt.Errorf("alias exists: %w", err)
+	}
+	_ = res.Body.Close()
+
+	switch res.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		return false, fmt.Errorf("alias exists status %d", res.StatusCode)
+	}
+}
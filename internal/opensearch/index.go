@@ -12,6 +12,7 @@ import (
 
 type IndexSpec struct {
 	IndexName string
+	// AliasName is pointed at the index. Optional.
 	AliasName string
 }
 
@@ -19,9 +20,6 @@ func EnsureIndex(ctx context.Context, c *opensearch.Client, spec IndexSpec, mapp
 	if spec.IndexName == "" {
 		return fmt.Errorf("index name required")
 	}
-	if spec.AliasName == "" {
-		spec.AliasName = "ipfsniffer-docs"
-	}
 
 	// Check if index exists
 	existsReq := opensearchapi.IndicesExistsReq{Indices: []string{spec.IndexName}}
@@ -32,6 +30,9 @@ func EnsureIndex(ctx context.Context, c *opensearch.Client, spec IndexSpec, mapp
 	_ = existsResp.Body.Close()
 
 	if existsResp.StatusCode == 200 {
+		if err := putMapping(ctx, c, spec.IndexName, mappingJSON); err != nil {
+			return err
+		}
 		return EnsureAlias(ctx, c, spec.AliasName, spec.IndexName)
 	}
 	if existsResp.StatusCode != 404 {
@@ -52,6 +53,30 @@ func EnsureIndex(ctx context.Context, c *opensearch.Client, spec IndexSpec, mapp
 	return EnsureAlias(ctx, c, spec.AliasName, spec.IndexName)
 }
 
+// putMapping applies the mappings of mappingJSON to an existing index, so
+// fields added since it was created become searchable. Changing the type of
+// an existing field fails.
+func putMapping(ctx context.Context, c *opensearch.Client, index string, mappingJSON []byte) error {
+	var spec struct {
+		Mappings json.RawMessage `json:"mappings"`
+	}
+	if err := json.Unmarshal(mappingJSON, &spec); err != nil {
+		return fmt.Errorf("parse mapping: %w", err)
+	}
+	if len(spec.Mappings) == 0 {
+		return nil
+	}
+	res, err := c.Do(ctx, opensearchapi.MappingPutReq{Indices: []string{index}, Body: bytes.NewReader(spec.Mappings)}, nil)
+	if err != nil {
+		return fmt.Errorf("put mapping: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("put mapping status %d", res.StatusCode)
+	}
+	return nil
+}
+
 func EnsureAlias(ctx context.Context, c *opensearch.Client, alias, index string) error {
 	if alias == "" || index == "" {
 		return nil
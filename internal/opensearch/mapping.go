@@ -34,6 +34,22 @@ var DefaultMappingJSON = []byte(`{
       "processed_at": { "type": "date" },
       "sources": { "type": "keyword" },
       "ipns_name": { "type": "keyword" },
+      "popularity": {
+        "properties": {
+          "first_seen": { "type": "date" },
+          "last_seen": { "type": "date" },
+          "count": { "type": "long" },
+          "peers": { "type": "long" },
+          "sources": {
+            "properties": {
+              "name": { "type": "keyword" },
+              "count": { "type": "long" }
+            }
+          },
+          "countries": { "type": "keyword" },
+          "asns": { "type": "long" }
+        }
+      },
       "dir": {
         "properties": {
           "entries_count": { "type": "integer" },
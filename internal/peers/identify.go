@@ -0,0 +1,51 @@
+package peers
+
+import (
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+)
+
+// identify copies what h already knows about id into d: the identify
+// results cached in its peerstore and the address of an open connection. It
+// never dials.
+func identify(h host.Host, id peer.ID, d *ipfsnifferv1.PeerObservedData) {
+	ps := h.Peerstore()
+	if v, err := ps.Get(id, "AgentVersion"); err == nil {
+		d.AgentVersion, _ = v.(string)
+	}
+	if protos, err := ps.GetProtocols(id); err == nil {
+		for _, p := range protos {
+			d.Protocols = append(d.Protocols, string(p))
+		}
+	}
+	if conns := h.Network().ConnsToPeer(id); len(conns) > 0 {
+		d.ObservedAddr = conns[0].RemoteMultiaddr().String()
+	}
+	if pk := ps.PubKey(id); pk != nil {
+		d.KeyType = pk.Type().String()
+	}
+	if len(d.Addrs) == 0 {
+		for _, a := range ps.Addrs(id) {
+			d.Addrs = append(d.Addrs, a.String())
+		}
+	}
+}
+
+// Addrs returns the addresses h knows for peerID without dialing: those of
+// open connections first, then the peerstore's.
+func Addrs(h host.Host, peerID string) []string {
+	id, err := peer.Decode(peerID)
+	if err != nil || h == nil {
+		return nil
+	}
+	var out []string
+	for _, c := range h.Network().ConnsToPeer(id) {
+		out = append(out, c.RemoteMultiaddr().String())
+	}
+	for _, a := range h.Peerstore().Addrs(id) {
+		out = append(out, a.String())
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package peers
+
+// MappingJSON is the peer index's settings and mappings.
+var MappingJSON = []byte(`{
+  "settings": {
+    "index": {
+      "number_of_shards": 1,
+      "number_of_replicas": 1,
+      "refresh_interval": "5s"
+    }
+  },
+  "mappings": {
+    "dynamic": "strict",
+    "properties": {
+      "peer_id": { "type": "keyword" },
+      "addrs": { "type": "keyword" },
+      "first_seen": { "type": "date" },
+      "last_seen": { "type": "date" },
+      "cids_count": { "type": "long" },
+      "sources": { "type": "keyword" },
+      "agent_version": { "type": "keyword" },
+      "protocols": { "type": "keyword" },
+      "observed_addr": { "type": "keyword" },
+      "key_type": { "type": "keyword" },
+      "country": { "type": "keyword" },
+      "asn": { "type": "long" },
+      "as_org": { "type": "keyword" }
+    }
+  }
+}`)
+
+// CIDsMappingJSON is the peer/CID pair index's settings and mappings.
+var CIDsMappingJSON = []byte(`{
+  "settings": {
+    "index": {
+      "number_of_shards": 3,
+      "number_of_replicas": 1,
+      "refresh_interval": "5s"
+    }
+  },
+  "mappings": {
+    "dynamic": "strict",
+    "properties": {
+      "peer_id": { "type": "keyword" },
+      "cid": { "type": "keyword" },
+      "first_seen": { "type": "date" },
+      "last_seen": { "type": "date" },
+      "sources": { "type": "keyword" },
+      "agent_version": { "type": "keyword" }
+    }
+  }
+}`)
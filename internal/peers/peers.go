@@ -0,0 +1,183 @@
+// Package peers records which peers provide or announce which CIDs.
+//
+// Discovery workers publish each new peer/CID pair to peer.observed through
+// an Observer, off their hot paths. The peer-indexer role folds those into two OpenSearch
+// indices: one document per peer (addresses, identify data, first and last
+// seen, CIDs provided, sources) and one per peer/CID pair, which answers
+// "what else has this peer published".
+package peers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/geoip"
+	"github.com/Rorical/IPFSniffer/internal/logging"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	nats "github.com/nats-io/nats.go"
+)
+
+type Config struct {
+	Enabled bool
+	// Index holds one document per peer.
+	Index string
+	// CIDsIndex holds one document per peer/CID pair.
+	CIDsIndex string
+	// DedupeTTL is how long a peer/CID pair is not republished.
+	DedupeTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:   true,
+		Index:     "ipfsniffer-peers",
+		CIDsIndex: "ipfsniffer-peer-cids",
+		DedupeTTL: 24 * time.Hour,
+	}
+}
+
+// DedupePrefix namespaces the peer/CID pairs already published.
+const DedupePrefix = "ipfsniffer:seen:peer"
+
+// DefaultQueueSize bounds the observations an Observer holds for Run.
+const DefaultQueueSize = 4096
+
+// dropLogInterval is how often Run logs the observations dropped since it
+// last did.
+const dropLogInterval = time.Minute
+
+// Observer publishes peer.observed once per peer/CID pair per dedupe TTL.
+// Observe only queues the pair, as it runs inside DHT and pubsub handlers;
+// Run dedupes and publishes the queue. Observations arriving while the
+// queue is full are dropped and counted. A nil *Observer ignores
+// observations.
+type Observer struct {
+	Bus     internalnats.Publisher
+	Deduper dedupe.Deduper
+	// Host fills in identify data and missing addresses from its peerstore.
+	// Optional.
+	Host host.Host
+	// GeoIP tags the peer with the location of its addresses. Optional.
+	GeoIP *geoip.DB
+	// QueueSize bounds the observations waiting for Run; 0 uses
+	// DefaultQueueSize.
+	QueueSize int
+
+	once    sync.Once
+	queue   chan observation
+	dropped atomic.Uint64
+}
+
+type observation struct {
+	peerID, cid, source, detail string
+	addrs                       []string
+	at                          time.Time
+}
+
+func (o *Observer) init() {
+	o.once.Do(func() {
+		n := o.QueueSize
+		if n <= 0 {
+			n = DefaultQueueSize
+		}
+		o.queue = make(chan observation, n)
+	})
+}
+
+// Observe reports that peerID provided or announced cid, reachable at addrs.
+// It never blocks.
+func (o *Observer) Observe(peerID string, addrs []string, cid, source, sourceDetail string) {
+	if o == nil || peerID == "" || cid == "" {
+		return
+	}
+	o.init()
+	select {
+	case o.queue <- observation{peerID: peerID, cid: cid, source: source, detail: sourceDetail, addrs: addrs, at: time.Now()}:
+	default:
+		o.dropped.Add(1)
+	}
+}
+
+// Dropped counts the observations dropped because the queue was full.
+func (o *Observer) Dropped() uint64 {
+	if o == nil {
+		return 0
+	}
+	return o.dropped.Load()
+}
+
+// Run publishes the queued observations until ctx is done.
+func (o *Observer) Run(ctx context.Context) {
+	if o == nil {
+		return
+	}
+	o.init()
+	logger := logging.FromContext(ctx)
+	tick := time.NewTicker(dropLogInterval)
+	defer tick.Stop()
+	var logged uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if n := o.Dropped(); n > logged {
+				logger.Warn("peer observations dropped, queue full", "dropped", n-logged, "total", n)
+				logged = n
+			}
+		case obs := <-o.queue:
+			o.publish(ctx, obs)
+		}
+	}
+}
+
+func (o *Observer) publish(ctx context.Context, obs observation) {
+	logger := logging.FromContext(ctx)
+	peerID, cid := obs.peerID, obs.cid
+
+	seen, err := o.Deduper.Seen(ctx, peerID+":"+cid)
+	if err != nil {
+		logger.Error("peer dedupe", "peer", peerID, "cid", cid, "err", err)
+		return
+	}
+	if seen {
+		return
+	}
+
+	now := obs.at.UTC().Format(time.RFC3339Nano)
+	data := &ipfsnifferv1.PeerObservedData{
+		PeerId:       peerID,
+		Addrs:        obs.addrs,
+		Cid:          cid,
+		Source:       obs.source,
+		SourceDetail: obs.detail,
+		ObservedAt:   now,
+	}
+	if id, err := peer.Decode(peerID); err == nil && o.Host != nil {
+		identify(o.Host, id, data)
+	}
+	// The connected address is the one known to reach the peer.
+	geo := o.GeoIP.Lookup(append([]string{data.ObservedAddr}, data.Addrs...))
+	data.Country, data.Asn, data.AsOrg = geo.Country, geo.ASN, geo.Org
+	env := &ipfsnifferv1.PeerObserved{V: 1, Id: uuid.NewString(), Ts: now, Data: data}
+	b, err := codec.Marshal(env)
+	if err != nil {
+		logger.Error("marshal", "peer", peerID, "err", err)
+		return
+	}
+	id := internalnats.MsgID("", internalnats.SubjectPeerObserved, peerID, cid)
+	if _, err := internalnats.Publish(ctx, o.Bus, internalnats.SubjectPeerObserved, b, nats.MsgId(id)); err != nil {
+		logger.Error("publish", "subject", internalnats.SubjectPeerObserved, "peer", peerID, "err", err)
+		_, _ = internalnats.PublishDLQWithID(ctx, o.Bus, internalnats.SubjectPeerObserved, id, b, err)
+	}
+}
@@ -0,0 +1,177 @@
+package peers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	nats "github.com/nats-io/nats.go"
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+)
+
+type mapDeduper map[string]bool
+
+func (d mapDeduper) Seen(_ context.Context, key string) (bool, error) {
+	seen := d[key]
+	d[key] = true
+	return seen, nil
+}
+
+func (d mapDeduper) Has(_ context.Context, key string) (bool, error) { return d[key], nil }
+
+func (d mapDeduper) Mark(_ context.Context, key string) error {
+	d[key] = true
+	return nil
+}
+
+func (d mapDeduper) Stats() dedupe.Stats { return dedupe.Stats{} }
+
+func TestObserver_PublishesEachPairOnce(t *testing.T) {
+	ctx := context.Background()
+	bus := internalnats.NewMemoryBus()
+	sub, err := bus.PullSubscribe(ctx, internalnats.SubjectPeerObserved, "test", internalnats.ConsumerOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Observer{Bus: bus, Deduper: mapDeduper{}}
+	o.Observe("peerA", []string{"/ip4/1.2.3.4/tcp/4001"}, "bafy1", "dht", "provider_add")
+	o.Observe("peerA", nil, "bafy1", "dht", "provider_add")
+	o.Observe("peerA", nil, "bafy2", "pubsub", "chat")
+	o.Observe("", nil, "bafy3", "pubsub", "chat")
+	var nilObserver *Observer
+	nilObserver.Observe("peerA", nil, "bafy4", "dht", "")
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go o.Run(runCtx)
+
+	msgs, err := sub.Fetch(ctx, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("published %d, want 2", len(msgs))
+	}
+	var first ipfsnifferv1.PeerObserved
+	if err := codec.Unmarshal(msgs[0].Msg().Data, &first); err != nil {
+		t.Fatal(err)
+	}
+	if d := first.GetData(); d.GetPeerId() != "peerA" || d.GetCid() != "bafy1" || len(d.GetAddrs()) != 1 {
+		t.Fatalf("data: %+v", d)
+	}
+}
+
+func TestObserver_DropsWhenQueueFull(t *testing.T) {
+	o := &Observer{Bus: internalnats.NewMemoryBus(), Deduper: mapDeduper{}, QueueSize: 2}
+	for _, c := range []string{"bafy1", "bafy2", "bafy3", "bafy4"} {
+		o.Observe("peerA", nil, c, "dht", "provider_add")
+	}
+	if got := o.Dropped(); got != 2 {
+		t.Fatalf("dropped = %d, want 2", got)
+	}
+}
+
+func TestWorker_CountsNewCIDs(t *testing.T) {
+	edges := map[string]bool{}
+	var peerParams []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Script struct {
+				Params map[string]any `json:"params"`
+			} `json:"script"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+		w.Header().Set("content-type", "application/json")
+
+		result := "updated"
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/cids/_update/"):
+			if !edges[r.URL.Path] {
+				edges[r.URL.Path] = true
+				result = "created"
+			}
+		case strings.HasPrefix(r.URL.Path, "/peers/_update/"):
+			peerParams = append(peerParams, body.Script.Params)
+		default:
+			w.WriteHeader(404)
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":"` + result + `"}`))
+	}))
+	defer srv.Close()
+
+	osc, err := osclient.NewClient(osclient.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{OS: osc, Index: "peers", CIDsIndex: "cids"}
+
+	for _, c := range []string{"bafy1", "bafy1", "bafy2"} {
+		env := &ipfsnifferv1.PeerObserved{V: 1, Data: &ipfsnifferv1.PeerObservedData{
+			PeerId: "peerA", Cid: c, Source: "pubsub", SourceDetail: "chat", ObservedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		}}
+		b, _ := codec.Marshal(env)
+		if err := w.handle(context.Background(), &nats.Msg{Data: b}); err != nil {
+			t.Fatalf("handle: %v", err)
+		}
+	}
+
+	if len(peerParams) != 3 {
+		t.Fatalf("peer updates = %d, want 3", len(peerParams))
+	}
+	for i, want := range []float64{1, 0, 1} {
+		if got := peerParams[i]["new_cids"]; got != want {
+			t.Fatalf("update %d: new_cids = %v, want %v", i, got, want)
+		}
+		if got := peerParams[i]["source"]; got != "pubsub:chat" {
+			t.Fatalf("update %d: source = %v", i, got)
+		}
+	}
+}
+
+func TestIdentify_UsesPeerstore(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := h.Peerstore()
+	_ = ps.Put(id, "AgentVersion", "kubo/0.30.0")
+	_ = ps.SetProtocols(id, "/ipfs/kad/1.0.0", "/ipfs/bitswap/1.2.0")
+	_ = ps.AddPubKey(id, pub)
+	ps.AddAddr(id, multiaddr.StringCast("/ip4/192.0.2.1/tcp/4001"), time.Hour)
+
+	d := &ipfsnifferv1.PeerObservedData{PeerId: id.String()}
+	identify(h, id, d)
+	if d.AgentVersion != "kubo/0.30.0" || len(d.Protocols) != 2 || d.KeyType != "Ed25519" {
+		t.Fatalf("identify: %+v", d)
+	}
+	if len(d.Addrs) != 1 || d.ObservedAddr != "" {
+		t.Fatalf("addrs: %v observed: %q", d.Addrs, d.ObservedAddr)
+	}
+}
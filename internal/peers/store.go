@@ -0,0 +1,77 @@
+package peers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+	osapi "github.com/opensearch-project/opensearch-go/v4/opensearchapi"
+)
+
+// Store reads the peer indices for the API.
+type Store struct {
+	OS        *osclient.Client
+	Index     string
+	CIDsIndex string
+}
+
+// CIDPage is one page of the CIDs a peer provided, most recently seen first.
+type CIDPage struct {
+	Total int               `json:"total"`
+	From  int               `json:"from"`
+	Size  int               `json:"size"`
+	CIDs  []json.RawMessage `json:"cids"`
+}
+
+// Get returns the peer document. It reports false when the peer was never
+// observed.
+func (s *Store) Get(ctx context.Context, peerID string) (json.RawMessage, bool, error) {
+	var out osapi.DocumentGetResp
+	res, err := s.OS.Do(ctx, osapi.DocumentGetReq{Index: s.Index, DocumentID: peerID}, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get peer: %w", err)
+	}
+	switch {
+	case res.StatusCode == 404:
+		return nil, false, nil
+	case res.StatusCode < 200 || res.StatusCode >= 300:
+		return nil, false, fmt.Errorf("get peer status %d", res.StatusCode)
+	}
+	if !out.Found {
+		return nil, false, nil
+	}
+	return out.Source, true, nil
+}
+
+// CIDs lists the CIDs peerID provided.
+func (s *Store) CIDs(ctx context.Context, peerID string, from, size int) (CIDPage, error) {
+	body, _ := json.Marshal(map[string]any{
+		"from":             from,
+		"size":             size,
+		"track_total_hits": true,
+		"query":            map[string]any{"term": map[string]any{"peer_id": peerID}},
+		"sort":             []any{map[string]any{"last_seen": map[string]any{"order": "desc"}}},
+	})
+	var out osapi.SearchResp
+	res, err := s.OS.Do(ctx, osapi.SearchReq{Indices: []string{s.CIDsIndex}, Body: bytes.NewReader(body)}, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return CIDPage{}, fmt.Errorf("search peer cids: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return CIDPage{}, fmt.Errorf("search peer cids status %d", res.StatusCode)
+	}
+
+	page := CIDPage{Total: out.Hits.Total.Value, From: from, Size: size, CIDs: make([]json.RawMessage, 0, len(out.Hits.Hits))}
+	for _, h := range out.Hits.Hits {
+		page.CIDs = append(page.CIDs, h.Source)
+	}
+	return page, nil
+}
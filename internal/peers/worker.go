@@ -0,0 +1,223 @@
+package peers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/logging"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+	"github.com/Rorical/IPFSniffer/internal/popularity"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	nats "github.com/nats-io/nats.go"
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+	osapi "github.com/opensearch-project/opensearch-go/v4/opensearchapi"
+)
+
+// maxAddrs caps the addresses kept per peer.
+const maxAddrs = 32
+
+// timeLayout has a fixed width, so the update scripts can compare
+// timestamps as strings.
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// Worker consumes peer.observed and upserts the peer and peer/CID documents.
+type Worker struct {
+	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus internalnats.Bus
+	// Conn enables max-delivery advisory handling. Optional.
+	Conn *nats.Conn
+	OS   *osclient.Client
+
+	Index      string
+	CIDsIndex  string
+	Durable    string
+	MaxDeliver int
+	AckWait    time.Duration
+	// Concurrency bounds in-flight messages; Batch caps each pull. Both
+	// default to 1.
+	Concurrency int
+	Batch       int
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
+		return fmt.Errorf("nats required")
+	}
+	if w.OS == nil {
+		return fmt.Errorf("opensearch client required")
+	}
+	def := DefaultConfig()
+	if w.Index == "" {
+		w.Index = def.Index
+	}
+	if w.CIDsIndex == "" {
+		w.CIDsIndex = def.CIDsIndex
+	}
+	if w.Durable == "" {
+		w.Durable = "peer-indexer"
+	}
+	if err := EnsureIndices(ctx, w.OS, w.Index, w.CIDsIndex); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("peer-indexer started", "subject", internalnats.SubjectPeerObserved, "durable", w.Durable, "index", w.Index)
+
+	c := &internalnats.Consumer{
+		NATS:        w.NATS,
+		Bus:         w.Bus,
+		Conn:        w.Conn,
+		Subject:     internalnats.SubjectPeerObserved,
+		Durable:     w.Durable,
+		MaxDeliver:  w.MaxDeliver,
+		AckWait:     w.AckWait,
+		Concurrency: w.Concurrency,
+		Batch:       w.Batch,
+		Handler:     w.handle,
+	}
+	return c.Run(ctx)
+}
+
+// EnsureIndices creates the peer indices if they are missing.
+func EnsureIndices(ctx context.Context, c *osclient.Client, index, cidsIndex string) error {
+	if err := opensearch.EnsureIndex(ctx, c, opensearch.IndexSpec{IndexName: index}, MappingJSON); err != nil {
+		return fmt.Errorf("ensure %s: %w", index, err)
+	}
+	if err := opensearch.EnsureIndex(ctx, c, opensearch.IndexSpec{IndexName: cidsIndex}, CIDsMappingJSON); err != nil {
+		return fmt.Errorf("ensure %s: %w", cidsIndex, err)
+	}
+	return nil
+}
+
+func (w *Worker) handle(ctx context.Context, msg *nats.Msg) error {
+	var in ipfsnifferv1.PeerObserved
+	if err := codec.Unmarshal(msg.Data, &in); err != nil {
+		return internalnats.Terminal(err)
+	}
+	d := in.GetData()
+	if d.GetPeerId() == "" || d.GetCid() == "" {
+		return nil
+	}
+
+	seen := time.Now().UTC()
+	if t, err := time.Parse(time.RFC3339Nano, d.GetObservedAt()); err == nil {
+		seen = t.UTC()
+	}
+	at := seen.Format(timeLayout)
+	source := popularity.SourceLabel(d.GetSource(), d.GetSourceDetail())
+	addrs := d.GetAddrs()
+	if addrs == nil {
+		addrs = []string{}
+	}
+	protocols := d.GetProtocols()
+	if protocols == nil {
+		protocols = []string{}
+	}
+
+	created, err := upsert(ctx, w.OS, w.CIDsIndex, PairID(d.GetPeerId(), d.GetCid()), seenScript,
+		map[string]any{"seen": at, "source": source, "agent_version": d.GetAgentVersion()},
+		map[string]any{
+			"peer_id":       d.GetPeerId(),
+			"cid":           d.GetCid(),
+			"first_seen":    at,
+			"last_seen":     at,
+			"sources":       []string{source},
+			"agent_version": d.GetAgentVersion(),
+		})
+	if err != nil {
+		return err
+	}
+	newCIDs := 0
+	if created {
+		newCIDs = 1
+	}
+
+	_, err = upsert(ctx, w.OS, w.Index, d.GetPeerId(), peerScript,
+		map[string]any{
+			"seen": at, "source": source, "addrs": addrs, "max_addrs": maxAddrs, "new_cids": newCIDs,
+			"agent_version": d.GetAgentVersion(), "protocols": protocols,
+			"observed_addr": d.GetObservedAddr(), "key_type": d.GetKeyType(),
+			"country": d.GetCountry(), "asn": d.GetAsn(), "as_org": d.GetAsOrg(),
+		},
+		map[string]any{
+			"peer_id":       d.GetPeerId(),
+			"addrs":         addrs[:min(len(addrs), maxAddrs)],
+			"first_seen":    at,
+			"last_seen":     at,
+			"cids_count":    newCIDs,
+			"sources":       []string{source},
+			"agent_version": d.GetAgentVersion(),
+			"protocols":     protocols,
+			"observed_addr": d.GetObservedAddr(),
+			"key_type":      d.GetKeyType(),
+			"country":       d.GetCountry(),
+			"asn":           d.GetAsn(),
+			"as_org":        d.GetAsOrg(),
+		})
+	return err
+}
+
+// PairID is the document ID of a peer/CID pair.
+func PairID(peerID, cid string) string {
+	return peerID + "/" + cid
+}
+
+// seenScript widens first/last seen, adds the source and keeps the latest
+// known agent version.
+const seenScript = `
+def s = ctx._source;
+if (params.seen.compareTo(s.last_seen) > 0) { s.last_seen = params.seen; }
+if (params.seen.compareTo(s.first_seen) < 0) { s.first_seen = params.seen; }
+if (!s.sources.contains(params.source)) { s.sources.add(params.source); }
+if (params.agent_version != '') { s.agent_version = params.agent_version; }
+`
+
+// peerScript also merges addresses, replaces the other identify data and
+// the location when known and counts newly provided CIDs.
+const peerScript = seenScript + `
+for (a in params.addrs) {
+  if (s.addrs.size() >= params.max_addrs) { break; }
+  if (!s.addrs.contains(a)) { s.addrs.add(a); }
+}
+if (params.protocols.size() > 0) { s.protocols = params.protocols; }
+if (params.observed_addr != '') { s.observed_addr = params.observed_addr; }
+if (params.key_type != '') { s.key_type = params.key_type; }
+if (params.country != '') { s.country = params.country; }
+if (params.asn > 0) { s.asn = params.asn; s.as_org = params.as_org; }
+s.cids_count += params.new_cids;
+`
+
+// upsert inserts doc as id, or runs script on the existing document. It
+// reports whether the document was created.
+func upsert(ctx context.Context, c *osclient.Client, index, id, script string, params, doc map[string]any) (bool, error) {
+	body, _ := json.Marshal(map[string]any{
+		"script": map[string]any{"lang": "painless", "source": script, "params": params},
+		"upsert": doc,
+	})
+	retries := 5
+	var out osapi.UpdateResp
+	res, err := c.Do(ctx, osapi.UpdateReq{
+		Index:      index,
+		DocumentID: id,
+		Body:       bytes.NewReader(body),
+		// Concurrent observations of one peer conflict on its document.
+		Params: osapi.UpdateParams{RetryOnConflict: &retries},
+	}, &out)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return false, fmt.Errorf("upsert %s/%s: %w", index, id, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return false, fmt.Errorf("upsert %s/%s status %d", index, id, res.StatusCode)
+	}
+	return out.Result == "created", nil
+}
@@ -0,0 +1,275 @@
+// Package policy keeps the pipeline policy that operators tune at runtime
+// (fetch limits, skip lists, discovery topics) in a JetStream KV bucket.
+// Workers watch their keys and apply changes live; the bucket history
+// records every version.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Keys in the policy bucket. A missing or deleted key means the worker's
+// configured defaults apply.
+const (
+	// KeyFetch holds a Fetch, read by the fetch enqueuer.
+	KeyFetch = "fetch"
+	// KeyPubSubTopics holds the pubsub topics discovery-pubsub subscribes to.
+	KeyPubSubTopics = "pubsub_topics"
+	// KeyIPNSPubSubNames holds the IPNS names discovery-ipns-pubsub polls.
+	KeyIPNSPubSubNames = "ipns_pubsub_names"
+)
+
+// Keys lists every key the bucket accepts.
+var Keys = []string{KeyFetch, KeyPubSubTopics, KeyIPNSPubSubNames}
+
+// ErrInvalid reports an unknown key or a malformed value.
+var ErrInvalid = errors.New("invalid policy")
+
+type Config struct {
+	Bucket string
+	// History is the number of versions kept per key (at most 64).
+	History  int
+	Replicas int
+}
+
+func DefaultConfig() Config {
+	return Config{Bucket: "IPFSNIFFER_POLICY", History: 64, Replicas: 1}
+}
+
+// Fetch overrides the fetch enqueuer's defaults. Zero limits keep the
+// configured value. A nil list keeps the configured list; an empty one
+// skips nothing.
+type Fetch struct {
+	MaxTotalBytes  int64    `json:"max_total_bytes,omitempty"`
+	MaxFileBytes   int64    `json:"max_file_bytes,omitempty"`
+	MaxDAGNodes    int64    `json:"max_dag_nodes,omitempty"`
+	MaxDepth       int64    `json:"max_depth,omitempty"`
+	TimeoutMs      int64    `json:"timeout_ms,omitempty"`
+	InlineMaxBytes int64    `json:"inline_max_bytes,omitempty"`
+	SkipExt        []string `json:"skip_ext"`
+	SkipMimePrefix []string `json:"skip_mime_prefix"`
+}
+
+func (f *Fetch) validate() error {
+	for _, v := range []int64{f.MaxTotalBytes, f.MaxFileBytes, f.MaxDAGNodes, f.MaxDepth, f.TimeoutMs, f.InlineMaxBytes} {
+		if v < 0 {
+			return errors.New("limits must not be negative")
+		}
+	}
+	return nil
+}
+
+// Entry is one version of a key.
+type Entry struct {
+	Key      string          `json:"key"`
+	Revision uint64          `json:"revision"`
+	Created  time.Time       `json:"created"`
+	Deleted  bool            `json:"deleted,omitempty"`
+	Value    json.RawMessage `json:"value,omitempty"`
+}
+
+// Ensure opens the policy bucket, creating it if needed.
+func Ensure(js nats.JetStreamContext, cfg Config) (nats.KeyValue, error) {
+	if cfg.Bucket == "" {
+		cfg.Bucket = DefaultConfig().Bucket
+	}
+	kv, err := js.KeyValue(cfg.Bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      cfg.Bucket,
+			Description: "ipfsniffer pipeline policy",
+			History:     uint8(min(max(cfg.History, 1), 64)),
+			Storage:     nats.FileStorage,
+			Replicas:    max(cfg.Replicas, 1),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create kv %s: %w", cfg.Bucket, err)
+		}
+		return kv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kv %s: %w", cfg.Bucket, err)
+	}
+	return kv, nil
+}
+
+// Normalize decodes value strictly for key and re-encodes it compactly.
+func Normalize(key string, value []byte) ([]byte, error) {
+	var v any
+	switch key {
+	case KeyFetch:
+		v = &Fetch{}
+	case KeyPubSubTopics, KeyIPNSPubSubNames:
+		v = &[]string{}
+	default:
+		return nil, fmt.Errorf("%w: unknown key %q (want one of %s)", ErrInvalid, key, strings.Join(Keys, ", "))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, key, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: %s: trailing data", ErrInvalid, key)
+	}
+
+	switch v := v.(type) {
+	case *Fetch:
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, key, err)
+		}
+	case *[]string:
+		list := make([]string, 0, len(*v))
+		for _, s := range *v {
+			if s = strings.TrimSpace(s); s != "" && !slices.Contains(list, s) {
+				list = append(list, s)
+			}
+		}
+		*v = list
+	}
+	return json.Marshal(v)
+}
+
+// Set validates value and stores it as the new version of key, returning its
+// revision.
+func Set(ctx context.Context, kv nats.KeyValue, key string, value []byte) (uint64, error) {
+	b, err := Normalize(key, value)
+	if err != nil {
+		return 0, err
+	}
+	rev, err := kv.Put(key, b)
+	if err != nil {
+		return 0, fmt.Errorf("put %s: %w", key, err)
+	}
+	logging.FromContext(ctx).Info("policy set", "key", key, "revision", rev)
+	return rev, nil
+}
+
+// Delete drops key so the workers' configured defaults apply again. The
+// delete is itself a version in the history.
+func Delete(ctx context.Context, kv nats.KeyValue, key string) error {
+	if !slices.Contains(Keys, key) {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalid, key)
+	}
+	if err := kv.Delete(key); err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	logging.FromContext(ctx).Info("policy deleted", "key", key)
+	return nil
+}
+
+// Current returns the latest version of every key that is set.
+func Current(kv nats.KeyValue) ([]Entry, error) {
+	out := []Entry{}
+	for _, key := range Keys {
+		e, err := kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get %s: %w", key, err)
+		}
+		out = append(out, entry(e))
+	}
+	return out, nil
+}
+
+// History returns the kept versions of key, oldest first.
+func History(kv nats.KeyValue, key string) ([]Entry, error) {
+	if !slices.Contains(Keys, key) {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalid, key)
+	}
+	hist, err := kv.History(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("history %s: %w", key, err)
+	}
+	out := make([]Entry, 0, len(hist))
+	for _, e := range hist {
+		out = append(out, entry(e))
+	}
+	return out, nil
+}
+
+func entry(e nats.KeyValueEntry) Entry {
+	out := Entry{Key: e.Key(), Revision: e.Revision(), Created: e.Created()}
+	if e.Operation() != nats.KeyValuePut {
+		out.Deleted = true
+		return out
+	}
+	out.Value = json.RawMessage(e.Value())
+	return out
+}
+
+// Watch applies the current value of key and then every later change until
+// ctx is done. apply gets nil when the key is unset or deleted. Watch returns
+// once the current value has been applied, so callers start with the stored
+// policy rather than their defaults. Values that fail to decode are logged
+// and skipped, keeping the previous policy.
+func Watch[T any](ctx context.Context, kv nats.KeyValue, key string, apply func(v *T, rev uint64)) error {
+	w, err := kv.Watch(key, nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("watch %s: %w", key, err)
+	}
+	logger := logging.FromContext(ctx).With("key", key)
+
+	handle := func(e nats.KeyValueEntry) {
+		if e.Operation() != nats.KeyValuePut {
+			apply(nil, e.Revision())
+			logger.Info("policy applied", "revision", e.Revision(), "deleted", true)
+			return
+		}
+		v := new(T)
+		if err := json.Unmarshal(e.Value(), v); err != nil {
+			logger.Error("policy decode", "revision", e.Revision(), "err", err)
+			return
+		}
+		apply(v, e.Revision())
+		logger.Info("policy applied", "revision", e.Revision())
+	}
+
+	// The watcher delivers the current value, then nil, then updates.
+	initial := true
+	for e := range w.Updates() {
+		if e == nil {
+			break
+		}
+		initial = false
+		handle(e)
+	}
+	if initial {
+		apply(nil, 0)
+	}
+
+	go func() {
+		defer func() { _ = w.Stop() }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-w.Updates():
+				if !ok {
+					return
+				}
+				if e != nil {
+					handle(e)
+				}
+			}
+		}
+	}()
+	return nil
+}
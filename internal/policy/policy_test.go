@@ -0,0 +1,41 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		key, in, want string
+	}{
+		{KeyFetch, `{"max_depth": 3, "skip_ext": []}`, `{"max_depth":3,"skip_ext":[],"skip_mime_prefix":null}`},
+		{KeyFetch, `{}`, `{"skip_ext":null,"skip_mime_prefix":null}`},
+		{KeyPubSubTopics, `[" a ", "b", "", "a"]`, `["a","b"]`},
+		{KeyIPNSPubSubNames, `[]`, `[]`},
+	} {
+		got, err := Normalize(tc.key, []byte(tc.in))
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.key, tc.in, err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("%s %s: got %s, want %s", tc.key, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNormalize_Rejects(t *testing.T) {
+	for _, tc := range []struct {
+		key, in string
+	}{
+		{"nope", `[]`},
+		{KeyFetch, `{"max_depht": 3}`},
+		{KeyFetch, `{"max_depth": -1}`},
+		{KeyFetch, `{} {}`},
+		{KeyPubSubTopics, `"a"`},
+	} {
+		if _, err := Normalize(tc.key, []byte(tc.in)); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("%s %s: got %v, want ErrInvalid", tc.key, tc.in, err)
+		}
+	}
+}
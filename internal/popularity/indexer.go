@@ -0,0 +1,147 @@
+package popularity
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/logging"
+	"github.com/Rorical/IPFSniffer/internal/opensearch"
+
+	osclient "github.com/opensearch-project/opensearch-go/v4"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Field is the document field holding a CID's popularity.
+const Field = "popularity"
+
+// Indexer copies the records of CIDs observed since its last pass into the
+// "popularity" field of their OpenSearch documents.
+//
+// A CID is usually observed before its documents are indexed; such CIDs
+// stay queued while they were last seen within Config.Retain. A re-indexed
+// document gets its counters back on the CID's next observation.
+type Indexer struct {
+	Redis     *goredis.Client
+	OS        *osclient.Client
+	IndexName string
+	Config    Config
+}
+
+func (x *Indexer) Run(ctx context.Context) error {
+	if x.Redis == nil {
+		return fmt.Errorf("redis required")
+	}
+	if x.OS == nil {
+		return fmt.Errorf("opensearch client required")
+	}
+	if x.IndexName == "" {
+		x.IndexName = "ipfsniffer-docs"
+	}
+	if x.Config.Retain <= 0 {
+		x.Config.Retain = time.Hour
+	}
+	if x.Config.IndexInterval <= 0 {
+		x.Config.IndexInterval = time.Minute
+	}
+	if x.Config.IndexBatch <= 0 {
+		x.Config.IndexBatch = 500
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("popularity indexer started", "index", x.IndexName, "interval", x.Config.IndexInterval)
+	tick := time.NewTicker(x.Config.IndexInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+		updated, err := x.Pass(ctx)
+		if err != nil {
+			logger.Error("popularity index", "err", err)
+			continue
+		}
+		logger.Debug("popularity index", "updated", updated)
+	}
+}
+
+// Pass drains the queue of changed CIDs in batches and returns the number of
+// documents updated.
+func (x *Indexer) Pass(ctx context.Context) (int, error) {
+	t := &Tracker{Redis: x.Redis, Config: x.Config}
+	var retained []string
+	updated := 0
+	defer func() {
+		// Requeue unindexed CIDs even when the pass fails.
+		if len(retained) > 0 {
+			members := make([]any, len(retained))
+			for i, root := range retained {
+				members[i] = root
+			}
+			_ = x.Redis.SAdd(context.WithoutCancel(ctx), t.dirtyKey(), members...).Err()
+		}
+	}()
+
+	for {
+		roots, err := x.Redis.SPopN(ctx, t.dirtyKey(), int64(x.Config.IndexBatch)).Result()
+		if err != nil {
+			return updated, fmt.Errorf("pop changed cids: %w", err)
+		}
+		if len(roots) == 0 {
+			return updated, nil
+		}
+
+		indexed, err := opensearch.ExistingRootCIDs(ctx, x.OS, x.IndexName, roots)
+		if err != nil {
+			retained = append(retained, roots...)
+			return updated, err
+		}
+		values := map[string]any{}
+		for _, root := range roots {
+			rec, ok, err := t.Get(ctx, root)
+			if err != nil {
+				retained = append(retained, roots...)
+				return updated, err
+			}
+			switch {
+			case !ok:
+				// Expired.
+			case indexed[root]:
+				values[root] = rec.document()
+			case time.Since(rec.LastSeen) < x.Config.Retain:
+				retained = append(retained, root)
+			}
+		}
+		n, err := opensearch.SetFieldByRootCID(ctx, x.OS, x.IndexName, Field, values)
+		if err != nil {
+			retained = append(retained, slices.Collect(maps.Keys(values))...)
+			return updated, err
+		}
+		updated += n
+		if len(roots) < x.Config.IndexBatch {
+			return updated, nil
+		}
+	}
+}
+
+// document renders r in the index mapping's shape.
+func (r Record) document() map[string]any {
+	sources := make([]map[string]any, 0, len(r.Sources))
+	names := slices.Sorted(maps.Keys(r.Sources))
+	for _, name := range names {
+		sources = append(sources, map[string]any{"name": name, "count": r.Sources[name]})
+	}
+	return map[string]any{
+		"first_seen": r.FirstSeen.Format(time.RFC3339Nano),
+		"last_seen":  r.LastSeen.Format(time.RFC3339Nano),
+		"count":      r.Count,
+		"peers":      r.Peers,
+		"sources":    sources,
+		"countries":  slices.Sorted(maps.Keys(r.Countries)),
+		"asns":       slices.Sorted(maps.Keys(r.ASNs)),
+	}
+}
@@ -0,0 +1,400 @@
+// Package popularity counts how often each CID is observed on the network.
+//
+// Discovery workers report every observation, including the ones dedupe
+// drops, to a Tracker. The Tracker aggregates them in memory and
+// periodically merges them into one Redis record per CID: first and last
+// seen, observation count, per-source, per-country and per-ASN counts and a
+// HyperLogLog of distinct peers. An Indexer copies changed records into the
+// CID's OpenSearch documents.
+package popularity
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/geoip"
+	"github.com/Rorical/IPFSniffer/internal/logging"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	Enabled bool
+	// Prefix namespaces the Redis keys.
+	Prefix string
+	// FlushInterval is how often observations are merged into Redis.
+	FlushInterval time.Duration
+	// FlushBatch caps the CIDs merged per Redis transaction.
+	FlushBatch int
+	// MaxPending caps the CIDs buffered between flushes; observations of
+	// further CIDs are dropped and counted.
+	MaxPending int
+	// IndexInterval is how often changed records are copied to OpenSearch.
+	IndexInterval time.Duration
+	// IndexBatch caps the records copied per pass.
+	IndexBatch int
+	// Retain keeps CIDs without documents queued for indexing while they
+	// were last seen this recently.
+	Retain time.Duration
+	// TTL drops records of CIDs not observed for this long; 0 keeps them.
+	TTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:       true,
+		Prefix:        "ipfsniffer:pop",
+		FlushInterval: 10 * time.Second,
+		FlushBatch:    500,
+		MaxPending:    100000,
+		IndexInterval: time.Minute,
+		IndexBatch:    500,
+		Retain:        time.Hour,
+		TTL:           30 * 24 * time.Hour,
+	}
+}
+
+// Record is the merged popularity of one CID.
+type Record struct {
+	FirstSeen time.Time        `json:"first_seen"`
+	LastSeen  time.Time        `json:"last_seen"`
+	Count     int64            `json:"count"`
+	Peers     int64            `json:"peers"`
+	Sources   map[string]int64 `json:"sources"`
+	// Countries and ASNs count the observations whose peer was located.
+	Countries map[string]int64 `json:"countries"`
+	ASNs      map[uint32]int64 `json:"asns"`
+}
+
+// RootCID returns the root CID that documents are indexed under for a
+// discovered /ipfs/ path or bare CID, and "" for anything else.
+func RootCID(s string) string {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "/ipfs/"); ok {
+		root, _, _ := strings.Cut(rest, "/")
+		return root
+	}
+	if strings.HasPrefix(s, "/") {
+		return ""
+	}
+	return s
+}
+
+// SourceLabel names an observation's source: pubsub observations carry
+// their topic, DHT provider records "dht:provider_add", and everything else
+// its source alone.
+func SourceLabel(source, detail string) string {
+	switch {
+	case source == "pubsub" && detail != "":
+		return "pubsub:" + detail
+	case source == "dht" && detail == "provider_add":
+		return "dht:provider_add"
+	}
+	return source
+}
+
+type pending struct {
+	first, last time.Time
+	count       int64
+	sources     map[string]int64
+	countries   map[string]int64
+	asns        map[uint32]int64
+	peers       map[string]struct{}
+}
+
+// maxPendingPeers bounds the peers buffered per CID between flushes; the
+// HyperLogLog only needs a sample when a CID is that hot.
+const maxPendingPeers = 256
+
+// Tracker buffers observations and merges them into Redis every
+// FlushInterval, so observing is cheap enough for DHT datastore paths. The
+// buffer holds at most MaxPending CIDs. A nil *Tracker ignores
+// observations.
+type Tracker struct {
+	Redis  *goredis.Client
+	Config Config
+
+	mu  sync.Mutex
+	buf map[string]*pending
+
+	dropped atomic.Uint64
+}
+
+// Dropped counts the observations dropped because the buffer was full or
+// a flush failed after sending them.
+func (t *Tracker) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+// full reports whether the buffer has no room for another CID. t.mu must
+// be held.
+func (t *Tracker) full() bool {
+	return t.Config.MaxPending > 0 && len(t.buf) >= t.Config.MaxPending
+}
+
+// Observe records one sighting of cid (a bare CID or /ipfs/ path) from
+// source. peer may be empty.
+func (t *Tracker) Observe(cid, source, detail, peer string) {
+	t.ObserveGeo(cid, source, detail, peer, geoip.Info{})
+}
+
+// ObserveGeo is Observe for a peer located at geo.
+func (t *Tracker) ObserveGeo(cid, source, detail, peer string, geo geoip.Info) {
+	if t == nil {
+		return
+	}
+	root := RootCID(cid)
+	if root == "" {
+		return
+	}
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.buf == nil {
+		t.buf = map[string]*pending{}
+	}
+	p := t.buf[root]
+	if p == nil {
+		if t.full() {
+			t.dropped.Add(1)
+			return
+		}
+		p = &pending{
+			first:     now,
+			sources:   map[string]int64{},
+			countries: map[string]int64{},
+			asns:      map[uint32]int64{},
+			peers:     map[string]struct{}{},
+		}
+		t.buf[root] = p
+	}
+	p.last = now
+	p.count++
+	p.sources[SourceLabel(source, detail)]++
+	if geo.Country != "" {
+		p.countries[geo.Country]++
+	}
+	if geo.ASN != 0 {
+		p.asns[geo.ASN]++
+	}
+	if peer != "" && len(p.peers) < maxPendingPeers {
+		p.peers[peer] = struct{}{}
+	}
+}
+
+// Run flushes every FlushInterval until ctx is done, then flushes once more.
+func (t *Tracker) Run(ctx context.Context) error {
+	if t.Redis == nil {
+		return fmt.Errorf("redis required")
+	}
+	if t.Config.FlushInterval <= 0 {
+		t.Config.FlushInterval = 10 * time.Second
+	}
+	logger := logging.FromContext(ctx)
+	tick := time.NewTicker(t.Config.FlushInterval)
+	defer tick.Stop()
+	var logged uint64
+	for {
+		select {
+		case <-ctx.Done():
+			// Keep what was observed before shutdown.
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := t.Flush(flushCtx); err != nil {
+				logger.Error("popularity flush", "err", err)
+			}
+			return ctx.Err()
+		case <-tick.C:
+			if err := t.Flush(ctx); err != nil {
+				logger.Error("popularity flush", "err", err)
+			}
+			if n := t.Dropped(); n > logged {
+				logger.Warn("popularity observations dropped", "dropped", n-logged, "total", n)
+				logged = n
+			}
+		}
+	}
+}
+
+func (t *Tracker) recordKey(root string) string { return t.Config.Prefix + ":" + root }
+func (t *Tracker) peersKey(root string) string  { return t.Config.Prefix + ":" + root + ":peers" }
+func (t *Tracker) dirtyKey() string             { return t.Config.Prefix + ":dirty" }
+
+// Flush merges the buffered observations into Redis, FlushBatch CIDs per
+// transaction. Redis does not roll back a transaction whose commands fail,
+// and a connection lost after EXEC leaves it applied, so retrying a batch
+// that was sent could count it twice: it is dropped and counted instead.
+// Batches never sent are buffered again, so delivery is at-least-once up to
+// EXEC and at-most-once after it.
+func (t *Tracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	buf := t.buf
+	t.buf = nil
+	t.mu.Unlock()
+	if len(buf) == 0 {
+		return nil
+	}
+
+	size := t.Config.FlushBatch
+	if size <= 0 {
+		size = 500
+	}
+	roots := make([]string, 0, len(buf))
+	for root := range buf {
+		roots = append(roots, root)
+	}
+
+	// One connection for every batch: once it answers, a failure can only
+	// come from a batch that was sent.
+	conn := t.Redis.Conn()
+	defer conn.Close()
+	if err := conn.Ping(ctx).Err(); err != nil {
+		t.restore(buf)
+		return fmt.Errorf("popularity flush: %w", err)
+	}
+	for len(roots) > 0 {
+		n := min(size, len(roots))
+		batch := roots[:n]
+		if err := t.flushBatch(ctx, conn, buf, batch); err != nil {
+			for _, root := range batch {
+				t.dropped.Add(uint64(buf[root].count))
+				delete(buf, root)
+			}
+			t.restore(buf)
+			return fmt.Errorf("popularity flush: %w", err)
+		}
+		for _, root := range batch {
+			delete(buf, root)
+		}
+		roots = roots[n:]
+	}
+	return nil
+}
+
+// flushBatch merges the observations of roots in one transaction.
+func (t *Tracker) flushBatch(ctx context.Context, conn *goredis.Conn, buf map[string]*pending, roots []string) error {
+	pipe := conn.TxPipeline()
+	for _, root := range roots {
+		p := buf[root]
+		key := t.recordKey(root)
+		pipe.HSetNX(ctx, key, "first_seen", p.first.UnixMilli())
+		pipe.HIncrBy(ctx, key, "count", p.count)
+		for src, n := range p.sources {
+			pipe.HIncrBy(ctx, key, "src:"+src, n)
+		}
+		for cc, n := range p.countries {
+			pipe.HIncrBy(ctx, key, "cc:"+cc, n)
+		}
+		for asn, n := range p.asns {
+			pipe.HIncrBy(ctx, key, "asn:"+strconv.FormatUint(uint64(asn), 10), n)
+		}
+		// Flushes from several processes may interleave, so last_seen only
+		// moves forward.
+		pipe.Eval(ctx, setMaxScript, []string{key}, "last_seen", p.last.UnixMilli())
+		if len(p.peers) > 0 {
+			peers := make([]any, 0, len(p.peers))
+			for peer := range p.peers {
+				peers = append(peers, peer)
+			}
+			pipe.PFAdd(ctx, t.peersKey(root), peers...)
+		}
+		if t.Config.TTL > 0 {
+			pipe.Expire(ctx, key, t.Config.TTL)
+			pipe.Expire(ctx, t.peersKey(root), t.Config.TTL)
+		}
+		pipe.SAdd(ctx, t.dirtyKey(), root)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// restore merges buf, taken by a failed flush, back into the buffer,
+// dropping the CIDs it has no room for.
+func (t *Tracker) restore(buf map[string]*pending) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.buf == nil {
+		t.buf = map[string]*pending{}
+	}
+	for root, p := range buf {
+		q := t.buf[root]
+		if q == nil {
+			if t.full() {
+				t.dropped.Add(uint64(p.count))
+				continue
+			}
+			t.buf[root] = p
+			continue
+		}
+		q.first = p.first
+		q.count += p.count
+		for k, n := range p.sources {
+			q.sources[k] += n
+		}
+		for k, n := range p.countries {
+			q.countries[k] += n
+		}
+		for k, n := range p.asns {
+			q.asns[k] += n
+		}
+		for peer := range p.peers {
+			if len(q.peers) >= maxPendingPeers {
+				break
+			}
+			q.peers[peer] = struct{}{}
+		}
+	}
+}
+
+const setMaxScript = `
+local cur = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if tonumber(ARGV[2]) > cur then redis.call('HSET', KEYS[1], ARGV[1], ARGV[2]) end
+return 0`
+
+// Get reads the merged record of root. It reports false when there is none.
+func (t *Tracker) Get(ctx context.Context, root string) (Record, bool, error) {
+	pipe := t.Redis.Pipeline()
+	fields := pipe.HGetAll(ctx, t.recordKey(root))
+	peers := pipe.PFCount(ctx, t.peersKey(root))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Record{}, false, fmt.Errorf("popularity get %s: %w", root, err)
+	}
+	m := fields.Val()
+	if len(m) == 0 {
+		return Record{}, false, nil
+	}
+	return parseRecord(m, peers.Val()), true, nil
+}
+
+func parseRecord(m map[string]string, peers int64) Record {
+	r := Record{Peers: peers, Sources: map[string]int64{}, Countries: map[string]int64{}, ASNs: map[uint32]int64{}}
+	for k, v := range m {
+		n, _ := strconv.ParseInt(v, 10, 64)
+		switch {
+		case k == "first_seen":
+			r.FirstSeen = time.UnixMilli(n).UTC()
+		case k == "last_seen":
+			r.LastSeen = time.UnixMilli(n).UTC()
+		case k == "count":
+			r.Count = n
+		case strings.HasPrefix(k, "src:"):
+			r.Sources[strings.TrimPrefix(k, "src:")] = n
+		case strings.HasPrefix(k, "cc:"):
+			r.Countries[strings.TrimPrefix(k, "cc:")] = n
+		case strings.HasPrefix(k, "asn:"):
+			if asn, err := strconv.ParseUint(strings.TrimPrefix(k, "asn:"), 10, 32); err == nil {
+				r.ASNs[uint32(asn)] = n
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,157 @@
+package popularity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/geoip"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestRootCID(t *testing.T) {
+	for in, want := range map[string]string{
+		"bafyroot":               "bafyroot",
+		"/ipfs/bafyroot":         "bafyroot",
+		"/ipfs/bafyroot/a/b.txt": "bafyroot",
+		"/ipns/k51name":          "",
+		" bafyroot ":             "bafyroot",
+	} {
+		if got := RootCID(in); got != want {
+			t.Fatalf("RootCID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTracker_ObserveAggregates(t *testing.T) {
+	tr := &Tracker{}
+	tr.Observe("bafyroot", "pubsub", "chat", "peerA")
+	tr.Observe("/ipfs/bafyroot/file", "pubsub", "chat", "peerA")
+	tr.Observe("bafyroot", "dht", "provider_add", "peerB")
+	tr.Observe("bafyroot", "dht", "datastore_put:providers", "")
+	tr.Observe("/ipns/k51name", "ipns-dht", "", "")
+
+	if len(tr.buf) != 1 {
+		t.Fatalf("pending cids = %d, want 1", len(tr.buf))
+	}
+	p := tr.buf["bafyroot"]
+	if p.count != 4 || len(p.peers) != 2 {
+		t.Fatalf("pending: count=%d peers=%d", p.count, len(p.peers))
+	}
+	want := map[string]int64{"pubsub:chat": 2, "dht:provider_add": 1, "dht": 1}
+	for src, n := range want {
+		if p.sources[src] != n {
+			t.Fatalf("sources = %v, want %v", p.sources, want)
+		}
+	}
+
+	var nilTracker *Tracker
+	nilTracker.Observe("bafyroot", "pubsub", "", "")
+}
+
+func TestTracker_FailedFlushKeepsObservations(t *testing.T) {
+	// Nothing listens on port 1, so every flush fails.
+	rdb := goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer rdb.Close()
+	tr := &Tracker{Redis: rdb, Config: DefaultConfig()}
+	tr.ObserveGeo("bafyroot", "dht", "provider_add", "peerA", geoip.Info{Country: "DE", ASN: 24940})
+	first := tr.buf["bafyroot"].first
+
+	if err := tr.Flush(context.Background()); err == nil {
+		t.Fatal("flush should fail without redis")
+	}
+	// Observations made while a flush is in flight are merged with what it
+	// puts back.
+	buf := tr.buf
+	tr.buf = nil
+	tr.Observe("bafyroot", "pubsub", "chat", "peerB")
+	tr.Observe("bafyother", "pubsub", "chat", "")
+	tr.restore(buf)
+
+	p := tr.buf["bafyroot"]
+	if p == nil || p.count != 2 || len(p.peers) != 2 || !p.first.Equal(first) {
+		t.Fatalf("pending after failed flushes: %+v", p)
+	}
+	if p.sources["dht:provider_add"] != 1 || p.sources["pubsub:chat"] != 1 || p.countries["DE"] != 1 || p.asns[24940] != 1 {
+		t.Fatalf("sources = %v, countries = %v, asns = %v", p.sources, p.countries, p.asns)
+	}
+	if q := tr.buf["bafyother"]; q == nil || q.count != 1 {
+		t.Fatalf("other cid: %+v", q)
+	}
+}
+
+func TestTracker_DropsCIDsBeyondMaxPending(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxPending = 2
+	tr := &Tracker{Config: cfg}
+	tr.Observe("bafy1", "dht", "", "")
+	tr.Observe("bafy2", "dht", "", "")
+	tr.Observe("bafy3", "dht", "", "")
+	// CIDs already buffered still count.
+	tr.Observe("bafy1", "dht", "", "")
+	if len(tr.buf) != 2 || tr.buf["bafy1"].count != 2 || tr.Dropped() != 1 {
+		t.Fatalf("buf = %d cids, bafy1 = %+v, dropped = %d", len(tr.buf), tr.buf["bafy1"], tr.Dropped())
+	}
+
+	// Putting back a failed flush keeps within the cap too.
+	tr = &Tracker{Config: cfg}
+	tr.Observe("bafy1", "dht", "", "")
+	tr.Observe("bafy2", "dht", "", "")
+	buf := tr.buf
+	tr.buf = nil
+	tr.Observe("bafy3", "dht", "", "")
+	tr.restore(buf)
+	if len(tr.buf) != 2 || tr.buf["bafy3"] == nil || tr.Dropped() != 1 {
+		t.Fatalf("after restore: buf = %d cids, dropped = %d", len(tr.buf), tr.Dropped())
+	}
+}
+
+func TestRecord_Document(t *testing.T) {
+	r := parseRecord(map[string]string{
+		"first_seen":      "1700000000000",
+		"last_seen":       "1700000060000",
+		"count":           "5",
+		"src:pubsub:chat": "3",
+		"src:dht":         "2",
+		"unrelated_field": "x",
+	}, 4)
+	if r.Count != 5 || r.Peers != 4 || r.LastSeen.Sub(r.FirstSeen) != time.Minute {
+		t.Fatalf("record: %+v", r)
+	}
+
+	doc := r.document()
+	sources := doc["sources"].([]map[string]any)
+	if len(sources) != 2 || sources[0]["name"] != "dht" || sources[1]["count"] != int64(3) {
+		t.Fatalf("sources: %v", sources)
+	}
+	if doc["first_seen"] != "2023-11-14T22:13:20Z" {
+		t.Fatalf("first_seen: %v", doc["first_seen"])
+	}
+}
+
+func TestRecord_Locations(t *testing.T) {
+	tr := &Tracker{}
+	tr.ObserveGeo("bafyroot", "dht", "provider_add", "peerA", geoip.Info{Country: "DE", ASN: 24940})
+	tr.ObserveGeo("bafyroot", "dht", "provider_add", "peerB", geoip.Info{Country: "DE"})
+	tr.Observe("bafyroot", "pubsub", "chat", "peerC")
+	p := tr.buf["bafyroot"]
+	if p.countries["DE"] != 2 || p.asns[24940] != 1 || len(p.asns) != 1 {
+		t.Fatalf("countries = %v, asns = %v", p.countries, p.asns)
+	}
+
+	r := parseRecord(map[string]string{
+		"count":     "3",
+		"cc:DE":     "2",
+		"cc:US":     "1",
+		"asn:24940": "1",
+		"asn:bogus": "1",
+	}, 3)
+	doc := r.document()
+	if c := doc["countries"].([]string); len(c) != 2 || c[0] != "DE" || c[1] != "US" {
+		t.Fatalf("countries: %v", doc["countries"])
+	}
+	if a := doc["asns"].([]uint32); len(a) != 1 || a[0] != 24940 {
+		t.Fatalf("asns: %v", doc["asns"])
+	}
+}
@@ -5,13 +5,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Rorical/IPFSniffer/internal/tlsconfig"
+
 	goredis "github.com/redis/go-redis/v9"
 )
 
 type Config struct {
-	Addr     string
+	Addr string
+	// Username selects a Redis 6 ACL user; empty authenticates as default.
+	Username string
 	Password string
 	DB       int
+
+	TLS tlsconfig.Config
 }
 
 func Connect(ctx context.Context, cfg Config) (*goredis.Client, error) {
@@ -19,10 +25,17 @@ func Connect(ctx context.Context, cfg Config) (*goredis.Client, error) {
 		return nil, fmt.Errorf("redis addr required")
 	}
 
+	tlsCfg, err := cfg.TLS.Client()
+	if err != nil {
+		return nil, fmt.Errorf("redis tls: %w", err)
+	}
+
 	rdb := goredis.NewClient(&goredis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
+		Addr:      cfg.Addr,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		DB:        cfg.DB,
+		TLSConfig: tlsCfg,
 	})
 
 	pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
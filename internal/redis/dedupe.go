@@ -14,25 +14,52 @@ type Dedupe struct {
 }
 
 func (d Dedupe) key(cid string) string {
+	if d.Prefix == "" {
+		d.Prefix = "ipfsniffer:seen"
+	}
 	return fmt.Sprintf("%s:%s", d.Prefix, cid)
 }
 
+func (d Dedupe) ttl() time.Duration {
+	if d.TTL == 0 {
+		return 24 * time.Hour
+	}
+	return d.TTL
+}
+
 // Seen returns true if we've already seen the CID. If not seen, it marks it as seen.
 func (d Dedupe) Seen(ctx context.Context, rdb *goredis.Client, cid string) (bool, error) {
 	if cid == "" {
 		return false, fmt.Errorf("cid required")
 	}
-	if d.Prefix == "" {
-		d.Prefix = "ipfsniffer:seen"
-	}
-	if d.TTL == 0 {
-		d.TTL = 24 * time.Hour
-	}
 
-	ok, err := rdb.SetNX(ctx, d.key(cid), "1", d.TTL).Result()
+	ok, err := rdb.SetNX(ctx, d.key(cid), "1", d.ttl()).Result()
 	if err != nil {
 		return false, fmt.Errorf("redis setnx: %w", err)
 	}
 	// ok=true means key was set (not seen before)
 	return !ok, nil
 }
+
+// Has returns true if the CID is marked, without marking it.
+func (d Dedupe) Has(ctx context.Context, rdb *goredis.Client, cid string) (bool, error) {
+	if cid == "" {
+		return false, fmt.Errorf("cid required")
+	}
+	n, err := rdb.Exists(ctx, d.key(cid)).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis exists: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Mark marks the CID as seen for TTL.
+func (d Dedupe) Mark(ctx context.Context, rdb *goredis.Client, cid string) error {
+	if cid == "" {
+		return fmt.Errorf("cid required")
+	}
+	if err := rdb.Set(ctx, d.key(cid), "1", d.ttl()).Err(); err != nil {
+		return fmt.Errorf("redis set: %w", err)
+	}
+	return nil
+}
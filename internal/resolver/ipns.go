@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -9,75 +10,110 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
 	ipfs "github.com/Rorical/IPFSniffer/internal/kubo"
 	"github.com/Rorical/IPFSniffer/internal/logging"
 	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/redis"
 	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
 
+	boxoipns "github.com/ipfs/boxo/ipns"
 	nats "github.com/nats-io/nats.go"
+	goredis "github.com/redis/go-redis/v9"
 )
 
+// maxHops bounds the DNSLink records followed from one name.
+const maxHops = 32
+
 type IPNSResolverWorker struct {
 	IPFS *ipfs.Node
 	NATS nats.JetStreamContext
+	// Bus overrides NATS, e.g. with an in-process bus. Optional.
+	Bus internalnats.Bus
+	// Conn enables max-delivery advisory handling. Optional.
+	Conn *nats.Conn
 
 	Durable    string
 	MaxDeliver int
+	AckWait    time.Duration
+	// Concurrency bounds in-flight messages; Batch caps each pull. Both
+	// default to 1.
+	Concurrency int
+	Batch       int
+
+	// DNSLink looks up DNSLink domains, e.g. on a local DNS server; nil
+	// leaves them to Kubo. Optional.
+	DNSLink *dnslink.Resolver
+	// Watchlist keeps the DNSLink domains resolved and re-resolves them on
+	// its schedule. Optional.
+	Watchlist *dnslink.Watchlist
+	// Names registers the IPNS keys resolved, with their records, and
+	// re-resolves them on its schedule. Optional.
+	Names *ipnsreg.Registry
+
+	// HostDedupe, when its Prefix is set, looks up each hostname candidate
+	// found in content once per TTL. Optional.
+	HostDedupe redis.Dedupe
+	Redis      *goredis.Client
+	// Dedupers picks the dedupe backend per prefix; nil uses Redis. Optional.
+	Dedupers *dedupe.Registry
+
+	hosts dedupe.Deduper
 }
 
 func (w *IPNSResolverWorker) Run(ctx context.Context) error {
 	if w.IPFS == nil || w.IPFS.API == nil {
 		return fmt.Errorf("ipfs node required")
 	}
-	if w.NATS == nil {
+	w.Bus = internalnats.DefaultBus(w.Bus, w.NATS)
+	if w.Bus == nil {
 		return fmt.Errorf("nats jetstream required")
 	}
 
+	if w.HostDedupe.Prefix != "" {
+		hosts, err := dedupe.Default(w.Dedupers, w.Redis).For(w.HostDedupe.Prefix, w.HostDedupe.TTL)
+		if err != nil {
+			return err
+		}
+		w.hosts = hosts
+	}
+
 	durable := w.Durable
 	if durable == "" {
 		durable = "resolver-ipns"
 	}
 
-	if err := internalnats.EnsureConsumer(ctx, w.NATS, internalnats.SubjectCidDiscovered, durable, w.MaxDeliver); err != nil {
-		return err
-	}
+	logging.FromContext(ctx).Info("resolver started", "subject", internalnats.SubjectCidDiscovered, "durable", durable)
 
-	sub, err := w.NATS.PullSubscribe(internalnats.SubjectCidDiscovered, durable)
-	if err != nil {
-		return fmt.Errorf("pull subscribe: %w", err)
+	if w.Watchlist != nil {
+		go w.watch(ctx)
+	}
+	if w.Names != nil {
+		go w.watchNames(ctx)
+		go w.Names.LogStats(ctx, w.Names.Config.StatsInterval)
 	}
 
-	logger := logging.FromContext(ctx)
-	logger.Info("resolver started", "subject", internalnats.SubjectCidDiscovered, "durable", durable)
-
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-
-		msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
-		if err != nil {
-			if err == nats.ErrTimeout {
-				continue
-			}
-			return fmt.Errorf("fetch: %w", err)
-		}
-
-		for _, msg := range msgs {
-			if err := w.handleMsg(ctx, msg); err != nil {
-				logger.Error("handle msg", "err", err)
-				// don't ack; let JetStream retry
-				continue
-			}
-			_ = msg.Ack()
-		}
+	c := &internalnats.Consumer{
+		NATS:        w.NATS,
+		Bus:         w.Bus,
+		Conn:        w.Conn,
+		Subject:     internalnats.SubjectCidDiscovered,
+		Durable:     durable,
+		MaxDeliver:  w.MaxDeliver,
+		AckWait:     w.AckWait,
+		Concurrency: w.Concurrency,
+		Batch:       w.Batch,
+		Handler:     w.handleMsg,
 	}
+	return c.Run(ctx)
 }
 
 func (w *IPNSResolverWorker) handleMsg(ctx context.Context, msg *nats.Msg) error {
 	var in ipfsnifferv1.CidDiscovered
 	if err := codec.Unmarshal(msg.Data, &in); err != nil {
-		return err
+		return internalnats.Terminal(err)
 	}
 
 	// Phase 1: only resolve if the "cid" looks like an IPNS name or /ipns/... path.
@@ -93,11 +129,46 @@ func (w *IPNSResolverWorker) handleMsg(ctx context.Context, msg *nats.Msg) error
 
 	// Kubo coreiface Name().Resolve expects name (string), not path.
 	name := strings.TrimPrefix(cand, "/ipns/")
+	// head is the key or domain, without any subpath; domains are case
+	// insensitive, keys are not.
+	head, _, _ := strings.Cut(name, "/")
+	isDomain := dnslink.IsDomain(head)
+	if isDomain {
+		head = strings.ToLower(head)
+	}
 
-	resolved, err := w.IPFS.API.Name().Resolve(ctx, name)
+	// Hostnames found in content repeat on every page that links them. They
+	// are marked only once handled or found without a record, so a failed
+	// lookup is retried on redelivery.
+	dedupeHost := isDomain && in.GetData().GetSource() == dnslink.Source && w.hosts != nil
+	if dedupeHost && !in.GetData().GetForce() {
+		seen, err := w.hosts.Has(ctx, head)
+		if err != nil {
+			return err
+		}
+		if seen {
+			return nil
+		}
+	}
+
+	resolved, via, err := w.resolve(ctx, name)
+	if isDomain && errors.Is(err, dnslink.ErrNoRecord) {
+		// Most hostnames are plain websites.
+		logging.FromContext(ctx).Debug("resolver: no dnslink", "domain", head)
+		if err := w.Watchlist.Remove(ctx, head); err != nil {
+			return err
+		}
+		return w.markHost(ctx, dedupeHost, head)
+	}
 	if err != nil {
 		return fmt.Errorf("ipns resolve %s: %w", name, err)
 	}
+	if isDomain {
+		w.watchDomain(ctx, head, resolved)
+	}
+	for _, d := range via {
+		w.watchDomain(ctx, d, "")
+	}
 
 	// Publish the resolved /ipfs/... path back into cid.discovered.
 	// This is the only conversion step; the rest of the pipeline ignores /ipns.
@@ -107,11 +178,14 @@ func (w *IPNSResolverWorker) handleMsg(ctx context.Context, msg *nats.Msg) error
 		Ts:    time.Now().UTC().Format(time.RFC3339Nano),
 		Trace: in.Trace,
 		Data: &ipfsnifferv1.CidDiscoveredData{
-			Cid:          resolved.String(),
+			Cid:          resolved,
 			Source:       "ipns",
 			SourceDetail: "resolved",
 			PeerId:       "",
 			ObservedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+			Limits:       in.GetData().GetLimits(),
+			Force:        in.GetData().GetForce(),
+			IpnsName:     head,
 		},
 	}
 
@@ -120,10 +194,125 @@ func (w *IPNSResolverWorker) handleMsg(ctx context.Context, msg *nats.Msg) error
 		return err
 	}
 
-	if _, err := internalnats.Publish(ctx, w.NATS, internalnats.SubjectCidDiscovered, b); err != nil {
-		_, _ = internalnats.PublishDLQ(ctx, w.NATS, internalnats.SubjectCidDiscovered, b)
+	id := internalnats.MsgID(internalnats.ParentMsgID(msg), internalnats.SubjectCidDiscovered, "ipns", name, resolved)
+	if _, err := internalnats.Publish(ctx, w.Bus, internalnats.SubjectCidDiscovered, b, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectCidDiscovered, id, b, err)
 		return err
 	}
 
-	return nil
+	return w.markHost(ctx, dedupeHost, head)
+}
+
+// markHost marks a hostname found in content as looked up when mark is set.
+func (w *IPNSResolverWorker) markHost(ctx context.Context, mark bool, host string) error {
+	if !mark {
+		return nil
+	}
+	return w.hosts.Mark(ctx, host)
+}
+
+// resolve follows name, an IPNS key or DNSLink domain with an optional
+// subpath, to an /ipfs/ path. It also returns the other domains the DNSLink
+// records on the way pointed at.
+func (w *IPNSResolverWorker) resolve(ctx context.Context, name string) (string, []string, error) {
+	var via []string
+	for range maxHops {
+		head, rest, _ := strings.Cut(name, "/")
+		if w.DNSLink == nil || !dnslink.IsDomain(head) {
+			p, err := w.resolveName(ctx, name)
+			return p, via, err
+		}
+		v, err := w.DNSLink.Lookup(ctx, head)
+		if err != nil {
+			return "", via, err
+		}
+		if rest != "" {
+			v = strings.TrimSuffix(v, "/") + "/" + rest
+		}
+		next, ok := strings.CutPrefix(v, "/ipns/")
+		if !ok {
+			return v, via, nil
+		}
+		if target, _, _ := strings.Cut(next, "/"); dnslink.IsDomain(target) {
+			via = append(via, strings.ToLower(target))
+		}
+		name = next
+	}
+	return "", via, fmt.Errorf("more than %d dnslink hops", maxHops)
+}
+
+// resolveName resolves an IPNS key, or a DNSLink domain left to Kubo, with
+// an optional subpath. Keys go through their records when Names is set, so
+// that they are registered.
+func (w *IPNSResolverWorker) resolveName(ctx context.Context, name string) (string, error) {
+	head, rest, _ := strings.Cut(name, "/")
+	if w.Names == nil || dnslink.IsDomain(head) {
+		p, err := w.IPFS.API.Name().Resolve(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		return p.String(), nil
+	}
+	p, _, err := w.resolveKey(ctx, head)
+	if err != nil {
+		return "", err
+	}
+	if rest != "" {
+		p = strings.TrimSuffix(p, "/") + "/" + rest
+	}
+	return p, nil
+}
+
+// resolveKey looks up the current record of an IPNS key and stores it in
+// Names. It returns the /ipfs/ path the key resolves to and whether its
+// value changed.
+func (w *IPNSResolverWorker) resolveKey(ctx context.Context, key string) (string, bool, error) {
+	name, err := boxoipns.NameFromString(key)
+	if err != nil {
+		return "", false, fmt.Errorf("ipns name %s: %w", key, err)
+	}
+	key = name.String()
+	rec, err := w.lookupRecord(ctx, name)
+	if err != nil {
+		if ferr := w.Names.Failed(ctx, key); ferr != nil {
+			logging.FromContext(ctx).Warn("resolver: record ipns failure", "name", key, "err", ferr)
+		}
+		return "", false, err
+	}
+	// A record older than the one registered resolves to the registered
+	// value instead.
+	p, changed, err := w.Names.Resolved(ctx, key, rec)
+	if err != nil {
+		return "", false, err
+	}
+	if next, ok := strings.CutPrefix(p, "/ipns/"); ok {
+		// Records pointing at other names are left to Kubo, which bounds
+		// the recursion.
+		resolved, err := w.IPFS.API.Name().Resolve(ctx, next)
+		if err != nil {
+			return "", false, err
+		}
+		p = resolved.String()
+	}
+	return p, changed, nil
+}
+
+// lookupRecord fetches the best record of name from the routing system and
+// validates it.
+func (w *IPNSResolverWorker) lookupRecord(ctx context.Context, name boxoipns.Name) (ipnsreg.Record, error) {
+	if w.IPFS.Raw == nil || w.IPFS.Raw.Routing == nil {
+		return ipnsreg.Record{}, fmt.Errorf("ipfs routing unavailable")
+	}
+	b, err := w.IPFS.Raw.Routing.GetValue(ctx, string(name.RoutingKey()))
+	if err != nil {
+		return ipnsreg.Record{}, fmt.Errorf("ipns record %s: %w", name, err)
+	}
+	rec, err := boxoipns.UnmarshalRecord(b)
+	if err != nil {
+		return ipnsreg.Record{}, fmt.Errorf("ipns record %s: %w", name, err)
+	}
+	if err := boxoipns.ValidateWithName(rec, name); err != nil {
+		return ipnsreg.Record{}, fmt.Errorf("ipns record %s: %w", name, err)
+	}
+	return ipnsreg.FromIPNS(rec)
 }
@@ -0,0 +1,155 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dedupe"
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	nats "github.com/nats-io/nats.go"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type mapDeduper map[string]bool
+
+func (d mapDeduper) Seen(_ context.Context, key string) (bool, error) {
+	seen := d[key]
+	d[key] = true
+	return seen, nil
+}
+
+func (d mapDeduper) Has(_ context.Context, key string) (bool, error) { return d[key], nil }
+
+func (d mapDeduper) Mark(_ context.Context, key string) error {
+	d[key] = true
+	return nil
+}
+
+func (d mapDeduper) Stats() dedupe.Stats { return dedupe.Stats{} }
+
+// serveTXT answers TXT queries from records on a local UDP socket, standing
+// in for a DNS server.
+func serveTXT(t *testing.T, records map[string][]string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			if txts, ok := records[q.Name.String()]; ok {
+				resp.RCode = dnsmessage.RCodeSuccess
+				if q.Type == dnsmessage.TypeTXT {
+					for _, txt := range txts {
+						resp.Answers = append(resp.Answers, dnsmessage.Resource{
+							Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60},
+							Body:   &dnsmessage.TXTResource{TXT: []string{txt}},
+						})
+					}
+				}
+			}
+			out, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = pc.WriteTo(out, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestHandleMsg_RetriesHostAfterFailedLookup(t *testing.T) {
+	ctx := context.Background()
+	addr := serveTXT(t, map[string][]string{
+		"_dnslink.site.example.": {"dnslink=/ipfs/bafysite"},
+	})
+	var down atomic.Bool
+	down.Store(true)
+	dns := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			if down.Load() {
+				return nil, errors.New("dns server unreachable")
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+
+	bus := internalnats.NewMemoryBus()
+	sub, err := bus.PullSubscribe(ctx, internalnats.SubjectCidDiscovered, "test", internalnats.ConsumerOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mapDeduper{}
+	w := &IPNSResolverWorker{Bus: bus, DNSLink: &dnslink.Resolver{DNS: dns}, hosts: hosts}
+
+	b, err := codec.Marshal(&ipfsnifferv1.CidDiscovered{
+		V:    1,
+		Data: &ipfsnifferv1.CidDiscoveredData{Cid: "/ipns/site.example", Source: dnslink.Source},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &nats.Msg{Subject: internalnats.SubjectCidDiscovered, Data: b}
+
+	if err := w.handleMsg(ctx, msg); err == nil {
+		t.Fatalf("want an error while dns is down")
+	}
+	if hosts["site.example"] {
+		t.Fatalf("host marked after a failed lookup")
+	}
+
+	down.Store(false)
+	if err := w.handleMsg(ctx, msg); err != nil {
+		t.Fatalf("redelivery: %v", err)
+	}
+	if !hosts["site.example"] {
+		t.Fatalf("host not marked after it resolved")
+	}
+	msgs, err := sub.Fetch(ctx, 10, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("published %d, want 1", len(msgs))
+	}
+	var out ipfsnifferv1.CidDiscovered
+	if err := codec.Unmarshal(msgs[0].Msg().Data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.GetData().GetCid() != "/ipfs/bafysite" || out.GetData().GetIpnsName() != "site.example" {
+		t.Fatalf("published %+v", out.GetData())
+	}
+
+	// A later mention is a duplicate.
+	if err := w.handleMsg(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := sub.Fetch(ctx, 10, 50*time.Millisecond); len(msgs) != 0 {
+		t.Fatalf("duplicate host published %d", len(msgs))
+	}
+}
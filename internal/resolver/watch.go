@@ -0,0 +1,163 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Rorical/IPFSniffer/internal/codec"
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
+	"github.com/Rorical/IPFSniffer/internal/logging"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	ipfsnifferv1 "github.com/Rorical/IPFSniffer/proto"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// watchBatch is how many due domains or names are claimed at a time.
+	watchBatch = 100
+	// refreshTimeout bounds the re-resolution of one domain or name.
+	refreshTimeout = 30 * time.Second
+)
+
+// watchDomain adds domain to the watchlist, recording path as what it
+// resolves to when known.
+func (w *IPNSResolverWorker) watchDomain(ctx context.Context, domain, path string) {
+	if w.Watchlist == nil {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	added, err := w.Watchlist.Add(ctx, domain)
+	if err != nil {
+		logger.Warn("resolver: watch domain", "domain", domain, "err", err)
+		return
+	}
+	if added {
+		logger.Info("resolver: watching dnslink domain", "domain", domain)
+	}
+	if path != "" {
+		if _, err := w.Watchlist.Update(ctx, domain, path); err != nil {
+			logger.Warn("resolver: record dnslink path", "domain", domain, "err", err)
+		}
+	}
+}
+
+// watch re-resolves the watched domains as they come due until ctx is done.
+func (w *IPNSResolverWorker) watch(ctx context.Context) {
+	schedule(ctx, "dnslink watchlist", min(w.Watchlist.Config.Interval, time.Minute), w.Watchlist.Due, w.refresh)
+}
+
+// watchNames re-resolves the registered IPNS names as they come due until
+// ctx is done.
+func (w *IPNSResolverWorker) watchNames(ctx context.Context) {
+	schedule(ctx, "ipns registry", min(w.Names.Config.MinInterval, time.Minute), w.Names.Due, w.refreshName)
+}
+
+// schedule polls due every poll and refreshes what it claims, until ctx is
+// done.
+func schedule(ctx context.Context, what string, poll time.Duration,
+	due func(context.Context, time.Time, int) ([]string, error), refresh func(context.Context, string)) {
+	logger := logging.FromContext(ctx)
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for {
+			batch, err := due(ctx, time.Now(), watchBatch)
+			if err != nil {
+				logger.Error("resolver: "+what, "err", err)
+				break
+			}
+			for _, name := range batch {
+				refresh(ctx, name)
+			}
+			if len(batch) < watchBatch {
+				break
+			}
+		}
+	}
+}
+
+// refresh re-resolves domain and publishes its path when it changed.
+func (w *IPNSResolverWorker) refresh(ctx context.Context, domain string) {
+	logger := logging.FromContext(ctx).With("domain", domain)
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	resolved, _, err := w.resolve(ctx, domain)
+	if errors.Is(err, dnslink.ErrNoRecord) {
+		logger.Info("resolver: dnslink record gone, unwatching")
+		if err := w.Watchlist.Remove(ctx, domain); err != nil {
+			logger.Warn("resolver: unwatch domain", "err", err)
+		}
+		return
+	}
+	if err != nil {
+		logger.Warn("resolver: dnslink refresh", "err", err)
+		return
+	}
+	changed, err := w.Watchlist.Update(ctx, domain, resolved)
+	if err != nil {
+		logger.Warn("resolver: record dnslink path", "err", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	logger.Info("resolver: dnslink path changed", "path", resolved)
+	w.publishChange(ctx, domain, resolved, "dnslink_watch")
+}
+
+// refreshName re-resolves an IPNS key and publishes its path when its value
+// changed.
+func (w *IPNSResolverWorker) refreshName(ctx context.Context, key string) {
+	logger := logging.FromContext(ctx).With("name", key)
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	resolved, changed, err := w.resolveKey(ctx, key)
+	if err != nil {
+		logger.Debug("resolver: ipns refresh", "err", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	logger.Info("resolver: ipns value changed", "path", resolved)
+	w.publishChange(ctx, key, resolved, "ipns_watch")
+}
+
+// publishChange publishes the new path of a watched domain or name as a
+// discovery, so it is fetched.
+func (w *IPNSResolverWorker) publishChange(ctx context.Context, name, resolved, detail string) {
+	logger := logging.FromContext(ctx)
+	out := &ipfsnifferv1.CidDiscovered{
+		V:  1,
+		Id: uuid.NewString(),
+		Ts: time.Now().UTC().Format(time.RFC3339Nano),
+		Data: &ipfsnifferv1.CidDiscoveredData{
+			Cid:          resolved,
+			Source:       "ipns",
+			SourceDetail: detail,
+			ObservedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+			IpnsName:     name,
+		},
+	}
+	b, err := codec.Marshal(out)
+	if err != nil {
+		logger.Error("resolver: marshal", "err", err)
+		return
+	}
+	id := internalnats.MsgID("", internalnats.SubjectCidDiscovered, "ipns", name, resolved)
+	if _, err := internalnats.Publish(ctx, w.Bus, internalnats.SubjectCidDiscovered, b, nats.MsgId(id)); err != nil {
+		_, _ = internalnats.PublishDLQWithID(ctx, w.Bus, internalnats.SubjectCidDiscovered, id, b, err)
+		logger.Error("resolver: publish", "err", err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Rorical/IPFSniffer/internal/dnslink"
+
 	osclient "github.com/opensearch-project/opensearch-go/v4"
 	osapi "github.com/opensearch-project/opensearch-go/v4/opensearchapi"
 )
@@ -32,6 +34,23 @@ type SearchParams struct {
 	Mime    string
 	Ext     string
 	Source  string
+	// IPNSName keeps documents fetched through this IPNS key or DNSLink
+	// domain.
+	IPNSName string
+
+	// MinCount keeps documents whose root CID was observed at least this
+	// often; SeenSince those observed at or after this date or date math
+	// expression (e.g. now-1d).
+	MinCount  int64
+	SeenSince string
+
+	// Country (ISO 3166-1 alpha-2) and ASN keep documents whose root CID was
+	// observed from a peer located there.
+	Country string
+	ASN     uint32
+
+	// Facets adds per-country and per-ASN document counts to the result.
+	Facets bool
 
 	// Sort format: field:dir (e.g. processed_at:desc).
 	Sort string
@@ -44,6 +63,12 @@ func (p *SearchParams) Normalize() {
 	p.Mime = strings.TrimSpace(p.Mime)
 	p.Ext = strings.TrimSpace(p.Ext)
 	p.Source = strings.TrimSpace(p.Source)
+	p.IPNSName = strings.TrimPrefix(strings.TrimSpace(p.IPNSName), "/ipns/")
+	if dnslink.IsDomain(p.IPNSName) {
+		p.IPNSName = strings.ToLower(p.IPNSName)
+	}
+	p.SeenSince = strings.TrimSpace(p.SeenSince)
+	p.Country = strings.ToUpper(strings.TrimSpace(p.Country))
 	p.Sort = strings.TrimSpace(p.Sort)
 
 	// Note: we keep parsing lenient; stricter validation can be done at the HTTP layer.
@@ -63,6 +88,14 @@ type SearchResult struct {
 	From  int      `json:"from"`
 	Size  int      `json:"size"`
 	Hits  []HitDoc `json:"hits"`
+	// Facets maps "country" and "asn" to their most common values among
+	// the matching documents, when requested.
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+}
+
+type FacetBucket struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
 }
 
 type HitDoc struct {
@@ -84,6 +117,14 @@ func ParseSearchParams(values url.Values) SearchParams {
 	p.Mime = values.Get("mime")
 	p.Ext = values.Get("ext")
 	p.Source = values.Get("source")
+	p.IPNSName = values.Get("ipns_name")
+	p.MinCount = int64(parseInt(values.Get("min_count"), 0))
+	p.SeenSince = values.Get("seen_since")
+	p.Country = values.Get("country")
+	if asn, err := strconv.ParseUint(strings.TrimSpace(values.Get("asn")), 10, 32); err == nil {
+		p.ASN = uint32(asn)
+	}
+	p.Facets, _ = strconv.ParseBool(values.Get("facets"))
 	p.Sort = values.Get("sort")
 	return p
 }
@@ -117,6 +158,9 @@ func (c *Client) Search(ctx context.Context, p SearchParams) (SearchResult, erro
 	if sortSpec != nil {
 		body["sort"] = sortSpec
 	}
+	if p.Facets {
+		body["aggs"] = facetAggs
+	}
 	body["highlight"] = map[string]any{
 		"pre_tags":  []string{"<em>"},
 		"post_tags": []string{"</em>"},
@@ -145,6 +189,41 @@ func (c *Client) Search(ctx context.Context, p SearchParams) (SearchResult, erro
 	for _, h := range resp.Hits.Hits {
 		out.Hits = append(out.Hits, HitDoc{ID: h.ID, Score: h.Score, Doc: h.Source, Highlight: h.Highlight})
 	}
+	if p.Facets {
+		out.Facets, err = parseFacets(resp.Aggregations)
+		if err != nil {
+			return SearchResult{}, err
+		}
+	}
+	return out, nil
+}
+
+// facetAggs counts the matching documents per country and ASN.
+var facetAggs = map[string]any{
+	"country": map[string]any{"terms": map[string]any{"field": "popularity.countries", "size": 20}},
+	"asn":     map[string]any{"terms": map[string]any{"field": "popularity.asns", "size": 20}},
+}
+
+func parseFacets(raw json.RawMessage) (map[string][]FacetBucket, error) {
+	var aggs map[string]struct {
+		Buckets []struct {
+			Key      any `json:"key"`
+			DocCount int `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &aggs); err != nil {
+			return nil, fmt.Errorf("decode facets: %w", err)
+		}
+	}
+	out := make(map[string][]FacetBucket, len(facetAggs))
+	for name := range facetAggs {
+		buckets := make([]FacetBucket, 0, len(aggs[name].Buckets))
+		for _, b := range aggs[name].Buckets {
+			buckets = append(buckets, FacetBucket{Key: fmt.Sprint(b.Key), Count: b.DocCount})
+		}
+		out[name] = buckets
+	}
 	return out, nil
 }
 
@@ -252,6 +331,21 @@ func buildQuery(p SearchParams) map[string]any {
 	if p.Source != "" {
 		filter = append(filter, map[string]any{"term": map[string]any{"sources": p.Source}})
 	}
+	if p.IPNSName != "" {
+		filter = append(filter, map[string]any{"term": map[string]any{"ipns_name": p.IPNSName}})
+	}
+	if p.MinCount > 0 {
+		filter = append(filter, map[string]any{"range": map[string]any{"popularity.count": map[string]any{"gte": p.MinCount}}})
+	}
+	if p.SeenSince != "" {
+		filter = append(filter, map[string]any{"range": map[string]any{"popularity.last_seen": map[string]any{"gte": p.SeenSince}}})
+	}
+	if p.Country != "" {
+		filter = append(filter, map[string]any{"term": map[string]any{"popularity.countries": p.Country}})
+	}
+	if p.ASN > 0 {
+		filter = append(filter, map[string]any{"term": map[string]any{"popularity.asns": p.ASN}})
+	}
 
 	return map[string]any{
 		"bool": map[string]any{
@@ -274,8 +368,12 @@ func parseSort(p SearchParams) ([]any, error) {
 
 	// Only allow a small, explicit list.
 	allowed := map[string]struct{}{
-		"processed_at": {},
-		"size_bytes":   {},
+		"processed_at":          {},
+		"size_bytes":            {},
+		"popularity.count":      {},
+		"popularity.peers":      {},
+		"popularity.first_seen": {},
+		"popularity.last_seen":  {},
 	}
 
 	field := sort
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	opensearch "github.com/opensearch-project/opensearch-go/v4"
@@ -153,3 +154,89 @@ func TestGetDoc_Found(t *testing.T) {
 		t.Fatalf("expected doc")
 	}
 }
+
+func TestSearch_PopularitySortAndFilters(t *testing.T) {
+	var gotBody []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`{"hits":{"total":{"value":0},"hits":[]}}`))
+	}))
+	defer srv.Close()
+
+	osc, err := opensearch.NewClient(opensearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	c := &Client{OS: osc, Index: "idx"}
+	p := ParseSearchParams(url.Values{"min_count": {"10"}, "seen_since": {"now-1d"}, "sort": {"popularity.count:desc"}})
+	if _, err := c.Search(context.Background(), p); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	for _, want := range []string{`"popularity.count":{"gte":10}`, `"popularity.last_seen":{"gte":"now-1d"}`, `"popularity.count":{"order":"desc"}`} {
+		if !bytes.Contains(gotBody, []byte(want)) {
+			t.Fatalf("request should contain %s: %s", want, gotBody)
+		}
+	}
+}
+
+func TestSearch_LocationFiltersAndFacets(t *testing.T) {
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`{"hits":{"total":{"value":0},"hits":[]},"aggregations":{
+			"country":{"buckets":[{"key":"DE","doc_count":3}]},
+			"asn":{"buckets":[{"key":24940,"doc_count":2}]}}}`))
+	}))
+	defer srv.Close()
+
+	osc, err := opensearch.NewClient(opensearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	c := &Client{OS: osc, Index: "idx"}
+	p := ParseSearchParams(url.Values{"country": {"de"}, "asn": {"24940"}, "facets": {"true"}})
+	res, err := c.Search(context.Background(), p)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	for _, want := range []string{`"popularity.countries":"DE"`, `"popularity.asns":24940`, `"field":"popularity.countries"`} {
+		if !bytes.Contains(gotBody, []byte(want)) {
+			t.Fatalf("request should contain %s: %s", want, gotBody)
+		}
+	}
+	if got := res.Facets["country"]; len(got) != 1 || got[0] != (FacetBucket{Key: "DE", Count: 3}) {
+		t.Fatalf("country facet: %+v", got)
+	}
+	if got := res.Facets["asn"]; len(got) != 1 || got[0] != (FacetBucket{Key: "24940", Count: 2}) {
+		t.Fatalf("asn facet: %+v", got)
+	}
+}
+
+func TestSearch_IPNSNameFilter(t *testing.T) {
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`{"hits":{"total":{"value":0},"hits":[]}}`))
+	}))
+	defer srv.Close()
+
+	osc, err := opensearch.NewClient(opensearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	c := &Client{OS: osc, Index: "idx"}
+	p := ParseSearchParams(url.Values{"ipns_name": {"/ipns/Docs.IPFS.tech"}})
+	if _, err := c.Search(context.Background(), p); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if want := `"ipns_name":"docs.ipfs.tech"`; !bytes.Contains(gotBody, []byte(want)) {
+		t.Fatalf("request should contain %s: %s", want, gotBody)
+	}
+}
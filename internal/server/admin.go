@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Rorical/IPFSniffer/internal/admin"
+	"github.com/Rorical/IPFSniffer/internal/httpjson"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+)
+
+type Admin interface {
+	Submit(ctx context.Context, req admin.SubmitRequest) (admin.SubmitResult, error)
+	Consumers(ctx context.Context) ([]internalnats.ConsumerStats, error)
+	DLQs(ctx context.Context) ([]internalnats.DLQInfo, error)
+	DLQMessages(ctx context.Context, subject string, limit int) ([]internalnats.DLQMessage, error)
+	ReplayDLQ(ctx context.Context, subject string, limit int) (int, error)
+	PurgeDLQ(ctx context.Context, subject string) error
+	DeleteDoc(ctx context.Context, docID string) (bool, error)
+	DeleteByRootCID(ctx context.Context, rootCID string) (int, error)
+	Policies(ctx context.Context) ([]policy.Entry, error)
+	PolicyHistory(ctx context.Context, key string) ([]policy.Entry, error)
+	SetPolicy(ctx context.Context, key string, value json.RawMessage) (uint64, error)
+	DeletePolicy(ctx context.Context, key string) error
+}
+
+const maxAdminBody = 1 << 20
+
+// adminHandler serves:
+//
+//	POST   /admin/submit                   submit targets as cid.discovered
+//	POST   /admin/refetch                  same, bypassing fetch dedupe
+//	GET    /admin/consumers                consumer pending/redelivery counts
+//	GET    /admin/dlq                      per-subject DLQ sizes
+//	GET    /admin/dlq/{subject}?limit=N    inspect DLQ messages
+//	POST   /admin/dlq/{subject}/replay     republish to the original subject
+//	POST   /admin/dlq/{subject}/purge      drop all DLQ messages
+//	DELETE /admin/doc/{id}                 delete one document
+//	DELETE /admin/docs?root_cid=CID        delete all documents under a root
+//	GET    /admin/policy                   current pipeline policy
+//	GET    /admin/policy/{key}             every kept version of a key
+//	PUT    /admin/policy/{key}             set a key; workers apply it live
+//	DELETE /admin/policy/{key}             revert a key to worker defaults
+func (a *API) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/submit", func(w http.ResponseWriter, r *http.Request) { a.handleAdminSubmit(w, r, false) })
+	mux.HandleFunc("/admin/refetch", func(w http.ResponseWriter, r *http.Request) { a.handleAdminSubmit(w, r, true) })
+	mux.HandleFunc("/admin/consumers", a.handleAdminConsumers)
+	mux.HandleFunc("/admin/dlq", a.handleAdminDLQList)
+	mux.HandleFunc("/admin/dlq/", a.handleAdminDLQ)
+	mux.HandleFunc("/admin/doc/", a.handleAdminDeleteDoc)
+	mux.HandleFunc("/admin/docs", a.handleAdminDeleteDocs)
+	mux.HandleFunc("/admin/policy", a.handleAdminPolicyList)
+	mux.HandleFunc("/admin/policy/", a.handleAdminPolicy)
+	return requireBearer(a.AdminToken, mux)
+}
+
+func requireBearer(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ipfsniffer-admin"`)
+			httpjson.Error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *API) handleAdminSubmit(w http.ResponseWriter, r *http.Request, force bool) {
+	if r.Method != http.MethodPost {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req admin.SubmitRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBody)).Decode(&req); err != nil {
+		httpjson.Error(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if force {
+		req.Force = true
+	}
+
+	res, err := a.Admin.Submit(r.Context(), req)
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	status := http.StatusAccepted
+	if len(res.Submitted) == 0 {
+		status = http.StatusBadRequest
+	}
+	httpjson.Write(w, status, res)
+}
+
+func (a *API) handleAdminConsumers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cs, err := a.Admin.Consumers(r.Context())
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusOK, map[string]any{"consumers": cs})
+}
+
+func (a *API) handleAdminDLQList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	dlqs, err := a.Admin.DLQs(r.Context())
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusOK, map[string]any{"dlq": dlqs})
+}
+
+func (a *API) handleAdminDLQ(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/admin/dlq/")
+	subject, action := rest, ""
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		subject, action = rest[:i], rest[i+1:]
+	}
+	if subject == "" {
+		httpjson.Error(w, http.StatusBadRequest, "missing subject")
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		msgs, err := a.Admin.DLQMessages(r.Context(), subject, limit)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"subject": subject, "messages": msgs})
+	case "replay":
+		if r.Method != http.MethodPost {
+			httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		n, err := a.Admin.ReplayDLQ(r.Context(), subject, limit)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"subject": subject, "replayed": n})
+	case "purge":
+		if r.Method != http.MethodPost {
+			httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err := a.Admin.PurgeDLQ(r.Context(), subject); err != nil {
+			adminError(w, err)
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"subject": subject, "purged": true})
+	default:
+		httpjson.Error(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *API) handleAdminDeleteDoc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/admin/doc/"))
+	if id == "" {
+		httpjson.Error(w, http.StatusBadRequest, "missing doc id")
+		return
+	}
+	found, err := a.Admin.DeleteDoc(r.Context(), id)
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	if !found {
+		httpjson.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	httpjson.Write(w, http.StatusOK, map[string]any{"id": id, "deleted": true})
+}
+
+func (a *API) handleAdminDeleteDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	root := strings.TrimSpace(r.URL.Query().Get("root_cid"))
+	if root == "" {
+		httpjson.Error(w, http.StatusBadRequest, "missing root_cid")
+		return
+	}
+	n, err := a.Admin.DeleteByRootCID(r.Context(), root)
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusOK, map[string]any{"root_cid": root, "deleted": n})
+}
+
+func (a *API) handleAdminPolicyList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	entries, err := a.Admin.Policies(r.Context())
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	httpjson.Write(w, http.StatusOK, map[string]any{"policy": entries})
+}
+
+func (a *API) handleAdminPolicy(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/admin/policy/"))
+	if key == "" {
+		httpjson.Error(w, http.StatusBadRequest, "missing key")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hist, err := a.Admin.PolicyHistory(r.Context(), key)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"key": key, "history": hist})
+	case http.MethodPut:
+		var value json.RawMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBody)).Decode(&value); err != nil {
+			httpjson.Error(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+		rev, err := a.Admin.SetPolicy(r.Context(), key, value)
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"key": key, "revision": rev})
+	case http.MethodDelete:
+		if err := a.Admin.DeletePolicy(r.Context(), key); err != nil {
+			adminError(w, err)
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"key": key, "deleted": true})
+	default:
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func adminError(w http.ResponseWriter, err error) {
+	if admin.IsBadRequest(err) {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	httpjson.Error(w, http.StatusBadGateway, err.Error())
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("limit must be an integer")
+	}
+	if n < 0 || n > 10000 {
+		return 0, fmt.Errorf("limit must be between 0 and 10000")
+	}
+	return n, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rorical/IPFSniffer/internal/admin"
+	internalnats "github.com/Rorical/IPFSniffer/internal/nats"
+	"github.com/Rorical/IPFSniffer/internal/policy"
+)
+
+type fakeAdmin struct {
+	lastSubmit  admin.SubmitRequest
+	lastSubject string
+	lastLimit   int
+	lastPolicy  string
+}
+
+func (f *fakeAdmin) Submit(ctx context.Context, req admin.SubmitRequest) (admin.SubmitResult, error) {
+	f.lastSubmit = req
+	return admin.SubmitResult{Submitted: []admin.Submitted{{Target: req.Targets[0]}}}, nil
+}
+
+func (f *fakeAdmin) Consumers(ctx context.Context) ([]internalnats.ConsumerStats, error) {
+	return []internalnats.ConsumerStats{{Name: "indexer", NumPending: 3}}, nil
+}
+
+func (f *fakeAdmin) DLQs(ctx context.Context) ([]internalnats.DLQInfo, error) {
+	return nil, nil
+}
+
+func (f *fakeAdmin) DLQMessages(ctx context.Context, subject string, limit int) ([]internalnats.DLQMessage, error) {
+	f.lastSubject, f.lastLimit = subject, limit
+	return nil, nil
+}
+
+func (f *fakeAdmin) ReplayDLQ(ctx context.Context, subject string, limit int) (int, error) {
+	f.lastSubject, f.lastLimit = subject, limit
+	return 2, nil
+}
+
+func (f *fakeAdmin) PurgeDLQ(ctx context.Context, subject string) error {
+	if subject == "bogus" {
+		return errors.Join(admin.ErrBadRequest, errors.New("unknown subject"))
+	}
+	f.lastSubject = subject
+	return nil
+}
+
+func (f *fakeAdmin) DeleteDoc(ctx context.Context, docID string) (bool, error) {
+	return docID == "d1", nil
+}
+
+func (f *fakeAdmin) DeleteByRootCID(ctx context.Context, rootCID string) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeAdmin) Policies(ctx context.Context) ([]policy.Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeAdmin) PolicyHistory(ctx context.Context, key string) ([]policy.Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeAdmin) SetPolicy(ctx context.Context, key string, value json.RawMessage) (uint64, error) {
+	if _, err := policy.Normalize(key, value); err != nil {
+		return 0, errors.Join(admin.ErrBadRequest, err)
+	}
+	f.lastPolicy = key + "=" + string(value)
+	return 7, nil
+}
+
+func (f *fakeAdmin) DeletePolicy(ctx context.Context, key string) error {
+	return nil
+}
+
+func adminRequest(api *API, method, target, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	api.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestAdmin_DisabledWithoutToken(t *testing.T) {
+	api := &API{Search: &fakeSearch{}, Admin: &fakeAdmin{}}
+	w := adminRequest(api, http.MethodGet, "/admin/consumers", "", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status %d", w.Code)
+	}
+}
+
+func TestAdmin_RequiresBearer(t *testing.T) {
+	api := &API{Search: &fakeSearch{}, Admin: &fakeAdmin{}, AdminToken: "s3cret"}
+	if w := adminRequest(api, http.MethodGet, "/admin/consumers", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d", w.Code)
+	}
+	if w := adminRequest(api, http.MethodGet, "/admin/consumers", "", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d", w.Code)
+	}
+	w := adminRequest(api, http.MethodGet, "/admin/consumers", "", "s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"num_pending":3`) {
+		t.Fatalf("body: %s", w.Body.String())
+	}
+}
+
+func TestAdmin_RefetchForcesDedupeBypass(t *testing.T) {
+	fa := &fakeAdmin{}
+	api := &API{Search: &fakeSearch{}, Admin: fa, AdminToken: "t"}
+	w := adminRequest(api, http.MethodPost, "/admin/refetch", `{"targets":["/ipfs/x"],"limits":{"max_depth":2}}`, "t")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d", w.Code)
+	}
+	if !fa.lastSubmit.Force || fa.lastSubmit.Limits == nil || fa.lastSubmit.Limits.MaxDepth != 2 {
+		t.Fatalf("submit: %+v", fa.lastSubmit)
+	}
+}
+
+func TestAdmin_DLQRoutes(t *testing.T) {
+	fa := &fakeAdmin{}
+	api := &API{Search: &fakeSearch{}, Admin: fa, AdminToken: "t"}
+
+	w := adminRequest(api, http.MethodGet, "/admin/dlq/fetch.request?limit=5", "", "t")
+	if w.Code != http.StatusOK || fa.lastSubject != "fetch.request" || fa.lastLimit != 5 {
+		t.Fatalf("inspect: %d %q %d", w.Code, fa.lastSubject, fa.lastLimit)
+	}
+
+	w = adminRequest(api, http.MethodPost, "/admin/dlq/doc.ready/replay", "", "t")
+	if w.Code != http.StatusOK || fa.lastSubject != "doc.ready" {
+		t.Fatalf("replay: %d %q", w.Code, fa.lastSubject)
+	}
+
+	if w = adminRequest(api, http.MethodGet, "/admin/dlq/doc.ready/replay", "", "t"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("replay GET: %d", w.Code)
+	}
+	if w = adminRequest(api, http.MethodPost, "/admin/dlq/bogus/purge", "", "t"); w.Code != http.StatusBadRequest {
+		t.Fatalf("purge bogus: %d", w.Code)
+	}
+}
+
+func TestAdmin_DeleteDoc(t *testing.T) {
+	api := &API{Search: &fakeSearch{}, Admin: &fakeAdmin{}, AdminToken: "t"}
+	if w := adminRequest(api, http.MethodDelete, "/admin/doc/d1", "", "t"); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if w := adminRequest(api, http.MethodDelete, "/admin/doc/missing", "", "t"); w.Code != http.StatusNotFound {
+		t.Fatalf("status %d", w.Code)
+	}
+}
+
+func TestAdmin_SetPolicy(t *testing.T) {
+	fa := &fakeAdmin{}
+	api := &API{Search: &fakeSearch{}, Admin: fa, AdminToken: "t"}
+
+	w := adminRequest(api, http.MethodPut, "/admin/policy/pubsub_topics", `["a","b"]`, "t")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"revision":7`) {
+		t.Fatalf("set: %d %s", w.Code, w.Body.String())
+	}
+	if fa.lastPolicy != `pubsub_topics=["a","b"]` {
+		t.Fatalf("policy: %q", fa.lastPolicy)
+	}
+	if w = adminRequest(api, http.MethodPut, "/admin/policy/fetch", `{"max_depht":3}`, "t"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad value: %d", w.Code)
+	}
+	if w = adminRequest(api, http.MethodPost, "/admin/policy/fetch", `{}`, "t"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: %d", w.Code)
+	}
+}
@@ -13,30 +13,67 @@ func parseSearchParams(v url.Values) (search.SearchParams, error) {
 	p := search.ParseSearchParams(v)
 	p.Normalize()
 
+	from, size, err := parsePage(v, p.From, p.Size)
+	if err != nil {
+		return search.SearchParams{}, err
+	}
+	p.From, p.Size = from, size
+
+	if raw := strings.TrimSpace(v.Get("min_count")); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return search.SearchParams{}, fmt.Errorf("min_count must be an integer")
+		}
+		if n < 0 {
+			return search.SearchParams{}, fmt.Errorf("min_count must be >= 0")
+		}
+		p.MinCount = n
+	}
+
+	if raw := strings.TrimSpace(v.Get("asn")); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return search.SearchParams{}, fmt.Errorf("asn must be a 32-bit unsigned integer")
+		}
+		p.ASN = uint32(n)
+	}
+	if raw := strings.TrimSpace(v.Get("facets")); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return search.SearchParams{}, fmt.Errorf("facets must be a boolean")
+		}
+		p.Facets = b
+	}
+
+	return p, nil
+}
+
+// parsePage validates the from and size query parameters, keeping the given
+// defaults when they are absent.
+func parsePage(v url.Values, from, size int) (int, int, error) {
 	if raw := strings.TrimSpace(v.Get("from")); raw != "" {
 		n, err := strconv.Atoi(raw)
 		if err != nil {
-			return search.SearchParams{}, fmt.Errorf("from must be an integer")
+			return 0, 0, fmt.Errorf("from must be an integer")
 		}
 		if n < 0 {
-			return search.SearchParams{}, fmt.Errorf("from must be >= 0")
+			return 0, 0, fmt.Errorf("from must be >= 0")
 		}
-		p.From = n
+		from = n
 	}
 
 	if raw := strings.TrimSpace(v.Get("size")); raw != "" {
 		n, err := strconv.Atoi(raw)
 		if err != nil {
-			return search.SearchParams{}, fmt.Errorf("size must be an integer")
+			return 0, 0, fmt.Errorf("size must be an integer")
 		}
 		if n <= 0 {
-			return search.SearchParams{}, fmt.Errorf("size must be > 0")
+			return 0, 0, fmt.Errorf("size must be > 0")
 		}
 		if n > 100 {
-			return search.SearchParams{}, fmt.Errorf("size must be <= 100")
+			return 0, 0, fmt.Errorf("size must be <= 100")
 		}
-		p.Size = n
+		size = n
 	}
-
-	return p, nil
+	return from, size, nil
 }
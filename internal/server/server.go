@@ -6,7 +6,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Rorical/IPFSniffer/internal/health"
 	"github.com/Rorical/IPFSniffer/internal/httpjson"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
+	"github.com/Rorical/IPFSniffer/internal/peers"
 	"github.com/Rorical/IPFSniffer/internal/search"
 )
 
@@ -15,21 +18,50 @@ type Searcher interface {
 	GetDoc(ctx context.Context, docID string) (json.RawMessage, bool, error)
 }
 
+type PeerStore interface {
+	Get(ctx context.Context, peerID string) (json.RawMessage, bool, error)
+	CIDs(ctx context.Context, peerID string, from, size int) (peers.CIDPage, error)
+}
+
+type NameStore interface {
+	History(ctx context.Context, name string, from, size int) (ipnsreg.HistoryPage, bool, error)
+}
+
 type API struct {
 	Search Searcher
+	// Peers backs /peer/*. Optional.
+	Peers PeerStore
+	// Names backs /ipns/*. Optional.
+	Names NameStore
+
+	// Ready backs /readyz. When nil, /readyz reports ready with no checks.
+	Ready *health.Checker
+
+	// Admin backs /admin/*, which requires "Authorization: Bearer <AdminToken>".
+	// The routes are not mounted unless both are set.
+	Admin      Admin
+	AdminToken string
 }
 
 func (a *API) Handler() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("content-type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	mux.HandleFunc("/healthz", health.Liveness)
+
+	ready := a.Ready
+	if ready == nil {
+		ready = &health.Checker{}
+	}
+	mux.Handle("/readyz", ready.Handler())
 
 	mux.HandleFunc("/search", a.handleSearch)
 	mux.HandleFunc("/doc/", a.handleDoc)
+	mux.HandleFunc("/peer/", a.handlePeer)
+	mux.HandleFunc("/ipns/", a.handleIPNS)
+
+	if a.Admin != nil && a.AdminToken != "" {
+		mux.Handle("/admin/", a.adminHandler())
+	}
 
 	h := http.Handler(mux)
 	h = OTel(h)
@@ -94,3 +126,92 @@ func (a *API) handleDoc(w http.ResponseWriter, r *http.Request) {
 
 	httpjson.Write(w, http.StatusOK, map[string]any{"id": id, "doc": doc})
 }
+
+// handlePeer serves /peer/{id} and /peer/{id}/cids?from=&size=.
+func (a *API) handlePeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if a.Peers == nil {
+		httpjson.Error(w, http.StatusNotFound, "peer index not configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/peer/")
+	id, sub, _ := strings.Cut(rest, "/")
+	id = strings.TrimSpace(id)
+	if id == "" {
+		httpjson.Error(w, http.StatusBadRequest, "missing peer id")
+		return
+	}
+
+	switch sub {
+	case "":
+		doc, found, err := a.Peers.Get(r.Context(), id)
+		if err != nil {
+			httpjson.Error(w, http.StatusBadGateway, "peer fetch failed")
+			return
+		}
+		if !found {
+			httpjson.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpjson.Write(w, http.StatusOK, map[string]any{"id": id, "peer": doc})
+	case "cids":
+		from, size, err := parsePage(r.URL.Query(), 0, 20)
+		if err != nil {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		page, err := a.Peers.CIDs(r.Context(), id, from, size)
+		if err != nil {
+			httpjson.Error(w, http.StatusBadGateway, "peer cids failed")
+			return
+		}
+		httpjson.Write(w, http.StatusOK, page)
+	default:
+		httpjson.Error(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handleIPNS serves /ipns/{name}/history?from=&size=, the changes of an IPNS
+// name's value, newest first.
+func (a *API) handleIPNS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpjson.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if a.Names == nil {
+		httpjson.Error(w, http.StatusNotFound, "ipns registry not configured")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/ipns/")
+	name, sub, _ := strings.Cut(rest, "/")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		httpjson.Error(w, http.StatusBadRequest, "missing ipns name")
+		return
+	}
+	if sub != "history" {
+		httpjson.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	from, size, err := parsePage(r.URL.Query(), 0, 20)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, found, err := a.Names.History(r.Context(), name, from, size)
+	if err != nil {
+		httpjson.Error(w, http.StatusBadGateway, "ipns history failed")
+		return
+	}
+	if !found {
+		httpjson.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	httpjson.Write(w, http.StatusOK, page)
+}
@@ -8,6 +8,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/Rorical/IPFSniffer/internal/health"
+	"github.com/Rorical/IPFSniffer/internal/ipnsreg"
+	"github.com/Rorical/IPFSniffer/internal/peers"
 	"github.com/Rorical/IPFSniffer/internal/search"
 )
 
@@ -149,3 +152,115 @@ func TestSearch_BadRequestErrorFromSearchPackage_Returns400(t *testing.T) {
 		t.Fatalf("status %d", w.Code)
 	}
 }
+
+func TestReadyz_DefaultsToReady(t *testing.T) {
+	api := &API{Search: &fakeSearch{}}
+	r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	w := httptest.NewRecorder()
+	api.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+}
+
+func TestReadyz_FailingCheck_Returns503(t *testing.T) {
+	ready := &health.Checker{}
+	ready.Add(health.Check{Name: "opensearch", Fn: func(ctx context.Context) error { return errors.New("down") }})
+
+	api := &API{Search: &fakeSearch{}, Ready: ready}
+	r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	w := httptest.NewRecorder()
+	api.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d", w.Code)
+	}
+}
+
+type fakePeers struct {
+	cidsFrom, cidsSize int
+}
+
+func (f *fakePeers) Get(ctx context.Context, peerID string) (json.RawMessage, bool, error) {
+	if peerID != "12D3KooW" {
+		return nil, false, nil
+	}
+	return json.RawMessage(`{"peer_id":"12D3KooW","cids_count":2}`), true, nil
+}
+
+func (f *fakePeers) CIDs(ctx context.Context, peerID string, from, size int) (peers.CIDPage, error) {
+	f.cidsFrom, f.cidsSize = from, size
+	return peers.CIDPage{Total: 2, From: from, Size: size, CIDs: []json.RawMessage{json.RawMessage(`{"cid":"bafy1"}`)}}, nil
+}
+
+func TestPeer(t *testing.T) {
+	fp := &fakePeers{}
+	api := &API{Search: &fakeSearch{}, Peers: fp}
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/peer/12D3KooW", http.StatusOK},
+		{"/peer/unknown", http.StatusNotFound},
+		{"/peer/", http.StatusBadRequest},
+		{"/peer/12D3KooW/cids?from=5&size=10", http.StatusOK},
+		{"/peer/12D3KooW/cids?size=500", http.StatusBadRequest},
+		{"/peer/12D3KooW/other", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		api.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.code {
+			t.Fatalf("%s: status %d, want %d", tc.path, w.Code, tc.code)
+		}
+	}
+	if fp.cidsFrom != 5 || fp.cidsSize != 10 {
+		t.Fatalf("page: from=%d size=%d", fp.cidsFrom, fp.cidsSize)
+	}
+}
+
+type fakeNames struct {
+	from, size int
+}
+
+func (f *fakeNames) History(ctx context.Context, name string, from, size int) (ipnsreg.HistoryPage, bool, error) {
+	if name != "k51qzi5uqu5d" {
+		return ipnsreg.HistoryPage{}, false, nil
+	}
+	f.from, f.size = from, size
+	return ipnsreg.HistoryPage{
+		Name:    ipnsreg.Name{Name: name, Value: "/ipfs/bafy2", Changes: 2},
+		Total:   2,
+		From:    from,
+		Size:    size,
+		Changes: []ipnsreg.Change{{Path: "/ipfs/bafy2", Seq: 2}, {Path: "/ipfs/bafy1", Seq: 1}},
+	}, true, nil
+}
+
+func TestIPNSHistory(t *testing.T) {
+	fn := &fakeNames{}
+	api := &API{Search: &fakeSearch{}, Names: fn}
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{"/ipns/k51qzi5uqu5d/history?from=1&size=5", http.StatusOK},
+		{"/ipns/unknown/history", http.StatusNotFound},
+		{"/ipns/", http.StatusBadRequest},
+		{"/ipns/k51qzi5uqu5d", http.StatusNotFound},
+		{"/ipns/k51qzi5uqu5d/history?from=-1", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		api.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.code {
+			t.Fatalf("%s: status %d, want %d", tc.path, w.Code, tc.code)
+		}
+	}
+	if fn.from != 1 || fn.size != 5 {
+		t.Fatalf("page: from=%d size=%d", fn.from, fn.size)
+	}
+
+	w := httptest.NewRecorder()
+	(&API{Search: &fakeSearch{}}).Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ipns/k51qzi5uqu5d/history", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unconfigured: status %d", w.Code)
+	}
+}
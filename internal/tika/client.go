@@ -71,3 +71,32 @@ func (c *Client) ExtractText(ctx context.Context, r io.Reader, timeout time.Dura
 	}
 	return res, nil
 }
+
+// Version calls Tika's /version endpoint; it doubles as a liveness probe.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	if c.BaseURL == "" {
+		return "", fmt.Errorf("tika base url required")
+	}
+
+	hc := c.HTTP
+	if hc == nil {
+		hc = &http.Client{}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/version", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("tika status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+	return string(bytes.TrimSpace(b)), nil
+}
@@ -0,0 +1,66 @@
+// Package tlsconfig builds client TLS settings from certificate files.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Config describes the client side of a TLS connection. The zero value
+// leaves TLS off; setting any file turns it on.
+type Config struct {
+	Enabled bool
+	// CAFile verifies the server; empty uses the system roots.
+	CAFile string
+	// CertFile and KeyFile present a client certificate (mutual TLS).
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name checked against the server certificate.
+	ServerName string
+}
+
+// On reports whether TLS should be used.
+func (c Config) On() bool {
+	return c.Enabled || c.CAFile != "" || c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate reports settings that cannot work together.
+func (c Config) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// Client loads the files into a tls.Config. It returns nil when TLS is off.
+func (c Config) Client() (*tls.Config, error) {
+	if !c.On() {
+		return nil, nil
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	out := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca file %s: no certificates found", c.CAFile)
+		}
+		out.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		out.Certificates = []tls.Certificate{cert}
+	}
+	return out, nil
+}
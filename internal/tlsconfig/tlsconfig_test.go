@@ -0,0 +1,73 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate and its key and returns the
+// file names.
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestClient(t *testing.T) {
+	if c, err := (Config{}).Client(); c != nil || err != nil {
+		t.Fatalf("zero config: %v %v", c, err)
+	}
+
+	certFile, keyFile := writeCert(t)
+	c, err := Config{CAFile: certFile, CertFile: certFile, KeyFile: keyFile, ServerName: "nats"}.Client()
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	if c.RootCAs == nil || len(c.Certificates) != 1 || c.ServerName != "nats" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+
+	if _, err := (Config{CertFile: certFile}).Client(); err == nil {
+		t.Fatalf("cert without key should fail")
+	}
+	if _, err := (Config{CAFile: keyFile}).Client(); err == nil {
+		t.Fatalf("ca file without certificates should fail")
+	}
+}